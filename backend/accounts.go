@@ -441,6 +441,24 @@ func (backend *Backend) SetAccountActive(accountCode accountsTypes.Code, active
 	return nil
 }
 
+// SetAccountNotificationsMuted mutes or unmutes the notifications about the transactions of an
+// account.
+func (backend *Backend) SetAccountNotificationsMuted(accountCode accountsTypes.Code, muted bool) error {
+	err := backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
+		acct := accountsConfig.Lookup(accountCode)
+		if acct == nil {
+			return errp.Newf("Could not find account %s", accountCode)
+		}
+		acct.NotificationsMuted = muted
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	backend.ReinitializeAccounts()
+	return nil
+}
+
 // SetTokenActive activates/deactivates an token on an account. `tokenCode` must be an ERC20 token
 // code, e.g. "eth-erc20-usdt", "eth-erc20-bat", etc.
 func (backend *Backend) SetTokenActive(accountCode accountsTypes.Code, tokenCode string, active bool) error {
@@ -494,11 +512,15 @@ func (backend *Backend) addAccount(account accounts.Interface) {
 // The accountsAndKeystoreLock must be held when calling this function.
 func (backend *Backend) createAndAddAccount(coin coinpkg.Coin, persistedConfig *config.Account) {
 	var account accounts.Interface
+	var accountKeystore keystore.Keystore
+	if entry := backend.keystores.forAccount(persistedConfig); entry != nil {
+		accountKeystore = entry.keystore
+	}
 	accountConfig := &accounts.AccountConfig{
 		Config:      persistedConfig,
 		DBFolder:    backend.arguments.CacheDirectoryPath(),
 		NotesFolder: backend.arguments.NotesDirectoryPath(),
-		Keystore:    backend.keystore,
+		Keystore:    accountKeystore,
 		OnEvent: func(event accountsTypes.Event) {
 			backend.events <- AccountEvent{
 				Type: "account", Code: persistedConfig.Code,
@@ -506,6 +528,8 @@ func (backend *Backend) createAndAddAccount(coin coinpkg.Coin, persistedConfig *
 			}
 			if account != nil && event == accountsTypes.EventSyncDone {
 				backend.notifyNewTxs(account)
+				go backend.evaluateAlerts()
+				go backend.checkPaymentRequests(account)
 			}
 		},
 		RateUpdater: backend.ratesUpdater,
@@ -515,10 +539,15 @@ func (backend *Backend) createAndAddAccount(coin coinpkg.Coin, persistedConfig *
 		GetSaveFilename:  backend.environment.GetSaveFilename,
 		UnsafeSystemOpen: backend.environment.SystemOpen,
 		BtcCurrencyUnit:  backend.config.AppConfig().Backend.BtcUnit,
+		GetMainFiat: func() string {
+			return backend.config.AppConfig().Backend.MainFiat
+		},
 	}
 
 	switch specificCoin := coin.(type) {
 	case *btc.Coin:
+		// Like ETH accounts, each account uses its own Electrum connection and Tor circuit, see
+		// btc.Coin.newAccountBlockchain().
 		account = backend.makeBtcAccount(
 			accountConfig,
 			specificCoin,
@@ -527,7 +556,14 @@ func (backend *Backend) createAndAddAccount(coin coinpkg.Coin, persistedConfig *
 		)
 		backend.addAccount(account)
 	case *eth.Coin:
-		account = backend.makeEthAccount(accountConfig, specificCoin, backend.httpClient, backend.log)
+		// Each account uses its own Tor circuit so that its requests can't be correlated with the
+		// ones of other accounts.
+		accountProxy := backend.socksProxy.Isolated(string(persistedConfig.Code))
+		httpClient, err := accountProxy.GetHTTPClient()
+		if err != nil {
+			backend.log.WithError(err).Error("Could not create the account HTTP client")
+		}
+		account = backend.makeEthAccount(accountConfig, specificCoin, httpClient, backend.log)
 		backend.addAccount(account)
 
 		// Load ERC20 tokens enabled with this Ethereum account.
@@ -552,6 +588,7 @@ func (backend *Backend) createAndAddAccount(coin coinpkg.Coin, persistedConfig *
 			erc20Config := &config.Account{
 				Inactive:              persistedConfig.Inactive,
 				HiddenBecauseUnused:   persistedConfig.HiddenBecauseUnused,
+				NotificationsMuted:    persistedConfig.NotificationsMuted,
 				CoinCode:              erc20CoinCode,
 				Name:                  tokenName,
 				Code:                  erc20AccountCode,
@@ -738,42 +775,64 @@ func (backend *Backend) persistETHAccountConfig(
 	}, accountsConfig)
 }
 
+// initPersistedAccounts loads the persisted accounts of all registered keystores, and of the
+// remembered keystores which are not connected.
 // The accountsAndKeystoreLock must be held when calling this function.
 func (backend *Backend) initPersistedAccounts() {
-	if backend.keystore == nil {
-		return
+	for _, entry := range backend.keystores.entries {
+		backend.initKeystoreAccounts(entry.rootFingerprint, entry.keystore)
 	}
-	// Only load accounts which belong to connected keystores.
-	rootFingerprint, err := backend.keystore.RootFingerprint()
-	if err != nil {
-		backend.log.WithError(err).Error("Could not retrieve root fingerprint")
-		return
+	for _, encoded := range backend.config.AccountsConfig().RememberedKeystores {
+		rootFingerprint, err := hex.DecodeString(encoded)
+		if err != nil {
+			backend.log.WithError(err).Errorf("invalid remembered keystore %s", encoded)
+			continue
+		}
+		if backend.keystores.get(rootFingerprint) == nil {
+			backend.initKeystoreAccounts(rootFingerprint, nil)
+		}
+	}
+}
+
+// keystoreSupportsAccount returns true if all signing configurations of the account are supported
+// by the keystore.
+func keystoreSupportsAccount(keystore keystore.Keystore, coin coinpkg.Coin, account *config.Account) bool {
+	switch coin.(type) {
+	case *btc.Coin:
+		for _, cfg := range account.SigningConfigurations {
+			if !keystore.SupportsAccount(coin, cfg.ScriptType()) {
+				return false
+			}
+		}
+		return true
+	default:
+		return keystore.SupportsAccount(coin, nil)
 	}
+}
+
+// initKeystoreAccounts loads the persisted accounts of the given keystore which are not loaded yet.
+// keystore is nil to load the accounts of a remembered keystore which is not connected. They are
+// loaded watch-only.
+// The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) initKeystoreAccounts(rootFingerprint []byte, keystore keystore.Keystore) {
 	keystoreConnected := func(account *config.Account) bool {
 		return account.SigningConfigurations.ContainsRootFingerprint(rootFingerprint)
 	}
 
 	persistedAccounts := backend.config.AccountsConfig()
-outer:
 	for _, account := range backend.filterAccounts(&persistedAccounts, keystoreConnected) {
 		account := account
+		if backend.accounts.lookup(account.Code) != nil {
+			continue
+		}
 		coin, err := backend.Coin(account.CoinCode)
 		if err != nil {
 			backend.log.Errorf("skipping persisted account %s/%s, could not find coin",
 				account.CoinCode, account.Code)
 			continue
 		}
-		switch coin.(type) {
-		case *btc.Coin:
-			for _, cfg := range account.SigningConfigurations {
-				if !backend.keystore.SupportsAccount(coin, cfg.ScriptType()) {
-					continue outer
-				}
-			}
-		default:
-			if !backend.keystore.SupportsAccount(coin, nil) {
-				continue
-			}
+		if keystore != nil && !keystoreSupportsAccount(keystore, coin, account) {
+			continue
 		}
 
 		backend.createAndAddAccount(coin, account)
@@ -853,7 +912,7 @@ func (backend *Backend) maybeAddP2TR(keystore keystore.Keystore, accounts []*con
 			}
 			if keystore.SupportsAccount(coin, signing.ScriptTypeP2TR) &&
 				account.SigningConfigurations.FindScriptType(signing.ScriptTypeP2TR) == -1 {
-				rootFingerprint, err := backend.keystore.RootFingerprint()
+				rootFingerprint, err := keystore.RootFingerprint()
 				if err != nil {
 					return err
 				}
@@ -923,6 +982,24 @@ func (backend *Backend) ReinitializeAccounts() {
 	backend.initAccounts()
 }
 
+// uninitKeystoreAccounts closes and removes the loaded accounts belonging to the keystore with the
+// given root fingerprint.
+// The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) uninitKeystoreAccounts(rootFingerprint []byte) {
+	remaining := []accounts.Interface{}
+	for _, account := range backend.accounts {
+		if !account.Config().Config.SigningConfigurations.ContainsRootFingerprint(rootFingerprint) {
+			remaining = append(remaining, account)
+			continue
+		}
+		if backend.onAccountUninit != nil {
+			backend.onAccountUninit(account)
+		}
+		account.Close()
+	}
+	backend.accounts = remaining
+}
+
 // The accountsAndKeystoreLock must be held when calling this function.
 func (backend *Backend) uninitAccounts() {
 	for _, account := range backend.accounts {
@@ -959,16 +1036,17 @@ func (backend *Backend) uninitAccounts() {
 //     account would not be discovered by other BIP44-compatible software.
 func (backend *Backend) maybeAddHiddenUnusedAccounts() {
 	defer backend.accountsAndKeystoreLock.Lock()()
-	if backend.keystore == nil {
-		return
-	}
 	// Only load accounts which belong to connected keystores.
-	rootFingerprint, err := backend.keystore.RootFingerprint()
-	if err != nil {
-		backend.log.WithError(err).Error("Could not retrieve root fingerprint")
-		return
+	for _, entry := range backend.keystores.entries {
+		backend.maybeAddHiddenUnusedKeystoreAccounts(entry.rootFingerprint, entry.keystore)
 	}
+}
 
+// maybeAddHiddenUnusedKeystoreAccounts adds the hidden accounts of the given keystore, see
+// maybeAddHiddenUnusedAccounts().
+// The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) maybeAddHiddenUnusedKeystoreAccounts(
+	rootFingerprint []byte, keystore keystore.Keystore) {
 	do := func(cfg *config.AccountsConfig, coinCode coinpkg.Code) *accountsTypes.Code {
 		log := backend.log.
 			WithField("rootFingerprint", hex.EncodeToString(rootFingerprint)).
@@ -1005,7 +1083,7 @@ func (backend *Backend) maybeAddHiddenUnusedAccounts() {
 				maxAccountNumber+1,
 				true,
 				"",
-				backend.keystore,
+				keystore,
 				nil,
 				cfg,
 			)
@@ -1034,7 +1112,7 @@ func (backend *Backend) maybeAddHiddenUnusedAccounts() {
 	}
 	for _, coinCode := range coinCodes {
 		var newAccountCode *accountsTypes.Code
-		err = backend.config.ModifyAccountsConfig(func(cfg *config.AccountsConfig) error {
+		err := backend.config.ModifyAccountsConfig(func(cfg *config.AccountsConfig) error {
 			newAccountCode = do(cfg, coinCode)
 			return nil
 		})
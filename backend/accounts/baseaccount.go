@@ -44,7 +44,9 @@ type AccountConfig struct {
 	Config   *config.Account
 	DBFolder string
 	// NotesFolder is the folder where the transaction notes are stored. Full path.
-	NotesFolder     string
+	NotesFolder string
+	// Keystore is nil if the account belongs to a remembered keystore which is not connected. The
+	// account can then only be used watch-only.
 	Keystore        keystore.Keystore
 	OnEvent         func(types.Event)
 	RateUpdater     *rates.RateUpdater
@@ -54,6 +56,8 @@ type AccountConfig struct {
 	UnsafeSystemOpen func(filename string) error
 	// BtcCurrencyUnit is the unit which should be used to format fiat amounts values expressed in BTC..
 	BtcCurrencyUnit coin.BtcUnit
+	// GetMainFiat returns the fiat currency used by default to value the account.
+	GetMainFiat func() string
 }
 
 // BaseAccount is an account struct with common functionality to all coin accounts.
@@ -0,0 +1,580 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package costbasis computes the cost basis of the coins held in accounts, as well as realized
+// and unrealized gains, from the transaction history and historical exchange rates.
+package costbasis
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// Method is the lot-matching method used to decide which lots are consumed when coins leave an
+// account.
+type Method string
+
+const (
+	// MethodFIFO consumes the earliest acquired lots first.
+	MethodFIFO Method = "fifo"
+	// MethodLIFO consumes the latest acquired lots first.
+	MethodLIFO Method = "lifo"
+	// MethodHIFO consumes the lots with the highest cost per unit first.
+	MethodHIFO Method = "hifo"
+)
+
+// FeeTreatment defines how network fees paid in the account's own coin are accounted for.
+type FeeTreatment string
+
+const (
+	// FeeDisposal treats the fee as a separate disposal at the market value at the time of the
+	// transaction.
+	FeeDisposal FeeTreatment = "disposal"
+	// FeeCost adds the cost basis of the coins spent on the fee to the cost of the transaction it
+	// pays for, without any proceeds. For a send, this lowers the realized gain of the send. For a
+	// transfer between own accounts (or a failed transaction), the cost is carried over onto the
+	// moved (or remaining) lots.
+	FeeCost FeeTreatment = "cost"
+)
+
+// TransferTreatment defines how transfers between own accounts are accounted for. This applies
+// to transactions of type `accounts.TxTypeSendSelf`, and in the portfolio report also to sends
+// which are received by another account of the same coin.
+type TransferTreatment string
+
+const (
+	// TransferCarry moves the lots including their acquisition time and cost basis.
+	TransferCarry TransferTreatment = "carry"
+	// TransferDisposal treats a transfer as a disposal at market value followed by an acquisition
+	// at market value.
+	TransferDisposal TransferTreatment = "disposal"
+)
+
+// Options configure how the report is computed.
+type Options struct {
+	Method    Method            `json:"method"`
+	Fee       FeeTreatment      `json:"fee"`
+	Transfers TransferTreatment `json:"transfers"`
+}
+
+// DefaultOptions are used for options which are not set.
+var DefaultOptions = Options{
+	Method:    MethodFIFO,
+	Fee:       FeeDisposal,
+	Transfers: TransferCarry,
+}
+
+// Validate checks the options and fills in defaults for empty values.
+func (options *Options) Validate() error {
+	switch options.Method {
+	case "":
+		options.Method = DefaultOptions.Method
+	case MethodFIFO, MethodLIFO, MethodHIFO:
+	default:
+		return errp.Newf("unknown lot-matching method %q", options.Method)
+	}
+	switch options.Fee {
+	case "":
+		options.Fee = DefaultOptions.Fee
+	case FeeDisposal, FeeCost:
+	default:
+		return errp.Newf("unknown fee treatment %q", options.Fee)
+	}
+	switch options.Transfers {
+	case "":
+		options.Transfers = DefaultOptions.Transfers
+	case TransferCarry, TransferDisposal:
+	default:
+		return errp.Newf("unknown transfer treatment %q", options.Transfers)
+	}
+	return nil
+}
+
+// Rates provides the exchange rates needed to value the transactions. It is implemented by
+// `rates.RateUpdater`.
+type Rates interface {
+	// HistoricalPriceAt returns the price of the coin at the given time, or 0 if not available.
+	HistoricalPriceAt(coinCode, fiat string, at time.Time) float64
+	// LatestPriceForPair returns the latest price for the coin unit.
+	LatestPriceForPair(coinUnit, fiat string) (float64, error)
+}
+
+// Account is the input data of one account.
+type Account struct {
+	Code     accountsTypes.Code
+	CoinCode coin.Code
+	// Unit is the unit of the coin, used to look up the latest price.
+	Unit string
+	// Decimals is the number of decimals of the coin unit, e.g. 8 for BTC.
+	Decimals     uint
+	Transactions accounts.OrderedTransactions
+}
+
+// NewAccount collects the input data from an initialized account.
+func NewAccount(account accounts.Interface) (*Account, error) {
+	txs, err := account.Transactions()
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		Code:         account.Config().Config.Code,
+		CoinCode:     account.Coin().Code(),
+		Unit:         account.Coin().Unit(false),
+		Decimals:     account.Coin().Decimals(false),
+		Transactions: txs,
+	}, nil
+}
+
+// toUnit converts an amount in the smallest unit to the coin unit.
+func (account *Account) toUnit(amount coin.Amount) *big.Rat {
+	return new(big.Rat).SetFrac(
+		amount.BigInt(),
+		new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(account.Decimals)), nil),
+	)
+}
+
+// DisposalKind is the reason coins were disposed of.
+type DisposalKind string
+
+const (
+	// DisposalSend is a send to a third party.
+	DisposalSend DisposalKind = "send"
+	// DisposalFee is a network fee, if fees are treated as disposals.
+	DisposalFee DisposalKind = "fee"
+	// DisposalTransfer is a transfer between own accounts, if transfers are treated as disposals.
+	DisposalTransfer DisposalKind = "transfer"
+)
+
+// Disposal is a realized gain or loss. All values are in the report's fiat currency, except for
+// Amount, which is in the coin unit. With `FeeCost`, the amount of a send includes the fee.
+type Disposal struct {
+	AccountCode accountsTypes.Code
+	CoinCode    coin.Code
+	Kind        DisposalKind
+	TxID        string
+	Time        time.Time
+	Amount      *big.Rat
+	Proceeds    *big.Rat
+	Cost        *big.Rat
+	// ShortTermGain is the gain realized on lots held for at most one year.
+	ShortTermGain *big.Rat
+	// LongTermGain is the gain realized on lots held for more than one year.
+	LongTermGain *big.Rat
+}
+
+// Gain returns the total realized gain of the disposal.
+func (disposal *Disposal) Gain() *big.Rat {
+	return new(big.Rat).Add(disposal.ShortTermGain, disposal.LongTermGain)
+}
+
+// Holding summarizes the open lots of one account.
+type Holding struct {
+	AccountCode accountsTypes.Code
+	CoinCode    coin.Code
+	Unit        string
+	Amount      *big.Rat
+	Cost        *big.Rat
+	// MarketValue is nil if the latest price is not available.
+	MarketValue *big.Rat
+	// UnrealizedGain is nil if the latest price is not available.
+	UnrealizedGain *big.Rat
+}
+
+// Report is the result of the cost basis computation.
+type Report struct {
+	Fiat    string
+	Options Options
+	// Lots are the open lots, sorted by account and acquisition time.
+	Lots      []*Lot
+	Disposals []*Disposal
+	Holdings  []*Holding
+
+	RealizedShortTerm *big.Rat
+	RealizedLongTerm  *big.Rat
+	// CostBasis is the total cost of all open lots.
+	CostBasis *big.Rat
+	// MarketValue is the total market value of all holdings for which a price is available.
+	MarketValue *big.Rat
+	// UnrealizedGain is the unrealized gain of all holdings for which a price is available.
+	UnrealizedGain *big.Rat
+
+	// MissingPrices is true if a historical or latest price was not available. Missing
+	// historical prices are valued at zero.
+	MissingPrices bool
+	// Incomplete is true if more coins left an account than were acquired according to the
+	// transaction history. The excess is treated as having a cost basis of zero.
+	Incomplete bool
+
+	decimals map[coin.Code]uint
+}
+
+// Realized returns the total realized gain.
+func (report *Report) Realized() *big.Rat {
+	return new(big.Rat).Add(report.RealizedShortTerm, report.RealizedLongTerm)
+}
+
+// event is a confirmed transaction of an account, to be processed in chronological order.
+type event struct {
+	account *Account
+	tx      *accounts.TransactionData
+}
+
+// transferKey identifies the receiving side of a transfer between own accounts.
+type transferKey struct {
+	coinCode coin.Code
+	txID     string
+}
+
+// computation holds the state while processing the events.
+type computation struct {
+	rates   Rates
+	fiat    string
+	options Options
+	report  *Report
+	// accounts in the order they were passed in.
+	accounts []*Account
+	ledgers  map[accountsTypes.Code]*ledger
+}
+
+// Compute computes the cost basis report of the given accounts. The accounts are processed
+// together, so that coins moving between the accounts keep their cost basis, depending on
+// `Options.Transfers`.
+func Compute(accountsData []*Account, rates Rates, fiat string, options Options) (*Report, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	c := &computation{
+		rates:   rates,
+		fiat:    fiat,
+		options: options,
+		report: &Report{
+			Fiat:              fiat,
+			Options:           options,
+			Lots:              []*Lot{},
+			Disposals:         []*Disposal{},
+			Holdings:          []*Holding{},
+			RealizedShortTerm: new(big.Rat),
+			RealizedLongTerm:  new(big.Rat),
+			CostBasis:         new(big.Rat),
+			MarketValue:       new(big.Rat),
+			UnrealizedGain:    new(big.Rat),
+			decimals:          map[coin.Code]uint{},
+		},
+		accounts: accountsData,
+		ledgers:  map[accountsTypes.Code]*ledger{},
+	}
+
+	events := []event{}
+	// Receives of own accounts, by coin and tx ID, for matching transfers between accounts.
+	receives := map[transferKey]event{}
+	for _, account := range accountsData {
+		c.ledgers[account.Code] = &ledger{account: account, method: options.Method}
+		c.report.decimals[account.CoinCode] = account.Decimals
+		// The transactions are ordered newest first.
+		for i := len(account.Transactions) - 1; i >= 0; i-- {
+			tx := account.Transactions[i]
+			if tx.Timestamp == nil || tx.Status == accounts.TxStatusPending {
+				continue
+			}
+			ev := event{account: account, tx: tx}
+			events = append(events, ev)
+			if tx.Type == accounts.TxTypeReceive && tx.Status == accounts.TxStatusComplete {
+				key := transferKey{coinCode: account.CoinCode, txID: tx.TxID}
+				if _, ok := receives[key]; !ok {
+					receives[key] = ev
+				}
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		timeI, timeJ := *events[i].tx.Timestamp, *events[j].tx.Timestamp
+		if !timeI.Equal(timeJ) {
+			return timeI.Before(timeJ)
+		}
+		// Within the same time, e.g. the same block, process incoming coins first.
+		return events[i].tx.Type == accounts.TxTypeReceive &&
+			events[j].tx.Type != accounts.TxTypeReceive
+	})
+
+	// Sends which are received by another of our accounts, and the receives which are processed
+	// as part of such a transfer.
+	transfers := map[*accounts.TransactionData]event{}
+	matched := map[*accounts.TransactionData]bool{}
+	for _, ev := range events {
+		if ev.tx.Type != accounts.TxTypeSend || ev.tx.Status != accounts.TxStatusComplete {
+			continue
+		}
+		key := transferKey{coinCode: ev.account.CoinCode, txID: ev.tx.TxID}
+		destination, ok := receives[key]
+		if !ok || destination.account == ev.account {
+			continue
+		}
+		delete(receives, key)
+		transfers[ev.tx] = destination
+		matched[destination.tx] = true
+	}
+
+	for _, ev := range events {
+		tx := ev.tx
+		if matched[tx] {
+			continue
+		}
+		from := c.ledgers[ev.account.Code]
+		switch {
+		case tx.Status == accounts.TxStatusFailed:
+			// Only the fee was paid.
+			c.transfer(ev, from, from, new(big.Rat))
+		case tx.Type == accounts.TxTypeReceive:
+			c.receive(ev)
+		case tx.Type == accounts.TxTypeSendSelf:
+			c.transfer(ev, from, from, ev.account.toUnit(tx.Amount))
+		case tx.Type == accounts.TxTypeSend:
+			if destination, ok := transfers[tx]; ok {
+				c.transferBetweenAccounts(ev, destination)
+			} else {
+				c.send(ev)
+			}
+		}
+	}
+
+	c.finish()
+	return c.report, nil
+}
+
+// price returns the historical price at the time of the event. Missing prices are recorded in
+// the report and valued at zero.
+func (c *computation) price(ev event) *big.Rat {
+	price := c.rates.HistoricalPriceAt(string(ev.account.CoinCode), c.fiat, *ev.tx.Timestamp)
+	if price == 0 {
+		c.report.MissingPrices = true
+	}
+	return new(big.Rat).SetFloat64(price)
+}
+
+// fee returns the fee paid in the account's own coin, or zero.
+func (c *computation) fee(ev event) *big.Rat {
+	if ev.tx.Fee == nil || ev.tx.FeeIsDifferentUnit {
+		return new(big.Rat)
+	}
+	return ev.account.toUnit(*ev.tx.Fee)
+}
+
+func (c *computation) receive(ev event) {
+	amount := ev.account.toUnit(ev.tx.Amount)
+	c.ledgers[ev.account.Code].add(&Lot{
+		AccountCode: ev.account.Code,
+		CoinCode:    ev.account.CoinCode,
+		TxID:        ev.tx.TxID,
+		Acquired:    *ev.tx.Timestamp,
+		Amount:      amount,
+		Cost:        new(big.Rat).Mul(amount, c.price(ev)),
+	})
+}
+
+// newDisposal creates a disposal and records it in the report. Its gains are filled in by
+// `realize()`.
+func (c *computation) newDisposal(ev event, kind DisposalKind) *Disposal {
+	disposal := &Disposal{
+		AccountCode:   ev.account.Code,
+		CoinCode:      ev.account.CoinCode,
+		Kind:          kind,
+		TxID:          ev.tx.TxID,
+		Time:          *ev.tx.Timestamp,
+		Amount:        new(big.Rat),
+		Proceeds:      new(big.Rat),
+		Cost:          new(big.Rat),
+		ShortTermGain: new(big.Rat),
+		LongTermGain:  new(big.Rat),
+	}
+	c.report.Disposals = append(c.report.Disposals, disposal)
+	return disposal
+}
+
+// consume takes the amount from the ledger. If the ledger does not hold enough coins, the excess
+// is returned as a lot acquired at the time of the event with a zero cost basis.
+func (c *computation) consume(ev event, from *ledger, amount *big.Rat) []*Lot {
+	lots, shortfall := from.consume(amount)
+	if shortfall.Sign() > 0 {
+		c.report.Incomplete = true
+		lots = append(lots, &Lot{
+			AccountCode: ev.account.Code,
+			CoinCode:    ev.account.CoinCode,
+			TxID:        ev.tx.TxID,
+			Acquired:    *ev.tx.Timestamp,
+			Amount:      shortfall,
+			Cost:        new(big.Rat),
+		})
+	}
+	return lots
+}
+
+// realize adds the consumed lots to the disposal. The proceeds are the amount valued at the
+// given price; pass a zero price for coins which were spent without proceeds.
+func (c *computation) realize(disposal *Disposal, lots []*Lot, price *big.Rat) {
+	longTerm := disposal.Time.AddDate(-1, 0, 0)
+	for _, lot := range lots {
+		proceeds := new(big.Rat).Mul(lot.Amount, price)
+		gain := new(big.Rat).Sub(proceeds, lot.Cost)
+		disposal.Amount.Add(disposal.Amount, lot.Amount)
+		disposal.Proceeds.Add(disposal.Proceeds, proceeds)
+		disposal.Cost.Add(disposal.Cost, lot.Cost)
+		if lot.Acquired.Before(longTerm) {
+			disposal.LongTermGain.Add(disposal.LongTermGain, gain)
+			c.report.RealizedLongTerm.Add(c.report.RealizedLongTerm, gain)
+		} else {
+			disposal.ShortTermGain.Add(disposal.ShortTermGain, gain)
+			c.report.RealizedShortTerm.Add(c.report.RealizedShortTerm, gain)
+		}
+	}
+}
+
+func (c *computation) send(ev event) {
+	from := c.ledgers[ev.account.Code]
+	price := c.price(ev)
+	disposal := c.newDisposal(ev, DisposalSend)
+	c.realize(disposal, c.consume(ev, from, ev.account.toUnit(ev.tx.Amount)), price)
+	fee := c.fee(ev)
+	if fee.Sign() == 0 {
+		return
+	}
+	feeLots := c.consume(ev, from, fee)
+	switch c.options.Fee {
+	case FeeDisposal:
+		c.realize(c.newDisposal(ev, DisposalFee), feeLots, price)
+	case FeeCost:
+		c.realize(disposal, feeLots, new(big.Rat))
+	}
+}
+
+// transfer moves the amount from one ledger to another (which can be the same ledger for
+// transactions within an account) and pays the fee of the event.
+func (c *computation) transfer(ev event, from, to *ledger, amount *big.Rat) {
+	c.transferAmounts(ev, from, to, amount, amount, c.fee(ev))
+}
+
+// transferAmounts moves `received` coins out of the `sent` coins from one ledger to another. The
+// difference between `sent` and `received` is disposed of like a send, and `fee` according to
+// the fee treatment.
+func (c *computation) transferAmounts(ev event, from, to *ledger, sent, received, fee *big.Rat) {
+	lots := c.consume(ev, from, sent)
+	feeLots := c.consume(ev, from, fee)
+	if excess := new(big.Rat).Sub(sent, received); excess.Sign() > 0 {
+		var excessLots []*Lot
+		excessLots, lots = splitLots(lots, excess)
+		c.realize(c.newDisposal(ev, DisposalSend), excessLots, c.price(ev))
+	}
+
+	if c.options.Transfers == TransferDisposal && len(lots) > 0 {
+		price := c.price(ev)
+		c.realize(c.newDisposal(ev, DisposalTransfer), lots, price)
+		amount := new(big.Rat)
+		for _, lot := range lots {
+			amount.Add(amount, lot.Amount)
+		}
+		lots = []*Lot{{
+			TxID:     ev.tx.TxID,
+			Acquired: *ev.tx.Timestamp,
+			Amount:   amount,
+			Cost:     new(big.Rat).Mul(amount, price),
+		}}
+	}
+
+	if len(feeLots) > 0 {
+		switch c.options.Fee {
+		case FeeDisposal:
+			c.realize(c.newDisposal(ev, DisposalFee), feeLots, c.price(ev))
+		case FeeCost:
+			feeCost := new(big.Rat)
+			for _, lot := range feeLots {
+				feeCost.Add(feeCost, lot.Cost)
+			}
+			switch {
+			case len(lots) > 0:
+				spreadCost(lots, feeCost)
+			case len(to.lots) > 0:
+				// Nothing was moved, e.g. a failed transaction. The fee is carried by the
+				// remaining lots.
+				spreadCost(to.lots, feeCost)
+			default:
+				c.realize(c.newDisposal(ev, DisposalFee), feeLots, new(big.Rat))
+			}
+		}
+	}
+
+	for _, lot := range lots {
+		lot.AccountCode = to.account.Code
+		lot.CoinCode = to.account.CoinCode
+		to.add(lot)
+	}
+}
+
+// transferBetweenAccounts processes a send which is received by another of our accounts.
+func (c *computation) transferBetweenAccounts(ev, destination event) {
+	sent := ev.account.toUnit(ev.tx.Amount)
+	received := destination.account.toUnit(destination.tx.Amount)
+	if received.Cmp(sent) > 0 {
+		// More was received than sent, e.g. multiple outputs to the destination account. The
+		// surplus is treated as a regular receive.
+		surplus := new(big.Rat).Sub(received, sent)
+		c.ledgers[destination.account.Code].add(&Lot{
+			AccountCode: destination.account.Code,
+			CoinCode:    destination.account.CoinCode,
+			TxID:        destination.tx.TxID,
+			Acquired:    *destination.tx.Timestamp,
+			Amount:      surplus,
+			Cost:        new(big.Rat).Mul(surplus, c.price(destination)),
+		})
+		received = sent
+	}
+	c.transferAmounts(
+		ev, c.ledgers[ev.account.Code], c.ledgers[destination.account.Code], sent, received, c.fee(ev))
+}
+
+// finish computes the holdings and the unrealized gains.
+func (c *computation) finish() {
+	for _, account := range c.accounts {
+		holding := &Holding{
+			AccountCode: account.Code,
+			CoinCode:    account.CoinCode,
+			Unit:        account.Unit,
+			Amount:      new(big.Rat),
+			Cost:        new(big.Rat),
+		}
+		for _, lot := range c.ledgers[account.Code].lots {
+			holding.Amount.Add(holding.Amount, lot.Amount)
+			holding.Cost.Add(holding.Cost, lot.Cost)
+			c.report.Lots = append(c.report.Lots, lot)
+		}
+		c.report.CostBasis.Add(c.report.CostBasis, holding.Cost)
+		c.report.Holdings = append(c.report.Holdings, holding)
+		if holding.Amount.Sign() == 0 {
+			continue
+		}
+		price, err := c.rates.LatestPriceForPair(account.Unit, c.fiat)
+		if err != nil {
+			c.report.MissingPrices = true
+			continue
+		}
+		holding.MarketValue = new(big.Rat).Mul(holding.Amount, new(big.Rat).SetFloat64(price))
+		holding.UnrealizedGain = new(big.Rat).Sub(holding.MarketValue, holding.Cost)
+		c.report.MarketValue.Add(c.report.MarketValue, holding.MarketValue)
+		c.report.UnrealizedGain.Add(c.report.UnrealizedGain, holding.UnrealizedGain)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package costbasis
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// day returns the time n days after t0.
+func day(n int) *time.Time {
+	t := t0.AddDate(0, 0, n)
+	return &t
+}
+
+// mockRates has one historical price per day and a latest price.
+type mockRates struct {
+	historical map[time.Time]float64
+	latest     float64
+}
+
+func (r *mockRates) HistoricalPriceAt(coinCode, fiat string, at time.Time) float64 {
+	return r.historical[at]
+}
+
+func (r *mockRates) LatestPriceForPair(coinUnit, fiat string) (float64, error) {
+	if r.latest == 0 {
+		return 0, errors.New("not available")
+	}
+	return r.latest, nil
+}
+
+func newTx(
+	txType accounts.TxType, txID string, at *time.Time, amount int64, fee int64,
+) *accounts.TransactionData {
+	tx := &accounts.TransactionData{
+		Type:      txType,
+		Status:    accounts.TxStatusComplete,
+		TxID:      txID,
+		Timestamp: at,
+		Amount:    coin.NewAmountFromInt64(amount),
+	}
+	if fee != 0 {
+		feeAmount := coin.NewAmountFromInt64(fee)
+		tx.Fee = &feeAmount
+	}
+	return tx
+}
+
+// newAccount creates a BTC account with the given transactions, oldest first.
+func newAccount(code string, txs ...*accounts.TransactionData) *Account {
+	ordered := make(accounts.OrderedTransactions, len(txs))
+	for i, tx := range txs {
+		ordered[len(txs)-1-i] = tx
+	}
+	return &Account{
+		Code:         accountsTypes.Code(code),
+		CoinCode:     coin.CodeBTC,
+		Unit:         "BTC",
+		Decimals:     8,
+		Transactions: ordered,
+	}
+}
+
+const btc = 100_000_000
+
+func requireRat(t *testing.T, expected string, actual *big.Rat) {
+	t.Helper()
+	expectedRat, ok := new(big.Rat).SetString(expected)
+	require.True(t, ok)
+	require.Equal(t, expectedRat.String(), actual.String())
+}
+
+func TestOptionsValidate(t *testing.T) {
+	options := Options{}
+	require.NoError(t, options.Validate())
+	require.Equal(t, DefaultOptions, options)
+
+	require.Error(t, (&Options{Method: "avg"}).Validate())
+	require.Error(t, (&Options{Fee: "ignore"}).Validate())
+	require.Error(t, (&Options{Transfers: "ignore"}).Validate())
+
+	_, err := Compute(nil, &mockRates{}, "USD", Options{Method: "avg"})
+	require.Error(t, err)
+}
+
+func TestMethods(t *testing.T) {
+	rates := &mockRates{
+		historical: map[time.Time]float64{*day(0): 100, *day(1): 200, *day(2): 300},
+		latest:     400,
+	}
+	account := newAccount("btc",
+		newTx(accounts.TxTypeReceive, "a", day(0), btc, 0),
+		newTx(accounts.TxTypeReceive, "b", day(1), btc, 0),
+		newTx(accounts.TxTypeSend, "c", day(2), btc, 0),
+	)
+
+	tests := []struct {
+		method       Method
+		realized     string
+		costBasis    string
+		unrealized   string
+		remainingLot string
+	}{
+		{MethodFIFO, "200", "200", "200", "b"},
+		{MethodLIFO, "100", "100", "300", "a"},
+		{MethodHIFO, "100", "100", "300", "a"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.method), func(t *testing.T) {
+			report, err := Compute([]*Account{account}, rates, "USD", Options{Method: test.method})
+			require.NoError(t, err)
+			requireRat(t, test.realized, report.Realized())
+			requireRat(t, test.realized, report.RealizedShortTerm)
+			requireRat(t, "0", report.RealizedLongTerm)
+			requireRat(t, test.costBasis, report.CostBasis)
+			requireRat(t, "400", report.MarketValue)
+			requireRat(t, test.unrealized, report.UnrealizedGain)
+			require.Len(t, report.Lots, 1)
+			require.Equal(t, test.remainingLot, report.Lots[0].TxID)
+			require.Len(t, report.Disposals, 1)
+			require.Equal(t, DisposalSend, report.Disposals[0].Kind)
+			require.False(t, report.MissingPrices)
+			require.False(t, report.Incomplete)
+		})
+	}
+}
+
+func TestHIFO(t *testing.T) {
+	rates := &mockRates{
+		historical: map[time.Time]float64{*day(0): 100, *day(1): 300, *day(2): 200, *day(3): 250},
+	}
+	account := newAccount("btc",
+		newTx(accounts.TxTypeReceive, "a", day(0), btc, 0),
+		newTx(accounts.TxTypeReceive, "b", day(1), btc, 0),
+		newTx(accounts.TxTypeReceive, "c", day(2), btc, 0),
+		newTx(accounts.TxTypeSend, "d", day(3), 3*btc/2, 0),
+	)
+	report, err := Compute([]*Account{account}, rates, "USD", Options{Method: MethodHIFO})
+	require.NoError(t, err)
+	// 1 BTC from b at 300 and 0.5 BTC from c at 200, sold at 250.
+	requireRat(t, "-25", report.Realized())
+	require.Len(t, report.Lots, 2)
+	require.Equal(t, "a", report.Lots[0].TxID)
+	require.Equal(t, "c", report.Lots[1].TxID)
+	requireRat(t, "1/2", report.Lots[1].Amount)
+	requireRat(t, "100", report.Lots[1].Cost)
+	// No latest price.
+	require.True(t, report.MissingPrices)
+	require.Nil(t, report.Holdings[0].MarketValue)
+}
+
+func TestFees(t *testing.T) {
+	rates := &mockRates{historical: map[time.Time]float64{*day(0): 100, *day(1): 200}}
+	account := newAccount("btc",
+		newTx(accounts.TxTypeReceive, "a", day(0), btc, 0),
+		newTx(accounts.TxTypeSend, "b", day(1), btc/2, btc/10),
+	)
+
+	report, err := Compute([]*Account{account}, rates, "USD", Options{Fee: FeeDisposal})
+	require.NoError(t, err)
+	require.Len(t, report.Disposals, 2)
+	require.Equal(t, DisposalSend, report.Disposals[0].Kind)
+	requireRat(t, "50", report.Disposals[0].Gain())
+	require.Equal(t, DisposalFee, report.Disposals[1].Kind)
+	requireRat(t, "10", report.Disposals[1].Gain())
+	requireRat(t, "60", report.Realized())
+	requireRat(t, "40", report.CostBasis)
+
+	report, err = Compute([]*Account{account}, rates, "USD", Options{Fee: FeeCost})
+	require.NoError(t, err)
+	require.Len(t, report.Disposals, 1)
+	requireRat(t, "100", report.Disposals[0].Proceeds)
+	requireRat(t, "60", report.Disposals[0].Cost)
+	requireRat(t, "40", report.Realized())
+	requireRat(t, "40", report.CostBasis)
+}
+
+func TestSendSelf(t *testing.T) {
+	rates := &mockRates{historical: map[time.Time]float64{*day(0): 100, *day(1): 200}}
+	account := newAccount("btc",
+		newTx(accounts.TxTypeReceive, "a", day(0), btc, 0),
+		newTx(accounts.TxTypeSendSelf, "b", day(1), btc/2, btc/10),
+	)
+
+	report, err := Compute([]*Account{account}, rates, "USD", Options{Fee: FeeCost})
+	require.NoError(t, err)
+	require.Empty(t, report.Disposals)
+	requireRat(t, "0", report.Realized())
+	// The fee's cost is carried by the remaining coins.
+	requireRat(t, "100", report.CostBasis)
+	requireRat(t, "9/10", report.Holdings[0].Amount)
+	for _, lot := range report.Lots {
+		require.Equal(t, *day(0), lot.Acquired)
+	}
+
+	report, err = Compute([]*Account{account}, rates, "USD", Options{Fee: FeeDisposal})
+	require.NoError(t, err)
+	require.Len(t, report.Disposals, 1)
+	require.Equal(t, DisposalFee, report.Disposals[0].Kind)
+	requireRat(t, "10", report.Realized())
+	requireRat(t, "90", report.CostBasis)
+
+	report, err = Compute([]*Account{account}, rates, "USD",
+		Options{Fee: FeeDisposal, Transfers: TransferDisposal})
+	require.NoError(t, err)
+	require.Len(t, report.Disposals, 2)
+	require.Equal(t, DisposalTransfer, report.Disposals[0].Kind)
+	requireRat(t, "60", report.Realized())
+	// 0.5 BTC re-acquired at 200 and 0.4 BTC at 100.
+	requireRat(t, "140", report.CostBasis)
+}
+
+func TestFailedTx(t *testing.T) {
+	rates := &mockRates{historical: map[time.Time]float64{*day(0): 100, *day(1): 200}}
+	failed := newTx(accounts.TxTypeSend, "b", day(1), btc/2, btc/10)
+	failed.Status = accounts.TxStatusFailed
+	account := newAccount("eth", newTx(accounts.TxTypeReceive, "a", day(0), btc, 0), failed)
+
+	report, err := Compute([]*Account{account}, rates, "USD", Options{Fee: FeeCost})
+	require.NoError(t, err)
+	require.Empty(t, report.Disposals)
+	requireRat(t, "9/10", report.Holdings[0].Amount)
+	requireRat(t, "100", report.CostBasis)
+}
+
+func TestTransferBetweenAccounts(t *testing.T) {
+	rates := &mockRates{historical: map[time.Time]float64{*day(0): 100, *day(1): 200}}
+	accountA := newAccount("a",
+		newTx(accounts.TxTypeReceive, "a", day(0), btc, 0),
+		newTx(accounts.TxTypeSend, "transfer", day(1), btc, 0),
+	)
+	accountB := newAccount("b", newTx(accounts.TxTypeReceive, "transfer", day(1), btc, 0))
+
+	// The receive of account B is processed before the send of account A.
+	report, err := Compute([]*Account{accountB, accountA}, rates, "USD", Options{})
+	require.NoError(t, err)
+	require.Empty(t, report.Disposals)
+	require.Len(t, report.Lots, 1)
+	require.Equal(t, accountsTypes.Code("b"), report.Lots[0].AccountCode)
+	require.Equal(t, *day(0), report.Lots[0].Acquired)
+	requireRat(t, "100", report.CostBasis)
+
+	report, err = Compute(
+		[]*Account{accountA, accountB}, rates, "USD", Options{Transfers: TransferDisposal})
+	require.NoError(t, err)
+	require.Len(t, report.Disposals, 1)
+	require.Equal(t, DisposalTransfer, report.Disposals[0].Kind)
+	requireRat(t, "100", report.Realized())
+	requireRat(t, "200", report.CostBasis)
+
+	// Computed separately, the transfer is a regular send and receive.
+	report, err = Compute([]*Account{accountA}, rates, "USD", Options{})
+	require.NoError(t, err)
+	require.Len(t, report.Disposals, 1)
+	require.Equal(t, DisposalSend, report.Disposals[0].Kind)
+	requireRat(t, "100", report.Realized())
+}
+
+func TestLongTerm(t *testing.T) {
+	rates := &mockRates{historical: map[time.Time]float64{
+		*day(0): 100, *day(300): 150, *day(400): 200,
+	}}
+	account := newAccount("btc",
+		newTx(accounts.TxTypeReceive, "a", day(0), btc, 0),
+		newTx(accounts.TxTypeReceive, "b", day(300), btc, 0),
+		newTx(accounts.TxTypeSend, "c", day(400), 2*btc, 0),
+	)
+	report, err := Compute([]*Account{account}, rates, "USD", Options{})
+	require.NoError(t, err)
+	requireRat(t, "100", report.RealizedLongTerm)
+	requireRat(t, "50", report.RealizedShortTerm)
+	requireRat(t, "100", report.Disposals[0].LongTermGain)
+	requireRat(t, "50", report.Disposals[0].ShortTermGain)
+}
+
+func TestIncompleteAndMissingPrices(t *testing.T) {
+	rates := &mockRates{historical: map[time.Time]float64{*day(1): 200}}
+	pending := newTx(accounts.TxTypeReceive, "pending", nil, btc, 0)
+	pending.Status = accounts.TxStatusPending
+	account := newAccount("btc",
+		newTx(accounts.TxTypeReceive, "a", day(0), btc, 0),
+		newTx(accounts.TxTypeSend, "b", day(1), 2*btc, 0),
+		pending,
+	)
+	report, err := Compute([]*Account{account}, rates, "USD", Options{})
+	require.NoError(t, err)
+	require.True(t, report.Incomplete)
+	require.True(t, report.MissingPrices)
+	// Both coins are valued at a cost basis of zero.
+	requireRat(t, "400", report.Realized())
+	require.Empty(t, report.Lots)
+}
+
+func TestFormat(t *testing.T) {
+	rates := &mockRates{
+		historical: map[time.Time]float64{*day(0): 20000, *day(1): 10000},
+		latest:     30000,
+	}
+	account := newAccount("btc",
+		newTx(accounts.TxTypeReceive, "a", day(0), btc, 0),
+		newTx(accounts.TxTypeSend, "b", day(1), btc/2, 0),
+	)
+	report, err := Compute([]*Account{account}, rates, "USD", Options{})
+	require.NoError(t, err)
+	formatted := report.Format(false)
+	require.Equal(t, "-5'000.00", formatted.Realized)
+	require.Equal(t, "10'000.00", formatted.CostBasis)
+	require.Equal(t, "5'000.00", formatted.UnrealizedGain)
+	require.Equal(t, "0.5", formatted.Lots[0].Amount)
+	require.Equal(t, "2020-01-01T00:00:00Z", formatted.Lots[0].Acquired)
+	require.Equal(t, "15'000.00", *formatted.Holdings[0].MarketValue)
+	require.Equal(t, MethodFIFO, formatted.Options.Method)
+}
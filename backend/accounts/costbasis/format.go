@@ -0,0 +1,154 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package costbasis
+
+import (
+	"math/big"
+	"strings"
+	"time"
+
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+)
+
+// FormattedLot is the JSON representation of a lot.
+type FormattedLot struct {
+	AccountCode accountsTypes.Code `json:"accountCode"`
+	CoinCode    coin.Code          `json:"coinCode"`
+	TxID        string             `json:"txID"`
+	Acquired    string             `json:"acquired"`
+	Amount      string             `json:"amount"`
+	Cost        string             `json:"cost"`
+}
+
+// FormattedDisposal is the JSON representation of a disposal.
+type FormattedDisposal struct {
+	AccountCode   accountsTypes.Code `json:"accountCode"`
+	CoinCode      coin.Code          `json:"coinCode"`
+	Kind          DisposalKind       `json:"kind"`
+	TxID          string             `json:"txID"`
+	Time          string             `json:"time"`
+	Amount        string             `json:"amount"`
+	Proceeds      string             `json:"proceeds"`
+	Cost          string             `json:"cost"`
+	ShortTermGain string             `json:"shortTermGain"`
+	LongTermGain  string             `json:"longTermGain"`
+	Gain          string             `json:"gain"`
+}
+
+// FormattedHolding is the JSON representation of a holding. The market value and unrealized
+// gain are nil if the latest price is not available.
+type FormattedHolding struct {
+	AccountCode    accountsTypes.Code `json:"accountCode"`
+	CoinCode       coin.Code          `json:"coinCode"`
+	Unit           string             `json:"unit"`
+	Amount         string             `json:"amount"`
+	Cost           string             `json:"cost"`
+	MarketValue    *string            `json:"marketValue"`
+	UnrealizedGain *string            `json:"unrealizedGain"`
+}
+
+// FormattedReport is the JSON representation of a report, with fiat values formatted in the
+// report's fiat currency and amounts in the coin unit.
+type FormattedReport struct {
+	Fiat              string              `json:"fiat"`
+	Options           Options             `json:"options"`
+	Lots              []FormattedLot      `json:"lots"`
+	Disposals         []FormattedDisposal `json:"disposals"`
+	Holdings          []FormattedHolding  `json:"holdings"`
+	RealizedShortTerm string              `json:"realizedShortTerm"`
+	RealizedLongTerm  string              `json:"realizedLongTerm"`
+	Realized          string              `json:"realized"`
+	CostBasis         string              `json:"costBasis"`
+	MarketValue       string              `json:"marketValue"`
+	UnrealizedGain    string              `json:"unrealizedGain"`
+	MissingPrices     bool                `json:"missingPrices"`
+	Incomplete        bool                `json:"incomplete"`
+}
+
+// Format converts the report to its JSON representation.
+func (report *Report) Format(formatBtcAsSat bool) *FormattedReport {
+	fiat := func(value *big.Rat) string {
+		// FormatAsCurrency does not handle the sign when grouping thousands.
+		if value.Sign() < 0 {
+			return "-" + coin.FormatAsCurrency(new(big.Rat).Neg(value), report.Fiat, formatBtcAsSat)
+		}
+		return coin.FormatAsCurrency(value, report.Fiat, formatBtcAsSat)
+	}
+	amount := func(coinCode coin.Code, value *big.Rat) string {
+		formatted := value.FloatString(int(report.decimals[coinCode]))
+		if strings.Contains(formatted, ".") {
+			formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+		}
+		return formatted
+	}
+	result := &FormattedReport{
+		Fiat:              report.Fiat,
+		Options:           report.Options,
+		Lots:              make([]FormattedLot, len(report.Lots)),
+		Disposals:         make([]FormattedDisposal, len(report.Disposals)),
+		Holdings:          make([]FormattedHolding, len(report.Holdings)),
+		RealizedShortTerm: fiat(report.RealizedShortTerm),
+		RealizedLongTerm:  fiat(report.RealizedLongTerm),
+		Realized:          fiat(report.Realized()),
+		CostBasis:         fiat(report.CostBasis),
+		MarketValue:       fiat(report.MarketValue),
+		UnrealizedGain:    fiat(report.UnrealizedGain),
+		MissingPrices:     report.MissingPrices,
+		Incomplete:        report.Incomplete,
+	}
+	for i, lot := range report.Lots {
+		result.Lots[i] = FormattedLot{
+			AccountCode: lot.AccountCode,
+			CoinCode:    lot.CoinCode,
+			TxID:        lot.TxID,
+			Acquired:    lot.Acquired.Format(time.RFC3339),
+			Amount:      amount(lot.CoinCode, lot.Amount),
+			Cost:        fiat(lot.Cost),
+		}
+	}
+	for i, disposal := range report.Disposals {
+		result.Disposals[i] = FormattedDisposal{
+			AccountCode:   disposal.AccountCode,
+			CoinCode:      disposal.CoinCode,
+			Kind:          disposal.Kind,
+			TxID:          disposal.TxID,
+			Time:          disposal.Time.Format(time.RFC3339),
+			Amount:        amount(disposal.CoinCode, disposal.Amount),
+			Proceeds:      fiat(disposal.Proceeds),
+			Cost:          fiat(disposal.Cost),
+			ShortTermGain: fiat(disposal.ShortTermGain),
+			LongTermGain:  fiat(disposal.LongTermGain),
+			Gain:          fiat(disposal.Gain()),
+		}
+	}
+	for i, holding := range report.Holdings {
+		formatted := FormattedHolding{
+			AccountCode: holding.AccountCode,
+			CoinCode:    holding.CoinCode,
+			Unit:        holding.Unit,
+			Amount:      amount(holding.CoinCode, holding.Amount),
+			Cost:        fiat(holding.Cost),
+		}
+		if holding.MarketValue != nil {
+			marketValue := fiat(holding.MarketValue)
+			unrealizedGain := fiat(holding.UnrealizedGain)
+			formatted.MarketValue = &marketValue
+			formatted.UnrealizedGain = &unrealizedGain
+		}
+		result.Holdings[i] = formatted
+	}
+	return result
+}
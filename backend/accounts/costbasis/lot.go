@@ -0,0 +1,158 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package costbasis
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+)
+
+// Lot is an amount of coins acquired in one transaction. Amount is in the coin unit, Cost is the
+// total cost basis of the lot in the report's fiat currency.
+type Lot struct {
+	AccountCode accountsTypes.Code
+	CoinCode    coin.Code
+	TxID        string
+	Acquired    time.Time
+	Amount      *big.Rat
+	Cost        *big.Rat
+}
+
+// split splits off the given amount from the lot, which must be smaller than the lot amount. The
+// cost basis is split proportionally.
+func (lot *Lot) split(amount *big.Rat) *Lot {
+	cost := new(big.Rat).Mul(lot.Cost, new(big.Rat).Quo(amount, lot.Amount))
+	part := *lot
+	part.Amount = new(big.Rat).Set(amount)
+	part.Cost = cost
+	lot.Amount = new(big.Rat).Sub(lot.Amount, amount)
+	lot.Cost = new(big.Rat).Sub(lot.Cost, cost)
+	return &part
+}
+
+// ledger holds the open lots of one account, ordered by acquisition time.
+type ledger struct {
+	account *Account
+	method  Method
+	lots    []*Lot
+}
+
+func (l *ledger) add(lot *Lot) {
+	if lot.Amount.Sign() == 0 {
+		return
+	}
+	index := sort.Search(len(l.lots), func(i int) bool {
+		return l.lots[i].Acquired.After(lot.Acquired)
+	})
+	l.lots = append(l.lots, nil)
+	copy(l.lots[index+1:], l.lots[index:])
+	l.lots[index] = lot
+}
+
+// order returns the indices of the lots in the order they are consumed according to the
+// lot-matching method.
+func (l *ledger) order() []int {
+	indices := make([]int, len(l.lots))
+	for i := range indices {
+		indices[i] = i
+	}
+	switch l.method {
+	case MethodLIFO:
+		for i, j := 0, len(indices)-1; i < j; i, j = i+1, j-1 {
+			indices[i], indices[j] = indices[j], indices[i]
+		}
+	case MethodHIFO:
+		costPerUnit := func(lot *Lot) *big.Rat {
+			return new(big.Rat).Quo(lot.Cost, lot.Amount)
+		}
+		sort.SliceStable(indices, func(i, j int) bool {
+			return costPerUnit(l.lots[indices[i]]).Cmp(costPerUnit(l.lots[indices[j]])) > 0
+		})
+	}
+	return indices
+}
+
+// consume removes the amount from the open lots and returns the consumed lots. If there are not
+// enough coins, the missing amount is returned as the shortfall.
+func (l *ledger) consume(amount *big.Rat) ([]*Lot, *big.Rat) {
+	remaining := new(big.Rat).Set(amount)
+	consumed := []*Lot{}
+	if remaining.Sign() <= 0 {
+		return consumed, remaining
+	}
+	emptied := map[int]bool{}
+	for _, index := range l.order() {
+		lot := l.lots[index]
+		if lot.Amount.Cmp(remaining) <= 0 {
+			consumed = append(consumed, lot)
+			emptied[index] = true
+			remaining.Sub(remaining, lot.Amount)
+		} else {
+			consumed = append(consumed, lot.split(remaining))
+			remaining.SetInt64(0)
+		}
+		if remaining.Sign() == 0 {
+			break
+		}
+	}
+	lots := l.lots[:0]
+	for index, lot := range l.lots {
+		if !emptied[index] {
+			lots = append(lots, lot)
+		}
+	}
+	l.lots = lots
+	return consumed, remaining
+}
+
+// splitLots splits the given amount off the lots, taking from the first lots first. The lots
+// must hold at least the given amount.
+func splitLots(lots []*Lot, amount *big.Rat) ([]*Lot, []*Lot) {
+	taken := []*Lot{}
+	remaining := new(big.Rat).Set(amount)
+	for len(lots) > 0 && remaining.Sign() > 0 {
+		lot := lots[0]
+		if lot.Amount.Cmp(remaining) <= 0 {
+			taken = append(taken, lot)
+			remaining.Sub(remaining, lot.Amount)
+			lots = lots[1:]
+			continue
+		}
+		taken = append(taken, lot.split(remaining))
+		remaining.SetInt64(0)
+	}
+	return taken, lots
+}
+
+// spreadCost adds the cost to the lots, proportionally to their amounts.
+func spreadCost(lots []*Lot, cost *big.Rat) {
+	total := new(big.Rat)
+	for _, lot := range lots {
+		total.Add(total, lot.Amount)
+	}
+	if total.Sign() == 0 {
+		return
+	}
+	for _, lot := range lots {
+		lot.Cost = new(big.Rat).Add(
+			lot.Cost,
+			new(big.Rat).Mul(cost, new(big.Rat).Quo(lot.Amount, total)),
+		)
+	}
+}
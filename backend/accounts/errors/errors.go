@@ -46,6 +46,10 @@ var (
 	// not synced yet, which is a prerequisite to making a timeseries of the portfolio.
 	ErrNotAvailable = errpkg.New("notAvailable")
 
+	// ErrKeystoreNotConnected is returned when an account of a remembered keystore needs the
+	// keystore, e.g. to sign a transaction, but the keystore is not connected.
+	ErrKeystoreNotConnected = errpkg.New("keystoreNotConnected")
+
 	// ERC20InsufficientGasFunds is returned when there is not enough ETH to pay the erc20 transaction fee.
 	ERC20InsufficientGasFunds = errpkg.New("erc20InsufficientGasFunds")
 )
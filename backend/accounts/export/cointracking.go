@@ -0,0 +1,95 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// coinTrackingExporter exports the CoinTracking CSV import format, see
+// https://cointracking.info/import/import_csv/.
+type coinTrackingExporter struct{}
+
+func (coinTrackingExporter) FileExtension() string { return "csv" }
+
+func (coinTrackingExporter) NeedsFiat() bool { return true }
+
+func (coinTrackingExporter) Export(w io.Writer, inputs []*Input) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{
+		"Type",
+		"Buy Amount",
+		"Buy Currency",
+		"Sell Amount",
+		"Sell Currency",
+		"Fee",
+		"Fee Currency",
+		"Exchange",
+		"Trade-Group",
+		"Comment",
+		"Date",
+		"Tx-ID",
+		"Buy Value in " + fiat(inputs),
+		"Sell Value in " + fiat(inputs),
+	})
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	for _, e := range mergedEntries(inputs) {
+		var txType, buyAmount, buyCurrency, buyValue, sellAmount, sellCurrency, sellValue string
+		var fee, feeCurrency string
+		switch e.kind {
+		case entryReceive:
+			txType = "Deposit"
+			buyAmount, buyCurrency = formatAmount(e.amount, e.decimals(false)), e.unit
+			buyValue = e.input.formatValue(e.value)
+		case entrySend:
+			txType = "Withdrawal"
+			sellAmount, sellCurrency = formatAmount(e.amount, e.decimals(false)), e.unit
+			sellValue = e.input.formatValue(e.value)
+		case entryFee:
+			txType = "Other Fee"
+			sellAmount, sellCurrency = formatAmount(e.fee, e.decimals(true)), e.feeUnit
+			sellValue = e.input.formatValue(e.feeValue)
+		}
+		if e.fee != nil && e.kind != entryFee {
+			fee, feeCurrency = formatAmount(e.fee, e.decimals(true)), e.feeUnit
+		}
+		err := writer.Write([]string{
+			txType,
+			buyAmount,
+			buyCurrency,
+			sellAmount,
+			sellCurrency,
+			fee,
+			feeCurrency,
+			e.input.Account.Config().Config.Name,
+			"",
+			e.note,
+			e.time.Format("2006-01-02 15:04:05"),
+			e.tx.TxID,
+			buyValue,
+			sellValue,
+		})
+		if err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
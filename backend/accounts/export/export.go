@@ -0,0 +1,350 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export writes the transactions of an account in formats which can be imported by tax
+// and accounting software.
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// Format identifies an export format.
+type Format string
+
+const (
+	// FormatCSV is the app's own CSV format, see `accounts.Interface.ExportCSV()`.
+	FormatCSV Format = "csv"
+	// FormatKoinly is the Koinly universal CSV format.
+	FormatKoinly Format = "koinly"
+	// FormatCoinTracking is the CoinTracking CSV import format.
+	FormatCoinTracking Format = "cointracking"
+	// FormatHledger is a plain text accounting journal for hledger and ledger-cli.
+	FormatHledger Format = "hledger"
+	// FormatBeancount is a plain text accounting journal for beancount.
+	FormatBeancount Format = "beancount"
+)
+
+// Exporter writes the transactions of an account in a specific format.
+type Exporter interface {
+	// FileExtension is the extension of exported files, without the dot.
+	FileExtension() string
+	// NeedsFiat is true if the format contains fiat values, so `Input.Fiat` must be set.
+	NeedsFiat() bool
+	// Export writes the transactions of the inputs to one file, merged in chronological order.
+	// All inputs must have the same fiat currency.
+	Export(w io.Writer, inputs []*Input) error
+}
+
+var exporters = map[Format]Exporter{
+	FormatCSV:          csvExporter{},
+	FormatKoinly:       koinlyExporter{},
+	FormatCoinTracking: coinTrackingExporter{},
+	FormatHledger:      ledgerExporter{dialect: hledger},
+	FormatBeancount:    ledgerExporter{dialect: beancount},
+}
+
+// Register adds an exporter, replacing any existing exporter of the same format. It must not be
+// called concurrently with exports.
+func Register(format Format, exporter Exporter) {
+	exporters[format] = exporter
+}
+
+// Lookup returns the exporter of the format. An empty format is the app's own CSV format.
+func Lookup(format Format) (Exporter, error) {
+	if format == "" {
+		format = FormatCSV
+	}
+	exporter, ok := exporters[format]
+	if !ok {
+		return nil, errp.Newf("unknown export format %q", format)
+	}
+	return exporter, nil
+}
+
+// Formats returns all registered formats, sorted.
+func Formats() []Format {
+	formats := make([]Format, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i] < formats[j] })
+	return formats
+}
+
+// Rates provides historical exchange rates. It is implemented by `rates.RateUpdater`.
+type Rates interface {
+	// HistoricalPriceAt returns the price of the coin at the given time, or 0 if not available.
+	HistoricalPriceAt(coinCode, fiat string, at time.Time) float64
+}
+
+// Filter selects the transactions to be exported.
+type Filter struct {
+	// From is the inclusive start of the time range. Ignored if zero.
+	From time.Time
+	// To is the exclusive end of the time range. Ignored if zero.
+	To time.Time
+	// Types are the transaction types to export. All types are exported if empty.
+	Types []accounts.TxType
+}
+
+// Apply returns the transactions matching the filter. Transactions without a timestamp are
+// excluded if a time range is set.
+func (filter Filter) Apply(transactions accounts.OrderedTransactions) accounts.OrderedTransactions {
+	result := accounts.OrderedTransactions{}
+	for _, tx := range transactions {
+		if !filter.From.IsZero() || !filter.To.IsZero() {
+			if tx.Timestamp == nil ||
+				(!filter.From.IsZero() && tx.Timestamp.Before(filter.From)) ||
+				(!filter.To.IsZero() && !tx.Timestamp.Before(filter.To)) {
+				continue
+			}
+		}
+		if len(filter.Types) > 0 && !containsType(filter.Types, tx.Type) {
+			continue
+		}
+		result = append(result, tx)
+	}
+	return result
+}
+
+func containsType(types []accounts.TxType, txType accounts.TxType) bool {
+	for _, t := range types {
+		if t == txType {
+			return true
+		}
+	}
+	return false
+}
+
+// Input is the data to be exported.
+type Input struct {
+	Account      accounts.Interface
+	Transactions accounts.OrderedTransactions
+	Rates        Rates
+	// Fiat is the currency of the fiat values.
+	Fiat string
+}
+
+// csvExporter exports the app's own CSV format.
+type csvExporter struct{}
+
+func (csvExporter) FileExtension() string { return "csv" }
+
+func (csvExporter) NeedsFiat() bool { return false }
+
+// Export writes the account's CSV export if there is one input. The exports of multiple accounts
+// are merged, with an additional first column naming the account.
+func (csvExporter) Export(w io.Writer, inputs []*Input) error {
+	if len(inputs) == 1 {
+		return inputs[0].Account.ExportCSV(w, inputs[0].Transactions)
+	}
+	type row struct {
+		time    time.Time
+		columns []string
+	}
+	var header []string
+	rows := []row{}
+	for _, input := range inputs {
+		var buf bytes.Buffer
+		if err := input.Account.ExportCSV(&buf, input.Transactions); err != nil {
+			return err
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		if len(records) == 0 {
+			continue
+		}
+		header = append([]string{"Account"}, records[0]...)
+		for _, record := range records[1:] {
+			// The first column is the time. Rows without a time (unconfirmed txs) come last.
+			t, err := time.Parse(time.RFC3339, record[0])
+			if err != nil {
+				t = time.Unix(1<<62, 0)
+			}
+			rows = append(rows, row{
+				time:    t,
+				columns: append([]string{input.Account.Config().Config.Name}, record...),
+			})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].time.Before(rows[j].time) })
+	writer := csv.NewWriter(w)
+	if header != nil {
+		if err := writer.Write(header); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	for _, row := range rows {
+		if err := writer.Write(row.columns); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// entryKind is the kind of an exported entry.
+type entryKind int
+
+const (
+	entryReceive entryKind = iota
+	entrySend
+	// entryFee is a transaction where only a fee left the account, e.g. a send to ourselves, a
+	// failed transaction or a ETH transaction executing an ERC20 token transfer.
+	entryFee
+)
+
+// entry is a confirmed transaction normalized for exporting. Amounts are in the coin unit, values
+// in the fiat currency.
+type entry struct {
+	input *Input
+	tx    *accounts.TransactionData
+	time  time.Time
+	kind  entryKind
+	note  string
+
+	amount *big.Rat
+	unit   string
+	// value is nil if the historical price is missing.
+	value *big.Rat
+
+	// fee is nil if there is no fee paid by this account.
+	fee     *big.Rat
+	feeUnit string
+	// feeValue is nil if the historical price is missing.
+	feeValue *big.Rat
+}
+
+// toUnit converts an amount in the smallest unit to the coin unit.
+func toUnit(amount coin.Amount, decimals uint) *big.Rat {
+	return new(big.Rat).SetFrac(
+		amount.BigInt(),
+		new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil),
+	)
+}
+
+// formatAmount formats an amount in the coin unit without trailing zeroes.
+func formatAmount(amount *big.Rat, decimals uint) string {
+	formatted := amount.FloatString(int(decimals))
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
+
+// value returns the fiat value of the amount at the given time, or nil if no price is available.
+func (input *Input) value(coinCode coin.Code, amount *big.Rat, at time.Time) *big.Rat {
+	price := input.Rates.HistoricalPriceAt(string(coinCode), input.Fiat, at)
+	if price == 0 {
+		return nil
+	}
+	return new(big.Rat).Mul(amount, new(big.Rat).SetFloat64(price))
+}
+
+// feeCoinCode returns the code of the coin the fees are paid in if they are paid in a different
+// unit, which is the case for ERC20 tokens.
+func feeCoinCode(accountCoin coin.Coin) coin.Code {
+	if tokenCoin, ok := accountCoin.(interface{ ERC20Token() *erc20.Token }); ok &&
+		tokenCoin.ERC20Token() != nil {
+		return coin.CodeETH
+	}
+	return accountCoin.Code()
+}
+
+// entries returns the confirmed transactions as entries, oldest first. Fees paid in a different
+// unit are omitted, as they are part of the export of the account holding that unit.
+func (input *Input) entries() []*entry {
+	accountCoin := input.Account.Coin()
+	result := []*entry{}
+	for i := len(input.Transactions) - 1; i >= 0; i-- {
+		tx := input.Transactions[i]
+		if tx.Timestamp == nil || tx.Status == accounts.TxStatusPending {
+			continue
+		}
+		e := &entry{
+			input:   input,
+			tx:      tx,
+			time:    tx.Timestamp.UTC(),
+			note:    input.Account.TxNote(tx.InternalID),
+			amount:  toUnit(tx.Amount, accountCoin.Decimals(false)),
+			unit:    accountCoin.Unit(false),
+			feeUnit: accountCoin.Unit(true),
+		}
+		if tx.Fee != nil && !tx.FeeIsDifferentUnit && tx.Fee.BigInt().Sign() > 0 {
+			e.fee = toUnit(*tx.Fee, accountCoin.Decimals(true))
+			e.feeValue = input.value(feeCoinCode(accountCoin), e.fee, e.time)
+		}
+		switch {
+		case tx.Type == accounts.TxTypeReceive && tx.Status != accounts.TxStatusFailed:
+			e.kind = entryReceive
+		case tx.Type == accounts.TxTypeSend && tx.Status != accounts.TxStatusFailed &&
+			e.amount.Sign() > 0:
+			e.kind = entrySend
+		default:
+			if e.fee == nil {
+				continue
+			}
+			e.kind = entryFee
+			e.amount = new(big.Rat)
+		}
+		e.value = input.value(accountCoin.Code(), e.amount, e.time)
+		result = append(result, e)
+	}
+	return result
+}
+
+// mergedEntries returns the entries of all inputs, oldest first.
+func mergedEntries(inputs []*Input) []*entry {
+	result := []*entry{}
+	for _, input := range inputs {
+		result = append(result, input.entries()...)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].time.Before(result[j].time) })
+	return result
+}
+
+// decimals returns the decimals of the amount or fee of the entry.
+func (e *entry) decimals(isFee bool) uint {
+	return e.input.Account.Coin().Decimals(isFee)
+}
+
+// fiat returns the fiat currency shared by all inputs.
+func fiat(inputs []*Input) string {
+	if len(inputs) == 0 {
+		return ""
+	}
+	return inputs[0].Fiat
+}
+
+// formatValue formats a fiat value, or returns an empty string if it is missing.
+func (input *Input) formatValue(value *big.Rat) string {
+	if value == nil {
+		return ""
+	}
+	return coin.FormatAsPlainCurrency(value, input.Fiat, false)
+}
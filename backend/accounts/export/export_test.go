@@ -0,0 +1,305 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsMocks "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/mocks"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	coinMocks "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	t2 = time.Date(2023, 2, 3, 11, 30, 0, 0, time.UTC)
+	t3 = time.Date(2023, 3, 4, 12, 0, 0, 0, time.UTC)
+)
+
+type mockRates map[time.Time]float64
+
+func (r mockRates) HistoricalPriceAt(coinCode, fiat string, at time.Time) float64 {
+	return r[at]
+}
+
+func amount(value int64) *coin.Amount {
+	result := coin.NewAmountFromInt64(value)
+	return &result
+}
+
+func newInput(code coin.Code, unit, feeUnit string, txs ...*accounts.TransactionData) *Input {
+	return newAccountInput("v0-test-btc-0", "My Bitcoin", code, unit, feeUnit, txs...)
+}
+
+func newAccountInput(
+	accountCode accountsTypes.Code, name string,
+	code coin.Code, unit, feeUnit string, txs ...*accounts.TransactionData) *Input {
+	mockCoin := &coinMocks.CoinMock{
+		CodeFunc:     func() coin.Code { return code },
+		DecimalsFunc: func(isFee bool) uint { return 8 },
+		UnitFunc: func(isFee bool) string {
+			if isFee {
+				return feeUnit
+			}
+			return unit
+		},
+	}
+	account := &accountsMocks.InterfaceMock{
+		CoinFunc: func() coin.Coin { return mockCoin },
+		ConfigFunc: func() *accounts.AccountConfig {
+			return &accounts.AccountConfig{Config: &config.Account{Code: accountCode, Name: name}}
+		},
+		TxNoteFunc: func(internalID string) string {
+			if internalID == "b" {
+				return "coffee"
+			}
+			return ""
+		},
+		ExportCSVFunc: func(w io.Writer, transactions []*accounts.TransactionData) error {
+			writer := csv.NewWriter(w)
+			if err := writer.Write([]string{"Time", "Transaction ID"}); err != nil {
+				return err
+			}
+			for _, tx := range transactions {
+				timeString := ""
+				if tx.Timestamp != nil {
+					timeString = tx.Timestamp.Format(time.RFC3339)
+				}
+				if err := writer.Write([]string{timeString, tx.TxID}); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		},
+	}
+	return &Input{
+		Account:      account,
+		Transactions: txs,
+		Rates:        mockRates{t1: 20000, t2: 30000},
+		Fiat:         "USD",
+	}
+}
+
+// btcTransactions are a receive, a send with a fee, a send to self and a pending receive, newest
+// first.
+func btcTransactions() accounts.OrderedTransactions {
+	return accounts.OrderedTransactions{
+		{Type: accounts.TxTypeReceive, Status: accounts.TxStatusPending, TxID: "d", InternalID: "d",
+			Amount: *amount(1)},
+		{Type: accounts.TxTypeSendSelf, Status: accounts.TxStatusComplete, TxID: "c", InternalID: "c",
+			Timestamp: &t3, Amount: *amount(1000), Fee: amount(500)},
+		{Type: accounts.TxTypeSend, Status: accounts.TxStatusComplete, TxID: "b", InternalID: "b",
+			Timestamp: &t2, Amount: *amount(50000000), Fee: amount(10000)},
+		{Type: accounts.TxTypeReceive, Status: accounts.TxStatusComplete, TxID: "a", InternalID: "a",
+			Timestamp: &t1, Amount: *amount(100000000)},
+	}
+}
+
+func export(t *testing.T, format Format, inputs ...*Input) string {
+	t.Helper()
+	exporter, err := Lookup(format)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, exporter.Export(&buf, inputs))
+	return buf.String()
+}
+
+func TestLookup(t *testing.T) {
+	exporter, err := Lookup("")
+	require.NoError(t, err)
+	require.Equal(t, csvExporter{}, exporter)
+	require.False(t, exporter.NeedsFiat())
+	_, err = Lookup("unknown")
+	require.Error(t, err)
+	require.Equal(t,
+		[]Format{FormatBeancount, FormatCoinTracking, FormatCSV, FormatHledger, FormatKoinly},
+		Formats())
+	require.Equal(t, "Time,Transaction ID\n", export(t, FormatCSV, newInput(coin.CodeBTC, "BTC", "BTC")))
+}
+
+func TestKoinly(t *testing.T) {
+	require.Equal(t,
+		`Date,Sent Amount,Sent Currency,Received Amount,Received Currency,Fee Amount,Fee Currency,Net Worth Amount,Net Worth Currency,Label,Description,TxHash
+2023-01-02 10:00:00 UTC,,,1,BTC,,,20000.00,USD,,,a
+2023-02-03 11:30:00 UTC,0.5,BTC,,,0.0001,BTC,15000.00,USD,,coffee,b
+2023-03-04 12:00:00 UTC,0.000005,BTC,,,,,,USD,cost,,c
+`,
+		export(t, FormatKoinly, newInput(coin.CodeBTC, "BTC", "BTC", btcTransactions()...)))
+}
+
+func TestCoinTracking(t *testing.T) {
+	require.Equal(t,
+		`Type,Buy Amount,Buy Currency,Sell Amount,Sell Currency,Fee,Fee Currency,Exchange,Trade-Group,Comment,Date,Tx-ID,Buy Value in USD,Sell Value in USD
+Deposit,1,BTC,,,,,My Bitcoin,,,2023-01-02 10:00:00,a,20000.00,
+Withdrawal,,,0.5,BTC,0.0001,BTC,My Bitcoin,,coffee,2023-02-03 11:30:00,b,,15000.00
+Other Fee,,,0.000005,BTC,,,My Bitcoin,,,2023-03-04 12:00:00,c,,
+`,
+		export(t, FormatCoinTracking, newInput(coin.CodeBTC, "BTC", "BTC", btcTransactions()...)))
+}
+
+func TestHledger(t *testing.T) {
+	require.Equal(t,
+		`; Exported from the BitBoxApp account My Bitcoin
+
+2023-01-02 Received BTC
+    ; txid: a
+    assets:crypto:v0-test-btc-0  1 BTC @@ 20000.00 USD
+    equity:external  -20000.00 USD
+
+2023-02-03 Sent BTC
+    ; txid: b
+    ; note: coffee
+    assets:crypto:v0-test-btc-0  -0.5001 BTC @@ 15003.00 USD
+    equity:external  15000.00 USD
+    expenses:fees:crypto  3.00 USD
+
+2023-03-04 Fee BTC
+    ; txid: c
+    assets:crypto:v0-test-btc-0  -0.000005 BTC
+    expenses:fees:crypto  0.000005 BTC
+
+`,
+		export(t, FormatHledger, newInput(coin.CodeBTC, "BTC", "BTC", btcTransactions()...)))
+}
+
+func TestBeancount(t *testing.T) {
+	require.Equal(t,
+		`; Exported from the BitBoxApp account My Bitcoin
+
+2023-01-02 open Assets:Crypto:V0-test-btc-0
+2023-01-02 open Equity:External
+2023-01-02 open Expenses:Fees:Crypto
+
+2023-01-02 * "Received BTC"
+  txid: "a"
+  Assets:Crypto:V0-test-btc-0  1 BTC @@ 20000.00 USD
+  Equity:External  -20000.00 USD
+
+2023-02-03 * "Sent BTC"
+  txid: "b"
+  note: "coffee"
+  Assets:Crypto:V0-test-btc-0  -0.5001 BTC @@ 15003.00 USD
+  Equity:External  15000.00 USD
+  Expenses:Fees:Crypto  3.00 USD
+
+2023-03-04 * "Fee BTC"
+  txid: "c"
+  Assets:Crypto:V0-test-btc-0  -0.000005 BTC
+  Expenses:Fees:Crypto  0.000005 BTC
+
+`,
+		export(t, FormatBeancount, newInput(coin.CodeBTC, "BTC", "BTC", btcTransactions()...)))
+}
+
+// TestERC20 checks that fees paid in ETH are not part of the token rows.
+func TestERC20(t *testing.T) {
+	input := newInput("eth-erc20-usdt", "USDT", "ETH",
+		&accounts.TransactionData{
+			Type: accounts.TxTypeSend, Status: accounts.TxStatusComplete, TxID: "a", InternalID: "a",
+			Timestamp: &t1, Amount: *amount(100000000), Fee: amount(1000), FeeIsDifferentUnit: true,
+		},
+		&accounts.TransactionData{
+			Type: accounts.TxTypeSend, Status: accounts.TxStatusFailed, TxID: "b", InternalID: "b",
+			Timestamp: &t2, Amount: *amount(100000000), Fee: amount(1000), FeeIsDifferentUnit: true,
+		},
+	)
+	input.Rates = mockRates{t1: 1}
+	require.Equal(t,
+		`Date,Sent Amount,Sent Currency,Received Amount,Received Currency,Fee Amount,Fee Currency,Net Worth Amount,Net Worth Currency,Label,Description,TxHash
+2023-01-02 10:00:00 UTC,1,USDT,,,,,1.00,USD,,,a
+`,
+		export(t, FormatKoinly, input))
+}
+
+func TestFilter(t *testing.T) {
+	txIDs := func(txs accounts.OrderedTransactions) []string {
+		result := []string{}
+		for _, tx := range txs {
+			result = append(result, tx.TxID)
+		}
+		return result
+	}
+	txs := btcTransactions()
+	require.Equal(t, []string{"d", "c", "b", "a"}, txIDs(Filter{}.Apply(txs)))
+	require.Equal(t, []string{"c", "b"}, txIDs(Filter{From: t2}.Apply(txs)))
+	require.Equal(t, []string{"a"}, txIDs(Filter{To: t2}.Apply(txs)))
+	require.Equal(t, []string{"d", "a"},
+		txIDs(Filter{Types: []accounts.TxType{accounts.TxTypeReceive}}.Apply(txs)))
+	require.Equal(t, []string{"b"},
+		txIDs(Filter{From: t1.Add(time.Second), Types: []accounts.TxType{accounts.TxTypeSend}}.Apply(txs)))
+}
+
+func TestMultipleAccounts(t *testing.T) {
+	btcInput := newInput(coin.CodeBTC, "BTC", "BTC", btcTransactions()...)
+	ltcInput := newAccountInput("v0-test-ltc-0", "My Litecoin", coin.CodeLTC, "LTC", "LTC",
+		&accounts.TransactionData{
+			Type: accounts.TxTypeReceive, Status: accounts.TxStatusComplete, TxID: "e", InternalID: "e",
+			Timestamp: &t2, Amount: *amount(200000000),
+		})
+	ltcInput.Rates = mockRates{t2: 50}
+
+	require.Equal(t,
+		`Account,Time,Transaction ID
+My Bitcoin,2023-01-02T10:00:00Z,a
+My Bitcoin,2023-02-03T11:30:00Z,b
+My Litecoin,2023-02-03T11:30:00Z,e
+My Bitcoin,2023-03-04T12:00:00Z,c
+My Bitcoin,,d
+`,
+		export(t, FormatCSV, btcInput, ltcInput))
+
+	require.Equal(t,
+		`Type,Buy Amount,Buy Currency,Sell Amount,Sell Currency,Fee,Fee Currency,Exchange,Trade-Group,Comment,Date,Tx-ID,Buy Value in USD,Sell Value in USD
+Deposit,1,BTC,,,,,My Bitcoin,,,2023-01-02 10:00:00,a,20000.00,
+Withdrawal,,,0.5,BTC,0.0001,BTC,My Bitcoin,,coffee,2023-02-03 11:30:00,b,,15000.00
+Deposit,2,LTC,,,,,My Litecoin,,,2023-02-03 11:30:00,e,100.00,
+Other Fee,,,0.000005,BTC,,,My Bitcoin,,,2023-03-04 12:00:00,c,,
+`,
+		export(t, FormatCoinTracking, btcInput, ltcInput))
+
+	ltcInput.Transactions = Filter{}.Apply(ltcInput.Transactions)
+	btcInput.Transactions = Filter{To: t2}.Apply(btcInput.Transactions)
+	require.Equal(t,
+		`; Exported from the BitBoxApp accounts My Bitcoin, My Litecoin
+
+2023-01-02 open Assets:Crypto:V0-test-btc-0
+2023-01-02 open Assets:Crypto:V0-test-ltc-0
+2023-01-02 open Equity:External
+2023-01-02 open Expenses:Fees:Crypto
+
+2023-01-02 * "Received BTC"
+  txid: "a"
+  account: "My Bitcoin"
+  Assets:Crypto:V0-test-btc-0  1 BTC @@ 20000.00 USD
+  Equity:External  -20000.00 USD
+
+2023-02-03 * "Received LTC"
+  txid: "e"
+  account: "My Litecoin"
+  Assets:Crypto:V0-test-ltc-0  2 LTC @@ 100.00 USD
+  Equity:External  -100.00 USD
+
+`,
+		export(t, FormatBeancount, btcInput, ltcInput))
+}
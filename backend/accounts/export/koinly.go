@@ -0,0 +1,90 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// koinlyExporter exports the Koinly universal CSV format, see
+// https://help.koinly.io/en/articles/3662999-how-to-create-a-custom-csv-file-with-your-data.
+type koinlyExporter struct{}
+
+func (koinlyExporter) FileExtension() string { return "csv" }
+
+func (koinlyExporter) NeedsFiat() bool { return true }
+
+func (koinlyExporter) Export(w io.Writer, inputs []*Input) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{
+		"Date",
+		"Sent Amount",
+		"Sent Currency",
+		"Received Amount",
+		"Received Currency",
+		"Fee Amount",
+		"Fee Currency",
+		"Net Worth Amount",
+		"Net Worth Currency",
+		"Label",
+		"Description",
+		"TxHash",
+	})
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	for _, e := range mergedEntries(inputs) {
+		var sentAmount, sentCurrency, receivedAmount, receivedCurrency string
+		var feeAmount, feeCurrency, label string
+		value := e.value
+		switch e.kind {
+		case entryReceive:
+			receivedAmount, receivedCurrency = formatAmount(e.amount, e.decimals(false)), e.unit
+		case entrySend:
+			sentAmount, sentCurrency = formatAmount(e.amount, e.decimals(false)), e.unit
+		case entryFee:
+			// Koinly needs a sent or received amount. A fee-only tx is a sent amount labeled
+			// as a cost.
+			sentAmount, sentCurrency = formatAmount(e.fee, e.decimals(true)), e.feeUnit
+			value = e.feeValue
+			label = "cost"
+		}
+		if e.fee != nil && e.kind != entryFee {
+			feeAmount, feeCurrency = formatAmount(e.fee, e.decimals(true)), e.feeUnit
+		}
+		err := writer.Write([]string{
+			e.time.Format("2006-01-02 15:04:05 UTC"),
+			sentAmount,
+			sentCurrency,
+			receivedAmount,
+			receivedCurrency,
+			feeAmount,
+			feeCurrency,
+			e.input.formatValue(value),
+			e.input.Fiat,
+			label,
+			e.note,
+			e.tx.TxID,
+		})
+		if err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
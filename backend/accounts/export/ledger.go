@@ -0,0 +1,243 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// dialect defines the syntax differences between hledger and beancount journals.
+type dialect struct {
+	// accounts are the names of the asset, counterparty and fee accounts, joined with the
+	// account code.
+	assetsPrefix string
+	external     string
+	fees         string
+	// open is true if accounts need to be opened before they are used.
+	open bool
+	// header formats the first line of a transaction.
+	header func(date, description string) string
+	// metadata formats a key/value pair attached to a transaction.
+	metadata func(key, value string) string
+	// accountName sanitizes the account code for use in an account name.
+	accountName func(code string) string
+	indent      string
+}
+
+// hledger is also compatible with ledger-cli.
+var hledger = dialect{
+	assetsPrefix: "assets:crypto:",
+	external:     "equity:external",
+	fees:         "expenses:fees:crypto",
+	header: func(date, description string) string {
+		return fmt.Sprintf("%s %s", date, description)
+	},
+	metadata: func(key, value string) string {
+		return fmt.Sprintf("; %s: %s", key, strings.Join(strings.Fields(value), " "))
+	},
+	accountName: func(code string) string {
+		return strings.NewReplacer(":", "-", " ", "-").Replace(code)
+	},
+	indent: "    ",
+}
+
+var beancount = dialect{
+	assetsPrefix: "Assets:Crypto:",
+	external:     "Equity:External",
+	fees:         "Expenses:Fees:Crypto",
+	open:         true,
+	header: func(date, description string) string {
+		return fmt.Sprintf("%s * %s", date, beancountString(description))
+	},
+	metadata: func(key, value string) string {
+		return fmt.Sprintf("%s: %s", key, beancountString(value))
+	},
+	accountName: func(code string) string {
+		// Account name components start with a capital letter or a digit, followed by letters,
+		// digits or dashes.
+		name := []rune{}
+		for _, r := range code {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+				name = append(name, r)
+			default:
+				name = append(name, '-')
+			}
+		}
+		if len(name) == 0 || !(name[0] >= 'A' && name[0] <= 'Z' || name[0] >= '0' && name[0] <= '9') {
+			if len(name) > 0 && name[0] >= 'a' && name[0] <= 'z' {
+				name[0] = name[0] - 'a' + 'A'
+			} else {
+				name = append([]rune{'A'}, name...)
+			}
+		}
+		return string(name)
+	},
+	indent: "  ",
+}
+
+func beancountString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ").Replace(value) + `"`
+}
+
+// ledgerExporter exports a plain text accounting journal. Receives and sends are booked against
+// an external equity account, fees against an expense account. Amounts are annotated with their
+// total fiat value at the time of the transaction, if available.
+type ledgerExporter struct {
+	dialect dialect
+}
+
+func (exporter ledgerExporter) FileExtension() string {
+	if exporter.dialect.open {
+		return "beancount"
+	}
+	return "journal"
+}
+
+func (ledgerExporter) NeedsFiat() bool { return true }
+
+// posting is one line of a transaction. If value is nil, the amount is booked in the unit.
+type posting struct {
+	account string
+	amount  *big.Rat
+	unit    string
+	value   *big.Rat
+	// isFee is true if the amount is in the fee unit.
+	isFee bool
+}
+
+func (exporter ledgerExporter) Export(w io.Writer, inputs []*Input) error {
+	d := exporter.dialect
+	fiat := strings.ToUpper(fiat(inputs))
+	assetAccount := func(input *Input) string {
+		return d.assetsPrefix + d.accountName(string(input.Account.Config().Config.Code))
+	}
+
+	// roundValue rounds the fiat value like it is formatted, so the postings balance exactly.
+	roundValue := func(e *entry, value *big.Rat) *big.Rat {
+		if value == nil {
+			return nil
+		}
+		rounded, _ := new(big.Rat).SetString(e.input.formatValue(value))
+		return rounded
+	}
+	formatPosting := func(e *entry, p posting) string {
+		if p.amount == nil {
+			return fmt.Sprintf("%s%s  %s %s", d.indent, p.account, e.input.formatValue(p.value), fiat)
+		}
+		line := fmt.Sprintf("%s%s  %s %s",
+			d.indent, p.account, formatAmount(p.amount, e.decimals(p.isFee)), strings.ToUpper(p.unit))
+		if p.value != nil {
+			line += fmt.Sprintf(" @@ %s %s", e.input.formatValue(new(big.Rat).Abs(p.value)), fiat)
+		}
+		return line
+	}
+
+	var builder strings.Builder
+	names := make([]string, len(inputs))
+	for i, input := range inputs {
+		names[i] = strings.Join(strings.Fields(input.Account.Config().Config.Name), " ")
+	}
+	if len(names) == 1 {
+		builder.WriteString(fmt.Sprintf("; Exported from the BitBoxApp account %s\n\n", names[0]))
+	} else {
+		builder.WriteString(fmt.Sprintf("; Exported from the BitBoxApp accounts %s\n\n",
+			strings.Join(names, ", ")))
+	}
+	entries := mergedEntries(inputs)
+	if d.open && len(entries) > 0 {
+		date := entries[0].time.Format("2006-01-02")
+		openAccounts := []string{}
+		for _, input := range inputs {
+			openAccounts = append(openAccounts, assetAccount(input))
+		}
+		for _, account := range append(openAccounts, d.external, d.fees) {
+			builder.WriteString(fmt.Sprintf("%s open %s\n", date, account))
+		}
+		builder.WriteString("\n")
+	}
+	for _, e := range entries {
+		asset := assetAccount(e.input)
+		value := roundValue(e, e.value)
+		feeValue := roundValue(e, e.feeValue)
+		hasValues := value != nil && (e.fee == nil || feeValue != nil)
+		var description string
+		var postings []posting
+		switch e.kind {
+		case entryReceive:
+			description = "Received " + e.unit
+			postings = append(postings, posting{account: asset, amount: e.amount, unit: e.unit})
+			if hasValues {
+				postings[0].value = value
+				postings = append(postings, posting{account: d.external, value: new(big.Rat).Neg(value)})
+			} else {
+				postings = append(postings, posting{
+					account: d.external, amount: new(big.Rat).Neg(e.amount), unit: e.unit})
+			}
+		case entrySend, entryFee:
+			description = "Sent " + e.unit
+			if e.kind == entryFee {
+				description = "Fee " + e.feeUnit
+			}
+			total := new(big.Rat).Set(e.amount)
+			if e.fee != nil {
+				total.Add(total, e.fee)
+			}
+			postings = append(postings, posting{account: asset, amount: new(big.Rat).Neg(total), unit: e.unit})
+			totalValue := new(big.Rat)
+			if hasValues {
+				totalValue.Add(totalValue, value)
+				if feeValue != nil {
+					totalValue.Add(totalValue, feeValue)
+				}
+				postings[0].value = totalValue
+			}
+			if e.kind == entrySend {
+				if hasValues {
+					postings = append(postings, posting{account: d.external, value: value})
+				} else {
+					postings = append(postings, posting{account: d.external, amount: e.amount, unit: e.unit})
+				}
+			}
+			if e.fee != nil {
+				if hasValues {
+					postings = append(postings, posting{account: d.fees, value: feeValue})
+				} else {
+					postings = append(postings, posting{
+						account: d.fees, amount: e.fee, unit: e.feeUnit, isFee: true})
+				}
+			}
+		}
+		builder.WriteString(d.header(e.time.Format("2006-01-02"), description) + "\n")
+		builder.WriteString(d.indent + d.metadata("txid", e.tx.TxID) + "\n")
+		if len(inputs) > 1 {
+			builder.WriteString(d.indent + d.metadata("account", e.input.Account.Config().Config.Name) + "\n")
+		}
+		if e.note != "" {
+			builder.WriteString(d.indent + d.metadata("note", e.note) + "\n")
+		}
+		for _, p := range postings {
+			builder.WriteString(formatPosting(e, p) + "\n")
+		}
+		builder.WriteString("\n")
+	}
+	_, err := io.WriteString(w, builder.String())
+	return errp.WithStack(err)
+}
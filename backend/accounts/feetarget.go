@@ -15,6 +15,8 @@
 package accounts
 
 import (
+	"strings"
+
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 )
 
@@ -40,6 +42,9 @@ func NewFeeTargetCode(code string) (FeeTargetCode, error) {
 	case string(FeeTargetCodeHigh):
 	case string(FeeTargetCodeCustom):
 	default:
+		if strings.HasPrefix(code, feeTargetCodePresetPrefix) && len(code) > len(feeTargetCodePresetPrefix) {
+			break
+		}
 		return "", errp.WithStack(errp.Newf("Unrecognized fee target code %s", code))
 	}
 	return FeeTargetCode(code), nil
@@ -62,6 +67,14 @@ const (
 	// estimated automatically.
 	FeeTargetCodeCustom FeeTargetCode = "custom"
 
+	// feeTargetCodePresetPrefix prefixes the codes of user-defined fee presets.
+	feeTargetCodePresetPrefix = "preset:"
+
 	// DefaultFeeTarget is the default fee target.
 	DefaultFeeTarget = FeeTargetCodeNormal
 )
+
+// NewPresetFeeTargetCode returns the code of the user-defined fee preset with the given name.
+func NewPresetFeeTargetCode(name string) FeeTargetCode {
+	return FeeTargetCode(feeTargetCodePresetPrefix + name)
+}
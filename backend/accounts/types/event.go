@@ -34,4 +34,9 @@ const (
 
 	// EventFeeTargetsChanged is fired when the fee targets change.
 	EventFeeTargetsChanged Event = "feeTargetsChanged"
+
+	// EventTransactionsReorged is fired when previously confirmed transactions were found to be in
+	// a block that was orphaned by a reorg. They are pending again until they are confirmed in the
+	// new chain.
+	EventTransactionsReorged Event = "transactionsReorged"
 )
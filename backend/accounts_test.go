@@ -890,6 +890,7 @@ func TestCreateAndAddAccount(t *testing.T) {
 	require.Equal(t, accountsTypes.Code("test-btc-account-code"), acct.Config().Config.Code)
 	require.Equal(t, coin, acct.Coin())
 	require.Equal(t, "Bitcoin account name", acct.Config().Config.Name)
+	require.Equal(t, b.Config().AppConfig().Backend.MainFiat, acct.Config().GetMainFiat())
 
 	// Add a Litecoin account.
 	coin, err = b.Coin(coinpkg.CodeLTC)
@@ -1029,7 +1030,7 @@ func TestAccountSupported(t *testing.T) {
 	require.Len(t, b.Accounts(), 3)
 	require.Len(t, b.Config().AccountsConfig().Accounts, 3)
 
-	b.DeregisterKeystore()
+	b.DeregisterKeystores()
 	// Registering a Bitcoin-only like keystore loads only the Bitcoin account, even though altcoins
 	// were persisted previously.
 	b.registerKeystore(bb02BtcOnly)
@@ -1098,7 +1099,7 @@ func TestInactiveAccount(t *testing.T) {
 
 	// Re-registering the keystore (i.e. replugging the device) ends in the same state: no
 	// additional accounts created.
-	b.DeregisterKeystore()
+	b.DeregisterKeystores()
 	b.registerKeystore(bitbox02LikeKeystore)
 	require.Len(t, b.Accounts(), 5)
 	require.Len(t, b.Config().AccountsConfig().Accounts, 3)
@@ -1184,7 +1185,7 @@ func TestTaprootUpgrade(t *testing.T) {
 		b.Config().AccountsConfig().Lookup("v0-55555555-btc-0").SigningConfigurations)
 
 	// "Unplug", then insert an updated keystore with taproot support.
-	b.DeregisterKeystore()
+	b.DeregisterKeystores()
 	b.registerKeystore(bitbox02Taproot)
 	require.Len(t, b.Accounts(), 3)
 	require.Len(t, b.Config().AccountsConfig().Accounts, 3)
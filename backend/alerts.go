@@ -0,0 +1,82 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/alerts"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+)
+
+// alertAccounts returns the balances of all active and synced accounts.
+func (backend *Backend) alertAccounts() []*alerts.Account {
+	result := []*alerts.Account{}
+	for _, account := range backend.Accounts() {
+		if account.Config().Config.Inactive || account.FatalError() || !account.Synced() {
+			continue
+		}
+		balance, err := account.Balance()
+		if err != nil {
+			backend.log.WithError(err).Error("could not get balance for alerts")
+			continue
+		}
+		accountCoin := account.Coin()
+		result = append(result, &alerts.Account{
+			Code:     account.Config().Config.Code,
+			Name:     account.Config().Config.Name,
+			CoinCode: string(accountCoin.Code()),
+			Unit:     accountCoin.Unit(false),
+			Balance: new(big.Rat).SetFrac(
+				balance.Available().BigInt(),
+				new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(accountCoin.Decimals(false))), nil),
+			),
+			FormattedBalance: accountCoin.FormatAmount(balance.Available(), false),
+		})
+	}
+	return result
+}
+
+// evaluateAlerts evaluates the alerts of the app config and notifies the user of the ones which
+// triggered, with a notification and an "alerts/triggered" event.
+func (backend *Backend) evaluateAlerts() {
+	backendConfig := backend.Config().AppConfig().Backend
+	if len(backendConfig.Alerts) == 0 {
+		return
+	}
+	triggered := backend.alerts.Evaluate(
+		backendConfig.Alerts,
+		backend.alertAccounts(),
+		backend.RatesUpdater(),
+		backendConfig.MainFiat,
+		time.Now(),
+	)
+	for _, alert := range triggered {
+		backend.log.Infof("alert %s triggered", alert.Alert.ID)
+		backend.NotifyUser(alert.Message)
+		backend.Notify(observable.Event{
+			Subject: "alerts/triggered",
+			Action:  action.Replace,
+			Object:  alert,
+		})
+	}
+}
+
+// AlertsStatus returns the alerts of the app config and whether they are triggered.
+func (backend *Backend) AlertsStatus() []*alerts.Status {
+	return backend.alerts.Status(backend.Config().AppConfig().Backend.Alerts)
+}
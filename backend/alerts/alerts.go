@@ -0,0 +1,353 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package alerts evaluates the user-defined price and balance alerts, see `config.Alert`.
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// portfolioChangePeriod is the period over which the portfolio value change is computed.
+const portfolioChangePeriod = 24 * time.Hour
+
+// Rates provides the exchange rates needed to evaluate the alerts. It is implemented by
+// `rates.RateUpdater`.
+type Rates interface {
+	// HistoricalPriceAt returns the price of the coin at the given time, or 0 if not available.
+	HistoricalPriceAt(coinCode, fiat string, at time.Time) float64
+	// LatestPriceForPair returns the latest price for the coin unit.
+	LatestPriceForPair(coinUnit, fiat string) (float64, error)
+}
+
+// Account is the balance of one account.
+type Account struct {
+	Code accountsTypes.Code
+	Name string
+	// CoinCode is the code of the coin as used for the historical rates, e.g. "btc".
+	CoinCode string
+	// Unit is the unit of the coin as used for the latest rates, e.g. "BTC".
+	Unit string
+	// Balance is the available balance in Unit.
+	Balance *big.Rat
+	// FormattedBalance is the balance formatted for the user.
+	FormattedBalance string
+}
+
+// Triggered is an alert whose condition became true.
+type Triggered struct {
+	Alert config.Alert `json:"alert"`
+	// Value is the price, the change in percent or the balance which triggered the alert.
+	Value float64 `json:"value"`
+	// Message describes the alert for the user.
+	Message string `json:"message"`
+}
+
+// Status is the state of an alert as of the last evaluation.
+type Status struct {
+	Alert config.Alert `json:"alert"`
+	// Triggered is true while the condition is true. The user is notified again only after the
+	// condition became false in the meantime.
+	Triggered bool `json:"triggered"`
+	// Value is the current value compared to the threshold. It is nil if it is not available,
+	// e.g. before the exchange rates are fetched.
+	Value *float64 `json:"value"`
+}
+
+// Validate checks that the alerts are complete and that their IDs are unique. isSupportedFiat
+// reports whether a fiat can be used.
+func Validate(alerts []config.Alert, isSupportedFiat func(string) bool) error {
+	ids := map[string]bool{}
+	for _, alert := range alerts {
+		if alert.ID == "" {
+			return errp.New("alert without ID")
+		}
+		if ids[alert.ID] {
+			return errp.Newf("duplicate alert ID %q", alert.ID)
+		}
+		ids[alert.ID] = true
+		threshold, ok := new(big.Rat).SetString(alert.Threshold)
+		if !ok || threshold.Sign() <= 0 {
+			return errp.Newf("alert %q: invalid threshold %q", alert.ID, alert.Threshold)
+		}
+		if alert.Fiat != "" && !isSupportedFiat(alert.Fiat) {
+			return errp.Newf("alert %q: unsupported fiat %q", alert.ID, alert.Fiat)
+		}
+		switch alert.Type {
+		case config.AlertTypePrice:
+			if alert.Coin == "" {
+				return errp.Newf("alert %q: coin missing", alert.ID)
+			}
+			if alert.Above == nil {
+				return errp.Newf("alert %q: direction missing", alert.ID)
+			}
+		case config.AlertTypePortfolioChange:
+		case config.AlertTypeBalanceBelow:
+			if alert.Account == "" {
+				return errp.Newf("alert %q: account missing", alert.ID)
+			}
+		default:
+			return errp.Newf("alert %q: unknown type %q", alert.ID, alert.Type)
+		}
+	}
+	return nil
+}
+
+type alertState struct {
+	alert     config.Alert
+	triggered bool
+	value     *float64
+}
+
+// persistedState is the part of alertState which is persisted, so that alerts which are still
+// triggered are not notified again after a restart.
+type persistedState struct {
+	Alert     config.Alert `json:"alert"`
+	Triggered bool         `json:"triggered"`
+}
+
+// Evaluator evaluates alerts and remembers which ones are triggered, so that the user is notified
+// only once each time a condition becomes true. It is safe for concurrent use.
+type Evaluator struct {
+	mu sync.Mutex
+	// states are keyed by alert ID.
+	states map[string]*alertState
+	// filename is the file the triggered states are persisted to. Empty if not persisted.
+	filename string
+	// persisted is what was last read from or written to filename.
+	persisted map[string]persistedState
+
+	log *logrus.Entry
+}
+
+// NewEvaluator returns a new Evaluator. The triggered states are persisted in the given file and
+// restored from it, unless filename is empty.
+func NewEvaluator(filename string) *Evaluator {
+	evaluator := &Evaluator{
+		states:    map[string]*alertState{},
+		filename:  filename,
+		persisted: map[string]persistedState{},
+		log:       logging.Get().WithGroup("alerts"),
+	}
+	if filename == "" {
+		return evaluator
+	}
+	jsonBytes, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return evaluator
+	}
+	if err == nil {
+		err = json.Unmarshal(jsonBytes, &evaluator.persisted)
+	}
+	if err != nil {
+		evaluator.log.WithError(err).Error("Could not read the alerts state")
+		evaluator.persisted = map[string]persistedState{}
+		return evaluator
+	}
+	for id, persisted := range evaluator.persisted {
+		evaluator.states[id] = &alertState{alert: persisted.Alert, triggered: persisted.Triggered}
+	}
+	return evaluator
+}
+
+// persist writes the triggered states if they changed. The caller must hold mu.
+func (evaluator *Evaluator) persist() {
+	if evaluator.filename == "" {
+		return
+	}
+	persisted := make(map[string]persistedState, len(evaluator.states))
+	for id, state := range evaluator.states {
+		persisted[id] = persistedState{Alert: state.alert, Triggered: state.triggered}
+	}
+	if reflect.DeepEqual(persisted, evaluator.persisted) {
+		return
+	}
+	jsonBytes, err := json.Marshal(persisted)
+	if err != nil {
+		evaluator.log.WithError(err).Error("Could not serialize the alerts state")
+		return
+	}
+	if err := os.WriteFile(evaluator.filename, jsonBytes, 0600); err != nil {
+		evaluator.log.WithError(err).Error("Could not write the alerts state")
+		return
+	}
+	evaluator.persisted = persisted
+}
+
+// Evaluate evaluates the enabled alerts and returns those whose condition became true since the
+// last evaluation. Alerts whose value is not available keep their state. The state of alerts
+// which were changed since the last evaluation is reset.
+func (evaluator *Evaluator) Evaluate(
+	alerts []config.Alert,
+	accounts []*Account,
+	rates Rates,
+	mainFiat string,
+	now time.Time,
+) []*Triggered {
+	evaluator.mu.Lock()
+	defer evaluator.mu.Unlock()
+	states := make(map[string]*alertState, len(alerts))
+	triggered := []*Triggered{}
+	for _, alert := range alerts {
+		state, ok := evaluator.states[alert.ID]
+		if !ok || !reflect.DeepEqual(state.alert, alert) {
+			state = &alertState{alert: alert}
+		}
+		states[alert.ID] = state
+		if alert.Disabled {
+			state.triggered = false
+			state.value = nil
+			continue
+		}
+		threshold, ok := new(big.Rat).SetString(alert.Threshold)
+		if !ok {
+			continue
+		}
+		thresholdFloat, _ := threshold.Float64()
+		fiat := alert.Fiat
+		if fiat == "" {
+			fiat = mainFiat
+		}
+		value, message, ok := evaluate(alert, thresholdFloat, accounts, rates, fiat, now)
+		if !ok {
+			state.value = nil
+			continue
+		}
+		state.value = &value
+		if message == "" {
+			state.triggered = false
+			continue
+		}
+		if !state.triggered {
+			triggered = append(triggered, &Triggered{Alert: alert, Value: value, Message: message})
+		}
+		state.triggered = true
+	}
+	evaluator.states = states
+	evaluator.persist()
+	return triggered
+}
+
+// Status returns the state of the alerts as of the last evaluation.
+func (evaluator *Evaluator) Status(alerts []config.Alert) []*Status {
+	evaluator.mu.Lock()
+	defer evaluator.mu.Unlock()
+	result := make([]*Status, len(alerts))
+	for i, alert := range alerts {
+		result[i] = &Status{Alert: alert}
+		if state, ok := evaluator.states[alert.ID]; ok && reflect.DeepEqual(state.alert, alert) {
+			result[i].Triggered = state.triggered
+			result[i].Value = state.value
+		}
+	}
+	return result
+}
+
+// evaluate returns the current value of the alert and, if the condition is true, the message to
+// the user. ok is false if the value is not available.
+func evaluate(
+	alert config.Alert,
+	threshold float64,
+	accounts []*Account,
+	rates Rates,
+	fiat string,
+	now time.Time,
+) (value float64, message string, ok bool) {
+	formatFiat := func(value float64) string {
+		return coin.FormatAsCurrency(new(big.Rat).SetFloat64(value), fiat, false)
+	}
+	switch alert.Type {
+	case config.AlertTypePrice:
+		price, err := rates.LatestPriceForPair(alert.Coin, fiat)
+		if err != nil || price == 0 {
+			return 0, "", false
+		}
+		switch {
+		case *alert.Above && price >= threshold:
+			message = fmt.Sprintf("%s rose above %s %s: %s %s",
+				alert.Coin, formatFiat(threshold), fiat, formatFiat(price), fiat)
+		case !*alert.Above && price <= threshold:
+			message = fmt.Sprintf("%s fell below %s %s: %s %s",
+				alert.Coin, formatFiat(threshold), fiat, formatFiat(price), fiat)
+		}
+		return price, message, true
+	case config.AlertTypePortfolioChange:
+		change, total, ok := portfolioChange(accounts, rates, fiat, now)
+		if !ok {
+			return 0, "", false
+		}
+		rose := change >= threshold && (alert.Above == nil || *alert.Above)
+		fell := change <= -threshold && (alert.Above == nil || !*alert.Above)
+		if rose || fell {
+			message = fmt.Sprintf("Your portfolio changed by %+.2f%% in the last 24 hours: %s %s",
+				change, formatFiat(total), fiat)
+		}
+		return change, message, true
+	case config.AlertTypeBalanceBelow:
+		for _, account := range accounts {
+			if account.Code != alert.Account {
+				continue
+			}
+			balance, _ := account.Balance.Float64()
+			if balance < threshold {
+				message = fmt.Sprintf("The balance of %s fell below %s %s: %s %s",
+					account.Name, alert.Threshold, account.Unit, account.FormattedBalance, account.Unit)
+			}
+			return balance, message, true
+		}
+	}
+	return 0, "", false
+}
+
+// portfolioChange returns the change in percent of the fiat value of the current balances over
+// portfolioChangePeriod, and the current total fiat value. Only price changes count, as the
+// current balances are valued at both times. ok is false if a needed rate is not available.
+func portfolioChange(accounts []*Account, rates Rates, fiat string, now time.Time) (
+	change float64, total float64, ok bool) {
+	var before float64
+	for _, account := range accounts {
+		if account.Balance.Sign() == 0 {
+			continue
+		}
+		balance, _ := account.Balance.Float64()
+		price, err := rates.LatestPriceForPair(account.Unit, fiat)
+		if err != nil || price == 0 {
+			return 0, 0, false
+		}
+		priceBefore := rates.HistoricalPriceAt(account.CoinCode, fiat, now.Add(-portfolioChangePeriod))
+		if priceBefore == 0 {
+			return 0, 0, false
+		}
+		total += balance * price
+		before += balance * priceBefore
+	}
+	if before == 0 || math.IsInf(total, 0) {
+		return 0, 0, false
+	}
+	return (total - before) / before * 100, total, true
+}
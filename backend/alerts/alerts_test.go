@@ -0,0 +1,163 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerts
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRates struct {
+	latest     map[string]float64
+	historical map[string]float64
+}
+
+func (rates *mockRates) HistoricalPriceAt(coinCode, fiat string, at time.Time) float64 {
+	return rates.historical[coinCode+fiat]
+}
+
+func (rates *mockRates) LatestPriceForPair(coinUnit, fiat string) (float64, error) {
+	return rates.latest[coinUnit+fiat], nil
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestValidate(t *testing.T) {
+	supported := func(fiat string) bool { return fiat == "USD" || fiat == "EUR" }
+	valid := []config.Alert{
+		{ID: "1", Type: config.AlertTypePrice, Coin: "BTC", Above: boolPtr(true), Threshold: "30000"},
+		{ID: "2", Type: config.AlertTypePortfolioChange, Fiat: "EUR", Threshold: "5.5"},
+		{ID: "3", Type: config.AlertTypeBalanceBelow, Account: "v0-55555555-btc-0", Threshold: "0.01"},
+	}
+	require.NoError(t, Validate(valid, supported))
+	require.NoError(t, Validate(nil, supported))
+
+	for _, alert := range []config.Alert{
+		{Type: config.AlertTypePortfolioChange, Threshold: "5"},
+		{ID: "1", Type: config.AlertTypePortfolioChange, Threshold: "-5"},
+		{ID: "1", Type: config.AlertTypePortfolioChange, Threshold: "abc"},
+		{ID: "1", Type: config.AlertTypePortfolioChange, Threshold: "5", Fiat: "XYZ"},
+		{ID: "1", Type: config.AlertTypePrice, Above: boolPtr(true), Threshold: "5"},
+		{ID: "1", Type: config.AlertTypePrice, Coin: "BTC", Threshold: "5"},
+		{ID: "1", Type: config.AlertTypeBalanceBelow, Threshold: "5"},
+		{ID: "1", Type: "unknown", Threshold: "5"},
+	} {
+		require.Error(t, Validate([]config.Alert{alert}, supported), alert)
+	}
+	require.Error(t, Validate(append(valid, valid[0]), supported))
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	rates := &mockRates{
+		latest:     map[string]float64{"BTCUSD": 29000, "ETHUSD": 2000, "BTCEUR": 27000},
+		historical: map[string]float64{"btcUSD": 30000, "ethUSD": 2000},
+	}
+	accounts := []*Account{
+		{Code: "btc-0", Name: "Bitcoin", CoinCode: "btc", Unit: "BTC", Balance: big.NewRat(1, 1), FormattedBalance: "1.00000000"},
+		{Code: "eth-0", Name: "Ethereum", CoinCode: "eth", Unit: "ETH", Balance: big.NewRat(1, 10), FormattedBalance: "0.1"},
+	}
+	alertsConfig := []config.Alert{
+		{ID: "above", Type: config.AlertTypePrice, Coin: "BTC", Above: boolPtr(true), Threshold: "30000"},
+		{ID: "below", Type: config.AlertTypePrice, Coin: "BTC", Fiat: "EUR", Above: boolPtr(false), Threshold: "28000"},
+		{ID: "change", Type: config.AlertTypePortfolioChange, Threshold: "3"},
+		{ID: "rise", Type: config.AlertTypePortfolioChange, Above: boolPtr(true), Threshold: "3"},
+		{ID: "balance", Type: config.AlertTypeBalanceBelow, Account: "eth-0", Threshold: "0.5"},
+		{ID: "disabled", Type: config.AlertTypeBalanceBelow, Account: "eth-0", Threshold: "0.5", Disabled: true},
+		{ID: "unknownAccount", Type: config.AlertTypeBalanceBelow, Account: "ltc-0", Threshold: "0.5"},
+	}
+	evaluator := NewEvaluator("")
+	triggered := evaluator.Evaluate(alertsConfig, accounts, rates, "USD", now)
+	ids := []string{}
+	for _, alert := range triggered {
+		ids = append(ids, alert.Alert.ID)
+	}
+	require.Equal(t, []string{"below", "change", "balance"}, ids)
+	require.Equal(t, "BTC fell below 28'000.00 EUR: 27'000.00 EUR", triggered[0].Message)
+	// (29000 + 200) / (30000 + 200) - 1
+	require.InDelta(t, -3.311, triggered[1].Value, 0.001)
+	require.Equal(t, "Your portfolio changed by -3.31% in the last 24 hours: 29'200.00 USD", triggered[1].Message)
+	require.Equal(t, "The balance of Ethereum fell below 0.5 ETH: 0.1 ETH", triggered[2].Message)
+
+	// Notified only once while the condition stays true.
+	require.Empty(t, evaluator.Evaluate(alertsConfig, accounts, rates, "USD", now))
+
+	status := evaluator.Status(alertsConfig)
+	require.False(t, status[0].Triggered)
+	require.Equal(t, 29000., *status[0].Value)
+	require.True(t, status[1].Triggered)
+	require.False(t, status[5].Triggered)
+	require.Nil(t, status[5].Value)
+	require.Nil(t, status[6].Value)
+
+	// The condition becomes false and true again.
+	rates.latest["BTCUSD"] = 31000
+	rates.latest["BTCEUR"] = 29000
+	triggered = evaluator.Evaluate(alertsConfig, accounts, rates, "USD", now)
+	require.Len(t, triggered, 2)
+	require.Equal(t, "above", triggered[0].Alert.ID)
+	// The change alert stays triggered, as it triggers in both directions.
+	require.Equal(t, "rise", triggered[1].Alert.ID)
+	rates.latest["BTCEUR"] = 27000
+	triggered = evaluator.Evaluate(alertsConfig, accounts, rates, "USD", now)
+	require.Len(t, triggered, 1)
+	require.Equal(t, "below", triggered[0].Alert.ID)
+
+	// A changed alert is reset.
+	alertsConfig[4].Threshold = "0.2"
+	triggered = evaluator.Evaluate(alertsConfig, accounts, rates, "USD", now)
+	require.Len(t, triggered, 1)
+	require.Equal(t, "balance", triggered[0].Alert.ID)
+
+	// Missing rates keep the state.
+	rates.latest = map[string]float64{}
+	require.Empty(t, evaluator.Evaluate(alertsConfig, accounts, rates, "USD", now))
+	require.True(t, evaluator.Status(alertsConfig)[1].Triggered)
+	require.Nil(t, evaluator.Status(alertsConfig)[1].Value)
+}
+
+func TestEvaluatorPersisted(t *testing.T) {
+	filename := filepath.Join(test.TstTempDir("alerts"), "alerts.json")
+	rates := &mockRates{latest: map[string]float64{"BTCUSD": 31000}}
+	alertsConfig := []config.Alert{
+		{ID: "above", Type: config.AlertTypePrice, Coin: "BTC", Above: boolPtr(true), Threshold: "30000"},
+	}
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	require.Len(t, NewEvaluator(filename).Evaluate(alertsConfig, nil, rates, "USD", now), 1)
+
+	// Not notified again after a restart while the condition stays true.
+	evaluator := NewEvaluator(filename)
+	require.True(t, evaluator.Status(alertsConfig)[0].Triggered)
+	require.Empty(t, evaluator.Evaluate(alertsConfig, nil, rates, "USD", now))
+
+	// A changed alert is reset.
+	alertsConfig[0].Threshold = "30500"
+	require.Len(t, NewEvaluator(filename).Evaluate(alertsConfig, nil, rates, "USD", now), 1)
+
+	// The condition became false before the restart.
+	rates.latest["BTCUSD"] = 29000
+	require.Empty(t, NewEvaluator(filename).Evaluate(alertsConfig, nil, rates, "USD", now))
+	rates.latest["BTCUSD"] = 31000
+	require.Len(t, NewEvaluator(filename).Evaluate(alertsConfig, nil, rates, "USD", now), 1)
+}
@@ -146,7 +146,14 @@ func (backend *Backend) aoppKeystoreRegistered() {
 	if backend.aopp.State != aoppStateAwaitingKeystore {
 		return
 	}
-	if !backend.keystore.CanSignMessage(backend.aopp.coinCode) {
+	canSignMessage := false
+	for _, keystore := range backend.keystores.list() {
+		if keystore.CanSignMessage(backend.aopp.coinCode) {
+			canSignMessage = true
+			break
+		}
+	}
+	if !canSignMessage {
 		backend.aoppSetError(errAOPPUnsupportedKeystore)
 		return
 	}
@@ -159,6 +166,10 @@ func (backend *Backend) aoppKeystoreRegistered() {
 		if acct.Coin().Code() != backend.aopp.coinCode {
 			continue
 		}
+		// Only keystores which can sign messages can be used.
+		if acct.Config().Keystore == nil || !acct.Config().Keystore.CanSignMessage(backend.aopp.coinCode) {
+			continue
+		}
 		// Filter for the requested script type.
 		if acct.Coin().Code() == coinpkg.CodeBTC && backend.aopp.format != "any" {
 			expectedScriptType, ok := aoppBTCScriptTypeMap[backend.aopp.format]
@@ -256,7 +267,7 @@ func (backend *Backend) AOPPApprove() {
 		return
 	}
 	backend.aopp.State = aoppStateAwaitingKeystore
-	if backend.keystore == nil {
+	if len(backend.keystores.entries) == 0 {
 		backend.notifyAOPP()
 		return
 	}
@@ -324,7 +335,7 @@ func (backend *Backend) aoppChooseAccount(code accountsTypes.Code) {
 	var signature []byte
 	switch account.Coin().Code() {
 	case coinpkg.CodeBTC:
-		sig, err := backend.keystore.SignBTCMessage(
+		sig, err := account.Config().Keystore.SignBTCMessage(
 			[]byte(backend.aopp.Message),
 			addr.AbsoluteKeypath(),
 			account.Config().Config.SigningConfigurations[signingConfigIdx].ScriptType(),
@@ -341,7 +352,7 @@ func (backend *Backend) aoppChooseAccount(code accountsTypes.Code) {
 		}
 		signature = sig
 	case coinpkg.CodeETH:
-		sig, err := backend.keystore.SignETHMessage(
+		sig, err := account.Config().Keystore.SignETHMessage(
 			[]byte(backend.aopp.Message),
 			addr.AbsoluteKeypath(),
 		)
@@ -182,7 +182,7 @@ func TestAOPPSuccess(t *testing.T) {
 				ks,
 			)
 			require.NoError(t, err)
-			b.DeregisterKeystore()
+			b.DeregisterKeystores()
 
 			callback := server.URL
 			params := defaultParams()
@@ -298,7 +298,7 @@ func TestAOPPSuccess(t *testing.T) {
 		b.registerKeystore(makeKeystore(t, scriptTypeRef(signing.ScriptTypeP2WPKH), keystoreHelper.ExtendedPublicKey))
 		b.HandleURI("aopp:?" + params.Encode())
 		require.Equal(t, aoppStateUserApproval, b.AOPP().State)
-		b.DeregisterKeystore()
+		b.DeregisterKeystores()
 		b.AOPPApprove()
 		require.Equal(t, aoppStateAwaitingKeystore, b.AOPP().State)
 	})
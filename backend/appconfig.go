@@ -0,0 +1,50 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"reflect"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/alerts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+)
+
+// SetAppConfig validates and persists the app config. See `validateFiats()` for the fiats. If the
+// fiats changed, the historical exchange rates are reconfigured. If the alerts changed, they are
+// evaluated.
+func (backend *Backend) SetAppConfig(appConfig config.AppConfig) error {
+	oldBackendConfig := backend.config.AppConfig().Backend
+	isKnownFiat, err := backend.validateFiats(&oldBackendConfig, &appConfig.Backend)
+	if err != nil {
+		return err
+	}
+	if err := alerts.Validate(appConfig.Backend.Alerts, isKnownFiat); err != nil {
+		return err
+	}
+	if err := validateTxNotifications(appConfig.Backend.TxNotifications.Confirmations); err != nil {
+		return err
+	}
+	if err := backend.config.SetAppConfig(appConfig); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(oldBackendConfig.Alerts, appConfig.Backend.Alerts) {
+		go backend.evaluateAlerts()
+	}
+	if !reflect.DeepEqual(oldBackendConfig.FiatList, appConfig.Backend.FiatList) {
+		defer backend.accountsAndKeystoreLock.RLock()()
+		backend.configureHistoryExchangeRates()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAppConfigAlerts(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	appConfig := b.Config().AppConfig()
+	appConfig.Backend.Alerts = []config.Alert{
+		{ID: "1", Type: config.AlertTypePortfolioChange, Fiat: "NOTAFIAT", Threshold: "5"},
+	}
+	require.Error(t, b.SetAppConfig(appConfig))
+	appConfig.Backend.Alerts[0].Fiat = "CHF"
+	require.NoError(t, b.SetAppConfig(appConfig))
+	status := b.AlertsStatus()
+	require.Len(t, status, 1)
+	require.False(t, status[0].Triggered)
+}
+
+func TestSetAppConfigTxNotifications(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	appConfig := b.Config().AppConfig()
+	appConfig.Backend.TxNotifications.Confirmations = []int{1, 1}
+	require.Error(t, b.SetAppConfig(appConfig))
+	appConfig.Backend.TxNotifications.Confirmations = []int{6, 1}
+	require.NoError(t, b.SetAppConfig(appConfig))
+	require.Equal(t, []int{6, 1}, b.Config().AppConfig().Backend.TxNotifications.Confirmations)
+}
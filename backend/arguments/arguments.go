@@ -42,6 +42,9 @@ type Arguments struct {
 	// accountsConfigFilename stores the filename of the accounts configuration.
 	accountsConfigFilename string
 
+	// externalSignersFile stores the filename of the external signers configuration.
+	externalSignersFile string
+
 	// Testing stores whether the application is for testing only.
 	testing bool
 
@@ -97,6 +100,7 @@ func NewArguments(
 		notesDirectoryPath:     notesDirectoryPath,
 		appConfigFilename:      path.Join(mainDirectoryPath, "config.json"),
 		accountsConfigFilename: path.Join(mainDirectoryPath, "accounts.json"),
+		externalSignersFile:    path.Join(mainDirectoryPath, "externalsigners.json"),
 		testing:                testing,
 		regtest:                regtest,
 		devservers:             devservers,
@@ -124,6 +128,12 @@ func (arguments *Arguments) AccountsConfigFilename() string {
 	return arguments.accountsConfigFilename
 }
 
+// ExternalSignersFilename returns the path to the external signers configuration file, see
+// config.ReadExternalSigners().
+func (arguments *Arguments) ExternalSignersFilename() string {
+	return arguments.externalSignersFile
+}
+
 // BitBox02DirectoryPath returns the path where BitBox data is stored.
 // The above constructor ensures that the directory with the returned path exists.
 func (arguments *Arguments) BitBox02DirectoryPath() string {
@@ -16,33 +16,41 @@
 package backend
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
 	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/alerts"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/arguments"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/banners"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/etherscan"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox02"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/device"
 	deviceevent "github.com/digitalbitbox/bitbox-wallet-app/backend/devices/device/event"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/inventory"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/usb"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/paymentrequests"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/rates"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
@@ -156,14 +164,35 @@ type Backend struct {
 	events chan interface{}
 
 	notifier *Notifier
+	// paymentRequests persists the payment requests of all accounts.
+	paymentRequests *paymentrequests.Store
+	// paymentRequestsMu serializes the updates of the payment requests, so that concurrent
+	// updates are not lost and no address is reserved by two requests.
+	paymentRequestsMu sync.Mutex
+	// deviceInventory records all devices ever connected.
+	deviceInventory *inventory.Store
+	// deviceInventoryIDs maps the IDs of the registered devices to their stable ID in the device
+	// inventory, once it is known and the connection was recorded.
+	deviceInventoryIDs   map[string]string
+	deviceInventoryIDsMu sync.Mutex
 
 	devices map[string]device.Interface
 
 	accountsAndKeystoreLock locker.Locker
 	accounts                accountsList
-	// keystore is nil if no keystore is connected.
-	keystore keystore.Keystore
-	aopp     AOPP
+	// keystores are the registered keystores. The accounts of all of them are loaded.
+	keystores keystores
+	// deviceKeystores maps device IDs to the root fingerprint of the keystore registered by the
+	// device.
+	deviceKeystores map[string][]byte
+	// testKeystores are the keystores registered with RegisterTestKeystore().
+	testKeystores []*registeredKeystore
+	// softwareKeystores are the stored software keystores, keyed by the hex encoded root
+	// fingerprint. They are registered while they are locked, too.
+	softwareKeystores map[string]*software.EncryptedKeystore
+	// externalSigners are the connected external signers, keyed by their configured name.
+	externalSigners map[string]*connectedExternalSigner
+	aopp            AOPP
 
 	// makeBtcAccount creates a BTC account. In production this is `btc.NewAccount`, but can be
 	// overridden in unit tests for mocking.
@@ -184,10 +213,14 @@ type Backend struct {
 
 	socksProxy socksproxy.SocksProxy
 	// can be a regular or, if Tor is enabled in the config, a SOCKS5 proxy client.
-	httpClient          *http.Client
-	etherScanHTTPClient *http.Client
-	ratesUpdater        *rates.RateUpdater
-	banners             *banners.Banners
+	httpClient *http.Client
+	// etherScanLimiter rate limits the requests to Etherscan, which are made over a separate
+	// circuit per coin if Tor is enabled.
+	etherScanLimiter *ratelimit.LimitedCall
+	ratesUpdater     *rates.RateUpdater
+	banners          *banners.Banners
+	// alerts evaluates the user-defined alerts of the app config.
+	alerts *alerts.Evaluator
 
 	// For unit tests, called when `backend.checkAccountUsed()` is called.
 	tstCheckAccountUsed func(accounts.Interface) bool
@@ -208,10 +241,14 @@ func NewBackend(arguments *arguments.Arguments, environment Environment) (*Backe
 		config:      config,
 		events:      make(chan interface{}, 1000),
 
-		devices:  map[string]device.Interface{},
-		coins:    map[coinpkg.Code]coinpkg.Coin{},
-		accounts: []accounts.Interface{},
-		aopp:     AOPP{State: aoppStateInactive},
+		devices:           map[string]device.Interface{},
+		deviceKeystores:   map[string][]byte{},
+		softwareKeystores: map[string]*software.EncryptedKeystore{},
+		externalSigners:   map[string]*connectedExternalSigner{},
+		coins:             map[coinpkg.Code]coinpkg.Coin{},
+		accounts:          []accounts.Interface{},
+		aopp:              AOPP{State: aoppStateInactive},
+		alerts:            alerts.NewEvaluator(filepath.Join(arguments.MainDirectoryPath(), "alerts.json")),
 
 		makeBtcAccount: func(config *accounts.AccountConfig, coin *btc.Coin, gapLimits *types.GapLimits, log *logrus.Entry) accounts.Interface {
 			return btc.NewAccount(config, coin, gapLimits, log)
@@ -227,23 +264,73 @@ func NewBackend(arguments *arguments.Arguments, environment Environment) (*Backe
 		return nil, err
 	}
 	backend.notifier = notifier
+	paymentRequests, err := paymentrequests.NewStore(
+		filepath.Join(arguments.MainDirectoryPath(), "paymentrequests.db"))
+	if err != nil {
+		return nil, err
+	}
+	backend.paymentRequests = paymentRequests
+	deviceInventory, err := inventory.NewStore(
+		filepath.Join(arguments.MainDirectoryPath(), "deviceinventory.db"))
+	if err != nil {
+		return nil, err
+	}
+	backend.deviceInventory = deviceInventory
+	backend.deviceInventoryIDs = map[string]string{}
+	proxyConfig := backend.config.AppConfig().Backend.Proxy
 	backend.socksProxy = socksproxy.NewSocksProxy(
-		backend.config.AppConfig().Backend.Proxy.UseProxy,
-		backend.config.AppConfig().Backend.Proxy.ProxyAddress,
-	)
+		proxyConfig.UseProxy,
+		proxyConfig.ProxyAddress,
+	).WithTorOnly(proxyConfig.TorOnly)
+	if err := backend.socksProxy.CheckClearnet(); err != nil {
+		log.WithError(err).Error("Tor-only mode is enabled, but the proxy is disabled")
+	}
 	hclient, err := backend.socksProxy.GetHTTPClient()
 	if err != nil {
 		return nil, err
 	}
 	backend.httpClient = hclient
-	backend.etherScanHTTPClient = ratelimit.FromTransport(hclient.Transport, etherscan.CallInterval)
+	backend.etherScanLimiter = ratelimit.NewLimitedCall(etherscan.CallInterval)
 
 	ratesCache := filepath.Join(arguments.CacheDirectoryPath(), "exchangerates")
 	if err := os.MkdirAll(ratesCache, 0700); err != nil {
 		log.Errorf("RateUpdater DB cache dir: %v", err)
 	}
-	backend.ratesUpdater = rates.NewRateUpdater(hclient, ratesCache)
+	ratesProxy := backend.socksProxy.Isolated("rates")
+	ratesClient, err := ratesProxy.GetHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	backend.ratesUpdater = rates.NewRateUpdater(ratesClient, ratesCache)
+	onionRatesURL := ""
+	if ratesProxy.UsesTor() {
+		onionRatesURL = proxyConfig.OnionRatesURL
+	}
+	providers := []rates.Provider{}
+	for _, providerConfig := range backend.config.AppConfig().Backend.RatesProviders {
+		url := providerConfig.URL
+		// The onion URL only replaces the default CoinGecko API, not a URL set by the user.
+		if url == "" && providerConfig.Name == rates.ProviderCoinGecko {
+			url = onionRatesURL
+		}
+		provider, err := rates.NewProvider(providerConfig.Name, url, ratesClient)
+		if err != nil {
+			log.WithError(err).Error("Ignoring rates provider")
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	if len(providers) != 0 {
+		backend.ratesUpdater.SetProviders(providers...)
+	} else if onionRatesURL != "" {
+		backend.ratesUpdater.SetCoingeckoURL(onionRatesURL)
+	}
 	backend.ratesUpdater.Observe(backend.Notify)
+	backend.ratesUpdater.Observe(func(event observable.Event) {
+		if event.Subject == rates.RatesEventSubject {
+			go backend.evaluateAlerts()
+		}
+	})
 
 	backend.banners = banners.NewBanners()
 	backend.banners.Observe(backend.Notify)
@@ -276,15 +363,23 @@ func (backend *Backend) notifyNewTxs(account accounts.Interface) {
 		return
 	}
 	if unnotifiedCount != 0 {
-		backend.events <- backendEvent{Type: "backend", Data: "newTxs", Meta: map[string]interface{}{
-			"count":       unnotifiedCount,
-			"accountName": account.Config().Config.Name,
-		}}
+		// With per-transaction notifications, new transactions are notified in
+		// notifyTxProgress instead.
+		if !account.Config().Config.NotificationsMuted &&
+			!backend.Config().AppConfig().Backend.TxNotifications.PerTransaction {
+			backend.events <- backendEvent{Type: "backend", Data: "newTxs", Meta: map[string]interface{}{
+				"count":       unnotifiedCount,
+				"accountName": account.Config().Config.Name,
+			}}
+		}
 
 		if err := notifier.MarkAllNotified(); err != nil {
 			backend.log.WithError(err).Error("error marking notified")
 		}
 	}
+	// Run asynchronously, as getting the transactions waits for the account to be synced, and this
+	// is called at the end of the sync.
+	go backend.notifyTxProgress(account)
 }
 
 // Config returns the app config.
@@ -356,6 +451,112 @@ func (backend *Backend) defaultElectrumXServers(code coinpkg.Code) []*config.Ser
 	return backend.defaultProdServers(code)
 }
 
+// onionElectrumXServers returns the configured onion servers of the coin.
+func (backend *Backend) onionElectrumXServers(code coinpkg.Code) []*config.ServerInfo {
+	if backend.arguments.DevServers() {
+		return nil
+	}
+	appConfig := backend.config.AppConfig().Backend
+	switch code {
+	case coinpkg.CodeBTC:
+		return appConfig.BTC.OnionElectrumServers
+	case coinpkg.CodeTBTC:
+		return appConfig.TBTC.OnionElectrumServers
+	case coinpkg.CodeRBTC:
+		return appConfig.RBTC.OnionElectrumServers
+	case coinpkg.CodeLTC:
+		return appConfig.LTC.OnionElectrumServers
+	case coinpkg.CodeTLTC:
+		return appConfig.TLTC.OnionElectrumServers
+	default:
+		panic(errp.Newf("The given code %s is unknown.", code))
+	}
+}
+
+// feeEstimationConfig returns the fee estimation configuration of the given btc-based coin.
+func (backend *Backend) feeEstimationConfig(code coinpkg.Code) config.FeeEstimation {
+	appConfig := backend.config.AppConfig().Backend
+	switch code {
+	case coinpkg.CodeBTC:
+		return appConfig.BTC.FeeEstimation
+	case coinpkg.CodeTBTC:
+		return appConfig.TBTC.FeeEstimation
+	case coinpkg.CodeRBTC:
+		return appConfig.RBTC.FeeEstimation
+	case coinpkg.CodeLTC:
+		return appConfig.LTC.FeeEstimation
+	case coinpkg.CodeTLTC:
+		return appConfig.TLTC.FeeEstimation
+	default:
+		panic(errp.Newf("The given code %s is unknown.", code))
+	}
+}
+
+// configureFeeEstimation sets up the fee presets and fee estimation sources of the coin.
+func (backend *Backend) configureFeeEstimation(coin *btc.Coin) {
+	feeEstimation := backend.feeEstimationConfig(coin.Code())
+	var mempoolSpace *feeestimate.MempoolSpace
+	if feeEstimation.MempoolAPIURL != "" {
+		socksProxy := backend.socksProxy.Isolated("mempool-" + string(coin.Code()))
+		httpClient, err := socksProxy.GetHTTPClient()
+		if err != nil {
+			backend.log.WithError(err).Error("Could not create the mempool API HTTP client")
+		} else {
+			mempoolSpace = feeestimate.NewMempoolSpace(feeEstimation.MempoolAPIURL, httpClient)
+		}
+	}
+	coin.SetFeeEstimation(feeEstimation.Presets, mempoolSpace)
+}
+
+// electrumXServers returns the servers to connect to. If Tor is enabled, the onion servers are
+// tried first. The clearnet servers serve as a fallback, except in Tor-only mode if there is at
+// least one onion server.
+func (backend *Backend) electrumXServers(code coinpkg.Code) []*config.ServerInfo {
+	servers := backend.defaultElectrumXServers(code)
+	if !backend.socksProxy.UsesTor() {
+		return servers
+	}
+	onionServers := []*config.ServerInfo{}
+	clearnetServers := []*config.ServerInfo{}
+	for _, server := range append(backend.onionElectrumXServers(code), servers...) {
+		if socksproxy.IsOnion(server.Server) {
+			onionServers = append(onionServers, server)
+		} else {
+			clearnetServers = append(clearnetServers, server)
+		}
+	}
+	if len(onionServers) == 0 {
+		return clearnetServers
+	}
+	if backend.socksProxy.TorOnly() {
+		return onionServers
+	}
+	return append(onionServers, clearnetServers...)
+}
+
+// etherScanHTTPClient returns the client used to query Etherscan for the given coin. The
+// connections of each coin are isolated, but all share the same rate limit.
+func (backend *Backend) etherScanHTTPClient(code coinpkg.Code) *http.Client {
+	socksProxy := backend.socksProxy.Isolated("etherscan-" + string(code))
+	client, err := socksProxy.GetHTTPClient()
+	if err != nil {
+		backend.log.WithError(err).Error("Could not create the Etherscan HTTP client")
+	}
+	return ratelimit.WithLimiter(client.Transport, backend.etherScanLimiter)
+}
+
+// makeEtherScanAccountClient returns a function creating the Etherscan client of an account. The
+// requests are made using the account's own HTTP client, so that they can't be correlated with the
+// ones of other accounts, but share the rate limit of all Etherscan requests.
+func (backend *Backend) makeEtherScanAccountClient(
+	url string) func(*http.Client) (rpcclient.Interface, eth.TransactionsSource) {
+	return func(httpClient *http.Client) (rpcclient.Interface, eth.TransactionsSource) {
+		etherScan := etherscan.NewEtherScan(
+			url, ratelimit.WithLimiter(httpClient.Transport, backend.etherScanLimiter))
+		return etherScan, etherScan
+	}
+}
+
 // DevServers returns the value of the `devservers` flag.
 func (backend *Backend) DevServers() bool {
 	return backend.arguments.DevServers()
@@ -372,46 +573,51 @@ func (backend *Backend) Coin(code coinpkg.Code) (coinpkg.Coin, error) {
 
 	erc20Token := erc20TokenByCode(code)
 	btcFormatUnit := backend.config.AppConfig().Backend.BtcUnit
+	var etherScanURL string
 	switch {
 	case code == coinpkg.CodeRBTC:
-		servers := backend.defaultElectrumXServers(code)
-		coin = btc.NewCoin(coinpkg.CodeRBTC, "Bitcoin Regtest", "RBTC", coinpkg.BtcUnitDefault, &chaincfg.RegressionNetParams, dbFolder, servers, "", backend.socksProxy)
+		servers := backend.electrumXServers(code)
+		coin = btc.NewCoin(coinpkg.CodeRBTC, "Bitcoin Regtest", "RBTC", coinpkg.BtcUnitDefault, &chaincfg.RegressionNetParams, dbFolder, servers, "", backend.socksProxy.Isolated(string(code)))
 	case code == coinpkg.CodeTBTC:
-		servers := backend.defaultElectrumXServers(code)
+		servers := backend.electrumXServers(code)
 		coin = btc.NewCoin(coinpkg.CodeTBTC, "Bitcoin Testnet", "TBTC", btcFormatUnit, &chaincfg.TestNet3Params, dbFolder, servers,
-			"https://blockstream.info/testnet/tx/", backend.socksProxy)
+			"https://blockstream.info/testnet/tx/", backend.socksProxy.Isolated(string(code)))
 	case code == coinpkg.CodeBTC:
-		servers := backend.defaultElectrumXServers(code)
+		servers := backend.electrumXServers(code)
 		coin = btc.NewCoin(coinpkg.CodeBTC, "Bitcoin", "BTC", btcFormatUnit, &chaincfg.MainNetParams, dbFolder, servers,
-			"https://blockstream.info/tx/", backend.socksProxy)
+			"https://blockstream.info/tx/", backend.socksProxy.Isolated(string(code)))
 	case code == coinpkg.CodeTLTC:
-		servers := backend.defaultElectrumXServers(code)
+		servers := backend.electrumXServers(code)
 		coin = btc.NewCoin(coinpkg.CodeTLTC, "Litecoin Testnet", "TLTC", coinpkg.BtcUnitDefault, &ltc.TestNet4Params, dbFolder, servers,
-			"https://sochain.com/tx/LTCTEST/", backend.socksProxy)
+			"https://sochain.com/tx/LTCTEST/", backend.socksProxy.Isolated(string(code)))
 	case code == coinpkg.CodeLTC:
-		servers := backend.defaultElectrumXServers(code)
+		servers := backend.electrumXServers(code)
 		coin = btc.NewCoin(coinpkg.CodeLTC, "Litecoin", "LTC", coinpkg.BtcUnitDefault, &ltc.MainNetParams, dbFolder, servers,
-			"https://blockchair.com/litecoin/transaction/", backend.socksProxy)
+			"https://blockchair.com/litecoin/transaction/", backend.socksProxy.Isolated(string(code)))
 	case code == coinpkg.CodeETH:
-		etherScan := etherscan.NewEtherScan("https://api.etherscan.io/api", backend.etherScanHTTPClient)
+		etherScanURL = "https://api.etherscan.io/api"
+		etherScan := etherscan.NewEtherScan(etherScanURL, backend.etherScanHTTPClient(code))
 		coin = eth.NewCoin(etherScan, code, "Ethereum", "ETH", "ETH", params.MainnetChainConfig,
 			"https://etherscan.io/tx/",
 			etherScan,
 			nil)
 	case code == coinpkg.CodeGOETH:
-		etherScan := etherscan.NewEtherScan("https://api-goerli.etherscan.io/api", backend.etherScanHTTPClient)
+		etherScanURL = "https://api-goerli.etherscan.io/api"
+		etherScan := etherscan.NewEtherScan(etherScanURL, backend.etherScanHTTPClient(code))
 		coin = eth.NewCoin(etherScan, code, "Ethereum Goerli", "GOETH", "GOETH", params.GoerliChainConfig,
 			"https://goerli.etherscan.io/tx/",
 			etherScan,
 			nil)
 	case code == coinpkg.CodeSEPETH:
-		etherScan := etherscan.NewEtherScan("https://api-sepolia.etherscan.io/api", backend.etherScanHTTPClient)
+		etherScanURL = "https://api-sepolia.etherscan.io/api"
+		etherScan := etherscan.NewEtherScan(etherScanURL, backend.etherScanHTTPClient(code))
 		coin = eth.NewCoin(etherScan, code, "Ethereum Sepolia", "SEPETH", "SEPETH", params.SepoliaChainConfig,
 			"https://sepolia.etherscan.io/tx/",
 			etherScan,
 			nil)
 	case erc20Token != nil:
-		etherScan := etherscan.NewEtherScan("https://api.etherscan.io/api", backend.etherScanHTTPClient)
+		etherScanURL = "https://api.etherscan.io/api"
+		etherScan := etherscan.NewEtherScan(etherScanURL, backend.etherScanHTTPClient(code))
 		coin = eth.NewCoin(etherScan, erc20Token.code, erc20Token.name, erc20Token.unit, "ETH", params.MainnetChainConfig,
 			"https://etherscan.io/tx/",
 			etherScan,
@@ -420,6 +626,12 @@ func (backend *Backend) Coin(code coinpkg.Code) (coinpkg.Coin, error) {
 	default:
 		return nil, errp.Newf("unknown coin code %s", code)
 	}
+	if btcCoin, ok := coin.(*btc.Coin); ok {
+		backend.configureFeeEstimation(btcCoin)
+	}
+	if ethCoin, ok := coin.(*eth.Coin); ok {
+		ethCoin.SetMakeAccountClient(backend.makeEtherScanAccountClient(etherScanURL))
+	}
 	backend.coins[code] = coin
 	coin.Observe(backend.Notify)
 	return coin, nil
@@ -476,6 +688,7 @@ func (backend *Backend) Start() <-chan interface{} {
 
 	defer backend.accountsAndKeystoreLock.Lock()()
 	backend.initPersistedAccounts()
+	backend.loadSoftwareKeystores()
 	backend.emitAccountsStatusChanged()
 
 	backend.ratesUpdater.StartCurrentRates()
@@ -493,35 +706,49 @@ func (backend *Backend) HTTPClient() *http.Client {
 	return backend.httpClient
 }
 
-// Keystore returns the keystore registered at this backend, or nil if no keystore is registered.
-func (backend *Backend) Keystore() keystore.Keystore {
+// Keystores returns the keystores registered at this backend, in the order they were registered.
+func (backend *Backend) Keystores() []keystore.Keystore {
 	defer backend.accountsAndKeystoreLock.RLock()()
-	return backend.keystore
+	return backend.keystores.list()
 }
 
-// registerKeystore registers the given keystore at this backend.
-// if another keystore is already registered, it will be replaced.
+// KeystoreByRootFingerprint returns the registered keystore with the given root fingerprint, or
+// nil if there is none.
+func (backend *Backend) KeystoreByRootFingerprint(rootFingerprint []byte) keystore.Keystore {
+	defer backend.accountsAndKeystoreLock.RLock()()
+	return backend.keystores.get(rootFingerprint)
+}
+
+// registerKeystore registers the given keystore at this backend and loads its accounts. If a
+// keystore with the same root fingerprint is already registered, it will be replaced.
 func (backend *Backend) registerKeystore(keystore keystore.Keystore) {
 	defer backend.accountsAndKeystoreLock.Lock()()
-	// Only for logging, if there is an error we continue anyway.
-	fingerprint, _ := keystore.RootFingerprint()
-	log := backend.log.WithField("rootFingerprint", fingerprint)
+	backend.addKeystore(keystore)
+}
+
+// addKeystore registers the keystore and returns its root fingerprint, or nil if the keystore
+// could not be registered. The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) addKeystore(keystore keystore.Keystore) []byte {
+	rootFingerprint, err := keystore.RootFingerprint()
+	if err != nil {
+		backend.log.WithError(err).Error("Could not retrieve root fingerprint")
+		return nil
+	}
+	log := backend.log.WithField("rootFingerprint", hex.EncodeToString(rootFingerprint))
 	log.Info("registering keystore")
-	backend.keystore = keystore
+	// Unload the accounts of the keystore it replaces (e.g. a second device with the same seed), or
+	// the watch-only accounts if the keystore is remembered.
+	backend.uninitKeystoreAccounts(rootFingerprint)
+	backend.keystores.add(rootFingerprint, keystore)
 	backend.Notify(observable.Event{
 		Subject: "keystores",
 		Action:  action.Reload,
 	})
 
 	belongsToKeystore := func(account *config.Account) bool {
-		fingerprint, err := keystore.RootFingerprint()
-		if err != nil {
-			log.WithError(err).Error("Could not retrieve root fingerprint")
-			return false
-		}
-		return account.SigningConfigurations.ContainsRootFingerprint(fingerprint)
+		return account.SigningConfigurations.ContainsRootFingerprint(rootFingerprint)
 	}
-	err := backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
+	err = backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
 		accounts := backend.filterAccounts(accountsConfig, belongsToKeystore)
 		if len(accounts) != 0 {
 			return backend.updatePersistedAccounts(keystore, accounts)
@@ -532,48 +759,118 @@ func (backend *Backend) registerKeystore(keystore keystore.Keystore) {
 		log.WithError(err).Error("Could not persist default accounts")
 	}
 
-	backend.initAccounts()
+	backend.initKeystoreAccounts(rootFingerprint, keystore)
+	backend.emitAccountsStatusChanged()
+	backend.configureHistoryExchangeRates()
 
 	backend.aoppKeystoreRegistered()
+	return rootFingerprint
 }
 
-// DeregisterKeystore removes the registered keystore.
-func (backend *Backend) DeregisterKeystore() {
+// removeKeystore deregisters the keystore with the given root fingerprint and unloads its
+// accounts. The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) removeKeystore(rootFingerprint []byte) {
+	log := backend.log.WithField("rootFingerprint", hex.EncodeToString(rootFingerprint))
+	if !backend.keystores.remove(rootFingerprint) {
+		log.Error("deregistering keystore, but no keystore found")
+		return
+	}
+	log.Info("deregistering keystore")
+	backend.Notify(observable.Event{
+		Subject: "keystores",
+		Action:  action.Reload,
+	})
+
+	backend.uninitKeystoreAccounts(rootFingerprint)
+	if backend.config.AccountsConfig().IsKeystoreRemembered(rootFingerprint) {
+		backend.initKeystoreAccounts(rootFingerprint, nil)
+	}
+	backend.emitAccountsStatusChanged()
+	backend.configureHistoryExchangeRates()
+}
+
+// DeregisterKeystores removes all registered keystores.
+func (backend *Backend) DeregisterKeystores() {
 	defer backend.accountsAndKeystoreLock.Lock()()
 
-	if backend.keystore == nil {
-		backend.log.Error("deregistering keystore, but no keystore found")
+	if len(backend.keystores.entries) == 0 {
+		backend.log.Error("deregistering keystores, but no keystore found")
 		return
 	}
-	// Only for logging, if there is an error we continue anyway.
-	fingerprint, _ := backend.keystore.RootFingerprint()
-	backend.log.WithField("rootFingerprint", fingerprint).Info("deregistering keystore")
-	backend.keystore = nil
+	for _, entry := range backend.keystores.entries {
+		backend.log.WithField("rootFingerprint", hex.EncodeToString(entry.rootFingerprint)).
+			Info("deregistering keystore")
+	}
+	backend.keystores = keystores{}
+	backend.deviceKeystores = map[string][]byte{}
 	backend.Notify(observable.Event{
 		Subject: "keystores",
 		Action:  action.Reload,
 	})
 
 	backend.uninitAccounts()
-	// TODO: classify accounts by keystore, remove only the ones belonging to the deregistered
-	// keystore. For now we just remove all, then re-add the rest.
+	// Reload the watch-only accounts of remembered keystores.
 	backend.initPersistedAccounts()
 	backend.emitAccountsStatusChanged()
+	backend.configureHistoryExchangeRates()
+}
+
+// registerDeviceKeystore registers the keystore of the device with the given ID.
+func (backend *Backend) registerDeviceKeystore(deviceID string, keystore keystore.Keystore) {
+	rootFingerprint := func() []byte {
+		defer backend.accountsAndKeystoreLock.Lock()()
+		rootFingerprint := backend.addKeystore(keystore)
+		if rootFingerprint != nil {
+			backend.deviceKeystores[deviceID] = rootFingerprint
+		}
+		return rootFingerprint
+	}()
+	if rootFingerprint != nil {
+		backend.recordDeviceKeystore(deviceID, rootFingerprint)
+	}
+}
+
+// deregisterDeviceKeystore deregisters the keystore registered by the device with the given ID. If
+// another connected device has the same root fingerprint, its keystore is registered instead.
+func (backend *Backend) deregisterDeviceKeystore(deviceID string) {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	rootFingerprint, ok := backend.deviceKeystores[deviceID]
+	if !ok {
+		return
+	}
+	delete(backend.deviceKeystores, deviceID)
+	for otherDeviceID, otherRootFingerprint := range backend.deviceKeystores {
+		if !bytes.Equal(otherRootFingerprint, rootFingerprint) {
+			continue
+		}
+		if otherDevice, ok := backend.devices[otherDeviceID]; ok {
+			if otherKeystore := otherDevice.Keystore(); otherKeystore != nil {
+				backend.addKeystore(otherKeystore)
+				return
+			}
+		}
+	}
+	if softwareKeystore, ok := backend.softwareKeystores[hex.EncodeToString(rootFingerprint)]; ok {
+		backend.addKeystore(softwareKeystore)
+		return
+	}
+	backend.removeKeystore(rootFingerprint)
 }
 
 // Register registers the given device at this backend.
 func (backend *Backend) Register(theDevice device.Interface) error {
 	backend.devices[theDevice.Identifier()] = theDevice
+	backend.recordDeviceConnected(theDevice)
 
-	mainKeystore := len(backend.devices) == 1
 	theDevice.SetOnEvent(func(event deviceevent.Event, data interface{}) {
+		// The stable ID of the BitBox02 is only known after the noise handshake.
+		backend.recordDeviceConnected(theDevice)
 		switch event {
 		case deviceevent.EventKeystoreGone:
-			backend.DeregisterKeystore()
+			backend.deregisterDeviceKeystore(theDevice.Identifier())
 		case deviceevent.EventKeystoreAvailable:
-			if mainKeystore {
-				// HACK: for device based, only one is supported at the moment.
-				backend.registerKeystore(theDevice.Keystore())
+			if keystore := theDevice.Keystore(); keystore != nil {
+				backend.registerDeviceKeystore(theDevice.Identifier(), keystore)
 			}
 		}
 		backend.events <- deviceEvent{
@@ -619,7 +916,8 @@ func (backend *Backend) Deregister(deviceID string) {
 	if device, ok := backend.devices[deviceID]; ok {
 		backend.onDeviceUninit(deviceID)
 		delete(backend.devices, deviceID)
-		backend.DeregisterKeystore()
+		backend.deregisterDeviceKeystore(deviceID)
+		backend.deviceInventoryDisconnected(deviceID)
 
 		// Old-school
 		backend.events <- backendEvent{Type: "devices", Data: "registeredChanged"}
@@ -659,7 +957,26 @@ func (backend *Backend) CheckElectrumServer(serverInfo *config.ServerInfo) error
 // devmode.
 func (backend *Backend) RegisterTestKeystore(pin string) {
 	softwareBasedKeystore := software.NewKeystoreFromPIN(pin)
-	backend.registerKeystore(softwareBasedKeystore)
+	defer backend.accountsAndKeystoreLock.Lock()()
+	if rootFingerprint := backend.addKeystore(softwareBasedKeystore); rootFingerprint != nil {
+		backend.testKeystores = append(backend.testKeystores, &registeredKeystore{
+			rootFingerprint: rootFingerprint,
+			keystore:        softwareBasedKeystore,
+		})
+	}
+}
+
+// DeregisterTestKeystores removes the keystores registered with RegisterTestKeystore(). Other
+// keystores, e.g. of connected devices, stay registered.
+func (backend *Backend) DeregisterTestKeystores() {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	for _, entry := range backend.testKeystores {
+		// The test keystore might have been replaced by a keystore with the same root fingerprint.
+		if backend.keystores.get(entry.rootFingerprint) == entry.keystore {
+			backend.removeKeystore(entry.rootFingerprint)
+		}
+	}
+	backend.testKeystores = nil
 }
 
 // NotifyUser creates a desktop notification.
@@ -699,6 +1016,13 @@ func (backend *Backend) Close() error {
 
 	backend.uninitAccounts()
 
+	for _, softwareKeystore := range backend.softwareKeystores {
+		softwareKeystore.Lock()
+	}
+	for _, externalSigner := range backend.externalSigners {
+		externalSigner.process.Stop()
+	}
+
 	for _, coin := range backend.coins {
 		if err := coin.Close(); err != nil {
 			errors = append(errors, err.Error())
@@ -707,6 +1031,12 @@ func (backend *Backend) Close() error {
 	if err := backend.notifier.Close(); err != nil {
 		errors = append(errors, err.Error())
 	}
+	if err := backend.paymentRequests.Close(); err != nil {
+		errors = append(errors, err.Error())
+	}
+	if err := backend.deviceInventory.Close(); err != nil {
+		errors = append(errors, err.Error())
+	}
 	if len(errors) > 0 {
 		return errp.New(strings.Join(errors, "; "))
 	}
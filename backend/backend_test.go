@@ -15,15 +15,25 @@
 package backend
 
 import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
 	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/arguments"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -82,7 +92,7 @@ func TestRegisterKeystore(t *testing.T) {
 
 	// Registering a new keystore persists a set of initial default accounts.
 	b.registerKeystore(ks1)
-	require.Equal(t, ks1, b.Keystore())
+	require.Equal(t, []keystore.Keystore{ks1}, b.Keystores())
 	require.Len(t, b.Accounts(), 3)
 	require.Len(t, b.Config().AccountsConfig().Accounts, 3)
 	require.NotNil(t, b.Config().AccountsConfig().Lookup("v0-55555555-btc-0"))
@@ -93,25 +103,191 @@ func TestRegisterKeystore(t *testing.T) {
 	require.Equal(t, "Ethereum", b.Config().AccountsConfig().Accounts[2].Name)
 
 	// Deregistering the keystore removes the loaded accounts, but not the persisted accounts.
-	b.DeregisterKeystore()
+	b.DeregisterKeystores()
 	require.Len(t, b.Accounts(), 0)
 	require.Len(t, b.Config().AccountsConfig().Accounts, 3)
 
 	// Registering the same keystore again loads the previously persisted accounts and does not
 	// automatically persist more accounts.
-	b.DeregisterKeystore()
+	b.DeregisterKeystores()
 	b.registerKeystore(ks1)
 	require.Len(t, b.Accounts(), 3)
 	require.Len(t, b.Config().AccountsConfig().Accounts, 3)
 
 	// Registering another keystore persists a set of initial default accounts and loads them.
-	b.DeregisterKeystore()
+	b.DeregisterKeystores()
 	b.registerKeystore(ks2)
 	require.Len(t, b.Accounts(), 3)
 	require.Len(t, b.Config().AccountsConfig().Accounts, 6)
 	require.NotNil(t, b.Config().AccountsConfig().Lookup("v0-66666666-btc-0"))
 	require.NotNil(t, b.Config().AccountsConfig().Lookup("v0-66666666-ltc-0"))
 	require.NotNil(t, b.Config().AccountsConfig().Lookup("v0-66666666-eth-0"))
+
+	// Multiple keystores can be registered at the same time, each loading its own accounts.
+	b.DeregisterKeystores()
+	b.registerDeviceKeystore("device1", ks1)
+	b.registerDeviceKeystore("device2", ks2)
+	require.Equal(t, []keystore.Keystore{ks1, ks2}, b.Keystores())
+	require.Equal(t, ks2, b.KeystoreByRootFingerprint([]byte{0x66, 0x66, 0x66, 0x66}))
+	require.Len(t, b.Accounts(), 6)
+	require.Len(t, b.Config().AccountsConfig().Accounts, 6)
+	// Each account signs with the keystore it belongs to.
+	require.Equal(t, ks1, lookup(b.Accounts(), "v0-55555555-btc-0").Config().Keystore)
+	require.Equal(t, ks2, lookup(b.Accounts(), "v0-66666666-btc-0").Config().Keystore)
+
+	// Deregistering the keystore of a device only removes its accounts.
+	b.deregisterDeviceKeystore("device1")
+	require.Equal(t, []keystore.Keystore{ks2}, b.Keystores())
+	require.Len(t, b.Accounts(), 3)
+	require.Nil(t, lookup(b.Accounts(), "v0-55555555-btc-0"))
+	require.NotNil(t, lookup(b.Accounts(), "v0-66666666-btc-0"))
+	b.deregisterDeviceKeystore("device2")
+	require.Empty(t, b.Keystores())
+	require.Len(t, b.Accounts(), 0)
+
+	// Deregistering the test keystores keeps the keystores of devices.
+	b.registerDeviceKeystore("device1", ks1)
+	b.RegisterTestKeystore("1234")
+	require.Len(t, b.Keystores(), 2)
+	b.DeregisterTestKeystores()
+	require.Equal(t, []keystore.Keystore{ks1}, b.Keystores())
+	require.Equal(t, []byte{0x55, 0x55, 0x55, 0x55}, b.deviceKeystores["device1"])
+}
+
+func TestRememberedKeystore(t *testing.T) {
+	ks := makeBitbox02LikeKeystore()
+	rootFingerprint, err := ks.RootFingerprint()
+	require.NoError(t, err)
+
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	// Only keystores with persisted accounts can be remembered.
+	require.Error(t, b.SetKeystoreRemembered(rootFingerprint, true))
+
+	b.registerKeystore(ks)
+	require.Len(t, b.Accounts(), 3)
+	require.NoError(t, b.SetKeystoreRemembered(rootFingerprint, true))
+	require.Equal(t,
+		[]*KnownKeystore{{RootFingerprint: "55555555", Connected: true, Remembered: true}},
+		b.KnownKeystores())
+
+	// The accounts of a remembered keystore stay loaded watch-only when it is disconnected.
+	b.DeregisterKeystores()
+	require.Len(t, b.Accounts(), 3)
+	for _, account := range b.Accounts() {
+		require.Nil(t, account.Config().Keystore)
+	}
+	require.Equal(t,
+		[]*KnownKeystore{{RootFingerprint: "55555555", Connected: false, Remembered: true}},
+		b.KnownKeystores())
+
+	// Reconnecting the keystore makes the accounts usable again.
+	b.registerKeystore(ks)
+	require.Len(t, b.Accounts(), 3)
+	for _, account := range b.Accounts() {
+		require.Equal(t, ks, account.Config().Keystore)
+	}
+
+	// Forgetting a disconnected keystore unloads its accounts.
+	b.DeregisterKeystores()
+	require.NoError(t, b.SetKeystoreRemembered(rootFingerprint, false))
+	require.Len(t, b.Accounts(), 0)
+
+	// Remembering it again loads the accounts without the keystore.
+	require.NoError(t, b.SetKeystoreRemembered(rootFingerprint, true))
+	require.Len(t, b.Accounts(), 3)
+}
+
+func TestSoftwareKeystores(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	mnemonic, err := b.CreateSoftwareKeystore(
+		"awkward squirrel wait rubber biology escape toe daring still pause fitness vendor", "", "password")
+	require.NoError(t, err)
+	require.Equal(t,
+		"awkward squirrel wait rubber biology escape toe daring still pause fitness vendor", mnemonic)
+	require.Len(t, b.Keystores(), 1)
+	require.NotEmpty(t, b.Accounts())
+	require.Equal(t,
+		[]SoftwareKeystore{{RootFingerprint: "fb7089bd", Locked: false}},
+		b.SoftwareKeystores())
+
+	// The same seed can't be stored twice.
+	_, err = b.CreateSoftwareKeystore(mnemonic, "", "password")
+	require.Error(t, err)
+
+	rootFingerprint := []byte{0xfb, 0x70, 0x89, 0xbd}
+	require.NoError(t, b.LockSoftwareKeystore(rootFingerprint))
+	require.Equal(t,
+		[]SoftwareKeystore{{RootFingerprint: "fb7089bd", Locked: true}},
+		b.SoftwareKeystores())
+	// A locked software keystore stays registered.
+	require.Len(t, b.Keystores(), 1)
+	require.True(t, errors.Is(
+		b.UnlockSoftwareKeystore(rootFingerprint, "wrong"), software.ErrWrongPassword))
+	require.NoError(t, b.UnlockSoftwareKeystore(rootFingerprint, "password"))
+	require.False(t, b.SoftwareKeystores()[0].Locked)
+
+	// Stored software keystores are loaded locked.
+	b.DeregisterKeystores()
+	b.softwareKeystores = map[string]*software.EncryptedKeystore{}
+	require.Empty(t, b.Keystores())
+	func() {
+		defer b.accountsAndKeystoreLock.Lock()()
+		b.loadSoftwareKeystores()
+	}()
+	require.Len(t, b.Keystores(), 1)
+	require.NotEmpty(t, b.Accounts())
+	require.Equal(t,
+		[]SoftwareKeystore{{RootFingerprint: "fb7089bd", Locked: true}},
+		b.SoftwareKeystores())
+
+	// A generated mnemonic has 24 words.
+	mnemonic, err = b.CreateSoftwareKeystore("", "", "password")
+	require.NoError(t, err)
+	require.Len(t, strings.Fields(mnemonic), 24)
+	require.Len(t, b.Keystores(), 2)
+}
+
+func TestExternalSigners(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	// Answers getinfo, and all other requests with an error.
+	const script = `read line
+echo '{"id":1,"result":{"name":"Test signer","rootFingerprint":"01020304","coins":["btc"],"scriptTypes":["p2wpkh"]}}'
+while read line; do
+  id=$(echo "$line" | sed 's/^{"id":\([0-9]*\).*/\1/')
+  echo "{\"id\":$id,\"error\":{\"message\":\"unsupported\"}}"
+done`
+	require.Empty(t, b.ExternalSigners())
+	signersJSON, err := json.Marshal([]config.ExternalSigner{
+		{Name: "test", Command: "sh", Args: []string{"-c", script}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(b.arguments.ExternalSignersFilename(), signersJSON, 0600))
+
+	require.Error(t, b.ConnectExternalSigner("unknown"))
+	require.Equal(t, []ExternalSigner{{Name: "test"}}, b.ExternalSigners())
+
+	require.NoError(t, b.ConnectExternalSigner("test"))
+	require.Equal(t,
+		[]ExternalSigner{{
+			Name:            "test",
+			Connected:       true,
+			SignerName:      "Test signer",
+			RootFingerprint: "01020304",
+		}},
+		b.ExternalSigners())
+	require.Len(t, b.Keystores(), 1)
+	require.Error(t, b.ConnectExternalSigner("test"))
+
+	require.NoError(t, b.DisconnectExternalSigner("test"))
+	require.Empty(t, b.Keystores())
+	require.Equal(t, []ExternalSigner{{Name: "test"}}, b.ExternalSigners())
+	require.Error(t, b.DisconnectExternalSigner("test"))
 }
 
 func lookup(accts []accounts.Interface, code accountsTypes.Code) accounts.Interface {
@@ -213,3 +389,47 @@ func TestAccounts(t *testing.T) {
 	require.Equal(t, "My ETH Renamed", b.Config().AccountsConfig().Lookup("v0-55555555-eth-0").Name)
 	require.Equal(t, "My ETH Renamed", lookup(b.Accounts(), "v0-55555555-eth-0").Config().Config.Name)
 }
+
+func TestElectrumXServers(t *testing.T) {
+	b, err := NewBackend(
+		arguments.NewArguments(
+			test.TstTempDir("appfolder"),
+			false, false,
+			false,
+			&types.GapLimits{Receive: 20, Change: 6}),
+		environment{},
+	)
+	require.NoError(t, err)
+	defer b.Close()
+	b.ratesUpdater.SetCoingeckoURL("unused") // avoid hitting real API
+
+	clearnet := b.defaultElectrumXServers(coinpkg.CodeBTC)
+	require.NotEmpty(t, clearnet)
+
+	// No proxy: the onion servers are not used.
+	require.Equal(t, clearnet, b.electrumXServers(coinpkg.CodeBTC))
+
+	// Proxy without onion servers.
+	b.socksProxy = socksproxy.NewSocksProxy(true, "")
+	require.Equal(t, clearnet, b.electrumXServers(coinpkg.CodeBTC))
+	b.socksProxy = b.socksProxy.WithTorOnly(true)
+	require.Equal(t, clearnet, b.electrumXServers(coinpkg.CodeBTC))
+
+	onion := &config.ServerInfo{Server: "abcdef.onion:50002", TLS: false}
+	appConfig := b.config.AppConfig()
+	appConfig.Backend.BTC.OnionElectrumServers = []*config.ServerInfo{onion}
+	require.NoError(t, b.config.SetAppConfig(appConfig))
+
+	// Tor-only: no clearnet fallback.
+	require.Equal(t, []*config.ServerInfo{onion}, b.electrumXServers(coinpkg.CodeBTC))
+
+	// Onion servers first, clearnet as a fallback.
+	b.socksProxy = b.socksProxy.WithTorOnly(false)
+	require.Equal(t,
+		append([]*config.ServerInfo{onion}, clearnet...),
+		b.electrumXServers(coinpkg.CodeBTC))
+
+	// Proxy disabled.
+	b.socksProxy = socksproxy.NewSocksProxy(false, "")
+	require.Equal(t, clearnet, b.electrumXServers(coinpkg.CodeBTC))
+}
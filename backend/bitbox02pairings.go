@@ -0,0 +1,70 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox02"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+)
+
+func (backend *Backend) bitbox02Config() *bitbox02.Config {
+	return bitbox02.NewConfig(backend.arguments.BitBox02DirectoryPath())
+}
+
+func (backend *Backend) notifyBitBox02PairingsChanged() {
+	backend.Notify(observable.Event{
+		Subject: "devices/bitbox02/pairings",
+		Action:  action.Reload,
+	})
+}
+
+// BitBox02Pairings returns the BitBox02 devices paired with the app.
+func (backend *Backend) BitBox02Pairings() []*bitbox02.Pairing {
+	return backend.bitbox02Config().Pairings()
+}
+
+// SetBitBox02PairingLabel sets the label of the paired BitBox02 with the given hex encoded noise
+// static pubkey.
+func (backend *Backend) SetBitBox02PairingLabel(deviceNoiseStaticPubkey string, label string) error {
+	if err := backend.bitbox02Config().SetPairingLabel(deviceNoiseStaticPubkey, label); err != nil {
+		return err
+	}
+	backend.notifyBitBox02PairingsChanged()
+	return nil
+}
+
+// RemoveBitBox02Pairing forgets the paired BitBox02 with the given hex encoded noise static pubkey.
+// The pairing code has to be verified again the next time the device connects.
+func (backend *Backend) RemoveBitBox02Pairing(deviceNoiseStaticPubkey string) error {
+	if err := backend.bitbox02Config().RemovePairing(deviceNoiseStaticPubkey); err != nil {
+		return err
+	}
+	backend.log.WithField("deviceNoiseStaticPubkey", deviceNoiseStaticPubkey).
+		Info("removed BitBox02 pairing")
+	backend.notifyBitBox02PairingsChanged()
+	return nil
+}
+
+// RotateBitBox02AppNoiseKeypair replaces the app's noise static keypair used to pair with
+// BitBox02 devices. All pairings are removed, so every device has to be paired again.
+func (backend *Backend) RotateBitBox02AppNoiseKeypair() error {
+	if err := backend.bitbox02Config().RotateAppNoiseStaticKeypair(); err != nil {
+		return err
+	}
+	backend.log.Info("rotated BitBox02 app noise static keypair")
+	backend.notifyBitBox02PairingsChanged()
+	return nil
+}
@@ -76,6 +76,22 @@ type Chart struct {
 	LastTimestamp int64 `json:"lastTimestamp"`
 }
 
+// sortedChartEntries converts the chart entries to a slice sorted by time, discarding the
+// RatValue, which is not used anymore.
+func sortedChartEntries(s map[int64]RatChartEntry, format func(*big.Rat) string) []ChartEntry {
+	result := make([]ChartEntry, 0, len(s))
+	for _, entry := range s {
+		floatValue, _ := entry.RatValue.Float64()
+		result = append(result, ChartEntry{
+			Time:           entry.Time,
+			Value:          floatValue,
+			FormattedValue: format(entry.RatValue),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time < result[j].Time })
+	return result
+}
+
 func (backend *Backend) addChartData(
 	coinCode coin.Code,
 	fiat string,
@@ -109,6 +125,71 @@ func (backend *Backend) addChartData(
 	}
 }
 
+// accountTimeseries returns the daily and hourly balance timeseries of the account until the
+// given time. dataMissing is true if the headers or historical rates needed are not available
+// yet. Both timeseries are empty if the account has no confirmed transactions.
+func (backend *Backend) accountTimeseries(
+	account accounts.Interface,
+	txs accounts.OrderedTransactions,
+	fiat string,
+	until time.Time,
+) (daily, hourly []accounts.TimeseriesEntry, dataMissing bool, err error) {
+	// Time from which the chart turns from daily points to hourly points.
+	hourlyFrom := time.Now().AddDate(0, 0, -7).Truncate(24 * time.Hour)
+
+	earliestPriceAvailable := backend.RatesUpdater().HistoryEarliestTimestamp(
+		string(account.Coin().Code()),
+		fiat)
+
+	earliestTxTime, err := txs.EarliestTime()
+	if errp.Cause(err) == errors.ErrNotAvailable {
+		backend.log.WithField("coin", account.Coin().Code()).Info("ChartDataMissing/earliestTxtime")
+		return nil, nil, true, nil
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if earliestTxTime.IsZero() {
+		// Ignore the chart for this account, there is no timed transaction.
+		return nil, nil, false, nil
+	}
+	if earliestPriceAvailable.IsZero() || earliestTxTime.Before(earliestPriceAvailable) {
+		backend.log.
+			WithField("coin", account.Coin().Code()).
+			WithField("earliestTxTime", earliestTxTime).
+			WithField("earliestPriceAvailable", earliestPriceAvailable).
+			Info("ChartDataMissing")
+		return nil, nil, true, nil
+	}
+
+	daily, err = txs.Timeseries(
+		earliestTxTime.Truncate(24*time.Hour),
+		until,
+		24*time.Hour,
+	)
+	if errp.Cause(err) == errors.ErrNotAvailable {
+		backend.log.WithField("coin", account.Coin().Code()).Info("ChartDataMissing")
+		return nil, nil, true, nil
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	hourly, err = txs.Timeseries(
+		hourlyFrom,
+		until,
+		time.Hour,
+	)
+	if errp.Cause(err) == errors.ErrNotAvailable {
+		backend.log.WithField("coin", account.Coin().Code()).Info("ChartDataMissing")
+		return nil, nil, true, nil
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return daily, hourly, false, nil
+}
+
 // ChartData assembles chart data for all active accounts.
 func (backend *Backend) ChartData() (*Chart, error) {
 	// If true, we are missing headers or historical conversion rates necessary to compute the chart
@@ -189,63 +270,15 @@ func (backend *Backend) ChartData() (*Chart, error) {
 			continue
 		}
 
-		// Time from which the chart turns from daily points to hourly points.
-		hourlyFrom := time.Now().AddDate(0, 0, -7).Truncate(24 * time.Hour)
-
-		earliestPriceAvailable := backend.RatesUpdater().HistoryEarliestTimestamp(
-			string(account.Coin().Code()),
-			fiat)
-
-		earliestTxTime, err := txs.EarliestTime()
-		if errp.Cause(err) == errors.ErrNotAvailable {
-			backend.log.WithField("coin", account.Coin().Code()).Info("ChartDataMissing/earliestTxtime")
-			chartDataMissing = true
-			continue
-		}
-		if err != nil {
-			return nil, err
-		}
-
-		if earliestTxTime.IsZero() {
-			// Ignore the chart for this account, there is no timed transaction.
-			continue
-		}
-		if earliestPriceAvailable.IsZero() || earliestTxTime.Before(earliestPriceAvailable) {
-			chartDataMissing = true
-			backend.log.
-				WithField("coin", account.Coin().Code()).
-				WithField("earliestTxTime", earliestTxTime).
-				WithField("earliestPriceAvailable", earliestPriceAvailable).
-				Info("ChartDataMissing")
-			continue
-		}
-
-		timeseriesDaily, err := txs.Timeseries(
-			earliestTxTime.Truncate(24*time.Hour),
-			until,
-			24*time.Hour,
-		)
-		if errp.Cause(err) == errors.ErrNotAvailable {
-			backend.log.WithField("coin", account.Coin().Code()).Info("ChartDataMissing")
-			chartDataMissing = true
-			continue
-		}
+		timeseriesDaily, timeseriesHourly, dataMissing, err := backend.accountTimeseries(
+			account, txs, fiat, until)
 		if err != nil {
 			return nil, err
 		}
-		timeseriesHourly, err := txs.Timeseries(
-			hourlyFrom,
-			until,
-			time.Hour,
-		)
-		if errp.Cause(err) == errors.ErrNotAvailable {
-			backend.log.WithField("coin", account.Coin().Code()).Info("ChartDataMissing")
+		if dataMissing {
 			chartDataMissing = true
 			continue
 		}
-		if err != nil {
-			return nil, err
-		}
 
 		backend.addChartData(account.Coin().Code(), fiat, coinDecimals, timeseriesDaily, chartEntriesDaily)
 		backend.addChartData(account.Coin().Code(), fiat, coinDecimals, timeseriesHourly, chartEntriesHourly)
@@ -253,19 +286,9 @@ func (backend *Backend) ChartData() (*Chart, error) {
 	}
 
 	toSortedSlice := func(s map[int64]RatChartEntry, fiat string) []ChartEntry {
-		result := make([]ChartEntry, len(s))
-		i := 0
-		// Discard the RatValue, which is not used anymore
-		for _, entry := range s {
-			floatValue, _ := entry.RatValue.Float64()
-			result[i] = ChartEntry{
-				Time:           entry.Time,
-				Value:          floatValue,
-				FormattedValue: coin.FormatAsCurrency(entry.RatValue, fiat, formatBtcAsSat),
-			}
-			i++
-		}
-		sort.Slice(result, func(i, j int) bool { return result[i].Time < result[j].Time })
+		result := sortedChartEntries(s, func(value *big.Rat) string {
+			return coin.FormatAsCurrency(value, fiat, formatBtcAsSat)
+		})
 
 		// Manually add the last point with the current total, to make the last point match.
 		// The last point might not match the account total otherwise because:
@@ -0,0 +1,190 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/util"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+)
+
+// ChartSeries is the chart timeseries of one account or of all accounts of one coin. The series
+// start at the first transaction and can be stacked to get the total chart.
+type ChartSeries struct {
+	// Code is the account code for an account series, or the coin code for a coin series.
+	Code     string    `json:"code"`
+	Name     string    `json:"name"`
+	CoinCode coin.Code `json:"coinCode"`
+	// Unit is the unit of the balance series.
+	Unit string `json:"unit"`
+	// DataDaily and DataHourly contain the value of the balance in fiat.
+	DataDaily  []ChartEntry `json:"chartDataDaily"`
+	DataHourly []ChartEntry `json:"chartDataHourly"`
+	// BalanceDaily and BalanceHourly contain the balance in the coin's unit.
+	BalanceDaily  []ChartEntry `json:"balanceDaily"`
+	BalanceHourly []ChartEntry `json:"balanceHourly"`
+}
+
+// ChartBreakdown is the chart data broken down per account and per coin.
+type ChartBreakdown struct {
+	// If true, we are missing historical exchange rates or block headers needed to compute the
+	// chart. The series of the affected accounts are omitted.
+	DataMissing bool `json:"chartDataMissing"`
+	// Fiat currency of the values in the series.
+	Fiat     string         `json:"chartFiat"`
+	Accounts []*ChartSeries `json:"accounts"`
+	Coins    []*ChartSeries `json:"coins"`
+	// Latest rate timestamp available among all enabled coins.
+	LastTimestamp int64 `json:"lastTimestamp"`
+}
+
+// chartSeriesData accumulates the data of a series.
+type chartSeriesData struct {
+	series        *ChartSeries
+	coin          coin.Coin
+	dataDaily     map[int64]RatChartEntry
+	dataHourly    map[int64]RatChartEntry
+	balanceDaily  map[int64]*big.Int
+	balanceHourly map[int64]*big.Int
+}
+
+func newChartSeriesData(code, name string, c coin.Coin) *chartSeriesData {
+	return &chartSeriesData{
+		series: &ChartSeries{
+			Code:     code,
+			Name:     name,
+			CoinCode: c.Code(),
+			Unit:     c.GetFormatUnit(false),
+		},
+		coin:          c,
+		dataDaily:     map[int64]RatChartEntry{},
+		dataHourly:    map[int64]RatChartEntry{},
+		balanceDaily:  map[int64]*big.Int{},
+		balanceHourly: map[int64]*big.Int{},
+	}
+}
+
+func addBalanceData(timeseries []accounts.TimeseriesEntry, balances map[int64]*big.Int) {
+	for _, e := range timeseries {
+		timestamp := e.Time.Unix()
+		if balances[timestamp] == nil {
+			balances[timestamp] = new(big.Int)
+		}
+		balances[timestamp].Add(balances[timestamp], e.Value.BigInt())
+	}
+}
+
+// finish converts the accumulated data to the sorted series.
+func (data *chartSeriesData) finish(formatFiat func(*big.Rat) string) *ChartSeries {
+	toSlice := func(balances map[int64]*big.Int) []ChartEntry {
+		result := make([]ChartEntry, 0, len(balances))
+		for timestamp, balance := range balances {
+			amount := coin.NewAmount(balance)
+			result = append(result, ChartEntry{
+				Time:           timestamp,
+				Value:          data.coin.ToUnit(amount, false),
+				FormattedValue: data.coin.FormatAmount(amount, false),
+			})
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Time < result[j].Time })
+		return result
+	}
+	data.series.DataDaily = sortedChartEntries(data.dataDaily, formatFiat)
+	data.series.DataHourly = sortedChartEntries(data.dataHourly, formatFiat)
+	data.series.BalanceDaily = toSlice(data.balanceDaily)
+	data.series.BalanceHourly = toSlice(data.balanceHourly)
+	return data.series
+}
+
+// ChartBreakdown assembles the chart data of all active accounts per account and per coin.
+func (backend *Backend) ChartBreakdown() (*ChartBreakdown, error) {
+	fiat := backend.Config().AppConfig().Backend.MainFiat
+	until := backend.RatesUpdater().HistoryLatestTimestampAll(backend.allCoinCodes(), fiat)
+	result := &ChartBreakdown{
+		Fiat:          fiat,
+		Accounts:      []*ChartSeries{},
+		Coins:         []*ChartSeries{},
+		LastTimestamp: until.UnixMilli(),
+	}
+	if until.IsZero() {
+		result.DataMissing = true
+		return result, nil
+	}
+
+	accountsData := []*chartSeriesData{}
+	coinsData := map[coin.Code]*chartSeriesData{}
+	// Coin codes in the order of the accounts.
+	coinCodes := []coin.Code{}
+	for _, account := range backend.Accounts() {
+		if account.Config().Config.Inactive {
+			continue
+		}
+		if account.FatalError() {
+			continue
+		}
+		if err := account.Initialize(); err != nil {
+			return nil, err
+		}
+		txs, err := account.Transactions()
+		if err != nil {
+			return nil, err
+		}
+		daily, hourly, dataMissing, err := backend.accountTimeseries(account, txs, fiat, until)
+		if err != nil {
+			return nil, err
+		}
+		if dataMissing {
+			result.DataMissing = true
+			continue
+		}
+
+		accountCoin := account.Coin()
+		coinDecimals := new(big.Int).Exp(
+			big.NewInt(10),
+			big.NewInt(int64(accountCoin.Decimals(false))),
+			nil,
+		)
+		accountData := newChartSeriesData(
+			string(account.Config().Config.Code), account.Config().Config.Name, accountCoin)
+		accountsData = append(accountsData, accountData)
+		coinData, ok := coinsData[accountCoin.Code()]
+		if !ok {
+			coinData = newChartSeriesData(string(accountCoin.Code()), accountCoin.Name(), accountCoin)
+			coinsData[accountCoin.Code()] = coinData
+			coinCodes = append(coinCodes, accountCoin.Code())
+		}
+		for _, data := range []*chartSeriesData{accountData, coinData} {
+			backend.addChartData(accountCoin.Code(), fiat, coinDecimals, daily, data.dataDaily)
+			backend.addChartData(accountCoin.Code(), fiat, coinDecimals, hourly, data.dataHourly)
+			addBalanceData(daily, data.balanceDaily)
+			addBalanceData(hourly, data.balanceHourly)
+		}
+	}
+
+	formatBtcAsSat := util.FormatBtcAsSat(backend.Config().AppConfig().Backend.BtcUnit)
+	formatFiat := func(value *big.Rat) string {
+		return coin.FormatAsCurrency(value, fiat, formatBtcAsSat)
+	}
+	for _, data := range accountsData {
+		result.Accounts = append(result.Accounts, data.finish(formatFiat))
+	}
+	for _, coinCode := range coinCodes {
+		result.Coins = append(result.Coins, coinsData[coinCode].finish(formatFiat))
+	}
+	return result, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	coinMocks "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChartSeriesData(t *testing.T) {
+	mockCoin := &coinMocks.CoinMock{
+		CodeFunc:          func() coin.Code { return coin.CodeBTC },
+		GetFormatUnitFunc: func(isFee bool) string { return "BTC" },
+		ToUnitFunc: func(amount coin.Amount, isFee bool) float64 {
+			result, _ := new(big.Rat).SetFrac(amount.BigInt(), big.NewInt(1e8)).Float64()
+			return result
+		},
+		FormatAmountFunc: func(amount coin.Amount, isFee bool) string {
+			return new(big.Rat).SetFrac(amount.BigInt(), big.NewInt(1e8)).FloatString(8)
+		},
+	}
+	t1 := time.Unix(1000, 0)
+	t2 := time.Unix(2000, 0)
+	data := newChartSeriesData("v0-test-btc-0", "Bitcoin 1", mockCoin)
+	// Two accounts of the same coin.
+	addBalanceData([]accounts.TimeseriesEntry{
+		{Time: t1, Value: coin.NewAmountFromInt64(1e8)},
+		{Time: t2, Value: coin.NewAmountFromInt64(2e8)},
+	}, data.balanceDaily)
+	addBalanceData([]accounts.TimeseriesEntry{
+		{Time: t2, Value: coin.NewAmountFromInt64(5e7)},
+	}, data.balanceDaily)
+	data.dataDaily[2000] = RatChartEntry{ChartEntry: ChartEntry{Time: 2000}, RatValue: big.NewRat(9, 2)}
+	data.dataDaily[1000] = RatChartEntry{ChartEntry: ChartEntry{Time: 1000}, RatValue: big.NewRat(1, 1)}
+
+	series := data.finish(func(value *big.Rat) string { return value.FloatString(2) })
+	require.Equal(t, "v0-test-btc-0", series.Code)
+	require.Equal(t, "Bitcoin 1", series.Name)
+	require.Equal(t, coin.CodeBTC, series.CoinCode)
+	require.Equal(t, "BTC", series.Unit)
+	require.Equal(t, []ChartEntry{
+		{Time: 1000, Value: 1, FormattedValue: "1.00000000"},
+		{Time: 2000, Value: 2.5, FormattedValue: "2.50000000"},
+	}, series.BalanceDaily)
+	require.Equal(t, []ChartEntry{
+		{Time: 1000, Value: 1, FormattedValue: "1.00"},
+		{Time: 2000, Value: 4.5, FormattedValue: "4.50"},
+	}, series.DataDaily)
+	require.Empty(t, series.BalanceHourly)
+	require.Empty(t, series.DataHourly)
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
 	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
@@ -38,6 +39,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
@@ -78,6 +80,9 @@ type Account struct {
 	*accounts.BaseAccount
 
 	coin *Coin
+	// blockchain is the account's own connection to the Electrum servers, see
+	// Coin.newAccountBlockchain(). Set in Initialize().
+	blockchain blockchain.Interface
 	// folder for this specific account. It is a subfolder of dbFolder. Full path.
 	dbSubfolder    string
 	db             transactions.DBInterface
@@ -136,18 +141,43 @@ func NewAccount(
 		dbSubfolder:    "", // set in Initialize()
 		forceGapLimits: forceGapLimits,
 
-		// feeTargets must be sorted by ascending priority.
-		feeTargets: []*FeeTarget{
-			{blocks: 24, code: accounts.FeeTargetCodeEconomy},
-			{blocks: 12, code: accounts.FeeTargetCodeLow},
-			{blocks: 6, code: accounts.FeeTargetCodeNormal},
-			{blocks: 2, code: accounts.FeeTargetCodeHigh},
-		},
-		log: log,
+		feeTargets: newFeeTargets(coin.FeePresets(), log),
+		log:        log,
 	}
 	return account
 }
 
+// newFeeTargets returns the default fee targets and the valid user-defined presets, sorted by
+// ascending priority.
+func newFeeTargets(presets []config.FeePreset, log *logrus.Entry) []*FeeTarget {
+	feeTargets := []*FeeTarget{}
+	names := map[string]struct{}{}
+	for _, preset := range presets {
+		if _, ok := names[preset.Name]; ok || preset.Name == "" ||
+			preset.Blocks < 1 || preset.Blocks > maxFeeTargetBlocks {
+			log.WithField("preset", preset).Warning("Ignoring invalid fee preset")
+			continue
+		}
+		names[preset.Name] = struct{}{}
+		feeTargets = append(feeTargets, &FeeTarget{
+			blocks: preset.Blocks,
+			code:   accounts.NewPresetFeeTargetCode(preset.Name),
+		})
+	}
+	// Presets come first so that the stable sort below lists them before default fee targets with
+	// the same target.
+	feeTargets = append(feeTargets,
+		&FeeTarget{blocks: 24, code: accounts.FeeTargetCodeEconomy},
+		&FeeTarget{blocks: 12, code: accounts.FeeTargetCodeLow},
+		&FeeTarget{blocks: 6, code: accounts.FeeTargetCodeNormal},
+		&FeeTarget{blocks: 2, code: accounts.FeeTargetCodeHigh},
+	)
+	sort.SliceStable(feeTargets, func(i, j int) bool {
+		return feeTargets[i].blocks > feeTargets[j].blocks
+	})
+	return feeTargets
+}
+
 // String returns a representation of the account for logging.
 func (account *Account) String() string {
 	return fmt.Sprintf("%s-%s", account.Coin().Code(), account.Config().Config.Code)
@@ -253,7 +283,7 @@ func (account *Account) getMinRelayFeeRate() (btcutil.Amount, error) {
 		return *cached, nil
 	}
 
-	feeRate, err := account.coin.Blockchain().RelayFee()
+	feeRate, err := account.blockchain.RelayFee()
 	if err != nil {
 		return 0, err
 	}
@@ -321,8 +351,9 @@ func (account *Account) Initialize() error {
 		}
 	}
 	account.coin.Initialize()
-	account.SetOffline(account.coin.Blockchain().ConnectionError())
-	account.coin.Blockchain().RegisterOnConnectionErrorChangedEvent(onConnectionStatusChanged)
+	account.blockchain = account.coin.newAccountBlockchain(string(account.Config().Config.Code))
+	account.SetOffline(account.blockchain.ConnectionError())
+	account.blockchain.RegisterOnConnectionErrorChangedEvent(onConnectionStatusChanged)
 	theHeaders := account.coin.Headers()
 	theHeaders.SubscribeEvent(func(event headers.Event) {
 		if event == headers.EventSynced {
@@ -331,7 +362,7 @@ func (account *Account) Initialize() error {
 	})
 	account.transactions = transactions.NewTransactions(
 		account.coin.Net(), account.db, theHeaders, account.Synchronizer,
-		account.coin.Blockchain(), account.notifier, account.log)
+		account.blockchain, account.notifier, account.Config().OnEvent, account.log)
 
 	for _, signingConfiguration := range signingConfigurations {
 		signingConfiguration := signingConfiguration
@@ -352,7 +383,7 @@ func (account *Account) Initialize() error {
 		account.subaccounts = append(account.subaccounts, subacc)
 	}
 	account.ensureAddresses()
-	account.coin.Blockchain().HeadersSubscribe(account.onNewHeader)
+	account.blockchain.HeadersSubscribe(account.onNewHeader)
 
 	return account.BaseAccount.Initialize(accountIdentifier)
 }
@@ -440,12 +471,13 @@ func (account *Account) Close() {
 	}
 	account.BaseAccount.Close()
 	account.log.Info("Closed account")
-	// TODO: deregister from json RPC client. The client can be closed when no account uses
-	// the client any longer.
 	account.ResetSynced()
 	if account.transactions != nil {
 		account.transactions.Close()
 	}
+	if account.blockchain != nil {
+		account.blockchain.Close()
+	}
 
 	if account.db != nil {
 		if err := account.db.Close(); err != nil {
@@ -476,7 +508,7 @@ func (account *Account) updateFeeTargets() {
 		minRelayFeeRate = &minRelayFeeRateVal
 	}
 	for _, feeTarget := range account.feeTargets {
-		feeRatePerKb, err := account.coin.Blockchain().EstimateFee(feeTarget.blocks)
+		feeRatePerKb, err := account.coin.FeeEstimator().EstimateFee(feeTarget.blocks)
 		if err != nil {
 			if account.coin.Code() != coin.CodeTLTC {
 				account.log.WithField("fee-target", feeTarget.blocks).
@@ -605,7 +637,7 @@ func (account *Account) onAddressStatus(address *addresses.AccountAddress, statu
 	account.log.Debug("Address status changed, fetching history.")
 
 	defer account.Synchronizer.IncRequestsCounter()()
-	history, err := account.coin.Blockchain().ScriptHashGetHistory(address.PubkeyScriptHashHex())
+	history, err := account.blockchain.ScriptHashGetHistory(address.PubkeyScriptHashHex())
 	if err != nil {
 		// We are not closing client.blockchain here, as it is reused per coin with
 		// different accounts.
@@ -657,7 +689,7 @@ func (account *Account) ensureAddresses() {
 }
 
 func (account *Account) subscribeAddress(address *addresses.AccountAddress) {
-	account.coin.Blockchain().ScriptHashSubscribe(
+	account.blockchain.ScriptHashSubscribe(
 		account.Synchronizer.IncRequestsCounter,
 		address.PubkeyScriptHashHex(),
 		func(status string) {
@@ -714,6 +746,17 @@ func (account *Account) GetUnusedReceiveAddresses() []accounts.AddressList {
 	return addresses
 }
 
+// receiveAddress returns the receive address with the given ID.
+func (account *Account) receiveAddress(addressID string) (*addresses.AccountAddress, error) {
+	scriptHashHex := blockchain.ScriptHashHex(addressID)
+	for _, subacc := range account.subaccounts {
+		if addr := subacc.receiveAddresses.LookupByScriptHashHex(scriptHashHex); addr != nil {
+			return addr, nil
+		}
+	}
+	return nil, errp.New("unknown address not found")
+}
+
 // VerifyAddress verifies a receive address on a keystore. Returns false, nil if no secure output
 // exists.
 func (account *Account) VerifyAddress(addressID string) (bool, error) {
@@ -721,18 +764,11 @@ func (account *Account) VerifyAddress(addressID string) (bool, error) {
 		return false, errp.New("account must be initialized")
 	}
 	account.Synchronizer.WaitSynchronized()
-	scriptHashHex := blockchain.ScriptHashHex(addressID)
-	var address *addresses.AccountAddress
-	for _, subacc := range account.subaccounts {
-		if addr := subacc.receiveAddresses.LookupByScriptHashHex(scriptHashHex); addr != nil {
-			address = addr
-			break
-		}
-	}
-	if address == nil {
-		return false, errp.New("unknown address not found")
+	address, err := account.receiveAddress(addressID)
+	if err != nil {
+		return false, err
 	}
-	canVerifyAddress, _, err := account.Config().Keystore.CanVerifyAddress(account.Coin())
+	canVerifyAddress, _, err := account.CanVerifyAddresses()
 	if err != nil {
 		return false, err
 	}
@@ -744,6 +780,9 @@ func (account *Account) VerifyAddress(addressID string) (bool, error) {
 
 // CanVerifyAddresses wraps Keystores().CanVerifyAddresses(), see that function for documentation.
 func (account *Account) CanVerifyAddresses() (bool, bool, error) {
+	if account.Config().Keystore == nil {
+		return false, false, nil
+	}
 	return account.Config().Keystore.CanVerifyAddress(account.Coin())
 }
 
@@ -800,6 +839,9 @@ func (account *Account) VerifyExtendedPublicKey(signingConfigIndex int) (bool, e
 	}
 
 	keystore := account.Config().Keystore
+	if keystore == nil {
+		return false, errp.WithStack(errors.ErrKeystoreNotConnected)
+	}
 	if keystore.CanVerifyExtendedPublicKey() {
 		return true, keystore.VerifyExtendedPublicKey(
 			account.Coin(),
@@ -0,0 +1,317 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/regtest"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	regtestTimeout = 10 * time.Second
+	regtestTick    = 20 * time.Millisecond
+)
+
+type nopNotifier struct{}
+
+func (nopNotifier) Put([]byte) error              { return nil }
+func (nopNotifier) Delete([]byte) error           { return nil }
+func (nopNotifier) UnnotifiedCount() (int, error) { return 0, nil }
+func (nopNotifier) MarkAllNotified() error        { return nil }
+
+// regtestAccount creates and initializes a P2WPKH account connected to an Electrum server serving
+// the given chain.
+func regtestAccount(t *testing.T, chain *regtest.Chain) *btc.Account {
+	t.Helper()
+	server := regtest.NewElectrumServer(chain)
+	t.Cleanup(server.Close)
+
+	dbFolder := test.TstTempDir("btc-regtest-dbfolder")
+	t.Cleanup(func() { _ = os.RemoveAll(dbFolder) })
+
+	net := &chaincfg.RegressionNetParams
+	coin := btc.NewCoin(
+		coin.CodeRBTC, "Bitcoin Regtest", "RBTC", coin.BtcUnitDefault, net, dbFolder,
+		[]*config.ServerInfo{server.ServerInfo()}, "", socksproxy.NewSocksProxy(false, ""))
+	t.Cleanup(func() { _ = coin.Close() })
+
+	keystore := software.NewKeystoreFromPIN("1234")
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/1'/0'")
+	require.NoError(t, err)
+	xpub, err := keystore.ExtendedPublicKey(coin, keypath)
+	require.NoError(t, err)
+	rootFingerprint, err := keystore.RootFingerprint()
+	require.NoError(t, err)
+
+	account := btc.NewAccount(
+		&accounts.AccountConfig{
+			Config: &config.Account{
+				Code: "regtest-account",
+				Name: "regtest account",
+				SigningConfigurations: signing.Configurations{signing.NewBitcoinConfiguration(
+					signing.ScriptTypeP2WPKH, rootFingerprint, keypath, xpub)},
+			},
+			DBFolder:        dbFolder,
+			NotesFolder:     dbFolder,
+			Keystore:        keystore,
+			OnEvent:         func(accountsTypes.Event) {},
+			GetNotifier:     func(signing.Configurations) accounts.Notifier { return nopNotifier{} },
+			GetSaveFilename: func(suggestedFilename string) string { return suggestedFilename },
+		},
+		coin, nil,
+		logging.Get().WithGroup("account_regtest_test"),
+	)
+	require.NoError(t, account.Initialize())
+	t.Cleanup(account.Close)
+	require.Eventually(t, account.Synced, regtestTimeout, regtestTick)
+	return account
+}
+
+func receivePkScript(t *testing.T, account *btc.Account) []byte {
+	t.Helper()
+	address := account.GetUnusedReceiveAddresses()[0].Addresses[0]
+	return address.(*addresses.AccountAddress).PubkeyScript()
+}
+
+// findTx returns the account transaction with the given hash, or nil if the account does not know
+// it (yet).
+func findTx(t *testing.T, account *btc.Account, txHash chainhash.Hash) *accounts.TransactionData {
+	t.Helper()
+	txs, err := account.Transactions()
+	require.NoError(t, err)
+	for _, tx := range txs {
+		if tx.TxID == txHash.String() {
+			return tx
+		}
+	}
+	return nil
+}
+
+// requireTxConfirmed waits until the account has verified the transaction in the block at the
+// given height.
+func requireTxConfirmed(
+	t *testing.T, account *btc.Account, chain *regtest.Chain, txHash chainhash.Hash, height int) {
+	t.Helper()
+	header := chain.Header(height)
+	require.NotNil(t, header)
+	require.Eventually(t, func() bool {
+		tx := findTx(t, account, txHash)
+		return tx != nil && tx.Height == height &&
+			tx.Timestamp != nil && tx.Timestamp.Equal(header.Timestamp)
+	}, regtestTimeout, regtestTick)
+}
+
+// requireSentTx waits until the account lists an outgoing transaction and returns it.
+func requireSentTx(t *testing.T, account *btc.Account, chain *regtest.Chain) *wire.MsgTx {
+	t.Helper()
+	var sentTx *wire.MsgTx
+	require.Eventually(t, func() bool {
+		txs, err := account.Transactions()
+		require.NoError(t, err)
+		for _, tx := range txs {
+			if tx.Type == accounts.TxTypeSend {
+				txHash, err := chainhash.NewHashFromStr(tx.TxID)
+				require.NoError(t, err)
+				sentTx = chain.Transaction(*txHash)
+				return true
+			}
+		}
+		return false
+	}, regtestTimeout, regtestTick)
+	require.NotNil(t, sentTx)
+	return sentTx
+}
+
+func requireBalance(t *testing.T, account *btc.Account, available, incoming btcutil.Amount) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		balance, err := account.Balance()
+		require.NoError(t, err)
+		return balance.Available().BigInt().Int64() == int64(available) &&
+			balance.Incoming().BigInt().Int64() == int64(incoming)
+	}, regtestTimeout, regtestTick)
+}
+
+func TestRegtestReceiveAndSend(t *testing.T) {
+	chain := regtest.NewChain()
+	chain.MineEmpty(10)
+	account := regtestAccount(t, chain)
+
+	fundingTx := chain.Fund(receivePkScript(t, account), btcutil.SatoshiPerBitcoin)
+	requireBalance(t, account, 0, btcutil.SatoshiPerBitcoin)
+
+	chain.Mine(1)
+	requireTxConfirmed(t, account, chain, fundingTx.TxHash(), 11)
+	requireBalance(t, account, btcutil.SatoshiPerBitcoin, 0)
+
+	recipient, err := btcutil.NewAddressWitnessPubKeyHash(make([]byte, 20), chain.Net())
+	require.NoError(t, err)
+	_, fee, _, err := account.TxProposal(&accounts.TxProposalArgs{
+		RecipientAddress: recipient.EncodeAddress(),
+		Amount:           coin.NewSendAmount("0.1"),
+		FeeTargetCode:    accounts.FeeTargetCodeCustom,
+		CustomFee:        "10",
+	})
+	require.NoError(t, err)
+	require.NoError(t, account.SendTx())
+
+	sentTx := requireSentTx(t, account, chain)
+	// Sent transactions signal replaceability.
+	for _, txIn := range sentTx.TxIn {
+		require.Equal(t, wire.MaxTxInSequenceNum-2, txIn.Sequence)
+	}
+	height, ok := chain.TxHeight(sentTx.TxHash())
+	require.True(t, ok)
+	require.Equal(t, 0, height)
+
+	chain.Mine(1)
+	requireTxConfirmed(t, account, chain, sentTx.TxHash(), 12)
+	requireBalance(t, account, btcutil.SatoshiPerBitcoin-btcutil.SatoshiPerBitcoin/10-btcutil.Amount(fee.BigInt().Int64()), 0)
+}
+
+func TestRegtestIncomingReplacement(t *testing.T) {
+	chain := regtest.NewChain()
+	chain.MineEmpty(10)
+	account := regtestAccount(t, chain)
+
+	fundingTx := chain.Fund(receivePkScript(t, account), btcutil.SatoshiPerBitcoin)
+	requireBalance(t, account, 0, btcutil.SatoshiPerBitcoin)
+
+	// Replace the incoming tx by one paying less and therefore a higher fee.
+	replacementTx := fundingTx.Copy()
+	replacementTx.TxOut[0].Value -= 10000
+	require.NoError(t, chain.Broadcast(replacementTx))
+	_, ok := chain.TxHeight(fundingTx.TxHash())
+	require.False(t, ok)
+
+	requireBalance(t, account, 0, btcutil.SatoshiPerBitcoin-10000)
+	require.Eventually(t, func() bool {
+		return findTx(t, account, fundingTx.TxHash()) == nil &&
+			findTx(t, account, replacementTx.TxHash()) != nil
+	}, regtestTimeout, regtestTick)
+
+	chain.Mine(1)
+	requireTxConfirmed(t, account, chain, replacementTx.TxHash(), 11)
+	requireBalance(t, account, btcutil.SatoshiPerBitcoin-10000, 0)
+}
+
+func TestRegtestReorg(t *testing.T) {
+	chain := regtest.NewChain()
+	chain.MineEmpty(10)
+	account := regtestAccount(t, chain)
+
+	fundingTx := chain.Fund(receivePkScript(t, account), btcutil.SatoshiPerBitcoin)
+	chain.Mine(1)
+	requireTxConfirmed(t, account, chain, fundingTx.TxHash(), 11)
+
+	// Orphan the block containing the tx with a longer chain not containing it.
+	chain.Disconnect(1)
+	chain.MineEmpty(2)
+	require.Eventually(t, func() bool {
+		tx := findTx(t, account, fundingTx.TxHash())
+		return tx != nil && tx.Height == 0
+	}, regtestTimeout, regtestTick)
+	requireBalance(t, account, 0, btcutil.SatoshiPerBitcoin)
+
+	chain.Mine(1)
+	requireTxConfirmed(t, account, chain, fundingTx.TxHash(), 13)
+	requireBalance(t, account, btcutil.SatoshiPerBitcoin, 0)
+}
+
+func TestRegtestOutgoingFeeBump(t *testing.T) {
+	chain := regtest.NewChain()
+	chain.MineEmpty(10)
+	account := regtestAccount(t, chain)
+
+	chain.Fund(receivePkScript(t, account), btcutil.SatoshiPerBitcoin)
+	chain.Mine(1)
+	requireBalance(t, account, btcutil.SatoshiPerBitcoin, 0)
+
+	recipient, err := btcutil.NewAddressWitnessPubKeyHash(make([]byte, 20), chain.Net())
+	require.NoError(t, err)
+	recipientPkScript, err := txscript.PayToAddrScript(recipient)
+	require.NoError(t, err)
+	_, fee, _, err := account.TxProposal(&accounts.TxProposalArgs{
+		RecipientAddress: recipient.EncodeAddress(),
+		Amount:           coin.NewSendAmount("0.1"),
+		FeeTargetCode:    accounts.FeeTargetCodeCustom,
+		CustomFee:        "10",
+	})
+	require.NoError(t, err)
+	require.NoError(t, account.SendTx())
+	sentTx := requireSentTx(t, account, chain)
+	feeAmount := btcutil.Amount(fee.BigInt().Int64())
+	// The change of our own unconfirmed tx is available right away.
+	requireBalance(t, account, btcutil.SatoshiPerBitcoin-btcutil.SatoshiPerBitcoin/10-feeAmount, 0)
+
+	// Bump the fee of the outgoing tx by paying less change, like the same wallet would from another
+	// device. The simulated chain does not execute scripts, so the signatures can stay the same.
+	const bump = 10000
+	replacementTx := sentTx.Copy()
+	changeIndex := -1
+	for index, txOut := range replacementTx.TxOut {
+		if !bytes.Equal(txOut.PkScript, recipientPkScript) {
+			changeIndex = index
+		}
+	}
+	require.NotEqual(t, -1, changeIndex)
+	replacementTx.TxOut[changeIndex].Value -= bump
+	require.NoError(t, chain.Broadcast(replacementTx))
+	_, ok := chain.TxHeight(sentTx.TxHash())
+	require.False(t, ok)
+
+	// The replaced tx is dropped from the history and the balance.
+	require.Eventually(t, func() bool {
+		return findTx(t, account, sentTx.TxHash()) == nil &&
+			findTx(t, account, replacementTx.TxHash()) != nil
+	}, regtestTimeout, regtestTick)
+	requireBalance(t, account,
+		btcutil.SatoshiPerBitcoin-btcutil.SatoshiPerBitcoin/10-feeAmount-bump, 0)
+	txs, err := account.Transactions()
+	require.NoError(t, err)
+	numSent := 0
+	for _, tx := range txs {
+		if tx.Type == accounts.TxTypeSend {
+			numSent++
+		}
+	}
+	require.Equal(t, 1, numSent)
+
+	chain.Mine(1)
+	requireTxConfirmed(t, account, chain, replacementTx.TxHash(), 12)
+	requireBalance(t, account,
+		btcutil.SatoshiPerBitcoin-btcutil.SatoshiPerBitcoin/10-feeAmount-bump, 0)
+}
@@ -49,6 +49,8 @@ func TestAccount(t *testing.T) {
 
 	blockchainMock := &blockchainMock.BlockchainMock{}
 	blockchainMock.MockRegisterOnConnectionErrorChangedEvent = func(f func(error)) {}
+	blockchainClosed := false
+	blockchainMock.MockClose = func() { blockchainClosed = true }
 
 	coin.TstSetMakeBlockchain(func() blockchain.Interface { return blockchainMock })
 
@@ -96,4 +98,8 @@ func TestAccount(t *testing.T) {
 	require.Equal(t, accounts.OrderedTransactions{}, transactions)
 
 	require.Equal(t, []*btc.SpendableOutput{}, account.SpendableOutputs())
+
+	// The account's own Electrum connection is closed with the account.
+	account.Close()
+	require.True(t, blockchainClosed)
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/block-client-go/electrum/types"
 )
@@ -113,6 +114,7 @@ type Interface interface {
 	TransactionBroadcast(*wire.MsgTx) error
 	RelayFee() (btcutil.Amount, error)
 	EstimateFee(int) (btcutil.Amount, error)
+	FeeHistogram() (feeestimate.Histogram, error)
 	Headers(int, int) (*HeadersResult, error)
 	GetMerkle(chainhash.Hash, int) (*GetMerkleResult, error)
 	Close()
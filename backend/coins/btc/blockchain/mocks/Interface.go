@@ -8,6 +8,8 @@ import (
 
 	chainhash "github.com/btcsuite/btcd/chaincfg/chainhash"
 
+	feeestimate "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
+
 	mock "github.com/stretchr/testify/mock"
 
 	testing "testing"
@@ -62,6 +64,29 @@ func (_m *Interface) EstimateFee(_a0 int) (btcutil.Amount, error) {
 	return r0, r1
 }
 
+// FeeHistogram provides a mock function with given fields:
+func (_m *Interface) FeeHistogram() (feeestimate.Histogram, error) {
+	ret := _m.Called()
+
+	var r0 feeestimate.Histogram
+	if rf, ok := ret.Get(0).(func() feeestimate.Histogram); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(feeestimate.Histogram)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetMerkle provides a mock function with given fields: _a0, _a1
 func (_m *Interface) GetMerkle(_a0 chainhash.Hash, _a1 int) (*blockchain.GetMerkleResult, error) {
 	ret := _m.Called(_a0, _a1)
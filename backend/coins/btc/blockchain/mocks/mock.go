@@ -21,6 +21,7 @@ import (
 	chainhash "github.com/btcsuite/btcd/chaincfg/chainhash"
 	wire "github.com/btcsuite/btcd/wire"
 	blockchain "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
 	"github.com/digitalbitbox/block-client-go/electrum/types"
 )
 
@@ -33,6 +34,7 @@ type BlockchainMock struct {
 	MockTransactionBroadcast func(*wire.MsgTx) error
 	MockRelayFee             func() (btcutil.Amount, error)
 	MockEstimateFee          func(int) (btcutil.Amount, error)
+	MockFeeHistogram         func() (feeestimate.Histogram, error)
 	MockHeaders              func(int, int) (*blockchain.HeadersResult, error)
 	MockGetMerkle            func(chainhash.Hash, int) (*blockchain.GetMerkleResult, error)
 	MockClose                func()
@@ -95,6 +97,14 @@ func (b *BlockchainMock) EstimateFee(i int) (btcutil.Amount, error) {
 	panic("not implemented")
 }
 
+// FeeHistogram implements Interface.
+func (b *BlockchainMock) FeeHistogram() (feeestimate.Histogram, error) {
+	if b.MockFeeHistogram != nil {
+		return b.MockFeeHistogram()
+	}
+	panic("not implemented")
+}
+
 // Headers implements Interface.
 func (b *BlockchainMock) Headers(i1 int, i2 int) (*blockchain.HeadersResult, error) {
 	if b.MockHeaders != nil {
@@ -28,6 +28,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/db/headersdb"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
@@ -53,6 +54,14 @@ type Coin struct {
 	makeBlockchain        func() blockchain.Interface
 	blockExplorerTxPrefix string
 
+	// makeAccountBlockchain creates the connection of an account, see newAccountBlockchain().
+	makeAccountBlockchain func(isolationID string) blockchain.Interface
+
+	// feePresets are user-defined fee targets offered by the accounts of this coin.
+	feePresets []config.FeePreset
+	// mempoolSpace, if not nil, is queried for fee estimates before the Electrum server.
+	mempoolSpace *feeestimate.MempoolSpace
+
 	observable.Implementation
 
 	blockchain blockchain.Interface
@@ -89,15 +98,31 @@ func NewCoin(
 				socksProxy.GetTCPProxyDialer(),
 			)
 		},
+		makeAccountBlockchain: func(isolationID string) blockchain.Interface {
+			accountProxy := socksProxy.Isolated(isolationID)
+			return electrum.NewElectrumConnection(
+				servers,
+				log.WithField("isolation", isolationID),
+				accountProxy.GetTCPProxyDialer(),
+			)
+		},
 		log: log,
 	}
 	return coin
 }
 
 // TstSetMakeBlockchain must only be used in unit tests to provide a mock instance for the
-// blockchain interface.
+// blockchain interface of the coin and its accounts.
 func (coin *Coin) TstSetMakeBlockchain(f func() blockchain.Interface) {
 	coin.makeBlockchain = f
+	coin.makeAccountBlockchain = func(string) blockchain.Interface { return f() }
+}
+
+// newAccountBlockchain returns a new connection to the Electrum servers for an account. It uses
+// its own Tor circuit if Tor is enabled, so that the servers can't link the addresses of the
+// different accounts of the coin.
+func (coin *Coin) newAccountBlockchain(isolationID string) blockchain.Interface {
+	return coin.makeAccountBlockchain(isolationID)
 }
 
 // Initialize implements coinpkg.Coin.
@@ -225,6 +250,30 @@ func (coin *Coin) Blockchain() blockchain.Interface {
 	return coin.blockchain
 }
 
+// SetFeeEstimation configures the user-defined fee presets and the optional mempool.space
+// compatible API used for fee estimation. It must be called before accounts of this coin are
+// created.
+func (coin *Coin) SetFeeEstimation(presets []config.FeePreset, mempoolSpace *feeestimate.MempoolSpace) {
+	coin.feePresets = presets
+	coin.mempoolSpace = mempoolSpace
+}
+
+// FeePresets returns the user-defined fee targets.
+func (coin *Coin) FeePresets() []config.FeePreset {
+	return coin.feePresets
+}
+
+// FeeEstimator returns the estimator for the fee targets. It must be called after Initialize().
+// The mempool.space API is queried first if configured, then the Electrum server's fee estimate.
+// The fee histogram of the Electrum server's mempool serves as the last fallback.
+func (coin *Coin) FeeEstimator() feeestimate.Estimator {
+	estimators := feeestimate.Fallback{}
+	if coin.mempoolSpace != nil {
+		estimators = append(estimators, coin.mempoolSpace)
+	}
+	return append(estimators, coin.blockchain, feeestimate.HistogramEstimator{Source: coin.blockchain})
+}
+
 // Headers returns the coin headers.
 func (coin *Coin) Headers() *headers.Headers {
 	return coin.headers
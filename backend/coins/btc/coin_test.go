@@ -17,14 +17,18 @@ package btc_test
 
 import (
 	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
@@ -51,8 +55,9 @@ type testSuite struct {
 	unit string
 	net  *chaincfg.Params
 
-	dbFolder string
-	coin     *btc.Coin
+	dbFolder  string
+	coin      *btc.Coin
+	chainMock *blockchainMock.BlockchainMock
 }
 
 func (s *testSuite) SetupTest() {
@@ -65,6 +70,7 @@ func (s *testSuite) SetupTest() {
 		result func(*types.Header)) {
 
 	}
+	s.chainMock = blockchainMock
 	s.coin.TstSetMakeBlockchain(func() blockchain.Interface { return blockchainMock })
 	s.coin.Initialize()
 }
@@ -91,6 +97,36 @@ func (s *testSuite) TestCoin() {
 	require.Equal(s.T(), explorer, s.coin.BlockExplorerTransactionURLPrefix())
 }
 
+func (s *testSuite) TestFeeEstimator() {
+	s.chainMock.MockFeeHistogram = func() (feeestimate.Histogram, error) {
+		return feeestimate.Histogram{{FeeRate: 20, VSize: 1000000}}, nil
+	}
+	s.chainMock.MockEstimateFee = func(blocks int) (btcutil.Amount, error) {
+		return 5000, nil
+	}
+	feeRatePerKb, err := s.coin.FeeEstimator().EstimateFee(1)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), btcutil.Amount(5000), feeRatePerKb)
+
+	// Fall back to the histogram if the server's estimate is not available.
+	s.chainMock.MockEstimateFee = func(blocks int) (btcutil.Amount, error) {
+		return 0, errp.New("not enough data")
+	}
+	feeRatePerKb, err = s.coin.FeeEstimator().EstimateFee(1)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), btcutil.Amount(20000), feeRatePerKb)
+
+	// The mempool.space API is queried first if configured.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"fastestFee":30,"halfHourFee":20,"hourFee":10,"economyFee":3,"minimumFee":1}`))
+	}))
+	defer server.Close()
+	s.coin.SetFeeEstimation(nil, feeestimate.NewMempoolSpace(server.URL+"/", server.Client()))
+	feeRatePerKb, err = s.coin.FeeEstimator().EstimateFee(1)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), btcutil.Amount(30000), feeRatePerKb)
+}
+
 func (s *testSuite) TestFormatAmount() {
 	for _, isFee := range []bool{false, true} {
 		require.Equal(s.T(), "12.34568910", s.coin.FormatAmount(
@@ -221,7 +221,7 @@ func (tx *Tx) UnverifiedTransactions() ([]chainhash.Hash, error) {
 }
 
 // MarkTxVerified implements transactions.DBTxInterface.
-func (tx *Tx) MarkTxVerified(txHash chainhash.Hash, headerTimestamp time.Time) error {
+func (tx *Tx) MarkTxVerified(txHash chainhash.Hash, headerTimestamp time.Time, blockHash chainhash.Hash) error {
 	bucketUnverifiedTransactions, err := tx.tx.CreateBucketIfNotExists([]byte(bucketUnverifiedTransactionsKey))
 	if err != nil {
 		panic(errp.WithStack(err))
@@ -233,6 +233,24 @@ func (tx *Tx) MarkTxVerified(txHash chainhash.Hash, headerTimestamp time.Time) e
 		truth := true
 		walletTx.Verified = &truth
 		walletTx.HeaderTimestamp = &headerTimestamp
+		walletTx.BlockHash = &blockHash
+	})
+}
+
+// MarkTxUnverified implements transactions.DBTxInterface.
+func (tx *Tx) MarkTxUnverified(txHash chainhash.Hash) error {
+	bucketUnverifiedTransactions, err := tx.tx.CreateBucketIfNotExists([]byte(bucketUnverifiedTransactionsKey))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	if err := bucketUnverifiedTransactions.Put(txHash[:], nil); err != nil {
+		return errp.WithStack(err)
+	}
+	return tx.modifyTx(txHash[:], func(walletTx *transactions.DBTxInfo) {
+		walletTx.Height = 0
+		walletTx.Verified = nil
+		walletTx.HeaderTimestamp = nil
+		walletTx.BlockHash = nil
 	})
 }
 
@@ -172,12 +172,14 @@ func TestTxQuick(t *testing.T) {
 			txHash := txHash
 			t.Run("", func(t *testing.T) {
 				expectedHeaderTimestamp := time.Unix(time.Now().Unix(), 123)
-				require.NoError(t, tx.MarkTxVerified(txHash, expectedHeaderTimestamp))
+				expectedBlockHash := chainhash.HashH(txHash[:])
+				require.NoError(t, tx.MarkTxVerified(txHash, expectedHeaderTimestamp, expectedBlockHash))
 				delete(allUnverifiedTxHashes, txHash)
 				require.True(t, checkTxHashes())
 				txInfo, err := tx.TxInfo(txHash)
 				require.NoError(t, err)
 				require.Equal(t, expectedHeaderTimestamp.String(), txInfo.HeaderTimestamp.String())
+				require.Equal(t, &expectedBlockHash, txInfo.BlockHash)
 				now := time.Now()
 				require.NotNil(t, txInfo.CreatedTimestamp)
 				require.True(t,
@@ -191,6 +193,31 @@ func TestTxQuick(t *testing.T) {
 	})
 }
 
+func TestMarkTxUnverified(t *testing.T) {
+	testTx(func(tx *Tx) {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		txHash := msgTx.TxHash()
+		require.NoError(t, tx.PutTx(txHash, msgTx, 10))
+		blockHash := chainhash.HashH([]byte("block"))
+		require.NoError(t, tx.MarkTxVerified(txHash, time.Unix(1234, 0), blockHash))
+		unverified, err := tx.UnverifiedTransactions()
+		require.NoError(t, err)
+		require.Empty(t, unverified)
+
+		require.NoError(t, tx.MarkTxUnverified(txHash))
+		unverified, err = tx.UnverifiedTransactions()
+		require.NoError(t, err)
+		require.Equal(t, []chainhash.Hash{txHash}, unverified)
+		txInfo, err := tx.TxInfo(txHash)
+		require.NoError(t, err)
+		require.Equal(t, 0, txInfo.Height)
+		require.Nil(t, txInfo.Verified)
+		require.Nil(t, txInfo.HeaderTimestamp)
+		require.Nil(t, txInfo.BlockHash)
+		require.Equal(t, msgTx, txInfo.Tx)
+	})
+}
+
 func TestInput(t *testing.T) {
 	testTx(func(tx *Tx) {
 		outpoint1 := wire.OutPoint{
@@ -18,20 +18,34 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"net"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/block-client-go/electrum"
 	"github.com/digitalbitbox/block-client-go/electrum/types"
+	"github.com/digitalbitbox/block-client-go/jsonrpc"
+)
+
+const (
+	// protocolVersion is the Electrum protocol version negotiated by FeeHistogram(). It is the
+	// same as the one of the electrum client.
+	protocolVersion = "1.4"
+
+	feeHistogramTimeout = 30 * time.Second
 )
 
 // client wraps electrum.Client to convert some method inputs and outputs to btcd/btcutil types. It
 // also implements blockchain.Interface.
 type client struct {
 	client *electrum.Client
+	// dial connects to the same server as client.
+	dial func() (net.Conn, error)
 }
 
 func (c *client) EstimateFee(number int) (btcutil.Amount, error) {
@@ -42,6 +56,34 @@ func (c *client) EstimateFee(number int) (btcutil.Amount, error) {
 	return btcutil.NewAmount(fee)
 }
 
+// FeeHistogram does the mempool.get_fee_histogram RPC call. electrum.Client does not support this
+// method, so a separate short-lived connection to the same server is used.
+func (c *client) FeeHistogram() (feeestimate.Histogram, error) {
+	rpc, err := jsonrpc.Connect(&jsonrpc.Options{Dial: c.dial})
+	if err != nil {
+		return nil, err
+	}
+	defer rpc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), feeHistogramTimeout)
+	defer cancel()
+	var serverVersion [2]string
+	if err := rpc.MethodBlocking(
+		ctx, &serverVersion, "server.version", softwareVersion, protocolVersion); err != nil {
+		return nil, err
+	}
+	// Each entry is a pair of the fee rate in sat/vB and the total virtual size of the mempool
+	// transactions paying this fee rate or more, down to the fee rate of the previous entry.
+	var entries [][2]float64
+	if err := rpc.MethodBlocking(ctx, &entries, "mempool.get_fee_histogram"); err != nil {
+		return nil, err
+	}
+	histogram := make(feeestimate.Histogram, len(entries))
+	for i, entry := range entries {
+		histogram[i] = feeestimate.HistogramEntry{FeeRate: entry[0], VSize: int64(entry[1])}
+	}
+	return histogram, nil
+}
+
 func (c *client) GetMerkle(txHash chainhash.Hash, height int) (*blockchain.GetMerkleResult, error) {
 	result, err := c.client.GetMerkle(context.Background(), txHash.String(), height)
 	if err != nil {
@@ -158,15 +158,16 @@ func NewElectrumConnection(serverInfos []*config.ServerInfo, log *logrus.Entry,
 			Connect: func() (*client, error) {
 				log := log.WithField("server", serverInfo.String())
 				log.Info("Trying to connect to backend")
+				dial := func() (net.Conn, error) {
+					return establishConnection(serverInfo, dialer)
+				}
 				c, err := electrum.Connect(&electrum.Options{
 					SoftwareVersion: softwareVersion,
 					// Slightly less than PingInterval according to the `electrum.Options` docs - a
 					// ping is a method call by itself.
 					MethodTimeout: 50 * time.Second,
 					PingInterval:  time.Minute,
-					Dial: func() (net.Conn, error) {
-						return establishConnection(serverInfo, dialer)
-					},
+					Dial:          dial,
 				})
 				if err != nil {
 					log.WithError(err).Error("Failover: backend is down")
@@ -175,7 +176,7 @@ func NewElectrumConnection(serverInfos []*config.ServerInfo, log *logrus.Entry,
 				log.
 					WithField("server-version", c.ServerVersion().String()).
 					Infof("Successfully connected to backend %s", serverInfo.Server)
-				return &client{client: c}, nil
+				return &client{client: c, dial: dial}, nil
 			},
 		})
 	}
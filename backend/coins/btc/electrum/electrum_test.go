@@ -15,13 +15,17 @@
 package electrum
 
 import (
+	"bufio"
 	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
 	"github.com/stretchr/testify/assert"
@@ -135,3 +139,41 @@ func TestEstablishConnectionTLS(t *testing.T) {
 		})
 	}
 }
+
+func TestFeeHistogram(t *testing.T) {
+	var methods []string
+	dial := func() (net.Conn, error) {
+		clientConn, serverConn := net.Pipe()
+		go func() {
+			defer serverConn.Close()
+			scanner := bufio.NewScanner(serverConn)
+			for scanner.Scan() {
+				var request struct {
+					ID     int    `json:"id"`
+					Method string `json:"method"`
+				}
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &request))
+				methods = append(methods, request.Method)
+				var result string
+				switch request.Method {
+				case "server.version":
+					result = `["fake", "1.4"]`
+				case "mempool.get_fee_histogram":
+					result = `[[53.5, 102030], [38, 110995], [1, 500000]]`
+				}
+				_, err := fmt.Fprintf(serverConn,
+					`{"jsonrpc": "2.0", "id": %d, "result": %s}`+"\n", request.ID, result)
+				require.NoError(t, err)
+			}
+		}()
+		return clientConn, nil
+	}
+	histogram, err := (&client{dial: dial}).FeeHistogram()
+	require.NoError(t, err)
+	require.Equal(t, feeestimate.Histogram{
+		{FeeRate: 53.5, VSize: 102030},
+		{FeeRate: 38, VSize: 110995},
+		{FeeRate: 1, VSize: 500000},
+	}, histogram)
+	require.Equal(t, []string{"server.version", "mempool.get_fee_histogram"}, methods)
+}
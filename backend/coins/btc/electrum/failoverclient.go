@@ -16,11 +16,13 @@ package electrum
 
 import (
 	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/feeestimate"
 	"github.com/digitalbitbox/block-client-go/electrum/types"
 	"github.com/digitalbitbox/block-client-go/failover"
 )
@@ -35,8 +37,18 @@ type failoverClient struct {
 	onConnectionErrorChangedCallbacks []func(error)
 	// covers connectionError and onConnectionErrorChangedCallbacks.
 	mu sync.RWMutex
+
+	// feeHistogram is the last fetched fee histogram, reused until feeHistogramMaxAge passed, as
+	// the fee targets of all accounts are estimated at every new block.
+	feeHistogram     feeestimate.Histogram
+	feeHistogramTime time.Time
+	// covers feeHistogram and feeHistogramTime.
+	feeHistogramMu sync.Mutex
 }
 
+// feeHistogramMaxAge is how long a fetched fee histogram is reused.
+const feeHistogramMaxAge = time.Minute
+
 // newFailoverClient creates a new failover client.
 func newFailoverClient(opts *failover.Options[*client]) *failoverClient {
 	return &failoverClient{
@@ -74,6 +86,23 @@ func (f *failoverClient) EstimateFee(number int) (btcutil.Amount, error) {
 	})
 }
 
+func (f *failoverClient) FeeHistogram() (feeestimate.Histogram, error) {
+	f.feeHistogramMu.Lock()
+	defer f.feeHistogramMu.Unlock()
+	if f.feeHistogram != nil && time.Since(f.feeHistogramTime) < feeHistogramMaxAge {
+		return f.feeHistogram, nil
+	}
+	histogram, err := failover.Call(f.failover, func(c *client) (feeestimate.Histogram, error) {
+		return c.FeeHistogram()
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.feeHistogram = histogram
+	f.feeHistogramTime = time.Now()
+	return histogram, nil
+}
+
 func (f *failoverClient) GetMerkle(txHash chainhash.Hash, height int) (*blockchain.GetMerkleResult, error) {
 	return failover.Call(f.failover, func(c *client) (*blockchain.GetMerkleResult, error) {
 		return c.GetMerkle(txHash, height)
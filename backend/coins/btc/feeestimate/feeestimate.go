@@ -0,0 +1,110 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package feeestimate provides fee rate estimators for btc-based coins.
+package feeestimate
+
+import (
+	"sort"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const (
+	// blockVSize is the maximum virtual size of a block.
+	blockVSize = 1000000
+
+	// minFeeRatePerKb is the estimate if the mempool is cleared within the target. The caller is
+	// expected to raise it to the minimum relay fee if needed.
+	minFeeRatePerKb = btcutil.Amount(1000)
+)
+
+// Estimator estimates fee rates.
+type Estimator interface {
+	// EstimateFee returns the fee rate in sat/kB needed for a transaction to be confirmed within
+	// the given number of blocks.
+	EstimateFee(blocks int) (btcutil.Amount, error)
+}
+
+// Fallback is an estimator trying each estimator in turn until one succeeds. If all fail, the
+// error of the last one is returned.
+type Fallback []Estimator
+
+// EstimateFee implements Estimator.
+func (fallback Fallback) EstimateFee(blocks int) (btcutil.Amount, error) {
+	err := errp.New("no fee estimators")
+	for _, estimator := range fallback {
+		var feeRatePerKb btcutil.Amount
+		feeRatePerKb, err = estimator.EstimateFee(blocks)
+		if err == nil {
+			return feeRatePerKb, nil
+		}
+	}
+	return 0, err
+}
+
+// HistogramEntry is the total virtual size of mempool transactions paying a given fee rate.
+type HistogramEntry struct {
+	// FeeRate in sat/vB.
+	FeeRate float64
+	VSize   int64
+}
+
+// Histogram describes the fee rates of the transactions in the mempool, like the result of
+// Electrum's `mempool.get_fee_histogram`.
+type Histogram []HistogramEntry
+
+// EstimateFee implements Estimator. The estimate is the fee rate needed to be part of the
+// transactions which fill the next `blocks` blocks, assuming no new transactions arrive.
+func (histogram Histogram) EstimateFee(blocks int) (btcutil.Amount, error) {
+	if blocks < 1 {
+		return 0, errp.Newf("invalid target %d", blocks)
+	}
+	sorted := make(Histogram, len(histogram))
+	copy(sorted, histogram)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].FeeRate > sorted[j].FeeRate })
+	capacity := int64(blocks) * blockVSize
+	var vsize int64
+	for _, entry := range sorted {
+		vsize += entry.VSize
+		if vsize >= capacity {
+			feeRatePerKb := btcutil.Amount(entry.FeeRate * 1000)
+			if feeRatePerKb < minFeeRatePerKb {
+				return minFeeRatePerKb, nil
+			}
+			return feeRatePerKb, nil
+		}
+	}
+	return minFeeRatePerKb, nil
+}
+
+// HistogramSource provides the current fee histogram.
+type HistogramSource interface {
+	FeeHistogram() (Histogram, error)
+}
+
+// HistogramEstimator estimates fee rates based on the histogram of its source.
+type HistogramEstimator struct {
+	Source HistogramSource
+}
+
+// EstimateFee implements Estimator.
+func (estimator HistogramEstimator) EstimateFee(blocks int) (btcutil.Amount, error) {
+	histogram, err := estimator.Source.FeeHistogram()
+	if err != nil {
+		return 0, err
+	}
+	return histogram.EstimateFee(blocks)
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feeestimate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/stretchr/testify/require"
+)
+
+type estimatorFunc func(int) (btcutil.Amount, error)
+
+func (f estimatorFunc) EstimateFee(blocks int) (btcutil.Amount, error) {
+	return f(blocks)
+}
+
+func TestFallback(t *testing.T) {
+	failing := estimatorFunc(func(int) (btcutil.Amount, error) { return 0, errors.New("failed") })
+	fixed := estimatorFunc(func(blocks int) (btcutil.Amount, error) {
+		return btcutil.Amount(blocks * 1000), nil
+	})
+
+	_, err := Fallback{}.EstimateFee(2)
+	require.Error(t, err)
+	_, err = Fallback{failing}.EstimateFee(2)
+	require.EqualError(t, err, "failed")
+
+	feeRatePerKb, err := Fallback{failing, fixed}.EstimateFee(2)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(2000), feeRatePerKb)
+}
+
+func TestHistogram(t *testing.T) {
+	// Unsorted on purpose.
+	histogram := Histogram{
+		{FeeRate: 10, VSize: 600000},
+		{FeeRate: 50, VSize: 500000},
+		{FeeRate: 2.5, VSize: 1500000},
+		{FeeRate: 0.5, VSize: 1000000},
+	}
+	for blocks, expected := range map[int]btcutil.Amount{
+		1: 10000,
+		2: 2500,
+		3: 1000,
+		4: 1000,
+		5: 1000,
+		6: 1000,
+	} {
+		feeRatePerKb, err := histogram.EstimateFee(blocks)
+		require.NoError(t, err)
+		require.Equal(t, expected, feeRatePerKb, "blocks: %d", blocks)
+	}
+
+	feeRatePerKb, err := Histogram{}.EstimateFee(1)
+	require.NoError(t, err)
+	require.Equal(t, minFeeRatePerKb, feeRatePerKb)
+
+	_, err = histogram.EstimateFee(0)
+	require.Error(t, err)
+}
+
+func TestMempoolSpace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/fees/recommended":
+			_, _ = w.Write([]byte(`{"fastestFee":30,"halfHourFee":20,"hourFee":10.5,"economyFee":3,"minimumFee":1}`))
+		case "/api/v1/fees/mempool-blocks":
+			_, _ = w.Write([]byte(`[
+{"blockSize":1500000,"blockVSize":997000,"nTx":3000,"totalFees":1,"medianFee":25,"feeRange":[]},
+{"blockSize":1500000,"blockVSize":998000,"nTx":3000,"totalFees":1,"medianFee":8,"feeRange":[]},
+{"blockSize":9000000,"blockVSize":8000000,"nTx":3000,"totalFees":1,"medianFee":2,"feeRange":[]}
+]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	mempoolSpace := NewMempoolSpace(server.URL+"/", server.Client())
+	for blocks, expected := range map[int]btcutil.Amount{
+		1:    30000,
+		2:    20000,
+		6:    10500,
+		7:    2000,
+		1008: 1000,
+	} {
+		feeRatePerKb, err := mempoolSpace.EstimateFee(blocks)
+		require.NoError(t, err)
+		require.Equal(t, expected, feeRatePerKb, "blocks: %d", blocks)
+	}
+
+	_, err := NewMempoolSpace(server.URL+"/unknown", server.Client()).EstimateFee(2)
+	require.Error(t, err)
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feeestimate
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// MempoolSpace queries a mempool.space compatible API, e.g. a self-hosted instance, for fee
+// estimates.
+type MempoolSpace struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewMempoolSpace returns an estimator using the API at baseURL, e.g. "https://mempool.space".
+func NewMempoolSpace(baseURL string, httpClient *http.Client) *MempoolSpace {
+	return &MempoolSpace{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// recommendedFees is the response of `/api/v1/fees/recommended`. The fee rates are in sat/vB.
+type recommendedFees struct {
+	FastestFee  float64 `json:"fastestFee"`
+	HalfHourFee float64 `json:"halfHourFee"`
+	HourFee     float64 `json:"hourFee"`
+}
+
+// mempoolBlock is an element of the response of `/api/v1/fees/mempool-blocks`, a projected block
+// built from the mempool.
+type mempoolBlock struct {
+	BlockVSize float64 `json:"blockVSize"`
+	MedianFee  float64 `json:"medianFee"`
+}
+
+func (mempoolSpace *MempoolSpace) get(endpoint string, result interface{}) error {
+	response, err := mempoolSpace.httpClient.Get(mempoolSpace.baseURL + endpoint)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		return errp.Newf("%s: expected 200 OK, got %d", endpoint, response.StatusCode)
+	}
+	const max = 1 << 20
+	if err := json.NewDecoder(io.LimitReader(response.Body, max)).Decode(result); err != nil {
+		return errp.WithStack(err)
+	}
+	return nil
+}
+
+// FeeHistogram implements HistogramSource, using the projected mempool blocks.
+func (mempoolSpace *MempoolSpace) FeeHistogram() (Histogram, error) {
+	var blocks []mempoolBlock
+	if err := mempoolSpace.get("/api/v1/fees/mempool-blocks", &blocks); err != nil {
+		return nil, err
+	}
+	histogram := make(Histogram, len(blocks))
+	for i, block := range blocks {
+		histogram[i] = HistogramEntry{FeeRate: block.MedianFee, VSize: int64(block.BlockVSize)}
+	}
+	return histogram, nil
+}
+
+// EstimateFee implements Estimator. Targets of up to six blocks use the recommended fees, longer
+// targets are estimated from the projected mempool blocks.
+func (mempoolSpace *MempoolSpace) EstimateFee(blocks int) (btcutil.Amount, error) {
+	if blocks > 6 {
+		return HistogramEstimator{Source: mempoolSpace}.EstimateFee(blocks)
+	}
+	var fees recommendedFees
+	if err := mempoolSpace.get("/api/v1/fees/recommended", &fees); err != nil {
+		return 0, err
+	}
+	var feeRate float64
+	switch {
+	case blocks < 1:
+		return 0, errp.Newf("invalid target %d", blocks)
+	case blocks == 1:
+		feeRate = fees.FastestFee
+	case blocks <= 3:
+		feeRate = fees.HalfHourFee
+	default:
+		feeRate = fees.HourFee
+	}
+	return btcutil.Amount(feeRate * 1000), nil
+}
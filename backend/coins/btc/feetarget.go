@@ -23,6 +23,10 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
 )
 
+// maxFeeTargetBlocks is the longest confirmation target that can be estimated, as in Bitcoin
+// Core's `estimatesmartfee`.
+const maxFeeTargetBlocks = 1008
+
 // FeeTarget contains the fee rate for a specific fee target.
 type FeeTarget struct {
 	// Blocks is the target number of blocks in which the transaction should be confirmed.
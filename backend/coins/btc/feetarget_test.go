@@ -20,6 +20,8 @@ import (
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
 	"github.com/stretchr/testify/require"
 )
 
@@ -54,3 +56,36 @@ func TestFeeTarget(t *testing.T) {
 		(&FeeTarget{feeRatePerKb: amt(10001)}).FormattedFeeRate(),
 	)
 }
+
+func TestNewFeeTargets(t *testing.T) {
+	log := logging.Get().WithGroup("feetarget_test")
+	feeTargets := newFeeTargets([]config.FeePreset{
+		{Name: "economy batch", Blocks: 1008},
+		{Name: "same as normal", Blocks: 6},
+		{Name: "", Blocks: 100},
+		{Name: "too long", Blocks: 1009},
+		{Name: "zero", Blocks: 0},
+		{Name: "economy batch", Blocks: 144},
+	}, log)
+	codes := []accounts.FeeTargetCode{}
+	for _, feeTarget := range feeTargets {
+		codes = append(codes, feeTarget.code)
+	}
+	require.Equal(t,
+		[]accounts.FeeTargetCode{
+			"preset:economy batch",
+			accounts.FeeTargetCodeEconomy,
+			accounts.FeeTargetCodeLow,
+			"preset:same as normal",
+			accounts.FeeTargetCodeNormal,
+			accounts.FeeTargetCodeHigh,
+		},
+		codes)
+	require.Equal(t, 1008, feeTargets[0].blocks)
+
+	code, err := accounts.NewFeeTargetCode("preset:economy batch")
+	require.NoError(t, err)
+	require.Equal(t, accounts.NewPresetFeeTargetCode("economy batch"), code)
+	_, err = accounts.NewFeeTargetCode("preset:")
+	require.Error(t, err)
+}
@@ -18,6 +18,7 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/big"
 	"net/http"
 	"os"
@@ -27,16 +28,21 @@ import (
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/costbasis"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/export"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/message"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/util"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/etherscan"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox02-api-go/api/firmware"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
@@ -57,14 +63,18 @@ func NewHandlers(
 	handleFunc("/transactions", handlers.ensureAccountInitialized(handlers.getAccountTransactions)).Methods("GET")
 	handleFunc("/transaction", handlers.ensureAccountInitialized(handlers.getAccountTransaction)).Methods("GET")
 	handleFunc("/export", handlers.ensureAccountInitialized(handlers.postExportTransactions)).Methods("POST")
+	handleFunc("/export-formats", handlers.getExportFormats).Methods("GET")
 	handleFunc("/info", handlers.ensureAccountInitialized(handlers.getAccountInfo)).Methods("GET")
 	handleFunc("/utxos", handlers.ensureAccountInitialized(handlers.getUTXOs)).Methods("GET")
 	handleFunc("/balance", handlers.ensureAccountInitialized(handlers.getAccountBalance)).Methods("GET")
+	handleFunc("/cost-basis", handlers.ensureAccountInitialized(handlers.getCostBasis)).Methods("GET")
 	handleFunc("/sendtx", handlers.ensureAccountInitialized(handlers.postAccountSendTx)).Methods("POST")
 	handleFunc("/fee-targets", handlers.ensureAccountInitialized(handlers.getAccountFeeTargets)).Methods("GET")
 	handleFunc("/tx-proposal", handlers.ensureAccountInitialized(handlers.postAccountTxProposal)).Methods("POST")
 	handleFunc("/receive-addresses", handlers.ensureAccountInitialized(handlers.getReceiveAddresses)).Methods("GET")
 	handleFunc("/verify-address", handlers.ensureAccountInitialized(handlers.postVerifyAddress)).Methods("POST")
+	handleFunc("/sign-message", handlers.ensureAccountInitialized(handlers.postSignMessage)).Methods("POST")
+	handleFunc("/proof-of-reserves", handlers.ensureAccountInitialized(handlers.postProofOfReserves)).Methods("POST")
 	handleFunc("/can-verify-extended-public-key", handlers.ensureAccountInitialized(handlers.getCanVerifyExtendedPublicKey)).Methods("GET")
 	handleFunc("/verify-extended-public-key", handlers.ensureAccountInitialized(handlers.postVerifyExtendedPublicKey)).Methods("POST")
 	handleFunc("/has-secure-output", handlers.ensureAccountInitialized(handlers.getHasSecureOutput)).Methods("GET")
@@ -257,12 +267,40 @@ func (handlers *Handlers) getAccountTransaction(r *http.Request) (interface{}, e
 	return nil, nil
 }
 
-func (handlers *Handlers) postExportTransactions(_ *http.Request) (interface{}, error) {
+func (handlers *Handlers) getExportFormats(_ *http.Request) (interface{}, error) {
+	return export.Formats(), nil
+}
+
+// postExportTransactions exports the transactions to a file. The optional JSON body selects the
+// format (see `export.Formats()`) and, for formats containing fiat values, the fiat currency.
+func (handlers *Handlers) postExportTransactions(r *http.Request) (interface{}, error) {
 	type result struct {
 		Success      bool   `json:"success"`
 		ErrorMessage string `json:"errorMessage"`
 	}
-	name := fmt.Sprintf("%s-%s-export.csv", time.Now().Format("2006-01-02-at-15-04-05"), handlers.account.Config().Config.Code)
+	var args struct {
+		Format export.Format `json:"format"`
+		Fiat   string        `json:"fiat"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil && err != io.EOF {
+		return nil, errp.WithStack(err)
+	}
+	exporter, err := export.Lookup(args.Format)
+	if err != nil {
+		return result{Success: false, ErrorMessage: err.Error()}, nil
+	}
+	if exporter.NeedsFiat() && args.Fiat == "" {
+		return result{Success: false, ErrorMessage: "fiat missing"}, nil
+	}
+	format := args.Format
+	if format == "" {
+		format = export.FormatCSV
+	}
+	name := fmt.Sprintf("%s-%s-export", time.Now().Format("2006-01-02-at-15-04-05"), handlers.account.Config().Config.Code)
+	if format != export.FormatCSV {
+		name += "-" + string(format)
+	}
+	name += "." + exporter.FileExtension()
 	downloadsDir, err := config.DownloadsDir()
 	if err != nil {
 		handlers.log.WithError(err).Error("error exporting account")
@@ -286,7 +324,13 @@ func (handlers *Handlers) postExportTransactions(_ *http.Request) (interface{},
 		handlers.log.WithError(err).Error("error exporting account")
 		return result{Success: false, ErrorMessage: err.Error()}, nil
 	}
-	if err := handlers.account.ExportCSV(file, transactions); err != nil {
+	err = exporter.Export(file, []*export.Input{{
+		Account:      handlers.account,
+		Transactions: transactions,
+		Rates:        handlers.account.Config().RateUpdater,
+		Fiat:         args.Fiat,
+	}})
+	if err != nil {
 		_ = file.Close()
 		handlers.log.WithError(err).Error("error exporting account")
 		return result{Success: false, ErrorMessage: err.Error()}, nil
@@ -344,6 +388,35 @@ func (handlers *Handlers) getAccountBalance(_ *http.Request) (interface{}, error
 	}, nil
 }
 
+// getCostBasis returns the cost basis and gains of the account, valued in the fiat currency given
+// by the `fiat` query parameter, which defaults to the main fiat currency. The `method`, `fee` and
+// `transfers` query parameters select the options, see `costbasis.Options`.
+func (handlers *Handlers) getCostBasis(r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	fiat := query.Get("fiat")
+	if fiat == "" {
+		fiat = handlers.account.Config().GetMainFiat()
+	}
+	account, err := costbasis.NewAccount(handlers.account)
+	if err != nil {
+		return nil, err
+	}
+	report, err := costbasis.Compute(
+		[]*costbasis.Account{account},
+		handlers.account.Config().RateUpdater,
+		fiat,
+		costbasis.Options{
+			Method:    costbasis.Method(query.Get("method")),
+			Fee:       costbasis.FeeTreatment(query.Get("fee")),
+			Transfers: costbasis.TransferTreatment(query.Get("transfers")),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return report.Format(util.FormatBtcAsSat(handlers.account.Config().BtcCurrencyUnit)), nil
+}
+
 type sendTxInput struct {
 	accounts.TxProposalArgs
 }
@@ -400,6 +473,14 @@ func (handlers *Handlers) postAccountSendTx(r *http.Request) (interface{}, error
 		if err.Error() == etherscan.ERC20GasErr {
 			result["errorCode"] = errors.ERC20InsufficientGasFunds.Error()
 		}
+		if errp.Cause(err) == errors.ErrKeystoreNotConnected {
+			// The frontend prompts the user to connect the device.
+			result["errorCode"] = errors.ErrKeystoreNotConnected.Error()
+		}
+		if errp.Cause(err) == software.ErrLocked {
+			// The frontend prompts the user to unlock the software keystore.
+			result["errorCode"] = software.ErrLocked.Error()
+		}
 		return result, nil
 	}
 	return map[string]interface{}{"success": true}, nil
@@ -493,18 +574,23 @@ func (handlers *Handlers) getReceiveAddresses(_ *http.Request) (interface{}, err
 	type jsonAddress struct {
 		Address   string `json:"address"`
 		AddressID string `json:"addressID"`
+		// NotVerified is true if the address cannot be verified on the device because the
+		// keystore is not connected, i.e. it was derived only from the remembered xpubs.
+		NotVerified bool `json:"notVerified"`
 	}
 	type jsonAddressList struct {
 		ScriptType *signing.ScriptType `json:"scriptType"`
 		Addresses  []jsonAddress       `json:"addresses"`
 	}
 	addressList := []jsonAddressList{}
+	notVerified := handlers.account.Config().Keystore == nil
 	for _, addresses := range handlers.account.GetUnusedReceiveAddresses() {
 		addrs := []jsonAddress{}
 		for _, address := range addresses.Addresses {
 			addrs = append(addrs, jsonAddress{
-				Address:   address.EncodeForHumans(),
-				AddressID: address.ID(),
+				Address:     address.EncodeForHumans(),
+				AddressID:   address.ID(),
+				NotVerified: notVerified,
 			})
 		}
 		addressList = append(addressList, jsonAddressList{
@@ -523,10 +609,95 @@ func (handlers *Handlers) postVerifyAddress(r *http.Request) (interface{}, error
 	return handlers.account.VerifyAddress(addressID)
 }
 
+func (handlers *Handlers) postSignMessage(r *http.Request) (interface{}, error) {
+	var input struct {
+		// AddressID is the receive address to sign with. Not needed for Ethereum accounts, which
+		// have only one address.
+		AddressID string `json:"addressID"`
+		Message   string `json:"message"`
+		// Format is "legacy" or "bip322" for Bitcoin, "eip191" or "eip712" for Ethereum.
+		Format string `json:"format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	var signedMessage interface{}
+	var err error
+	switch specificAccount := handlers.account.(type) {
+	case *btc.Account:
+		signedMessage, err = specificAccount.SignMessage(
+			input.AddressID, input.Message, message.Format(input.Format))
+	case *eth.Account:
+		signedMessage, err = specificAccount.SignMessage(input.Message, eth.MessageFormat(input.Format))
+	default:
+		err = errp.New("message signing is not supported for this account")
+	}
+	if errp.Cause(err) == keystore.ErrSigningAborted || firmware.IsErrorAbort(err) {
+		return map[string]interface{}{"success": false, "aborted": true}, nil
+	}
+	if err != nil {
+		handlers.log.WithError(err).Error("Failed to sign message")
+		result := map[string]interface{}{"success": false, "errorMessage": err.Error()}
+		if errp.Cause(err) == btc.ErrBIP322NotSupported {
+			result["errorCode"] = btc.ErrBIP322NotSupported.Error()
+		}
+		if errp.Cause(err) == errors.ErrKeystoreNotConnected {
+			result["errorCode"] = errors.ErrKeystoreNotConnected.Error()
+		}
+		if errp.Cause(err) == software.ErrLocked {
+			result["errorCode"] = software.ErrLocked.Error()
+		}
+		return result, nil
+	}
+	return map[string]interface{}{"success": true, "signedMessage": signedMessage}, nil
+}
+
+func (handlers *Handlers) postProofOfReserves(r *http.Request) (interface{}, error) {
+	var input struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return map[string]interface{}{
+			"success":      false,
+			"errorMessage": "proofs of reserves are only supported for Bitcoin accounts",
+		}, nil
+	}
+	proof, err := btcAccount.ProofOfReserves(input.Message)
+	if errp.Cause(err) == keystore.ErrSigningAborted || firmware.IsErrorAbort(err) {
+		return map[string]interface{}{"success": false, "aborted": true}, nil
+	}
+	if err != nil {
+		handlers.log.WithError(err).Error("Failed to create proof of reserves")
+		result := map[string]interface{}{"success": false, "errorMessage": err.Error()}
+		if errp.Cause(err) == btc.ErrProofOfReservesNotSupported {
+			result["errorCode"] = btc.ErrProofOfReservesNotSupported.Error()
+		}
+		if errp.Cause(err) == errors.ErrKeystoreNotConnected {
+			result["errorCode"] = errors.ErrKeystoreNotConnected.Error()
+		}
+		if errp.Cause(err) == software.ErrLocked {
+			result["errorCode"] = software.ErrLocked.Error()
+		}
+		return result, nil
+	}
+	return map[string]interface{}{
+		"success":    true,
+		"message":    proof.Message,
+		"proof":      proof.Proof,
+		"amount":     handlers.formatBTCAmountAsJSON(proof.Amount, false),
+		"numOutputs": proof.NumOutputs,
+	}, nil
+}
+
 func (handlers *Handlers) getCanVerifyExtendedPublicKey(_ *http.Request) (interface{}, error) {
 	switch specificAccount := handlers.account.(type) {
 	case *btc.Account:
-		return specificAccount.Config().Keystore.CanVerifyExtendedPublicKey(), nil
+		keystore := specificAccount.Config().Keystore
+		return keystore != nil && keystore.CanVerifyExtendedPublicKey(), nil
 	case *eth.Account:
 		// No xpub verification for ethereum accounts
 		return false, nil
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sync/atomic"
 	"time"
 
 	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
@@ -47,6 +48,9 @@ const (
 	EventSynced Event = "synced"
 	// EventNewTip is fired when a new tip is known.
 	EventNewTip Event = "newTip"
+	// EventReorg is fired when a reorg was detected and the headers were rewound. The headers are
+	// re-synced afterwards, followed by EventSynced.
+	EventReorg Event = "reorg"
 )
 
 // Interface represents the public API of this package.
@@ -69,8 +73,9 @@ type Headers struct {
 	blockchain      blockchain.Interface
 	headersPerBatch int
 	lock            locker.Locker
-	// targetHeight is the potential tip height we are syncing up to.
-	targetHeight int
+	// targetHeight is the potential tip height we are syncing up to. It is updated from the
+	// blockchain notification goroutine, hence atomic.
+	targetHeight atomic.Int64
 	// tipAtInitTime is the tip at init time, i.e. the last tip known, loaded from the DB. It is
 	// used to show the sync progress since the last time (catch up).
 	tipAtInitTime int
@@ -109,7 +114,6 @@ func NewHeaders(
 		// We start with a small batch size and increase to the maximum allowed one with the first
 		// response.
 		headersPerBatch: 10,
-		targetHeight:    0,
 		tipAtInitTime:   0,
 		kickChan:        make(chan struct{}, 1),
 		quitChan:        make(chan struct{}),
@@ -168,7 +172,7 @@ func (headers *Headers) SubscribeEvent(f func(event Event)) func() {
 
 // TipHeight returns the height of the tip.
 func (headers *Headers) TipHeight() int {
-	return headers.targetHeight
+	return int(headers.targetHeight.Load())
 }
 
 // Initialize starts the syncing process.
@@ -380,6 +384,7 @@ func (headers *Headers) reorg(db DBInterface, tip int) {
 	if err := db.RevertTo(newTip); err != nil {
 		panic(err)
 	}
+	headers.notifyEvent(EventReorg)
 	headers.kick()
 }
 
@@ -454,7 +459,7 @@ func (headers *Headers) kick() {
 func (headers *Headers) update(blockHeight int) {
 	headers.log.Debugf("new target %d", blockHeight)
 	headers.kick()
-	headers.targetHeight = blockHeight
+	headers.targetHeight.Store(int64(blockHeight))
 	headers.notifyEvent(EventNewTip)
 }
 
@@ -488,7 +493,7 @@ func (headers *Headers) Status() (*Status, error) {
 	return &Status{
 		TipAtInitTime: headers.tipAtInitTime,
 		Tip:           tip,
-		TargetHeight:  headers.targetHeight,
+		TargetHeight:  int(headers.targetHeight.Load()),
 		TipHashHex:    tipHashHex,
 	}, nil
 }
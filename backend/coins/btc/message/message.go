@@ -0,0 +1,265 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package message implements signing and verifying Bitcoin messages, both in the legacy format
+// used by Electrum and BIP137, and in the BIP322 "simple" format for segwit and taproot addresses.
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// Format is the format of a message signature.
+type Format string
+
+const (
+	// FormatLegacy is the 65 byte recoverable signature over the "Bitcoin Signed Message" hash,
+	// as produced by Electrum and Bitcoin Core's `signmessage`. It is supported for P2PKH and,
+	// following Electrum and BIP137, P2WPKH and P2WPKH-P2SH addresses.
+	FormatLegacy Format = "legacy"
+	// FormatBIP322 is the BIP322 "simple" signature, i.e. the witness spending the address in a
+	// virtual transaction committing to the message. It is supported for P2WPKH and P2TR addresses.
+	FormatBIP322 Format = "bip322"
+)
+
+const legacySignatureLen = 65
+
+// ErrInvalidSignature is returned if a signature does not match the address and message.
+var ErrInvalidSignature = errors.New("invalidSignature")
+
+// LegacyHash returns the hash signed by a legacy message signature.
+func LegacyHash(message []byte) []byte {
+	var buf bytes.Buffer
+	// Writing to a bytes.Buffer does not fail.
+	_ = wire.WriteVarString(&buf, 0, "Bitcoin Signed Message:\n")
+	_ = wire.WriteVarBytes(&buf, 0, message)
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// EncodeLegacySignature encodes the 65 byte signature returned by `Keystore.SignBTCMessage()` the
+// way wallets exchange it, in base64.
+func EncodeLegacySignature(signature []byte) (string, error) {
+	if len(signature) != legacySignatureLen {
+		return "", errp.Newf("expected a 65 byte signature, got %d bytes", len(signature))
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// VerifyLegacy verifies a base64 encoded legacy signature of the message by the address.
+func VerifyLegacy(address btcutil.Address, message []byte, signature string, net *chaincfg.Params) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errp.WithStack(ErrInvalidSignature)
+	}
+	return verifyLegacy(address, message, sig, net)
+}
+
+func verifyLegacy(address btcutil.Address, message []byte, sig []byte, net *chaincfg.Params) error {
+	if len(sig) != legacySignatureLen {
+		return errp.WithStack(ErrInvalidSignature)
+	}
+	header := sig[0]
+	if header < 27 || header > 42 {
+		return errp.WithStack(ErrInvalidSignature)
+	}
+	// BIP137 uses the headers 35-38 for P2WPKH-P2SH and 39-42 for P2WPKH, which are otherwise the
+	// same as the compressed P2PKH headers 31-34 used by Electrum for all script types.
+	compactSig := append([]byte{}, sig...)
+	if header >= 35 {
+		compactSig[0] = 31 + (header-35)%4
+	}
+	pubkey, compressed, err := ecdsa.RecoverCompact(compactSig, LegacyHash(message))
+	if err != nil {
+		return errp.WithStack(ErrInvalidSignature)
+	}
+	var serializedPubkey []byte
+	if compressed {
+		serializedPubkey = pubkey.SerializeCompressed()
+	} else {
+		serializedPubkey = pubkey.SerializeUncompressed()
+	}
+	pubkeyHash := btcutil.Hash160(serializedPubkey)
+	candidates := []btcutil.Address{}
+	if p2pkh, err := btcutil.NewAddressPubKeyHash(pubkeyHash, net); err == nil {
+		candidates = append(candidates, p2pkh)
+	}
+	if compressed {
+		if p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(pubkeyHash, net); err == nil {
+			candidates = append(candidates, p2wpkh)
+			redeemScript, err := txscript.PayToAddrScript(p2wpkh)
+			if err != nil {
+				return errp.WithStack(err)
+			}
+			if p2sh, err := btcutil.NewAddressScriptHash(redeemScript, net); err == nil {
+				candidates = append(candidates, p2sh)
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if candidate.EncodeAddress() == address.EncodeAddress() {
+			return nil
+		}
+	}
+	return errp.WithStack(ErrInvalidSignature)
+}
+
+// bip322MessageHash returns the BIP340 tagged hash of the message with the tag
+// "BIP0322-signed-message".
+func bip322MessageHash(message []byte) []byte {
+	tag := sha256.Sum256([]byte("BIP0322-signed-message"))
+	h := sha256.New()
+	h.Write(tag[:])
+	h.Write(tag[:])
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// BIP322ToSpend returns the virtual transaction paying to the pubkey script, committing to the
+// message.
+func BIP322ToSpend(pkScript []byte, message []byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(0)
+	// Building a script with constant size pushes does not fail.
+	sigScript, _ := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_0).
+		AddData(bip322MessageHash(message)).
+		Script()
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{}, Index: 0xFFFFFFFF},
+		SignatureScript:  sigScript,
+		Sequence:         0,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, pkScript))
+	return tx
+}
+
+// BIP322ToSign returns the unsigned virtual transaction spending the output of `toSpend`. The
+// BIP322 signature is the witness of its only input.
+func BIP322ToSign(toSpend *wire.MsgTx) *wire.MsgTx {
+	tx := wire.NewMsgTx(0)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: toSpend.TxHash(), Index: 0},
+		Sequence:         0,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return tx
+}
+
+// EncodeBIP322Signature encodes the witness of the signed `to_sign` transaction as a BIP322
+// "simple" signature.
+func EncodeBIP322Signature(witness wire.TxWitness) (string, error) {
+	var buf bytes.Buffer
+	if err := wire.WriteVarInt(&buf, 0, uint64(len(witness))); err != nil {
+		return "", errp.WithStack(err)
+	}
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(&buf, 0, item); err != nil {
+			return "", errp.WithStack(err)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decodeBIP322Signature(sig []byte) (wire.TxWitness, error) {
+	reader := bytes.NewReader(sig)
+	count, err := wire.ReadVarInt(reader, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count > wire.MaxMessagePayload {
+		return nil, ErrInvalidSignature
+	}
+	witness := wire.TxWitness{}
+	for i := uint64(0); i < count; i++ {
+		item, err := wire.ReadVarBytes(reader, 0, wire.MaxMessagePayload, "witness item")
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, item)
+	}
+	if reader.Len() != 0 {
+		return nil, ErrInvalidSignature
+	}
+	return witness, nil
+}
+
+// VerifyBIP322 verifies a base64 encoded BIP322 "simple" signature of the message by the address.
+func VerifyBIP322(address btcutil.Address, message []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errp.WithStack(ErrInvalidSignature)
+	}
+	return verifyBIP322(address, message, sig)
+}
+
+func verifyBIP322(address btcutil.Address, message []byte, sig []byte) error {
+	switch address.(type) {
+	case *btcutil.AddressWitnessPubKeyHash, *btcutil.AddressTaproot, *btcutil.AddressWitnessScriptHash:
+	default:
+		return errp.Newf("BIP322 simple signatures are only supported for segwit addresses")
+	}
+	witness, err := decodeBIP322Signature(sig)
+	if err != nil {
+		return errp.WithStack(ErrInvalidSignature)
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	toSpend := BIP322ToSpend(pkScript, message)
+	toSign := BIP322ToSign(toSpend)
+	toSign.TxIn[0].Witness = witness
+	prevOutputFetcher := txscript.NewCannedPrevOutputFetcher(pkScript, 0)
+	engine, err := txscript.NewEngine(
+		pkScript, toSign, 0, txscript.StandardVerifyFlags, nil,
+		txscript.NewTxSigHashes(toSign, prevOutputFetcher), 0, prevOutputFetcher)
+	if err != nil {
+		return errp.WithStack(ErrInvalidSignature)
+	}
+	if err := engine.Execute(); err != nil {
+		return errp.WithStack(ErrInvalidSignature)
+	}
+	return nil
+}
+
+// Verify verifies a base64 encoded signature of the message by the address. The format is
+// detected automatically: 65 byte signatures with a valid header byte are legacy signatures, all
+// others are BIP322 signatures. The detected format is returned.
+func Verify(address string, message []byte, signature string, net *chaincfg.Params) (Format, error) {
+	decodedAddress, err := btcutil.DecodeAddress(address, net)
+	if err != nil {
+		return "", errp.WithStack(err)
+	}
+	if !decodedAddress.IsForNet(net) {
+		return "", errp.Newf("address %s is not for %s", address, net.Name)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", errp.WithStack(ErrInvalidSignature)
+	}
+	if len(sig) == legacySignatureLen && sig[0] >= 27 && sig[0] <= 42 {
+		return FormatLegacy, verifyLegacy(decodedAddress, message, sig, net)
+	}
+	return FormatBIP322, verifyBIP322(decodedAddress, message, sig)
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package message
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBIP322Transactions(t *testing.T) {
+	// Test vectors from BIP322.
+	require.Equal(t,
+		"c90c269c4f8fcbe6880f72a721ddfbf1914268a794cbb21cfafee13770ae19f1",
+		hex.EncodeToString(bip322MessageHash([]byte(""))))
+	require.Equal(t,
+		"f0eb03b1a75ac6d9847f55c624a99169b5dccba2a31f5b23bea77ba270de0a7a",
+		hex.EncodeToString(bip322MessageHash([]byte("Hello World"))))
+
+	address, err := btcutil.DecodeAddress(
+		"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	toSpend := BIP322ToSpend(pkScript, []byte(""))
+	require.Equal(t,
+		"c5680aa69bb8d860bf82d4e9cd3504b55dde018de765a91bb566283c545a99a7",
+		toSpend.TxHash().String())
+	require.Equal(t,
+		"1e9654e951a5ba44c8604c4de6c67fd78a27e81dcadcfe1edf638ba3aaebaed6",
+		BIP322ToSign(toSpend).TxHash().String())
+	toSpend = BIP322ToSpend(pkScript, []byte("Hello World"))
+	require.Equal(t,
+		"b79d196740ad5217771c1098fc4a4b51e0535c32236c71f1ea4d61a2d603352b",
+		toSpend.TxHash().String())
+	require.Equal(t,
+		"88737ae86f2077145f93cc4b153ae9a1cb8d56afa511988c149c5c8c9d93bddf",
+		BIP322ToSign(toSpend).TxHash().String())
+}
+
+func TestVerify(t *testing.T) {
+	net := &chaincfg.MainNetParams
+	// Test vectors from BIP322.
+	format, err := Verify(
+		"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+		[]byte("Hello World"),
+		"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		net)
+	require.NoError(t, err)
+	require.Equal(t, FormatBIP322, format)
+	format, err = Verify(
+		"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+		[]byte(""),
+		"AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		net)
+	require.NoError(t, err)
+	require.Equal(t, FormatBIP322, format)
+	format, err = Verify(
+		"bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3",
+		[]byte("Hello World"),
+		"AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ==",
+		net)
+	require.NoError(t, err)
+	require.Equal(t, FormatBIP322, format)
+
+	// Wrong message.
+	_, err = Verify(
+		"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+		[]byte("Hello World!"),
+		"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		net)
+	require.Equal(t, ErrInvalidSignature, errp.Cause(err))
+	// Wrong address.
+	_, err = Verify(
+		"bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3",
+		[]byte("Hello World"),
+		"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		net)
+	require.Equal(t, ErrInvalidSignature, errp.Cause(err))
+	// Not base64.
+	_, err = Verify("bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", []byte(""), "?", net)
+	require.Equal(t, ErrInvalidSignature, errp.Cause(err))
+	// Wrong network.
+	_, err = Verify("bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", []byte(""), "",
+		&chaincfg.TestNet3Params)
+	require.Error(t, err)
+}
+
+func TestLegacy(t *testing.T) {
+	net := &chaincfg.MainNetParams
+	privateKey, _ := btcec.PrivKeyFromBytes([]byte("01234567890123456789012345678901"))
+	pubkeyHash := btcutil.Hash160(privateKey.PubKey().SerializeCompressed())
+	p2pkh, err := btcutil.NewAddressPubKeyHash(pubkeyHash, net)
+	require.NoError(t, err)
+	p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(pubkeyHash, net)
+	require.NoError(t, err)
+	redeemScript, err := txscript.PayToAddrScript(p2wpkh)
+	require.NoError(t, err)
+	p2sh, err := btcutil.NewAddressScriptHash(redeemScript, net)
+	require.NoError(t, err)
+
+	message := []byte("Proof of reserves")
+	sig, err := ecdsa.SignCompact(privateKey, LegacyHash(message), true)
+	require.NoError(t, err)
+	signature, err := EncodeLegacySignature(sig)
+	require.NoError(t, err)
+
+	for _, address := range []btcutil.Address{p2pkh, p2wpkh, p2sh} {
+		require.NoError(t, VerifyLegacy(address, message, signature, net))
+		format, err := Verify(address.EncodeAddress(), message, signature, net)
+		require.NoError(t, err)
+		require.Equal(t, FormatLegacy, format)
+		require.Equal(t, ErrInvalidSignature,
+			errp.Cause(VerifyLegacy(address, []byte("other"), signature, net)))
+	}
+
+	// BIP137 headers.
+	bip137 := append([]byte{}, sig...)
+	bip137[0] += 8
+	signature, err = EncodeLegacySignature(bip137)
+	require.NoError(t, err)
+	require.NoError(t, VerifyLegacy(p2wpkh, message, signature, net))
+
+	otherKey, _ := btcec.PrivKeyFromBytes([]byte("11234567890123456789012345678901"))
+	otherAddress, err := btcutil.NewAddressWitnessPubKeyHash(
+		btcutil.Hash160(otherKey.PubKey().SerializeCompressed()), net)
+	require.NoError(t, err)
+	require.Equal(t, ErrInvalidSignature,
+		errp.Cause(VerifyLegacy(otherAddress, message, signature, net)))
+
+	_, err = EncodeLegacySignature(sig[1:])
+	require.Error(t, err)
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	accountErrors "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/proofofreserves"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// ProofOfReserves is a BIP127 proof of reserves of an account.
+type ProofOfReserves struct {
+	Message string
+	// Proof is the base64 encoded PSBT of the proof, see the proofofreserves package.
+	Proof string
+	// Amount is the amount of all outputs covered by the proof.
+	Amount     btcutil.Amount
+	NumOutputs int
+}
+
+// ErrProofOfReservesNotSupported is returned by ProofOfReserves() if the keystore cannot sign
+// proofs of reserves, e.g. the BitBox02.
+var ErrProofOfReservesNotSupported = errors.New("proofOfReservesNotSupported")
+
+// ProofOfReserves creates a proof of reserves committing to the message, covering all spendable
+// outputs of the account. The keystore signs the proof like a regular transaction, skipping the
+// commitment input.
+func (account *Account) ProofOfReserves(msg string) (*ProofOfReserves, error) {
+	if !account.isInitialized() {
+		return nil, errp.New("account must be initialized")
+	}
+	keystore := account.Config().Keystore
+	if keystore == nil {
+		return nil, errp.WithStack(accountErrors.ErrKeystoreNotConnected)
+	}
+	if !keystore.CanSignProofOfReserves(account.coin.Code()) {
+		return nil, errp.WithStack(ErrProofOfReservesNotSupported)
+	}
+	spendableOutputs := account.SpendableOutputs()
+	if len(spendableOutputs) == 0 {
+		return nil, errp.New("the account has no spendable outputs")
+	}
+
+	commitmentOutPoint := proofofreserves.CommitmentOutPoint(msg)
+	commitmentOutput := proofofreserves.CommitmentOutput()
+	previousOutputs := maketx.PreviousOutputs{
+		commitmentOutPoint: &transactions.SpendableOutput{TxOut: commitmentOutput},
+	}
+	outPoints := make([]wire.OutPoint, len(spendableOutputs))
+	var total btcutil.Amount
+	for index, output := range spendableOutputs {
+		outPoints[index] = output.OutPoint
+		previousOutputs[output.OutPoint] = output.SpendableOutput
+		total += btcutil.Amount(output.Value)
+	}
+	tx := proofofreserves.NewTransaction(msg, outPoints, total)
+
+	signingConfigs := make([]*signing.Configuration, len(account.subaccounts))
+	for i, subacc := range account.subaccounts {
+		signingConfigs[i] = subacc.signingConfiguration
+	}
+	commitmentScriptHashHex := blockchain.NewScriptHashHex(commitmentOutput.PkScript)
+	getAddress := func(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
+		if scriptHashHex == commitmentScriptHashHex {
+			return nil
+		}
+		return account.getAddress(scriptHashHex)
+	}
+	proposedTransaction := &ProposedTransaction{
+		TXProposal: &maketx.TxProposal{
+			Coin:            account.coin,
+			Transaction:     tx,
+			PreviousOutputs: previousOutputs,
+		},
+		AccountSigningConfigurations: signingConfigs,
+		GetAddress:                   getAddress,
+		GetPrevTx:                    account.blockchain.TransactionGet,
+		SkipForeignInputs:            true,
+		Signatures:                   make([]*types.Signature, len(tx.TxIn)),
+		SigHashes:                    txscript.NewTxSigHashes(tx, previousOutputs),
+		FormatUnit:                   account.coin.formatUnit,
+	}
+	if err := keystore.SignTransaction(proposedTransaction); err != nil {
+		return nil, err
+	}
+
+	spentOutputs := []*wire.TxOut{commitmentOutput}
+	for index := 1; index < len(tx.TxIn); index++ {
+		txIn := tx.TxIn[index]
+		spentOutput := previousOutputs[txIn.PreviousOutPoint]
+		signature := proposedTransaction.Signatures[index]
+		if signature == nil {
+			return nil, errp.New("Signature missing")
+		}
+		txIn.SignatureScript, txIn.Witness = getAddress(spentOutput.ScriptHashHex()).SignatureScript(
+			*signature)
+		spentOutputs = append(spentOutputs, spentOutput.TxOut)
+	}
+	// Sanity check, e.g. that the keystore signed with the keys of the inputs.
+	for index := 1; index < len(tx.TxIn); index++ {
+		spentOutput := spentOutputs[index]
+		engine, err := txscript.NewEngine(spentOutput.PkScript, tx, index,
+			txscript.StandardVerifyFlags, nil, proposedTransaction.SigHashes, spentOutput.Value,
+			previousOutputs)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if err := engine.Execute(); err != nil {
+			return nil, errp.WithStack(err)
+		}
+	}
+
+	proof, err := proofofreserves.Encode(tx, spentOutputs)
+	if err != nil {
+		return nil, err
+	}
+	return &ProofOfReserves{
+		Message:    msg,
+		Proof:      proof,
+		Amount:     total,
+		NumOutputs: len(outPoints),
+	}, nil
+}
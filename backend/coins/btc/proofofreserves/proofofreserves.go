@@ -0,0 +1,161 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proofofreserves implements BIP127 proofs of reserves. A proof is a transaction spending
+// a set of unspent outputs together with a commitment input that spends a non-existent output
+// derived from a message, e.g. a challenge chosen by an auditor. Because of the commitment input,
+// the transaction can never be included in a block, so creating a proof does not move any coins.
+// See https://github.com/bitcoin/bips/blob/master/bip-0127.mediawiki.
+//
+// Proofs are exchanged as base64 encoded PSBTs with finalized inputs.
+package proofofreserves
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/psbt"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const commitmentPrefix = "Proof-of-Reserves: "
+
+// CommitmentOutPoint returns the non-existent outpoint spent by the commitment input, which is the
+// first input of the proof. Its transaction ID is the SHA256 hash of the prefixed message.
+func CommitmentOutPoint(message string) wire.OutPoint {
+	return wire.OutPoint{
+		Hash:  chainhash.HashH([]byte(commitmentPrefix + message)),
+		Index: 0,
+	}
+}
+
+// CommitmentOutput returns the output treated as spent by the commitment input when computing the
+// signature hashes of the other inputs. Taproot signature hashes commit to the amounts and scripts
+// of all spent outputs.
+func CommitmentOutput() *wire.TxOut {
+	return wire.NewTxOut(0, []byte{txscript.OP_TRUE})
+}
+
+// NewTransaction creates the unsigned proof transaction committing to the message and spending the
+// given outputs. The only output sends the total amount to an OP_TRUE script.
+func NewTransaction(message string, outPoints []wire.OutPoint, total btcutil.Amount) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	commitmentOutPoint := CommitmentOutPoint(message)
+	tx.AddTxIn(wire.NewTxIn(&commitmentOutPoint, nil, nil))
+	for index := range outPoints {
+		tx.AddTxIn(wire.NewTxIn(&outPoints[index], nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(int64(total), []byte{txscript.OP_TRUE}))
+	return tx
+}
+
+// Encode encodes the signed proof transaction as a base64 PSBT with finalized inputs.
+// spentOutputs contains the output spent by each input, starting with CommitmentOutput().
+func Encode(tx *wire.MsgTx, spentOutputs []*wire.TxOut) (string, error) {
+	if len(spentOutputs) != len(tx.TxIn) {
+		return "", errp.New("there needs to be exactly one output being spent per input")
+	}
+	unsignedTx := tx.Copy()
+	for _, txIn := range unsignedTx.TxIn {
+		txIn.SignatureScript = nil
+		txIn.Witness = nil
+	}
+	packet, err := psbt.New(unsignedTx)
+	if err != nil {
+		return "", err
+	}
+	for index, txIn := range tx.TxIn {
+		input := &packet.Inputs[index]
+		var txOutBuf bytes.Buffer
+		if err := wire.WriteTxOut(&txOutBuf, 0, 0, spentOutputs[index]); err != nil {
+			return "", errp.WithStack(err)
+		}
+		input.Add(psbt.InWitnessUTXO, nil, txOutBuf.Bytes())
+		input.Add(psbt.InFinalScriptSig, nil, txIn.SignatureScript)
+		if len(txIn.Witness) != 0 {
+			var witnessBuf bytes.Buffer
+			if err := wire.WriteVarInt(&witnessBuf, 0, uint64(len(txIn.Witness))); err != nil {
+				return "", errp.WithStack(err)
+			}
+			for _, item := range txIn.Witness {
+				if err := wire.WriteVarBytes(&witnessBuf, 0, item); err != nil {
+					return "", errp.WithStack(err)
+				}
+			}
+			input.Add(psbt.InFinalScriptWitness, nil, witnessBuf.Bytes())
+		}
+	}
+	serialized, err := packet.Serialize()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(serialized), nil
+}
+
+// Decode decodes a proof encoded with Encode(). It returns the signed transaction and the outputs
+// spent by its inputs as claimed by the PSBT.
+func Decode(proof string) (*wire.MsgTx, []*wire.TxOut, error) {
+	serialized, err := base64.StdEncoding.DecodeString(strings.TrimSpace(proof))
+	if err != nil {
+		return nil, nil, errp.WithStack(err)
+	}
+	packet, err := psbt.Parse(serialized)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := packet.UnsignedTx
+	spentOutputs := make([]*wire.TxOut, len(tx.TxIn))
+	for index, txIn := range tx.TxIn {
+		input := packet.Inputs[index]
+		txOutBytes, ok := input.Find(psbt.InWitnessUTXO, nil)
+		if !ok {
+			return nil, nil, errp.Newf("input %d is missing the spent output", index)
+		}
+		spentOutputs[index] = &wire.TxOut{}
+		if err := wire.ReadTxOut(
+			bytes.NewReader(txOutBytes), 0, 0, spentOutputs[index]); err != nil {
+			return nil, nil, errp.WithStack(err)
+		}
+		scriptSig, hasScriptSig := input.Find(psbt.InFinalScriptSig, nil)
+		witnessBytes, hasWitness := input.Find(psbt.InFinalScriptWitness, nil)
+		if !hasScriptSig && !hasWitness {
+			return nil, nil, errp.Newf("input %d is not finalized", index)
+		}
+		txIn.SignatureScript = scriptSig
+		if hasWitness {
+			r := bytes.NewReader(witnessBytes)
+			count, err := wire.ReadVarInt(r, 0)
+			if err != nil {
+				return nil, nil, errp.WithStack(err)
+			}
+			// Each witness item takes at least one byte.
+			if count > uint64(len(witnessBytes)) {
+				return nil, nil, errp.Newf("invalid witness of input %d", index)
+			}
+			txIn.Witness = make(wire.TxWitness, count)
+			for i := range txIn.Witness {
+				txIn.Witness[i], err = wire.ReadVarBytes(r, 0, wire.MaxBlockPayload, "witness")
+				if err != nil {
+					return nil, nil, errp.WithStack(err)
+				}
+			}
+		}
+	}
+	return tx, spentOutputs, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proofofreserves_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/proofofreserves"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/stretchr/testify/require"
+)
+
+const msg = "audit 2023-06-30, challenge 8c3b1e"
+
+// chain is a blockchain with the given transactions, confirmed at height 100.
+type chain struct {
+	txs []*wire.MsgTx
+}
+
+func (c *chain) add(tx *wire.MsgTx) *wire.MsgTx {
+	c.txs = append(c.txs, tx)
+	return tx
+}
+
+func (c *chain) mock() *blockchainMock.BlockchainMock {
+	return &blockchainMock.BlockchainMock{
+		MockTransactionGet: func(txHash chainhash.Hash) (*wire.MsgTx, error) {
+			for _, tx := range c.txs {
+				if tx.TxHash() == txHash {
+					return tx, nil
+				}
+			}
+			return nil, errp.New("transaction not found")
+		},
+		MockScriptHashGetHistory: func(scriptHashHex blockchain.ScriptHashHex) (blockchain.TxHistory, error) {
+			history := blockchain.TxHistory{}
+			for _, tx := range c.txs {
+				for _, txOut := range tx.TxOut {
+					if blockchain.NewScriptHashHex(txOut.PkScript) == scriptHashHex {
+						history = append(history, &blockchain.TxInfo{
+							Height: 100, TXHash: blockchain.TXHash(tx.TxHash()),
+						})
+						break
+					}
+				}
+			}
+			return history, nil
+		},
+	}
+}
+
+type key struct {
+	privateKey *btcec.PrivateKey
+	taproot    bool
+}
+
+func (k *key) pkScript(t *testing.T) []byte {
+	t.Helper()
+	var address btcutil.Address
+	var err error
+	if k.taproot {
+		address, err = btcutil.NewAddressTaproot(
+			txscript.ComputeTaprootKeyNoScript(k.privateKey.PubKey()).SerializeCompressed()[1:],
+			&chaincfg.TestNet3Params)
+	} else {
+		address, err = btcutil.NewAddressWitnessPubKeyHash(
+			btcutil.Hash160(k.privateKey.PubKey().SerializeCompressed()), &chaincfg.TestNet3Params)
+	}
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	return pkScript
+}
+
+// makeProof creates a proof for the outputs with the given values, funded by transactions added to
+// the chain.
+func makeProof(t *testing.T, c *chain, message string, values ...int64) string {
+	t.Helper()
+	keys := []*key{}
+	outPoints := []wire.OutPoint{}
+	spentOutputs := []*wire.TxOut{proofofreserves.CommitmentOutput()}
+	var total btcutil.Amount
+	for index, value := range values {
+		privateKey, err := btcec.NewPrivateKey()
+		require.NoError(t, err)
+		k := &key{privateKey: privateKey, taproot: index%2 == 1}
+		funding := wire.NewMsgTx(wire.TxVersion)
+		funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: uint32(len(c.txs))}, nil, nil))
+		funding.AddTxOut(wire.NewTxOut(value, k.pkScript(t)))
+		c.add(funding)
+		keys = append(keys, k)
+		outPoints = append(outPoints, wire.OutPoint{Hash: funding.TxHash(), Index: 0})
+		spentOutputs = append(spentOutputs, funding.TxOut[0])
+		total += btcutil.Amount(value)
+	}
+	tx := proofofreserves.NewTransaction(message, outPoints, total)
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for index, txIn := range tx.TxIn {
+		prevOuts.AddPrevOut(txIn.PreviousOutPoint, spentOutputs[index])
+	}
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+	for index, k := range keys {
+		inputIndex := index + 1
+		spentOutput := spentOutputs[inputIndex]
+		var witness wire.TxWitness
+		var err error
+		if k.taproot {
+			witness, err = txscript.TaprootWitnessSignature(tx, sigHashes, inputIndex,
+				spentOutput.Value, spentOutput.PkScript, txscript.SigHashDefault, k.privateKey)
+		} else {
+			witness, err = txscript.WitnessSignature(tx, sigHashes, inputIndex, spentOutput.Value,
+				spentOutput.PkScript, txscript.SigHashAll, k.privateKey, true)
+		}
+		require.NoError(t, err)
+		tx.TxIn[inputIndex].Witness = witness
+	}
+	proof, err := proofofreserves.Encode(tx, spentOutputs)
+	require.NoError(t, err)
+	return proof
+}
+
+func TestCommitmentOutPoint(t *testing.T) {
+	outPoint := proofofreserves.CommitmentOutPoint("")
+	require.Equal(t, chainhash.HashH([]byte("Proof-of-Reserves: ")), outPoint.Hash)
+	require.Equal(t, uint32(0), outPoint.Index)
+	require.NotEqual(t, outPoint, proofofreserves.CommitmentOutPoint(msg))
+}
+
+func TestEncodeDecode(t *testing.T) {
+	c := &chain{}
+	proof := makeProof(t, c, msg, 1000, 2000)
+	tx, spentOutputs, err := proofofreserves.Decode(proof)
+	require.NoError(t, err)
+	require.Len(t, tx.TxIn, 3)
+	require.Len(t, spentOutputs, 3)
+	require.Equal(t, proofofreserves.CommitmentOutPoint(msg), tx.TxIn[0].PreviousOutPoint)
+	require.Empty(t, tx.TxIn[0].Witness)
+	for index := 1; index < 3; index++ {
+		require.Equal(t, c.txs[index-1].TxOut[0], spentOutputs[index])
+		require.NotEmpty(t, tx.TxIn[index].Witness)
+	}
+	require.Equal(t, []*wire.TxOut{wire.NewTxOut(3000, []byte{txscript.OP_TRUE})}, tx.TxOut)
+
+	// Re-encoding results in the same proof.
+	reencoded, err := proofofreserves.Encode(tx, spentOutputs)
+	require.NoError(t, err)
+	require.Equal(t, proof, reencoded)
+
+	_, _, err = proofofreserves.Decode("not a proof")
+	require.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	c := &chain{}
+	proof := makeProof(t, c, msg, 1000, 2000, 3000)
+
+	result, err := proofofreserves.Verify(proof, msg, c.mock())
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(6000), result.Total)
+	require.Equal(t, btcutil.Amount(6000), result.Unspent)
+	require.Len(t, result.Outputs, 3)
+	for index, output := range result.Outputs {
+		require.Equal(t, wire.OutPoint{Hash: c.txs[index].TxHash(), Index: 0}, output.OutPoint)
+		require.Equal(t, btcutil.Amount(c.txs[index].TxOut[0].Value), output.Value)
+		require.Equal(t, 100, output.Height)
+		require.False(t, output.Spent)
+	}
+
+	// The proof does not commit to another message.
+	_, err = proofofreserves.Verify(proof, "other message", c.mock())
+	require.Equal(t, proofofreserves.ErrInvalidProof, errp.Cause(err))
+
+	// Spending an output after creating the proof reduces the reserves.
+	spendingTx := wire.NewMsgTx(wire.TxVersion)
+	spendingTx.AddTxIn(wire.NewTxIn(&result.Outputs[1].OutPoint, nil, nil))
+	spendingTx.AddTxOut(c.txs[1].TxOut[0])
+	c.add(spendingTx)
+	result, err = proofofreserves.Verify(proof, msg, c.mock())
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(6000), result.Total)
+	require.Equal(t, btcutil.Amount(4000), result.Unspent)
+	require.False(t, result.Outputs[0].Spent)
+	require.True(t, result.Outputs[1].Spent)
+	require.False(t, result.Outputs[2].Spent)
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	c := &chain{}
+	proof := makeProof(t, c, msg, 1000, 2000)
+	tx, spentOutputs, err := proofofreserves.Decode(proof)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		modify func(tx *wire.MsgTx, spentOutputs []*wire.TxOut)
+	}{
+		{
+			name: "invalid signature",
+			modify: func(tx *wire.MsgTx, _ []*wire.TxOut) {
+				tx.TxIn[1].Witness = tx.TxIn[2].Witness
+			},
+		},
+		{
+			name: "wrong amount",
+			modify: func(tx *wire.MsgTx, _ []*wire.TxOut) {
+				tx.TxOut[0].Value++
+			},
+		},
+		{
+			name: "spendable output",
+			modify: func(tx *wire.MsgTx, _ []*wire.TxOut) {
+				tx.TxOut[0].PkScript = spentOutputs[1].PkScript
+			},
+		},
+		{
+			name: "no commitment",
+			modify: func(tx *wire.MsgTx, spentOutputs []*wire.TxOut) {
+				tx.TxIn[0] = tx.TxIn[1]
+				spentOutputs[0] = spentOutputs[1]
+			},
+		},
+		{
+			name: "signed commitment",
+			modify: func(tx *wire.MsgTx, _ []*wire.TxOut) {
+				tx.TxIn[0].Witness = wire.TxWitness{{1}}
+			},
+		},
+		{
+			name: "unknown commitment output",
+			modify: func(_ *wire.MsgTx, spentOutputs []*wire.TxOut) {
+				spentOutputs[0] = wire.NewTxOut(1, []byte{txscript.OP_TRUE})
+			},
+		},
+		{
+			name: "nonexistent output",
+			modify: func(tx *wire.MsgTx, _ []*wire.TxOut) {
+				tx.TxIn[1].PreviousOutPoint.Index = 1
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			modifiedTx := tx.Copy()
+			modifiedSpentOutputs := append([]*wire.TxOut{}, spentOutputs...)
+			for index, txOut := range modifiedSpentOutputs {
+				modifiedSpentOutputs[index] = wire.NewTxOut(txOut.Value, txOut.PkScript)
+			}
+			test.modify(modifiedTx, modifiedSpentOutputs)
+			modifiedProof, err := proofofreserves.Encode(modifiedTx, modifiedSpentOutputs)
+			require.NoError(t, err)
+			_, err = proofofreserves.Verify(modifiedProof, msg, c.mock())
+			require.Equal(t, proofofreserves.ErrInvalidProof, errp.Cause(err), err)
+		})
+	}
+}
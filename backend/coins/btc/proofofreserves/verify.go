@@ -0,0 +1,186 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proofofreserves
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// ErrInvalidProof is returned by Verify() if the proof is malformed, does not commit to the
+// message, spends outputs which do not exist or has invalid signatures.
+var ErrInvalidProof = errors.New("invalidProof")
+
+// Output is an output covered by a proof of reserves.
+type Output struct {
+	OutPoint wire.OutPoint
+	Value    btcutil.Amount
+	PkScript []byte
+	// Height is the height of the block containing the transaction which created the output, or
+	// 0 if it is unconfirmed.
+	Height int
+	// Spent is true if the output has been spent since the proof was created.
+	Spent bool
+}
+
+// Result is the result of a successful verification.
+type Result struct {
+	Outputs []*Output
+	// Total is the amount of all outputs covered by the proof.
+	Total btcutil.Amount
+	// Unspent is the amount of the outputs which are still unspent and confirmed, i.e. the
+	// reserves at the time of the verification.
+	Unspent btcutil.Amount
+}
+
+// Verify checks that the proof commits to the message and is validly signed, looking up the spent
+// outputs and whether they are still unspent on the blockchain. The outputs claimed by the proof
+// itself are not trusted. The error cause is ErrInvalidProof if the proof is invalid.
+func Verify(proof string, message string, client blockchain.Interface) (*Result, error) {
+	tx, claimedOutputs, err := Decode(proof)
+	if err != nil {
+		return nil, errp.WithMessage(ErrInvalidProof, err.Error())
+	}
+	if err := checkStructure(tx, claimedOutputs, message); err != nil {
+		return nil, err
+	}
+
+	spentOutputs := txscript.NewMultiPrevOutFetcher(nil)
+	spentOutputs.AddPrevOut(tx.TxIn[0].PreviousOutPoint, CommitmentOutput())
+	result := &Result{}
+	for _, txIn := range tx.TxIn[1:] {
+		output, err := lookupOutput(txIn.PreviousOutPoint, client)
+		if err != nil {
+			return nil, err
+		}
+		spentOutputs.AddPrevOut(output.OutPoint, wire.NewTxOut(int64(output.Value), output.PkScript))
+		result.Outputs = append(result.Outputs, output)
+		result.Total += output.Value
+		if !output.Spent && output.Height > 0 {
+			result.Unspent += output.Value
+		}
+	}
+	if btcutil.Amount(tx.TxOut[0].Value) != result.Total {
+		return nil, errp.WithMessage(ErrInvalidProof,
+			"the output amount does not match the amount of the spent outputs")
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx, spentOutputs)
+	for index := 1; index < len(tx.TxIn); index++ {
+		spentOutput := spentOutputs.FetchPrevOutput(tx.TxIn[index].PreviousOutPoint)
+		engine, err := txscript.NewEngine(spentOutput.PkScript, tx, index,
+			txscript.StandardVerifyFlags, nil, sigHashes, spentOutput.Value, spentOutputs)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if err := engine.Execute(); err != nil {
+			return nil, errp.WithMessage(ErrInvalidProof,
+				fmt.Sprintf("invalid signature of input %d: %v", index, err))
+		}
+	}
+	return result, nil
+}
+
+// checkStructure checks that the first input is the commitment input of the message and that the
+// only output is the OP_TRUE output.
+func checkStructure(tx *wire.MsgTx, claimedOutputs []*wire.TxOut, message string) error {
+	if len(tx.TxIn) < 2 {
+		return errp.WithMessage(ErrInvalidProof, "the proof does not spend any outputs")
+	}
+	commitmentInput := tx.TxIn[0]
+	if commitmentInput.PreviousOutPoint != CommitmentOutPoint(message) {
+		return errp.WithMessage(ErrInvalidProof, "the proof does not commit to the message")
+	}
+	if len(commitmentInput.SignatureScript) != 0 || len(commitmentInput.Witness) != 0 {
+		return errp.WithMessage(ErrInvalidProof, "the commitment input must not be signed")
+	}
+	commitmentOutput := CommitmentOutput()
+	if claimedOutputs[0].Value != commitmentOutput.Value ||
+		!bytes.Equal(claimedOutputs[0].PkScript, commitmentOutput.PkScript) {
+		return errp.WithMessage(ErrInvalidProof, "invalid output spent by the commitment input")
+	}
+	seen := map[wire.OutPoint]struct{}{}
+	for _, txIn := range tx.TxIn {
+		if _, ok := seen[txIn.PreviousOutPoint]; ok {
+			return errp.WithMessage(ErrInvalidProof, "the proof spends an output twice")
+		}
+		seen[txIn.PreviousOutPoint] = struct{}{}
+	}
+	if len(tx.TxOut) != 1 || !bytes.Equal(tx.TxOut[0].PkScript, []byte{txscript.OP_TRUE}) {
+		return errp.WithMessage(ErrInvalidProof, "the proof must have exactly one OP_TRUE output")
+	}
+	return nil
+}
+
+// lookupOutput fetches the output from the blockchain and determines whether it is confirmed and
+// unspent by going through the history of its script.
+func lookupOutput(outPoint wire.OutPoint, client blockchain.Interface) (*Output, error) {
+	tx, err := fetchTx(outPoint.Hash, client)
+	if err != nil {
+		return nil, err
+	}
+	if int(outPoint.Index) >= len(tx.TxOut) {
+		return nil, errp.WithMessage(ErrInvalidProof,
+			fmt.Sprintf("the spent output %s does not exist", outPoint))
+	}
+	txOut := tx.TxOut[outPoint.Index]
+	output := &Output{
+		OutPoint: outPoint,
+		Value:    btcutil.Amount(txOut.Value),
+		PkScript: txOut.PkScript,
+	}
+	history, err := client.ScriptHashGetHistory(blockchain.NewScriptHashHex(txOut.PkScript))
+	if err != nil {
+		return nil, err
+	}
+	for _, txInfo := range history {
+		txHash := txInfo.TXHash.Hash()
+		if txHash == outPoint.Hash {
+			if txInfo.Height > 0 {
+				output.Height = txInfo.Height
+			}
+			continue
+		}
+		spendingTx, err := fetchTx(txHash, client)
+		if err != nil {
+			return nil, err
+		}
+		for _, txIn := range spendingTx.TxIn {
+			if txIn.PreviousOutPoint == outPoint {
+				output.Spent = true
+			}
+		}
+	}
+	return output, nil
+}
+
+func fetchTx(txHash chainhash.Hash, client blockchain.Interface) (*wire.MsgTx, error) {
+	tx, err := client.TransactionGet(txHash)
+	if err != nil {
+		return nil, err
+	}
+	if tx.TxHash() != txHash {
+		return nil, errp.New("the server returned the wrong transaction")
+	}
+	return tx, nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/proofofreserves"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+// proofKeystore is a software keystore which can be configured to not support proofs of reserves.
+type proofKeystore struct {
+	*software.Keystore
+	unsupported bool
+}
+
+func (keystore *proofKeystore) CanSignProofOfReserves(code coin.Code) bool {
+	return !keystore.unsupported && keystore.Keystore.CanSignProofOfReserves(code)
+}
+
+func TestProofOfReserves(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	dbFolder := test.TstTempDir("btc-proofofreserves")
+	defer func() { _ = os.RemoveAll(dbFolder) }()
+
+	tbtc := btc.NewCoin(coin.CodeTBTC, "Bitcoin Testnet", "TBTC", coin.BtcUnitDefault, net,
+		dbFolder, nil, explorer, socksproxy.NewSocksProxy(false, ""))
+
+	// The funding transactions of the account, confirmed.
+	var lock sync.Mutex
+	txs := map[chainhash.Hash]*wire.MsgTx{}
+	histories := map[blockchain.ScriptHashHex]blockchain.TxHistory{}
+	onStatus := map[blockchain.ScriptHashHex]func(string){}
+	blockchainMock := &blockchainMock.BlockchainMock{}
+	blockchainMock.MockRegisterOnConnectionErrorChangedEvent = func(f func(error)) {}
+	blockchainMock.MockScriptHashSubscribe = func(
+		setupAndTeardown func() func(), scriptHashHex blockchain.ScriptHashHex, success func(string)) {
+		lock.Lock()
+		onStatus[scriptHashHex] = success
+		lock.Unlock()
+		success("")
+	}
+	blockchainMock.MockScriptHashGetHistory = func(
+		scriptHashHex blockchain.ScriptHashHex) (blockchain.TxHistory, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return histories[scriptHashHex], nil
+	}
+	blockchainMock.MockTransactionGet = func(txHash chainhash.Hash) (*wire.MsgTx, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		tx, ok := txs[txHash]
+		if !ok {
+			return nil, errp.New("transaction not found")
+		}
+		return tx, nil
+	}
+	tbtc.TstSetMakeBlockchain(func() blockchain.Interface { return blockchainMock })
+
+	master, err := hdkeychain.NewMaster(make([]byte, 32), net)
+	require.NoError(t, err)
+	keystore := &proofKeystore{Keystore: software.NewKeystore(master)}
+	rootFingerprint, err := keystore.RootFingerprint()
+	require.NoError(t, err)
+
+	signingConfigurations := signing.Configurations{}
+	for scriptType, keypathStr := range map[signing.ScriptType]string{
+		signing.ScriptTypeP2WPKHP2SH: "m/49'/1'/0'",
+		signing.ScriptTypeP2WPKH:     "m/84'/1'/0'",
+		signing.ScriptTypeP2TR:       "m/86'/1'/0'",
+	} {
+		keypath, err := signing.NewAbsoluteKeypath(keypathStr)
+		require.NoError(t, err)
+		xpub, err := keystore.ExtendedPublicKey(tbtc, keypath)
+		require.NoError(t, err)
+		signingConfigurations = append(signingConfigurations,
+			signing.NewBitcoinConfiguration(scriptType, rootFingerprint, keypath, xpub))
+	}
+
+	account := btc.NewAccount(
+		&accounts.AccountConfig{
+			Config: &config.Account{
+				Code:                  "accountcode",
+				Name:                  "accountname",
+				SigningConfigurations: signingConfigurations,
+			},
+			DBFolder:        dbFolder,
+			Keystore:        keystore,
+			OnEvent:         func(accountsTypes.Event) {},
+			RateUpdater:     nil,
+			GetNotifier:     func(signing.Configurations) accounts.Notifier { return nopNotifier{} },
+			GetSaveFilename: func(suggestedFilename string) string { return suggestedFilename },
+		},
+		tbtc, nil,
+		logging.Get().WithGroup("proofofreserves_test"),
+	)
+	require.NoError(t, account.Initialize())
+	defer account.Close()
+
+	const msg = "Proof of reserves for the audit of 2023"
+	_, err = account.ProofOfReserves(msg)
+	require.Error(t, err, "no spendable outputs")
+
+	// Fund the first receive address of each script type.
+	receiveAddresses := account.GetUnusedReceiveAddresses()
+	require.Len(t, receiveAddresses, 3)
+	var total btcutil.Amount
+	for index, addressList := range receiveAddresses {
+		address, err := btcutil.DecodeAddress(addressList.Addresses[0].EncodeForHumans(), net)
+		require.NoError(t, err)
+		pkScript, err := txscript.PayToAddrScript(address)
+		require.NoError(t, err)
+		value := int64(index+1) * 100000
+		total += btcutil.Amount(value)
+		funding := wire.NewMsgTx(wire.TxVersion)
+		funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: uint32(index)}, nil, nil))
+		funding.AddTxOut(wire.NewTxOut(value, pkScript))
+		scriptHashHex := blockchain.NewScriptHashHex(pkScript)
+		history := blockchain.TxHistory{
+			{Height: 10, TXHash: blockchain.TXHash(funding.TxHash())},
+		}
+		lock.Lock()
+		txs[funding.TxHash()] = funding
+		histories[scriptHashHex] = history
+		success := onStatus[scriptHashHex]
+		lock.Unlock()
+		success(history.Status())
+	}
+	require.Eventually(t, func() bool { return len(account.SpendableOutputs()) == 3 },
+		5*time.Second, 10*time.Millisecond)
+
+	keystore.unsupported = true
+	_, err = account.ProofOfReserves(msg)
+	require.Equal(t, btc.ErrProofOfReservesNotSupported, errp.Cause(err))
+	keystore.unsupported = false
+
+	proof, err := account.ProofOfReserves(msg)
+	require.NoError(t, err)
+	require.Equal(t, msg, proof.Message)
+	require.Equal(t, total, proof.Amount)
+	require.Equal(t, 3, proof.NumOutputs)
+
+	result, err := proofofreserves.Verify(proof.Proof, msg, blockchainMock)
+	require.NoError(t, err)
+	require.Equal(t, total, result.Total)
+	require.Equal(t, total, result.Unspent)
+	require.Len(t, result.Outputs, 3)
+
+	_, err = proofofreserves.Verify(proof.Proof, "other message", blockchainMock)
+	require.Equal(t, proofofreserves.ErrInvalidProof, errp.Cause(err))
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package psbt is a minimal implementation of the parts of BIP174 (PSBT) and BIP371 (Taproot fields
+// for PSBT) needed to exchange single-sig transactions with external signers.
+// See https://github.com/bitcoin/bips/blob/master/bip-0174.mediawiki.
+package psbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+var magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// Key types of the global, input and output maps.
+const (
+	GlobalUnsignedTx = 0x00
+
+	InNonWitnessUTXO     = 0x00
+	InWitnessUTXO        = 0x01
+	InPartialSig         = 0x02
+	InRedeemScript       = 0x04
+	InBIP32Derivation    = 0x06
+	InFinalScriptSig     = 0x07
+	InFinalScriptWitness = 0x08
+	InTapKeySig          = 0x13
+	InTapBIP32Derivation = 0x16
+	InTapInternalKey     = 0x17
+
+	OutRedeemScript       = 0x00
+	OutBIP32Derivation    = 0x02
+	OutTapInternalKey     = 0x05
+	OutTapBIP32Derivation = 0x06
+)
+
+// Entry is a key-value pair of a PSBT map. The first byte of the key is the type.
+type Entry struct {
+	Key   []byte
+	Value []byte
+}
+
+// Map is a global, input or output map of a PSBT.
+type Map []Entry
+
+// Add appends an entry with the given type and key data.
+func (m *Map) Add(keyType byte, keyData []byte, value []byte) {
+	*m = append(*m, Entry{Key: append([]byte{keyType}, keyData...), Value: value})
+}
+
+// Find returns the value of the first entry with the given type and key data.
+func (m Map) Find(keyType byte, keyData []byte) ([]byte, bool) {
+	for _, entry := range m {
+		if entry.Key[0] == keyType && bytes.Equal(entry.Key[1:], keyData) {
+			return entry.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Packet is a PSBT with one map per input and output of the unsigned transaction.
+type Packet struct {
+	UnsignedTx *wire.MsgTx
+	Global     Map
+	Inputs     []Map
+	Outputs    []Map
+}
+
+// New creates a PSBT with empty input and output maps for the transaction. The signature scripts
+// and witnesses of the transaction must be empty.
+func New(unsignedTx *wire.MsgTx) (*Packet, error) {
+	var txBuf bytes.Buffer
+	if err := unsignedTx.SerializeNoWitness(&txBuf); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	packet := &Packet{
+		UnsignedTx: unsignedTx,
+		Inputs:     make([]Map, len(unsignedTx.TxIn)),
+		Outputs:    make([]Map, len(unsignedTx.TxOut)),
+	}
+	packet.Global.Add(GlobalUnsignedTx, nil, txBuf.Bytes())
+	return packet, nil
+}
+
+func writeMap(w io.Writer, m Map) error {
+	for _, entry := range m {
+		if err := wire.WriteVarBytes(w, 0, entry.Key); err != nil {
+			return errp.WithStack(err)
+		}
+		if err := wire.WriteVarBytes(w, 0, entry.Value); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	// Separator.
+	_, err := w.Write([]byte{0x00})
+	return errp.WithStack(err)
+}
+
+// Serialize encodes the PSBT in the binary format.
+func (packet *Packet) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	if err := writeMap(&buf, packet.Global); err != nil {
+		return nil, err
+	}
+	for _, m := range packet.Inputs {
+		if err := writeMap(&buf, m); err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range packet.Outputs {
+		if err := writeMap(&buf, m); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// maxEntrySize limits the size of keys and values when parsing.
+const maxEntrySize = 4000000
+
+func readMap(r io.Reader) (Map, error) {
+	m := Map{}
+	for {
+		key, err := wire.ReadVarBytes(r, 0, maxEntrySize, "key")
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if len(key) == 0 {
+			// Separator.
+			return m, nil
+		}
+		value, err := wire.ReadVarBytes(r, 0, maxEntrySize, "value")
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if _, ok := m.Find(key[0], key[1:]); ok {
+			return nil, errp.New("duplicate key in PSBT")
+		}
+		m = append(m, Entry{Key: key, Value: value})
+	}
+}
+
+// Parse decodes a PSBT in the binary format.
+func Parse(serialized []byte) (*Packet, error) {
+	if !bytes.HasPrefix(serialized, magic) {
+		return nil, errp.New("invalid PSBT magic")
+	}
+	r := bytes.NewReader(serialized[len(magic):])
+	global, err := readMap(r)
+	if err != nil {
+		return nil, err
+	}
+	txBytes, ok := global.Find(GlobalUnsignedTx, nil)
+	if !ok {
+		return nil, errp.New("PSBT is missing the unsigned transaction")
+	}
+	unsignedTx := &wire.MsgTx{}
+	if err := unsignedTx.DeserializeNoWitness(bytes.NewReader(txBytes)); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	packet := &Packet{
+		UnsignedTx: unsignedTx,
+		Global:     global,
+		Inputs:     make([]Map, len(unsignedTx.TxIn)),
+		Outputs:    make([]Map, len(unsignedTx.TxOut)),
+	}
+	for i := range packet.Inputs {
+		if packet.Inputs[i], err = readMap(r); err != nil {
+			return nil, err
+		}
+	}
+	for i := range packet.Outputs {
+		if packet.Outputs[i], err = readMap(r); err != nil {
+			return nil, err
+		}
+	}
+	return packet, nil
+}
+
+// BIP32Derivation encodes the root fingerprint and keypath as in the BIP32 derivation fields.
+func BIP32Derivation(rootFingerprint []byte, keypath []uint32) []byte {
+	result := append([]byte{}, rootFingerprint...)
+	for _, element := range keypath {
+		result = binary.LittleEndian.AppendUint32(result, element)
+	}
+	return result
+}
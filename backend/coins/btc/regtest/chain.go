@@ -0,0 +1,548 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package regtest provides a simulated Bitcoin regtest chain and an in-process Electrum server
+// serving it. It is used to test accounts end to end against the real Electrum client, without
+// having to run bitcoind and an Electrum server.
+package regtest
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const (
+	blockInterval = 10 * time.Minute
+
+	// fundingFee is the fee paid by funding transactions created with FundingTx().
+	fundingFee = btcutil.Amount(1000)
+)
+
+type block struct {
+	header wire.BlockHeader
+	// txs[0] is the coinbase transaction.
+	txs []*wire.MsgTx
+}
+
+func (b *block) txHashes() []chainhash.Hash {
+	hashes := make([]chainhash.Hash, len(b.txs))
+	for i, tx := range b.txs {
+		hashes[i] = tx.TxHash()
+	}
+	return hashes
+}
+
+// Chain is a simulated regtest blockchain with a mempool. Blocks are not mined with proof of work
+// and scripts are not executed, but inputs are checked to exist and be unspent, and mempool
+// conflicts are resolved according to the BIP125 replace-by-fee rules. It is safe for concurrent
+// use.
+type Chain struct {
+	net *chaincfg.Params
+
+	mu      sync.RWMutex
+	blocks  []*block
+	mempool []*wire.MsgTx
+	// txs contains all transactions ever seen, including orphaned and replaced ones, so they can be
+	// fetched by their hash.
+	txs map[chainhash.Hash]*wire.MsgTx
+	// faucet contains the values of the outpoints spent by funding transactions. They do not exist
+	// as transaction outputs.
+	faucet        map[wire.OutPoint]btcutil.Amount
+	faucetCounter uint32
+	nonce         uint32
+
+	feeRatePerKb  btcutil.Amount
+	relayFeePerKb btcutil.Amount
+
+	observersMu sync.RWMutex
+	observers   []func()
+}
+
+// NewChain creates a new chain containing only the regtest genesis block.
+func NewChain() *Chain {
+	net := &chaincfg.RegressionNetParams
+	return &Chain{
+		net: net,
+		blocks: []*block{{
+			header: net.GenesisBlock.Header,
+			txs:    net.GenesisBlock.Transactions,
+		}},
+		txs:           map[chainhash.Hash]*wire.MsgTx{},
+		faucet:        map[wire.OutPoint]btcutil.Amount{},
+		feeRatePerKb:  10000,
+		relayFeePerKb: 1000,
+	}
+}
+
+// Net returns the chain params.
+func (chain *Chain) Net() *chaincfg.Params {
+	return chain.net
+}
+
+// OnChange registers a callback which is called after every change of the chain or the mempool.
+func (chain *Chain) OnChange(f func()) {
+	chain.observersMu.Lock()
+	defer chain.observersMu.Unlock()
+	chain.observers = append(chain.observers, f)
+}
+
+func (chain *Chain) notifyChange() {
+	chain.observersMu.RLock()
+	defer chain.observersMu.RUnlock()
+	for _, f := range chain.observers {
+		f()
+	}
+}
+
+// SetFeeRates sets the fee rates reported as the fee estimation and relay fee.
+func (chain *Chain) SetFeeRates(feeRatePerKb, relayFeePerKb btcutil.Amount) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	chain.feeRatePerKb = feeRatePerKb
+	chain.relayFeePerKb = relayFeePerKb
+}
+
+// FeeRates returns the fee estimation and the relay fee.
+func (chain *Chain) FeeRates() (btcutil.Amount, btcutil.Amount) {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return chain.feeRatePerKb, chain.relayFeePerKb
+}
+
+// TipHeight returns the height of the chain tip.
+func (chain *Chain) TipHeight() int {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return len(chain.blocks) - 1
+}
+
+// Header returns the header at the given height, or nil if the height is beyond the tip.
+func (chain *Chain) Header(height int) *wire.BlockHeader {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	if height < 0 || height >= len(chain.blocks) {
+		return nil
+	}
+	header := chain.blocks[height].header
+	return &header
+}
+
+// Headers returns at most `count` headers starting at `startHeight`.
+func (chain *Chain) Headers(startHeight int, count int) []wire.BlockHeader {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	headers := []wire.BlockHeader{}
+	for height := startHeight; height < len(chain.blocks) && len(headers) < count; height++ {
+		headers = append(headers, chain.blocks[height].header)
+	}
+	return headers
+}
+
+// Transaction returns a transaction by its hash, or nil if it is unknown. Orphaned or replaced
+// transactions are still returned.
+func (chain *Chain) Transaction(txHash chainhash.Hash) *wire.MsgTx {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return chain.txs[txHash]
+}
+
+// TxHeight returns the height of the block containing the transaction, 0 if it is in the mempool,
+// or -1 if it is in the mempool and spends an unconfirmed output. false is returned if the
+// transaction is neither in the chain nor in the mempool.
+func (chain *Chain) TxHeight(txHash chainhash.Hash) (int, bool) {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return chain.txHeight(txHash)
+}
+
+func (chain *Chain) txHeight(txHash chainhash.Hash) (int, bool) {
+	for height, block := range chain.blocks {
+		for _, tx := range block.txs {
+			if tx.TxHash() == txHash {
+				return height, true
+			}
+		}
+	}
+	for _, tx := range chain.mempool {
+		if tx.TxHash() != txHash {
+			continue
+		}
+		for _, txIn := range tx.TxIn {
+			if chain.inMempool(txIn.PreviousOutPoint.Hash) {
+				return -1, true
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (chain *Chain) inMempool(txHash chainhash.Hash) bool {
+	for _, tx := range chain.mempool {
+		if tx.TxHash() == txHash {
+			return true
+		}
+	}
+	return false
+}
+
+// History returns the Electrum history of the given script hash: confirmed transactions ordered by
+// height, followed by mempool transactions.
+func (chain *Chain) History(scriptHashHex blockchain.ScriptHashHex) blockchain.TxHistory {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+
+	touches := func(tx *wire.MsgTx) bool {
+		for _, txOut := range tx.TxOut {
+			if blockchain.NewScriptHashHex(txOut.PkScript) == scriptHashHex {
+				return true
+			}
+		}
+		for _, txIn := range tx.TxIn {
+			prevTx, ok := chain.txs[txIn.PreviousOutPoint.Hash]
+			if !ok || int(txIn.PreviousOutPoint.Index) >= len(prevTx.TxOut) {
+				continue
+			}
+			pkScript := prevTx.TxOut[txIn.PreviousOutPoint.Index].PkScript
+			if blockchain.NewScriptHashHex(pkScript) == scriptHashHex {
+				return true
+			}
+		}
+		return false
+	}
+	history := blockchain.TxHistory{}
+	for height, block := range chain.blocks {
+		for _, tx := range block.txs {
+			if touches(tx) {
+				history = append(history, &blockchain.TxInfo{
+					Height: height,
+					TXHash: blockchain.TXHash(tx.TxHash()),
+				})
+			}
+		}
+	}
+	for _, tx := range chain.mempool {
+		if touches(tx) {
+			height, _ := chain.txHeight(tx.TxHash())
+			history = append(history, &blockchain.TxInfo{
+				Height: height,
+				TXHash: blockchain.TXHash(tx.TxHash()),
+			})
+		}
+	}
+	return history
+}
+
+// Merkle returns the merkle branch of the transaction in the block at the given height, and the
+// position of the transaction in the block.
+func (chain *Chain) Merkle(txHash chainhash.Hash, height int) ([]chainhash.Hash, int, error) {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	if height < 0 || height >= len(chain.blocks) {
+		return nil, 0, errp.Newf("no block at height %d", height)
+	}
+	hashes := chain.blocks[height].txHashes()
+	for pos, hash := range hashes {
+		if hash == txHash {
+			branch, _ := merkleBranch(hashes, pos)
+			return branch, pos, nil
+		}
+	}
+	return nil, 0, errp.Newf("tx %s not in block at height %d", txHash, height)
+}
+
+// merkleBranch returns the merkle branch of the hash at position `pos`, and the merkle root.
+func merkleBranch(hashes []chainhash.Hash, pos int) ([]chainhash.Hash, chainhash.Hash) {
+	branch := []chainhash.Hash{}
+	level := append([]chainhash.Hash{}, hashes...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, level[pos^1])
+		next := make([]chainhash.Hash, len(level)/2)
+		for i := range next {
+			next[i] = chainhash.DoubleHashH(append(level[2*i][:], level[2*i+1][:]...))
+		}
+		level = next
+		pos >>= 1
+	}
+	return branch, level[0]
+}
+
+// outputValue returns the value of an outpoint, which is either the output of a known transaction
+// or a faucet outpoint.
+func (chain *Chain) outputValue(outPoint wire.OutPoint) (btcutil.Amount, bool) {
+	if value, ok := chain.faucet[outPoint]; ok {
+		return value, true
+	}
+	tx, ok := chain.txs[outPoint.Hash]
+	if !ok || int(outPoint.Index) >= len(tx.TxOut) {
+		return 0, false
+	}
+	return btcutil.Amount(tx.TxOut[outPoint.Index].Value), true
+}
+
+func (chain *Chain) fee(tx *wire.MsgTx) btcutil.Amount {
+	var fee btcutil.Amount
+	for _, txIn := range tx.TxIn {
+		value, _ := chain.outputValue(txIn.PreviousOutPoint)
+		fee += value
+	}
+	for _, txOut := range tx.TxOut {
+		fee -= btcutil.Amount(txOut.Value)
+	}
+	return fee
+}
+
+func signalsRBF(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// withDescendants returns the given mempool transactions plus all mempool transactions spending
+// their outputs, recursively.
+func (chain *Chain) withDescendants(txHashes map[chainhash.Hash]struct{}) map[chainhash.Hash]struct{} {
+	result := map[chainhash.Hash]struct{}{}
+	for txHash := range txHashes {
+		result[txHash] = struct{}{}
+	}
+	for {
+		added := false
+		for _, tx := range chain.mempool {
+			txHash := tx.TxHash()
+			if _, ok := result[txHash]; ok {
+				continue
+			}
+			for _, txIn := range tx.TxIn {
+				if _, ok := result[txIn.PreviousOutPoint.Hash]; ok {
+					result[txHash] = struct{}{}
+					added = true
+					break
+				}
+			}
+		}
+		if !added {
+			return result
+		}
+	}
+}
+
+func (chain *Chain) removeFromMempool(txHashes map[chainhash.Hash]struct{}) {
+	mempool := []*wire.MsgTx{}
+	for _, tx := range chain.mempool {
+		if _, ok := txHashes[tx.TxHash()]; !ok {
+			mempool = append(mempool, tx)
+		}
+	}
+	chain.mempool = mempool
+}
+
+// Broadcast adds a transaction to the mempool. It fails if an input does not exist or is spent in
+// the chain. Mempool transactions spending the same inputs are replaced if they signal
+// replaceability and the new transaction pays a higher fee.
+func (chain *Chain) Broadcast(tx *wire.MsgTx) error {
+	if err := chain.broadcast(tx); err != nil {
+		return err
+	}
+	chain.notifyChange()
+	return nil
+}
+
+func (chain *Chain) broadcast(tx *wire.MsgTx) error {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	txHash := tx.TxHash()
+	if _, ok := chain.txHeight(txHash); ok {
+		return errp.New("txn-already-known")
+	}
+	spentInChain := map[wire.OutPoint]struct{}{}
+	for _, block := range chain.blocks {
+		for _, blockTx := range block.txs {
+			for _, txIn := range blockTx.TxIn {
+				spentInChain[txIn.PreviousOutPoint] = struct{}{}
+			}
+		}
+	}
+	spentInMempool := map[wire.OutPoint]chainhash.Hash{}
+	for _, mempoolTx := range chain.mempool {
+		for _, txIn := range mempoolTx.TxIn {
+			spentInMempool[txIn.PreviousOutPoint] = mempoolTx.TxHash()
+		}
+	}
+
+	var inputsSum btcutil.Amount
+	conflicts := map[chainhash.Hash]struct{}{}
+	for _, txIn := range tx.TxIn {
+		value, ok := chain.outputValue(txIn.PreviousOutPoint)
+		if !ok {
+			return errp.New("bad-txns-inputs-missingorspent")
+		}
+		if _, ok := spentInChain[txIn.PreviousOutPoint]; ok {
+			return errp.New("bad-txns-inputs-missingorspent")
+		}
+		if conflict, ok := spentInMempool[txIn.PreviousOutPoint]; ok {
+			conflicts[conflict] = struct{}{}
+		}
+		inputsSum += value
+	}
+	var outputsSum btcutil.Amount
+	for _, txOut := range tx.TxOut {
+		outputsSum += btcutil.Amount(txOut.Value)
+	}
+	if outputsSum > inputsSum {
+		return errp.New("bad-txns-in-belowout")
+	}
+
+	if len(conflicts) > 0 {
+		replaced := chain.withDescendants(conflicts)
+		var replacedFees btcutil.Amount
+		for _, mempoolTx := range chain.mempool {
+			if _, ok := replaced[mempoolTx.TxHash()]; !ok {
+				continue
+			}
+			if _, ok := conflicts[mempoolTx.TxHash()]; ok && !signalsRBF(mempoolTx) {
+				return errp.New("txn-mempool-conflict")
+			}
+			replacedFees += chain.fee(mempoolTx)
+		}
+		if inputsSum-outputsSum <= replacedFees {
+			return errp.New("insufficient fee")
+		}
+		chain.removeFromMempool(replaced)
+	}
+	chain.txs[txHash] = tx
+	chain.mempool = append(chain.mempool, tx)
+	return nil
+}
+
+// FundingTx creates a transaction paying `amount` to `pkScript`, spending a new faucet outpoint.
+// The transaction signals replaceability and pays a fee of `fundingFee`. It is not broadcast.
+func (chain *Chain) FundingTx(pkScript []byte, amount btcutil.Amount) *wire.MsgTx {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	chain.faucetCounter++
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, chain.faucetCounter)
+	outPoint := wire.OutPoint{Hash: chainhash.HashH(counter), Index: 0}
+	chain.faucet[outPoint] = amount + fundingFee
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: outPoint,
+		Sequence:         wire.MaxTxInSequenceNum - 2,
+	})
+	tx.AddTxOut(wire.NewTxOut(int64(amount), pkScript))
+	return tx
+}
+
+// Fund broadcasts a funding transaction paying `amount` to `pkScript`. See FundingTx().
+func (chain *Chain) Fund(pkScript []byte, amount btcutil.Amount) *wire.MsgTx {
+	tx := chain.FundingTx(pkScript, amount)
+	if err := chain.Broadcast(tx); err != nil {
+		panic(err)
+	}
+	return tx
+}
+
+// Evict removes a transaction and all its descendants from the mempool, e.g. to simulate that it
+// was dropped or double spent.
+func (chain *Chain) Evict(txHash chainhash.Hash) {
+	chain.mu.Lock()
+	chain.removeFromMempool(chain.withDescendants(map[chainhash.Hash]struct{}{txHash: {}}))
+	chain.mu.Unlock()
+	chain.notifyChange()
+}
+
+func (chain *Chain) mine(txs []*wire.MsgTx) {
+	height := len(chain.blocks)
+	chain.nonce++
+	scriptSig := make([]byte, 8)
+	binary.BigEndian.PutUint32(scriptSig, uint32(height))
+	binary.BigEndian.PutUint32(scriptSig[4:], chain.nonce)
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  scriptSig,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+	chain.txs[coinbase.TxHash()] = coinbase
+
+	newBlock := &block{txs: append([]*wire.MsgTx{coinbase}, txs...)}
+	_, merkleRoot := merkleBranch(newBlock.txHashes(), 0)
+	prevHeader := chain.blocks[height-1].header
+	newBlock.header = wire.BlockHeader{
+		Version:    4,
+		PrevBlock:  prevHeader.BlockHash(),
+		MerkleRoot: merkleRoot,
+		Timestamp:  prevHeader.Timestamp.Add(blockInterval),
+		Bits:       chain.net.PowLimitBits,
+		Nonce:      chain.nonce,
+	}
+	chain.blocks = append(chain.blocks, newBlock)
+}
+
+// Mine mines `count` blocks. The first block contains all mempool transactions.
+func (chain *Chain) Mine(count int) {
+	chain.mu.Lock()
+	for i := 0; i < count; i++ {
+		chain.mine(chain.mempool)
+		chain.mempool = nil
+	}
+	chain.mu.Unlock()
+	chain.notifyChange()
+}
+
+// MineEmpty mines `count` blocks without including mempool transactions.
+func (chain *Chain) MineEmpty(count int) {
+	chain.mu.Lock()
+	for i := 0; i < count; i++ {
+		chain.mine(nil)
+	}
+	chain.mu.Unlock()
+	chain.notifyChange()
+}
+
+// Disconnect removes the `count` top blocks, e.g. to simulate a reorg together with mining a
+// longer chain afterwards. The transactions of the removed blocks are moved back to the mempool.
+func (chain *Chain) Disconnect(count int) {
+	chain.mu.Lock()
+	if count >= len(chain.blocks) {
+		chain.mu.Unlock()
+		panic("can't disconnect the genesis block")
+	}
+	mempool := []*wire.MsgTx{}
+	for _, block := range chain.blocks[len(chain.blocks)-count:] {
+		mempool = append(mempool, block.txs[1:]...)
+	}
+	chain.mempool = append(mempool, chain.mempool...)
+	chain.blocks = chain.blocks[:len(chain.blocks)-count]
+	chain.mu.Unlock()
+	chain.notifyChange()
+}
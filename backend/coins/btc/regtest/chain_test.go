@@ -0,0 +1,110 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regtest
+
+import (
+	"testing"
+
+	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/stretchr/testify/require"
+)
+
+var pkScript = []byte{0x00, 0x14, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+func TestMineAndMerkle(t *testing.T) {
+	chain := NewChain()
+	txs := []*wire.MsgTx{}
+	for i := 0; i < 4; i++ {
+		txs = append(txs, chain.Fund(pkScript, btcutil.Amount(1000+i)))
+	}
+	chain.Mine(1)
+	require.Equal(t, 1, chain.TipHeight())
+	header := chain.Header(1)
+	require.Equal(t, chain.Header(0).BlockHash(), header.PrevBlock)
+
+	// With the coinbase, the block has an odd number of transactions.
+	utilTxs := []*btcutil.Tx{}
+	for _, tx := range chain.blocks[1].txs {
+		utilTxs = append(utilTxs, btcutil.NewTx(tx))
+	}
+	merkles := btcdBlockchain.BuildMerkleTreeStore(utilTxs, false)
+	require.Equal(t, *merkles[len(merkles)-1], header.MerkleRoot)
+
+	for _, tx := range txs {
+		branch, pos, err := chain.Merkle(tx.TxHash(), 1)
+		require.NoError(t, err)
+		root := tx.TxHash()
+		for i, hash := range branch {
+			if (pos>>i)&1 == 0 {
+				root = chainhash.DoubleHashH(append(root[:], hash[:]...))
+			} else {
+				root = chainhash.DoubleHashH(append(hash[:], root[:]...))
+			}
+		}
+		require.Equal(t, header.MerkleRoot, root)
+		height, ok := chain.TxHeight(tx.TxHash())
+		require.True(t, ok)
+		require.Equal(t, 1, height)
+	}
+}
+
+func TestBroadcastReplacement(t *testing.T) {
+	chain := NewChain()
+	tx := chain.Fund(pkScript, 1000)
+
+	// Same fee.
+	replacement := tx.Copy()
+	replacement.LockTime = 1
+	require.Error(t, chain.Broadcast(replacement))
+
+	replacement.TxOut[0].Value--
+	require.NoError(t, chain.Broadcast(replacement))
+	_, ok := chain.TxHeight(tx.TxHash())
+	require.False(t, ok)
+	require.NotNil(t, chain.Transaction(tx.TxHash()))
+
+	// Not replaceable.
+	final := chain.FundingTx(pkScript, 1000)
+	final.TxIn[0].Sequence = wire.MaxTxInSequenceNum
+	require.NoError(t, chain.Broadcast(final))
+	finalReplacement := final.Copy()
+	finalReplacement.TxOut[0].Value--
+	require.Error(t, chain.Broadcast(finalReplacement))
+
+	// Spending an unconfirmed output.
+	child := wire.NewMsgTx(wire.TxVersion)
+	child.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: replacement.TxHash(), Index: 0}, nil, nil))
+	child.AddTxOut(wire.NewTxOut(500, pkScript))
+	require.NoError(t, chain.Broadcast(child))
+	height, ok := chain.TxHeight(child.TxHash())
+	require.True(t, ok)
+	require.Equal(t, -1, height)
+
+	chain.Mine(1)
+	double := child.Copy()
+	double.TxOut[0].Value = 400
+	require.Error(t, chain.Broadcast(double))
+
+	// Disconnecting the block moves its transactions back to the mempool.
+	chain.Disconnect(1)
+	height, ok = chain.TxHeight(child.TxHash())
+	require.True(t, ok)
+	require.Equal(t, -1, height)
+	require.Len(t, chain.History(blockchain.NewScriptHashHex(pkScript)), 3)
+}
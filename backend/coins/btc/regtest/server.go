@@ -0,0 +1,355 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+)
+
+const (
+	serverSoftwareVersion = "regtest-electrum/0.1"
+	protocolVersion       = "1.4"
+	// maxHeaders is the maximum number of headers returned by blockchain.block.headers.
+	maxHeaders = 2016
+)
+
+type request struct {
+	ID     *int              `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int        `json:"id,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   interface{} `json:"error,omitempty"`
+	Method  string      `json:"method,omitempty"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type connection struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	mu                sync.Mutex
+	headersSubscribed bool
+	lastTip           chainhash.Hash
+	// statuses contains the last status sent to the client for each subscribed script hash.
+	statuses map[blockchain.ScriptHashHex]string
+}
+
+func (c *connection) write(resp *response) {
+	resp.JSONRPC = "2.0"
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		panic(err)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, _ = c.conn.Write(append(respBytes, '\n'))
+}
+
+// ElectrumServer serves a Chain using the Electrum protocol over TLS on localhost. Subscribed clients
+// are notified of new tips and of script hash status changes whenever the chain changes.
+type ElectrumServer struct {
+	chain  *Chain
+	server *test.TCPServer
+
+	connectionsMu sync.Mutex
+	connections   map[*connection]struct{}
+}
+
+// NewElectrumServer starts serving the chain. Call Close() to stop the server.
+func NewElectrumServer(chain *Chain) *ElectrumServer {
+	server := &ElectrumServer{
+		chain:       chain,
+		server:      &test.TCPServer{},
+		connections: map[*connection]struct{}{},
+	}
+	server.server.StartTLS(server.accept)
+	chain.OnChange(server.onChainChange)
+	return server
+}
+
+// ServerInfo returns the server config needed to connect to the server.
+func (server *ElectrumServer) ServerInfo() *config.ServerInfo {
+	return &config.ServerInfo{
+		Server:  server.server.Addr(),
+		TLS:     true,
+		PEMCert: test.TCPServerCertPub,
+	}
+}
+
+// Close stops listening and closes all client connections.
+func (server *ElectrumServer) Close() {
+	server.server.Close()
+	server.connectionsMu.Lock()
+	defer server.connectionsMu.Unlock()
+	for c := range server.connections {
+		_ = c.conn.Close()
+	}
+	server.connections = map[*connection]struct{}{}
+}
+
+func (server *ElectrumServer) accept(conn net.Conn) {
+	c := &connection{
+		conn:     conn,
+		statuses: map[blockchain.ScriptHashHex]string{},
+	}
+	server.connectionsMu.Lock()
+	server.connections[c] = struct{}{}
+	server.connectionsMu.Unlock()
+	defer func() {
+		server.connectionsMu.Lock()
+		delete(server.connections, c)
+		server.connectionsMu.Unlock()
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			return
+		}
+		result, err := server.handle(c, &req)
+		if req.ID == nil {
+			continue
+		}
+		if err != nil {
+			c.write(&response{ID: req.ID, Error: &rpcError{Code: 1, Message: err.Error()}})
+			continue
+		}
+		if result == nil {
+			// Marshal an explicit null result.
+			result = json.RawMessage("null")
+		}
+		c.write(&response{ID: req.ID, Result: result})
+	}
+}
+
+func parseParams(params []json.RawMessage, targets ...interface{}) error {
+	if len(params) < len(targets) {
+		return errp.Newf("expected %d params, got %d", len(targets), len(params))
+	}
+	for i, target := range targets {
+		if err := json.Unmarshal(params[i], target); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func headerHex(header *wire.BlockHeader) string {
+	var buf bytes.Buffer
+	if err := header.Serialize(&buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func (server *ElectrumServer) tip() map[string]interface{} {
+	height := server.chain.TipHeight()
+	return map[string]interface{}{
+		"height": height,
+		"hex":    headerHex(server.chain.Header(height)),
+	}
+}
+
+// feeRate converts a fee rate to BTC/kB, as used by the Electrum protocol.
+func feeRate(feeRatePerKb btcutil.Amount) float64 {
+	return feeRatePerKb.ToBTC()
+}
+
+func (server *ElectrumServer) handle(c *connection, req *request) (interface{}, error) {
+	switch req.Method {
+	case "server.version":
+		return []string{serverSoftwareVersion, protocolVersion}, nil
+	case "server.ping":
+		return nil, nil
+	case "blockchain.headers.subscribe":
+		tip := server.tip()
+		c.mu.Lock()
+		c.headersSubscribed = true
+		c.lastTip = server.chain.Header(tip["height"].(int)).BlockHash()
+		c.mu.Unlock()
+		return tip, nil
+	case "blockchain.scripthash.subscribe":
+		var scriptHashHex blockchain.ScriptHashHex
+		if err := parseParams(req.Params, &scriptHashHex); err != nil {
+			return nil, err
+		}
+		status := server.chain.History(scriptHashHex).Status()
+		c.mu.Lock()
+		c.statuses[scriptHashHex] = status
+		c.mu.Unlock()
+		if status == "" {
+			return nil, nil
+		}
+		return status, nil
+	case "blockchain.scripthash.get_history":
+		var scriptHashHex blockchain.ScriptHashHex
+		if err := parseParams(req.Params, &scriptHashHex); err != nil {
+			return nil, err
+		}
+		return server.chain.History(scriptHashHex), nil
+	case "blockchain.transaction.get":
+		var txHashHex string
+		if err := parseParams(req.Params, &txHashHex); err != nil {
+			return nil, err
+		}
+		txHash, err := chainhash.NewHashFromStr(txHashHex)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		tx := server.chain.Transaction(*txHash)
+		if tx == nil {
+			return nil, errp.New("No such mempool or blockchain transaction")
+		}
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		return hex.EncodeToString(buf.Bytes()), nil
+	case "blockchain.transaction.broadcast":
+		var rawTxHex string
+		if err := parseParams(req.Params, &rawTxHex); err != nil {
+			return nil, err
+		}
+		rawTx, err := hex.DecodeString(rawTxHex)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		tx := wire.NewMsgTx(wire.TxVersion)
+		if err := tx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if err := server.chain.Broadcast(tx); err != nil {
+			return nil, err
+		}
+		return tx.TxHash().String(), nil
+	case "blockchain.estimatefee":
+		feeRatePerKb, _ := server.chain.FeeRates()
+		return feeRate(feeRatePerKb), nil
+	case "blockchain.relayfee":
+		_, relayFeePerKb := server.chain.FeeRates()
+		return feeRate(relayFeePerKb), nil
+	case "blockchain.block.headers":
+		var startHeight, count int
+		if err := parseParams(req.Params, &startHeight, &count); err != nil {
+			return nil, err
+		}
+		if count > maxHeaders {
+			count = maxHeaders
+		}
+		var buf bytes.Buffer
+		headers := server.chain.Headers(startHeight, count)
+		for _, header := range headers {
+			header := header
+			if err := header.Serialize(&buf); err != nil {
+				return nil, errp.WithStack(err)
+			}
+		}
+		return map[string]interface{}{
+			"hex":   hex.EncodeToString(buf.Bytes()),
+			"count": len(headers),
+			"max":   maxHeaders,
+		}, nil
+	case "blockchain.transaction.get_merkle":
+		var txHashHex string
+		var height int
+		if err := parseParams(req.Params, &txHashHex, &height); err != nil {
+			return nil, err
+		}
+		txHash, err := chainhash.NewHashFromStr(txHashHex)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		branch, pos, err := server.chain.Merkle(*txHash, height)
+		if err != nil {
+			return nil, err
+		}
+		merkle := make([]string, len(branch))
+		for i, hash := range branch {
+			merkle[i] = hash.String()
+		}
+		return map[string]interface{}{
+			"merkle":       merkle,
+			"pos":          pos,
+			"block_height": height,
+		}, nil
+	default:
+		return nil, errp.Newf("unknown method %s", req.Method)
+	}
+}
+
+// onChainChange notifies all clients of a new tip and of changed script hash statuses.
+func (server *ElectrumServer) onChainChange() {
+	server.connectionsMu.Lock()
+	connections := make([]*connection, 0, len(server.connections))
+	for c := range server.connections {
+		connections = append(connections, c)
+	}
+	server.connectionsMu.Unlock()
+
+	tip := server.tip()
+	tipHash := server.chain.Header(tip["height"].(int)).BlockHash()
+	for _, c := range connections {
+		c.mu.Lock()
+		if c.headersSubscribed && c.lastTip != tipHash {
+			c.lastTip = tipHash
+			c.write(&response{Method: "blockchain.headers.subscribe", Params: []interface{}{tip}})
+		}
+		for scriptHashHex, lastStatus := range c.statuses {
+			status := server.chain.History(scriptHashHex).Status()
+			if status == lastStatus {
+				continue
+			}
+			c.statuses[scriptHashHex] = status
+			var statusParam interface{}
+			if status != "" {
+				statusParam = status
+			}
+			c.write(&response{
+				Method: "blockchain.scripthash.subscribe",
+				Params: []interface{}{scriptHashHex, statusParam},
+			})
+		}
+		c.mu.Unlock()
+	}
+}
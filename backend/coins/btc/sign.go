@@ -19,6 +19,7 @@ import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
@@ -33,8 +34,15 @@ type ProposedTransaction struct {
 	TXProposal *maketx.TxProposal
 	// List of signing configurations that might be used in the tx inputs.
 	AccountSigningConfigurations []*signing.Configuration
-	GetAddress                   func(blockchain.ScriptHashHex) *addresses.AccountAddress
-	GetPrevTx                    func(chainhash.Hash) (*wire.MsgTx, error)
+	// GetAddress returns the account address of a spent output. It returns nil for outputs not
+	// belonging to the account, which are only allowed if SkipForeignInputs is set.
+	GetAddress func(blockchain.ScriptHashHex) *addresses.AccountAddress
+	GetPrevTx  func(chainhash.Hash) (*wire.MsgTx, error)
+	// SkipForeignInputs allows inputs spending outputs which do not belong to the account, like the
+	// commitment input of a proof of reserves. Keystores supporting this leave the signatures of
+	// these inputs nil, all other keystores return an error. If not set, keystores return an error
+	// instead of returning a partially signed transaction.
+	SkipForeignInputs bool
 	// Signatures collects the signatures, one per transaction input.
 	Signatures []*types.Signature
 	SigHashes  *txscript.TxSigHashes
@@ -63,6 +71,9 @@ func (account *Account) signTransaction(
 		FormatUnit:                   account.coin.formatUnit,
 	}
 
+	if account.Config().Keystore == nil {
+		return errp.WithStack(errors.ErrKeystoreNotConnected)
+	}
 	if err := account.Config().Keystore.SignTransaction(proposedTransaction); err != nil {
 		return err
 	}
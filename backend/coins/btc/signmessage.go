@@ -0,0 +1,145 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	accountErrors "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/message"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// SignedMessage is a message signed by an address of the account.
+type SignedMessage struct {
+	Address   string         `json:"address"`
+	Message   string         `json:"message"`
+	Format    message.Format `json:"format"`
+	Signature string         `json:"signature"`
+}
+
+// ErrBIP322NotSupported is returned by SignMessage() if the keystore cannot sign BIP322 message
+// signatures, e.g. the BitBox02.
+var ErrBIP322NotSupported = errors.New("bip322NotSupported")
+
+// SignMessage signs the message with the private key of the receive address with the given ID.
+// Legacy signatures are supported for P2WPKH and P2WPKH-P2SH addresses, BIP322 signatures for
+// P2WPKH and P2TR addresses.
+func (account *Account) SignMessage(
+	addressID string, msg string, format message.Format) (*SignedMessage, error) {
+	if !account.isInitialized() {
+		return nil, errp.New("account must be initialized")
+	}
+	keystore := account.Config().Keystore
+	if keystore == nil {
+		return nil, errp.WithStack(accountErrors.ErrKeystoreNotConnected)
+	}
+	address, err := account.receiveAddress(addressID)
+	if err != nil {
+		return nil, err
+	}
+	scriptType := address.Configuration.ScriptType()
+	var signature string
+	switch format {
+	case message.FormatLegacy:
+		if scriptType == signing.ScriptTypeP2TR {
+			return nil, errp.New("taproot addresses only support BIP322 signatures")
+		}
+		if !keystore.CanSignMessage(account.coin.Code()) {
+			return nil, errp.New("the keystore does not support signing messages")
+		}
+		sig, err := keystore.SignBTCMessage([]byte(msg), address.AbsoluteKeypath(), scriptType)
+		if err != nil {
+			return nil, err
+		}
+		signature, err = message.EncodeLegacySignature(sig)
+		if err != nil {
+			return nil, err
+		}
+	case message.FormatBIP322:
+		if scriptType != signing.ScriptTypeP2WPKH && scriptType != signing.ScriptTypeP2TR {
+			return nil, errp.Newf("BIP322 signatures are not supported for %s addresses", scriptType)
+		}
+		if !keystore.CanSignBIP322(account.coin.Code()) {
+			return nil, errp.WithStack(ErrBIP322NotSupported)
+		}
+		signature, err = account.signBIP322(address.PubkeyScript(), []byte(msg))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errp.Newf("unknown message signature format: %s", format)
+	}
+	// Sanity check, e.g. that the keystore signed with the key of the address.
+	_, err = message.Verify(address.EncodeForHumans(), []byte(msg), signature, account.coin.Net())
+	if err != nil {
+		return nil, err
+	}
+	return &SignedMessage{
+		Address:   address.EncodeForHumans(),
+		Message:   msg,
+		Format:    format,
+		Signature: signature,
+	}, nil
+}
+
+// signBIP322 signs the BIP322 `to_sign` virtual transaction like a regular transaction and
+// returns the encoded witness.
+func (account *Account) signBIP322(pkScript []byte, msg []byte) (string, error) {
+	toSpend := message.BIP322ToSpend(pkScript, msg)
+	toSign := message.BIP322ToSign(toSpend)
+	previousOutputs := maketx.PreviousOutputs{
+		toSign.TxIn[0].PreviousOutPoint: &transactions.SpendableOutput{TxOut: toSpend.TxOut[0]},
+	}
+	signingConfigs := make([]*signing.Configuration, len(account.subaccounts))
+	for i, subacc := range account.subaccounts {
+		signingConfigs[i] = subacc.signingConfiguration
+	}
+	proposedTransaction := &ProposedTransaction{
+		TXProposal: &maketx.TxProposal{
+			Coin:            account.coin,
+			Transaction:     toSign,
+			PreviousOutputs: previousOutputs,
+		},
+		AccountSigningConfigurations: signingConfigs,
+		GetAddress:                   account.getAddress,
+		GetPrevTx: func(hash chainhash.Hash) (*wire.MsgTx, error) {
+			if hash != toSpend.TxHash() {
+				return nil, errp.New("unknown previous transaction")
+			}
+			return toSpend, nil
+		},
+		Signatures: make([]*types.Signature, 1),
+		SigHashes:  txscript.NewTxSigHashes(toSign, previousOutputs),
+		FormatUnit: account.coin.formatUnit,
+	}
+	if err := account.Config().Keystore.SignTransaction(proposedTransaction); err != nil {
+		return "", err
+	}
+	signature := proposedTransaction.Signatures[0]
+	if signature == nil {
+		return "", errp.New("Signature missing")
+	}
+	address := account.getAddress(previousOutputs[toSign.TxIn[0].PreviousOutPoint].ScriptHashHex())
+	_, witness := address.SignatureScript(*signature)
+	return message.EncodeBIP322Signature(witness)
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/message"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+// newSignMessageAccount returns an initialized account with P2WPKH-P2SH, P2WPKH and P2TR
+// subaccounts. The xpubs are derived by the software keystore, the account signs with keystore if
+// it is not nil, otherwise with the software keystore.
+func newSignMessageAccount(t *testing.T, keystore keystore.Keystore) *btc.Account {
+	t.Helper()
+	net := &chaincfg.TestNet3Params
+	dbFolder := test.TstTempDir("btc-signmessage")
+	t.Cleanup(func() { _ = os.RemoveAll(dbFolder) })
+
+	tbtc := btc.NewCoin(coin.CodeTBTC, "Bitcoin Testnet", "TBTC", coin.BtcUnitDefault, net,
+		dbFolder, nil, explorer, socksproxy.NewSocksProxy(false, ""))
+	blockchainMock := &blockchainMock.BlockchainMock{}
+	blockchainMock.MockRegisterOnConnectionErrorChangedEvent = func(f func(error)) {}
+	tbtc.TstSetMakeBlockchain(func() blockchain.Interface { return blockchainMock })
+
+	master, err := hdkeychain.NewMaster(make([]byte, 32), net)
+	require.NoError(t, err)
+	softwareKeystore := software.NewKeystore(master)
+	if keystore == nil {
+		keystore = softwareKeystore
+	}
+	rootFingerprint, err := softwareKeystore.RootFingerprint()
+	require.NoError(t, err)
+
+	signingConfigurations := signing.Configurations{}
+	for _, scriptType := range []signing.ScriptType{
+		signing.ScriptTypeP2WPKHP2SH, signing.ScriptTypeP2WPKH, signing.ScriptTypeP2TR,
+	} {
+		keypath, err := signing.NewAbsoluteKeypath(map[signing.ScriptType]string{
+			signing.ScriptTypeP2WPKHP2SH: "m/49'/1'/0'",
+			signing.ScriptTypeP2WPKH:     "m/84'/1'/0'",
+			signing.ScriptTypeP2TR:       "m/86'/1'/0'",
+		}[scriptType])
+		require.NoError(t, err)
+		xpub, err := softwareKeystore.ExtendedPublicKey(tbtc, keypath)
+		require.NoError(t, err)
+		signingConfigurations = append(signingConfigurations,
+			signing.NewBitcoinConfiguration(scriptType, rootFingerprint, keypath, xpub))
+	}
+
+	account := btc.NewAccount(
+		&accounts.AccountConfig{
+			Config: &config.Account{
+				Code:                  "accountcode",
+				Name:                  "accountname",
+				SigningConfigurations: signingConfigurations,
+			},
+			DBFolder:        dbFolder,
+			Keystore:        keystore,
+			OnEvent:         func(accountsTypes.Event) {},
+			RateUpdater:     nil,
+			GetNotifier:     func(signing.Configurations) accounts.Notifier { return nil },
+			GetSaveFilename: func(suggestedFilename string) string { return suggestedFilename },
+		},
+		tbtc, nil,
+		logging.Get().WithGroup("signmessage_test"),
+	)
+	require.NoError(t, account.Initialize())
+	t.Cleanup(account.Close)
+	return account
+}
+
+func TestSignMessage(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	account := newSignMessageAccount(t, nil)
+
+	const msg = "I control this address"
+	receiveAddresses := account.GetUnusedReceiveAddresses()
+	require.Len(t, receiveAddresses, 3)
+	for _, addressList := range receiveAddresses {
+		address := addressList.Addresses[0]
+		scriptType := *addressList.ScriptType
+		for _, format := range []message.Format{message.FormatLegacy, message.FormatBIP322} {
+			supported := map[message.Format]bool{
+				message.FormatLegacy: scriptType != signing.ScriptTypeP2TR,
+				message.FormatBIP322: scriptType != signing.ScriptTypeP2WPKHP2SH,
+			}[format]
+			signedMessage, err := account.SignMessage(address.ID(), msg, format)
+			if !supported {
+				require.Error(t, err, "%s %s", scriptType, format)
+				continue
+			}
+			require.NoError(t, err, "%s %s", scriptType, format)
+			require.Equal(t, address.EncodeForHumans(), signedMessage.Address)
+			require.Equal(t, msg, signedMessage.Message)
+			require.Equal(t, format, signedMessage.Format)
+
+			detectedFormat, err := message.Verify(
+				signedMessage.Address, []byte(msg), signedMessage.Signature, net)
+			require.NoError(t, err)
+			require.Equal(t, format, detectedFormat)
+			_, err = message.Verify(
+				signedMessage.Address, []byte("other message"), signedMessage.Signature, net)
+			require.Error(t, err)
+		}
+	}
+
+	_, err := account.SignMessage("unknown", msg, message.FormatLegacy)
+	require.Error(t, err)
+}
+
+func TestSignMessageBIP322NotSupported(t *testing.T) {
+	master, err := hdkeychain.NewMaster(make([]byte, 32), &chaincfg.TestNet3Params)
+	require.NoError(t, err)
+	softwareKeystore := software.NewKeystore(master)
+	// Like the BitBox02, which supports legacy message signatures but rejects the BIP322
+	// virtual transaction.
+	bitbox02LikeKeystore := &keystoremock.KeystoreMock{
+		CanSignMessageFunc: func(code coin.Code) bool {
+			return true
+		},
+		CanSignBIP322Func: func(code coin.Code) bool {
+			return false
+		},
+		SignBTCMessageFunc: softwareKeystore.SignBTCMessage,
+		SignTransactionFunc: func(interface{}) error {
+			require.FailNow(t, "SignTransaction must not be called")
+			return nil
+		},
+	}
+	account := newSignMessageAccount(t, bitbox02LikeKeystore)
+
+	const msg = "I control this address"
+	receiveAddresses := account.GetUnusedReceiveAddresses()
+	require.Len(t, receiveAddresses, 3)
+	// P2WPKH.
+	address := receiveAddresses[1].Addresses[0]
+	_, err = account.SignMessage(address.ID(), msg, message.FormatBIP322)
+	require.Equal(t, btc.ErrBIP322NotSupported, errp.Cause(err))
+	_, err = account.SignMessage(address.ID(), msg, message.FormatLegacy)
+	require.NoError(t, err)
+}
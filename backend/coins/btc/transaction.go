@@ -237,12 +237,12 @@ func (account *Account) SendTx() error {
 	}
 
 	account.log.Info("Signing and sending transaction")
-	if err := account.signTransaction(txProposal, account.coin.Blockchain().TransactionGet); err != nil {
+	if err := account.signTransaction(txProposal, account.blockchain.TransactionGet); err != nil {
 		return errp.WithMessage(err, "Failed to sign transaction")
 	}
 
 	account.log.Info("Signed transaction is broadcasted")
-	if err := account.coin.Blockchain().TransactionBroadcast(txProposal.Transaction); err != nil {
+	if err := account.blockchain.TransactionBroadcast(txProposal.Transaction); err != nil {
 		return err
 	}
 
@@ -32,6 +32,10 @@ type DBTxInfo struct {
 	Verified         *bool           `json:"Verified"`
 	HeaderTimestamp  *time.Time      `json:"ts"`
 	CreatedTimestamp *time.Time      `json:"created"`
+	// BlockHash is the hash of the block the tx was verified to be in. It is used to detect when
+	// the block is orphaned by a reorg. Nil if the tx is not verified, or was verified before the
+	// block hash was recorded.
+	BlockHash *chainhash.Hash `json:"blockHash"`
 
 	// TxHash is the same as Tx.TxHash(), but since we already have this value in the database, it
 	// is faster to access it this way than to recompute it.  It is not serialized and stored in the
@@ -68,8 +72,13 @@ type DBTxInterface interface {
 	// UnverifiedTransactions retrieves all stored transaction hashes of unverified transactions.
 	UnverifiedTransactions() ([]chainhash.Hash, error)
 
-	// MarkTxVerified marks a tx as verified. Stores timestamp of the header this tx appears in.
-	MarkTxVerified(txHash chainhash.Hash, headerTimestamp time.Time) error
+	// MarkTxVerified marks a tx as verified. Stores timestamp and hash of the header this tx
+	// appears in.
+	MarkTxVerified(txHash chainhash.Hash, headerTimestamp time.Time, blockHash chainhash.Hash) error
+
+	// MarkTxUnverified reverts MarkTxVerified and moves the tx back to pending (height 0). Used
+	// when the block the tx was verified in was orphaned.
+	MarkTxUnverified(txHash chainhash.Hash) error
 
 	// PutInput stores a transaction input. It is referenced by the output it spends. The
 	// transaction hash of the transaction this input was found in is recorded. TODO: store slice of
@@ -15,6 +15,8 @@
 package transactions
 
 import (
+	"sync/atomic"
+
 	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -22,6 +24,7 @@ import (
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/synchronizer"
@@ -59,9 +62,15 @@ type Transactions struct {
 
 	unsubscribeHeadersEvent func()
 
+	// checkReorgedPending is true if confirmed transactions need to be checked against the headers
+	// after the headers are synced, to detect transactions whose block was orphaned. It is set
+	// initially and after each reorg.
+	checkReorgedPending atomic.Bool
+
 	synchronizer *synchronizer.Synchronizer
 	blockchain   blockchain.Interface
 	notifier     accounts.Notifier
+	onEvent      func(accountsTypes.Event)
 	log          *logrus.Entry
 
 	closed     bool
@@ -76,6 +85,7 @@ func NewTransactions(
 	synchronizer *synchronizer.Synchronizer,
 	blockchain blockchain.Interface,
 	notifier accounts.Notifier,
+	onEvent func(accountsTypes.Event),
 	log *logrus.Entry,
 ) *Transactions {
 	transactions := &Transactions{
@@ -88,8 +98,10 @@ func NewTransactions(
 		synchronizer: synchronizer,
 		blockchain:   blockchain,
 		notifier:     notifier,
+		onEvent:      onEvent,
 		log:          log.WithFields(logrus.Fields{"group": "transactions", "net": net.Name}),
 	}
+	transactions.checkReorgedPending.Store(true)
 	transactions.unsubscribeHeadersEvent = headers.SubscribeEvent(transactions.onHeadersEvent)
 	return transactions
 }
@@ -17,6 +17,7 @@ package transactions_test
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -24,11 +25,13 @@ import (
 	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
 	accountsMock "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/mocks"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
 	blockchainpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/db/transactionsdb"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
 	headersMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/synchronizer"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
@@ -87,8 +90,13 @@ type transactionsSuite struct {
 	blockchainMock *BlockchainMock
 	headersMock    *headersMock.Interface
 	notifierMock   *accountsMock.Notifier
+	db             *transactionsdb.DB
+	events         chan accountsTypes.Event
 	transactions   *transactions.Transactions
 
+	// onHeadersEvent is the callback the transactions subscribed to the headers with.
+	onHeadersEvent func(headers.Event)
+
 	log *logrus.Entry
 }
 
@@ -107,10 +115,16 @@ func (s *transactionsSuite) SetupTest() {
 	if err != nil {
 		panic(err)
 	}
+	s.db = db
 	s.headersMock = &headersMock.Interface{}
-	s.headersMock.On("SubscribeEvent", mock.AnythingOfType("func(headers.Event)")).Return(func() {})
+	s.headersMock.On("SubscribeEvent", mock.AnythingOfType("func(headers.Event)")).
+		Run(func(args mock.Arguments) {
+			s.onHeadersEvent = args.Get(0).(func(headers.Event))
+		}).
+		Return(func() {})
 	s.headersMock.On("TipHeight").Return(15).Once()
 	s.notifierMock = &accountsMock.Notifier{}
+	s.events = make(chan accountsTypes.Event, 10)
 	s.transactions = transactions.NewTransactions(
 		s.net,
 		db,
@@ -118,6 +132,7 @@ func (s *transactionsSuite) SetupTest() {
 		s.synchronizer,
 		s.blockchainMock,
 		s.notifierMock,
+		func(event accountsTypes.Event) { s.events <- event },
 		s.log,
 	)
 }
@@ -371,3 +386,55 @@ func (s *transactionsSuite) TestRemoveTransaction() {
 	require.NoError(s.T(), err)
 	require.Len(s.T(), transactions, 2)
 }
+
+func (s *transactionsSuite) txInfo(txHash chainhash.Hash) *transactions.DBTxInfo {
+	txInfo, err := transactions.DBView(s.db, func(dbTx transactions.DBTxInterface) (*transactions.DBTxInfo, error) {
+		return dbTx.TxInfo(txHash)
+	})
+	require.NoError(s.T(), err)
+	return txInfo
+}
+
+// TestReorg checks that a verified tx whose block is orphaned is moved back to pending, and that
+// it picks up its new height.
+func (s *transactionsSuite) TestReorg() {
+	addresses, err := s.addressChain.EnsureAddresses()
+	require.NoError(s.T(), err)
+	address := addresses[0]
+	tx1 := newTx(chainhash.HashH(nil), 0, address, 123)
+	tx1Hash := tx1.TxHash()
+	s.blockchainMock.RegisterTxs(tx1)
+
+	// With an empty merkle branch, the merkle root is the tx hash itself.
+	header := &wire.BlockHeader{MerkleRoot: tx1Hash, Nonce: 1}
+	s.headersMock.On("VerifiedHeaderByHeight", 10).Return(header, nil).Once()
+	s.blockchainMock.On("GetMerkle", tx1Hash, 10).Return(&blockchainpkg.GetMerkleResult{}, nil)
+	s.updateAddressHistory(address, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx1Hash), Height: 10},
+	})
+	require.Eventually(s.T(), func() bool {
+		blockHash := s.txInfo(tx1Hash).BlockHash
+		return blockHash != nil && *blockHash == header.BlockHash()
+	}, time.Second, 10*time.Millisecond)
+
+	// No reorg: nothing changes.
+	s.headersMock.On("VerifiedHeaderByHeight", 10).Return(header, nil).Once()
+	s.onHeadersEvent(headers.EventSynced)
+	require.Equal(s.T(), 10, s.txInfo(tx1Hash).Height)
+	require.Empty(s.T(), s.events)
+
+	// The block at height 10 is replaced, and the tx is now mined at height 11.
+	orphaningHeader := &wire.BlockHeader{Nonce: 2}
+	s.headersMock.On("VerifiedHeaderByHeight", 10).Return(orphaningHeader, nil).Once()
+	s.headersMock.On("VerifiedHeaderByHeight", 11).Return(nil, nil)
+	s.blockchainMock.On("ScriptHashGetHistory", address.PubkeyScriptHashHex()).Return(
+		blockchainpkg.TxHistory{{TXHash: blockchainpkg.TXHash(tx1Hash), Height: 11}}, nil).Once()
+	s.notifierMock.On("Put", tx1Hash[:]).Return(nil).Once()
+	s.onHeadersEvent(headers.EventReorg)
+	s.onHeadersEvent(headers.EventSynced)
+	require.Equal(s.T(), accountsTypes.EventTransactionsReorged, <-s.events)
+	txInfo := s.txInfo(tx1Hash)
+	require.Equal(s.T(), 11, txInfo.Height)
+	require.Nil(s.T(), txInfo.BlockHash)
+	require.Nil(s.T(), txInfo.Verified)
+}
@@ -16,6 +16,7 @@ package transactions
 
 import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
 )
@@ -23,7 +24,12 @@ import (
 func (transactions *Transactions) onHeadersEvent(event headers.Event) {
 	switch event {
 	case headers.EventSynced:
+		if transactions.checkReorgedPending.CompareAndSwap(true, false) {
+			transactions.checkReorgedTransactions()
+		}
 		transactions.verifyTransactions()
+	case headers.EventReorg:
+		transactions.checkReorgedPending.Store(true)
 	case headers.EventNewTip:
 		done := transactions.synchronizer.IncRequestsCounter()
 		transactions.headersTipHeight = transactions.headers.TipHeight()
@@ -104,9 +110,91 @@ func (transactions *Transactions) verifyTransaction(txHash chainhash.Hash, heigh
 	transactions.log.Debugf("Merkle root verification succeeded")
 
 	err = DBUpdate(transactions.db, func(dbTx DBTxInterface) error {
-		return dbTx.MarkTxVerified(txHash, header.Timestamp)
+		return dbTx.MarkTxVerified(txHash, header.Timestamp, header.BlockHash())
 	})
 	if err != nil {
 		transactions.log.WithError(err).Error("MarkTXVerified")
 	}
 }
+
+// reorgedTransactions returns the verified transactions whose recorded block hash does not match
+// the header at their height anymore, along with the addresses they touch. Transactions whose
+// height is not synced yet are skipped.
+func (transactions *Transactions) reorgedTransactions() (map[chainhash.Hash][]blockchain.ScriptHashHex, error) {
+	return DBView(transactions.db, func(dbTx DBTxInterface) (map[chainhash.Hash][]blockchain.ScriptHashHex, error) {
+		txHashes, err := dbTx.Transactions()
+		if err != nil {
+			return nil, err
+		}
+		result := map[chainhash.Hash][]blockchain.ScriptHashHex{}
+		for _, txHash := range txHashes {
+			txInfo, err := dbTx.TxInfo(txHash)
+			if err != nil {
+				return nil, err
+			}
+			if txInfo.BlockHash == nil || txInfo.Height <= 0 {
+				continue
+			}
+			header, err := transactions.headers.VerifiedHeaderByHeight(txInfo.Height)
+			if err != nil {
+				return nil, err
+			}
+			if header == nil || header.BlockHash() == *txInfo.BlockHash {
+				continue
+			}
+			addresses := []blockchain.ScriptHashHex{}
+			for address := range txInfo.Addresses {
+				addresses = append(addresses, blockchain.ScriptHashHex(address))
+			}
+			result[txHash] = addresses
+		}
+		return result, nil
+	})
+}
+
+// checkReorgedTransactions moves transactions whose block was orphaned back to pending. The
+// histories of the addresses they touch are re-fetched so they pick up their height in the new
+// chain, which triggers a new verification.
+func (transactions *Transactions) checkReorgedTransactions() {
+	reorged, err := transactions.reorgedTransactions()
+	if err != nil {
+		transactions.log.WithError(err).Error("reorgedTransactions")
+		return
+	}
+	if len(reorged) == 0 {
+		return
+	}
+	transactions.log.Warningf("%d transactions were in orphaned blocks", len(reorged))
+
+	done := transactions.synchronizer.IncRequestsCounter()
+	defer done()
+
+	err = DBUpdate(transactions.db, func(dbTx DBTxInterface) error {
+		for txHash := range reorged {
+			if err := dbTx.MarkTxUnverified(txHash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		transactions.log.WithError(err).Error("MarkTxUnverified")
+		return
+	}
+	transactions.onEvent(accountsTypes.EventTransactionsReorged)
+
+	scriptHashes := map[blockchain.ScriptHashHex]struct{}{}
+	for _, addresses := range reorged {
+		for _, scriptHashHex := range addresses {
+			scriptHashes[scriptHashHex] = struct{}{}
+		}
+	}
+	for scriptHashHex := range scriptHashes {
+		history, err := transactions.blockchain.ScriptHashGetHistory(scriptHashHex)
+		if err != nil {
+			transactions.log.WithError(err).Error("ScriptHashGetHistory")
+			continue
+		}
+		transactions.UpdateAddressHistory(scriptHashHex, history)
+	}
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/db"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/etherscan"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
 	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
@@ -66,6 +67,10 @@ type Account struct {
 	signingConfiguration *signing.Configuration
 	notifier             accounts.Notifier
 	httpClient           *http.Client
+	// client and transactionsSource are the ones of the coin, or, if the coin supports it, separate
+	// instances using httpClient.
+	client             rpcclient.Interface
+	transactionsSource TransactionsSource
 
 	// true when initialized (Initialize() was called).
 	initialized     bool
@@ -107,12 +112,19 @@ func NewAccount(
 		WithFields(logrus.Fields{"coin": accountCoin.String(), "code": config.Config.Code, "name": config.Config.Name})
 	log.Debug("Creating new account")
 
+	client, transactionsSource := accountCoin.client, accountCoin.transactionsSource
+	if accountCoin.makeAccountClient != nil && httpClient != nil {
+		client, transactionsSource = accountCoin.makeAccountClient(httpClient)
+	}
+
 	account := &Account{
 		BaseAccount:          accounts.NewBaseAccount(config, accountCoin, log),
 		coin:                 accountCoin,
 		dbSubfolder:          "", // set in Initialize()
 		signingConfiguration: nil,
 		httpClient:           httpClient,
+		client:               client,
+		transactionsSource:   transactionsSource,
 		balance:              coin.NewAmountFromInt64(0),
 
 		enqueueUpdateCh: make(chan struct{}),
@@ -262,12 +274,12 @@ func (account *Account) updateOutgoingTransactions(tipHeight uint64) {
 	// Update the stored txs' metadata if up to 12 confirmations.
 	for idx, tx := range outgoingTransactions {
 		txLog := account.log.WithField("idx", idx)
-		remoteTx, err := account.coin.client.TransactionReceiptWithBlockNumber(context.TODO(), tx.Transaction.Hash())
+		remoteTx, err := account.client.TransactionReceiptWithBlockNumber(context.TODO(), tx.Transaction.Hash())
 		if remoteTx == nil || err != nil {
 			// Transaction not found. This usually happens for pending transactions.
 			// In this case, check if the node actually knows about the transaction, and if not, re-broadcast.
 			// We do this because it seems that sometimes, a transaction that was broadcast without error still ends up lost.
-			_, _, err := account.coin.client.TransactionByHash(context.TODO(), tx.Transaction.Hash())
+			_, _, err := account.client.TransactionByHash(context.TODO(), tx.Transaction.Hash())
 			if err != nil {
 				tx.BroadcastAttempts++
 				txLog.WithError(err).Errorf("could not fetch transaction - rebroadcasting, attempt %d", tx.BroadcastAttempts)
@@ -275,7 +287,7 @@ func (account *Account) updateOutgoingTransactions(tipHeight uint64) {
 					txLog.WithError(err).Error("could not update outgoing tx")
 					// Do not abort here, we want to attempt broadcastng the tx in any case.
 				}
-				if err := account.coin.client.SendTransaction(context.TODO(), tx.Transaction); err != nil {
+				if err := account.client.SendTransaction(context.TODO(), tx.Transaction); err != nil {
 					txLog.WithError(err).Error("failed to broadcast")
 					continue
 				}
@@ -334,13 +346,13 @@ func (account *Account) update() error {
 	defer account.updateLock.Lock()()
 	defer account.Synchronizer.IncRequestsCounter()()
 
-	blockNumber, err := account.coin.client.BlockNumber(context.TODO())
+	blockNumber, err := account.client.BlockNumber(context.TODO())
 	if err != nil {
 		return errp.WithStack(err)
 	}
 	account.blockNumber = blockNumber
 
-	transactionsSource := account.coin.TransactionsSource()
+	transactionsSource := account.transactionsSource
 
 	go account.updateOutgoingTransactions(account.blockNumber.Uint64())
 
@@ -365,7 +377,7 @@ func (account *Account) update() error {
 
 	// Nonce to be used for the next tx, fetched from the ETH node. It might be out of date due to
 	// latency, which is addressed below by using the locally stored nonce.
-	nodeNonce, err := account.coin.client.PendingNonceAt(context.TODO(), account.address.Address)
+	nodeNonce, err := account.client.PendingNonceAt(context.TODO(), account.address.Address)
 	if err != nil {
 		return err
 	}
@@ -396,12 +408,12 @@ func (account *Account) update() error {
 
 	var balance *big.Int
 	if account.coin.erc20Token != nil {
-		balance, err = account.coin.client.ERC20Balance(account.address.Address, account.coin.erc20Token)
+		balance, err = account.client.ERC20Balance(account.address.Address, account.coin.erc20Token)
 		if err != nil {
 			return errp.WithStack(err)
 		}
 	} else {
-		balance, err = account.coin.client.Balance(context.TODO(), account.address.Address)
+		balance, err = account.client.Balance(context.TODO(), account.address.Address)
 		if err != nil {
 			return errp.WithStack(err)
 		}
@@ -564,7 +576,7 @@ func (account *Account) newTx(args *accounts.TxProposalArgs) (*TxProposal, error
 			}
 		}
 	}
-	gasLimit, err := account.coin.client.EstimateGas(context.TODO(), message)
+	gasLimit, err := account.client.EstimateGas(context.TODO(), message)
 	if err != nil {
 		if strings.Contains(err.Error(), etherscan.ERC20GasErr) {
 			return nil, errp.WithStack(errors.ErrInsufficientFunds)
@@ -643,13 +655,16 @@ func (account *Account) SendTx() error {
 	}
 
 	account.log.Info("Signing and sending transaction")
+	if account.Config().Keystore == nil {
+		return errp.WithStack(errors.ErrKeystoreNotConnected)
+	}
 	if err := account.Config().Keystore.SignTransaction(txProposal); err != nil {
 		return err
 	}
 	// By experience, at least with the Etherscan backend, this can succeed and still the
 	// transaction will be lost (not in any block explorer, the node does not know about it, etc.).
 	// We do an attempt here and more attempts if needed in `updateOutgoingTransactions()`.
-	if err := account.coin.client.SendTransaction(context.TODO(), txProposal.Tx); err != nil {
+	if err := account.client.SendTransaction(context.TODO(), txProposal.Tx); err != nil {
 		return errp.WithStack(err)
 	}
 	if err := account.storePendingOutgoingTransaction(txProposal.Tx); err != nil {
@@ -719,7 +734,7 @@ func (account *Account) feeTargets() []*feeTarget {
 		return ethGasStationTargets
 	}
 	account.log.WithError(err).Error("Could not get fee targets from eth gas station, falling back to RPC eth_gasPrice")
-	suggestedGasPrice, err := account.coin.client.SuggestGasPrice(context.TODO())
+	suggestedGasPrice, err := account.client.SuggestGasPrice(context.TODO())
 	if err != nil {
 		account.log.WithError(err).Error("Fallback to RPC eth_gasPrice failed")
 		return nil
@@ -802,7 +817,7 @@ func (account *Account) VerifyAddress(addressID string) (bool, error) {
 	if !account.isInitialized() {
 		return false, errp.New("account must be initialized")
 	}
-	canVerifyAddress, _, err := account.Config().Keystore.CanVerifyAddress(account.Coin())
+	canVerifyAddress, _, err := account.CanVerifyAddresses()
 	if err != nil {
 		return false, err
 	}
@@ -814,5 +829,8 @@ func (account *Account) VerifyAddress(addressID string) (bool, error) {
 
 // CanVerifyAddresses implements accounts.Interface.
 func (account *Account) CanVerifyAddresses() (bool, bool, error) {
+	if account.Config().Keystore == nil {
+		return false, false, nil
+	}
 	return account.Config().Keystore.CanVerifyAddress(account.Coin())
 }
@@ -0,0 +1,334 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsMocks "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/mocks"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/etherscan"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/etherscan/etherscantest"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testTokenContract = common.HexToAddress("0x00000000000000000000000000000000000e2c20")
+	oneEther          = big.NewInt(params.Ether)
+	recipient         = "0xa29163852021BF4C139D03Dff59ae763AC73e84e"
+)
+
+type etherscanTestEnv struct {
+	chain  *etherscantest.Chain
+	server *etherscantest.Server
+	// privateKey is the key of the accounts created by newAccount().
+	privateKey *ecdsa.PrivateKey
+	xpub       *hdkeychain.ExtendedKey
+}
+
+func newEtherscanTestEnv(t *testing.T) *etherscanTestEnv {
+	t.Helper()
+	chain := etherscantest.NewChain(params.GoerliChainConfig)
+	chain.AddToken(testTokenContract)
+	server := etherscantest.NewServer(chain)
+	t.Cleanup(server.Close)
+
+	xprv, err := hdkeychain.NewMaster(make([]byte, 32), &chaincfg.TestNet3Params)
+	require.NoError(t, err)
+	privateKey, err := xprv.ECPrivKey()
+	require.NoError(t, err)
+	xpub, err := xprv.Neuter()
+	require.NoError(t, err)
+	return &etherscanTestEnv{
+		chain:      chain,
+		server:     server,
+		privateKey: privateKey.ToECDSA(),
+		xpub:       xpub,
+	}
+}
+
+// newAccount creates an account using the Etherscan API served by the test server. If erc20Token
+// is not nil, the account is an account of that token.
+func (env *etherscanTestEnv) newAccount(t *testing.T, erc20Token *erc20.Token) *Account {
+	t.Helper()
+	dbFolder := test.TstTempDir("eth-etherscan-dbfolder")
+	t.Cleanup(func() { _ = os.RemoveAll(dbFolder) })
+
+	keypath, err := signing.NewAbsoluteKeypath("m/44'/1'/0'/0/0")
+	require.NoError(t, err)
+
+	etherScan := etherscan.NewEtherScan(env.server.URL(), &http.Client{})
+	code, unit := coin.CodeGOETH, "GOETH"
+	if erc20Token != nil {
+		code, unit = "goeth-erc20-test", "TEST"
+	}
+	coin := NewCoin(etherScan, code, "Goerli", unit, "GOETH", params.GoerliChainConfig, "", etherScan, erc20Token)
+
+	notifier := &accountsMocks.Notifier{}
+	notifier.On("Put", mock.Anything).Return(nil)
+	keystore := &keystoremock.KeystoreMock{
+		SignTransactionFunc: func(proposedTx interface{}) error {
+			txProposal := proposedTx.(*TxProposal)
+			signedTx, err := types.SignTx(txProposal.Tx, txProposal.Signer, env.privateKey)
+			if err != nil {
+				return err
+			}
+			txProposal.Tx = signedTx
+			return nil
+		},
+	}
+	acct := NewAccount(
+		&accounts.AccountConfig{
+			Config: &config.Account{
+				Code: "accountcode",
+				Name: "accountname",
+				SigningConfigurations: signing.Configurations{
+					signing.NewEthereumConfiguration([]byte{1, 2, 3, 4}, keypath, env.xpub)},
+			},
+			DBFolder:        dbFolder,
+			NotesFolder:     dbFolder,
+			Keystore:        keystore,
+			OnEvent:         func(accountsTypes.Event) {},
+			GetNotifier:     func(signing.Configurations) accounts.Notifier { return notifier },
+			GetSaveFilename: func(suggestedFilename string) string { return suggestedFilename },
+		},
+		coin,
+		&http.Client{},
+		logging.Get().WithGroup("account_etherscan_test"),
+	)
+	require.NoError(t, acct.Initialize())
+	t.Cleanup(acct.Close)
+	acct.Synchronizer.WaitSynchronized()
+	return acct
+}
+
+// requireEventually updates the account until the condition holds.
+func requireEventually(t *testing.T, acct *Account, condition func() bool) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		if err := acct.update(); err != nil {
+			return false
+		}
+		return condition()
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func txByID(acct *Account, txID string) *accounts.TransactionData {
+	txs, err := acct.Transactions()
+	if err != nil {
+		return nil
+	}
+	for _, tx := range txs {
+		if tx.TxID == txID {
+			return tx
+		}
+	}
+	return nil
+}
+
+func txStatus(acct *Account, txID string) accounts.TxStatus {
+	tx := txByID(acct, txID)
+	if tx == nil {
+		return ""
+	}
+	return tx.Status
+}
+
+func balance(acct *Account) *big.Int {
+	balance, err := acct.Balance()
+	if err != nil {
+		return nil
+	}
+	return balance.Available().BigInt()
+}
+
+func gwei(amount int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), big.NewInt(params.GWei))
+}
+
+func fee(gas uint64, gasPrice *big.Int) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(gas), gasPrice)
+}
+
+// send proposes and sends a tx with a gas price of 10 Gwei and returns its hash.
+func send(t *testing.T, env *etherscanTestEnv, acct *Account, amount string) common.Hash {
+	t.Helper()
+	nonce := env.chain.PendingNonce(acct.address.Address)
+	_, _, _, err := acct.TxProposal(&accounts.TxProposalArgs{
+		RecipientAddress: recipient,
+		Amount:           coin.NewSendAmount(amount),
+		FeeTargetCode:    accounts.FeeTargetCodeCustom,
+		CustomFee:        "10",
+	})
+	require.NoError(t, err)
+	require.NoError(t, acct.SendTx())
+	require.Equal(t, nonce+1, env.chain.PendingNonce(acct.address.Address))
+	return acct.activeTxProposal.Tx.Hash()
+}
+
+func TestEtherscanReceive(t *testing.T) {
+	env := newEtherscanTestEnv(t)
+	acct := env.newAccount(t, nil)
+
+	tx := env.chain.Fund(acct.address.Address, oneEther)
+	// Etherscan does not list pending transactions.
+	require.NoError(t, acct.update())
+	require.Nil(t, txByID(acct, tx.Hash().Hex()))
+	require.Equal(t, big.NewInt(0), balance(acct))
+
+	env.chain.Mine(1)
+	requireEventually(t, acct, func() bool {
+		return txStatus(acct, tx.Hash().Hex()) == accounts.TxStatusPending
+	})
+	received := txByID(acct, tx.Hash().Hex())
+	require.Equal(t, accounts.TxTypeReceive, received.Type)
+	require.Equal(t, 1, received.NumConfirmations)
+	require.Equal(t, int(env.chain.BlockNumber()), received.Height)
+	require.Equal(t, oneEther, received.Amount.BigInt())
+	require.Equal(t, oneEther, balance(acct))
+
+	env.chain.Mine(11)
+	requireEventually(t, acct, func() bool {
+		return txStatus(acct, tx.Hash().Hex()) == accounts.TxStatusComplete
+	})
+}
+
+func TestEtherscanSend(t *testing.T) {
+	env := newEtherscanTestEnv(t)
+	acct := env.newAccount(t, nil)
+	env.chain.Fund(acct.address.Address, oneEther)
+	env.chain.Mine(1)
+	requireEventually(t, acct, func() bool { return balance(acct).Cmp(oneEther) == 0 })
+
+	txHash := send(t, env, acct, "0.1")
+	expectedBalance := new(big.Int).Sub(oneEther, big.NewInt(params.Ether/10))
+	expectedBalance.Sub(expectedBalance, fee(etherscantest.GasTransfer, gwei(10)))
+
+	// The pending outgoing tx is stored locally and deducted from the balance.
+	requireEventually(t, acct, func() bool {
+		return txStatus(acct, txHash.Hex()) == accounts.TxStatusPending
+	})
+	require.Equal(t, expectedBalance, balance(acct))
+	require.Equal(t, 0, txByID(acct, txHash.Hex()).Height)
+
+	// A tx lost by the node is broadcast again.
+	env.chain.Drop(txHash)
+	require.Equal(t, uint64(0), env.chain.PendingNonce(acct.address.Address))
+	requireEventually(t, acct, func() bool {
+		return env.chain.PendingNonce(acct.address.Address) == 1
+	})
+
+	env.chain.Mine(1)
+	requireEventually(t, acct, func() bool {
+		tx := txByID(acct, txHash.Hex())
+		return tx != nil && tx.NumConfirmations == 1
+	})
+	require.Equal(t, expectedBalance, balance(acct))
+	require.Equal(t, expectedBalance, env.chain.Balance(acct.address.Address))
+
+	env.chain.Mine(11)
+	requireEventually(t, acct, func() bool {
+		return txStatus(acct, txHash.Hex()) == accounts.TxStatusComplete
+	})
+	require.Equal(t, expectedBalance, balance(acct))
+}
+
+func TestEtherscanSendFailed(t *testing.T) {
+	env := newEtherscanTestEnv(t)
+	acct := env.newAccount(t, nil)
+	env.chain.Fund(acct.address.Address, oneEther)
+	env.chain.Mine(1)
+	requireEventually(t, acct, func() bool { return balance(acct).Cmp(oneEther) == 0 })
+
+	txHash := send(t, env, acct, "0.1")
+	env.chain.FailOnMine(txHash)
+	env.chain.Mine(1)
+
+	requireEventually(t, acct, func() bool {
+		return txStatus(acct, txHash.Hex()) == accounts.TxStatusFailed
+	})
+	// Only the fee was paid.
+	expectedBalance := new(big.Int).Sub(oneEther, fee(etherscantest.GasTransfer, gwei(10)))
+	require.Equal(t, expectedBalance, balance(acct))
+}
+
+func TestEtherscanERC20(t *testing.T) {
+	env := newEtherscanTestEnv(t)
+	token := erc20.NewToken(testTokenContract.Hex(), 6)
+	acct := env.newAccount(t, token)
+
+	received := env.chain.FundToken(testTokenContract, acct.address.Address, big.NewInt(1000e6))
+	// Ether to pay the fees.
+	env.chain.Fund(acct.address.Address, oneEther)
+	env.chain.Mine(1)
+	requireEventually(t, acct, func() bool {
+		return txStatus(acct, received.Hash().Hex()) == accounts.TxStatusPending
+	})
+	receivedData := txByID(acct, received.Hash().Hex())
+	require.Equal(t, accounts.TxTypeReceive, receivedData.Type)
+	require.True(t, receivedData.IsErc20)
+	require.Equal(t, big.NewInt(1000e6), receivedData.Amount.BigInt())
+	require.Equal(t, big.NewInt(1000e6), balance(acct))
+
+	// Spending more than the token balance is caught by the gas estimation.
+	_, _, _, err := acct.TxProposal(&accounts.TxProposalArgs{
+		RecipientAddress: recipient,
+		Amount:           coin.NewSendAmount("2000"),
+		FeeTargetCode:    accounts.FeeTargetCodeCustom,
+		CustomFee:        "10",
+	})
+	require.Error(t, err)
+
+	sent := send(t, env, acct, "100")
+	requireEventually(t, acct, func() bool { return balance(acct).Cmp(big.NewInt(900e6)) == 0 })
+	env.chain.Mine(1)
+	requireEventually(t, acct, func() bool {
+		tx := txByID(acct, sent.Hex())
+		return tx != nil && tx.NumConfirmations == 1
+	})
+	require.Equal(t, big.NewInt(900e6), env.chain.TokenBalance(testTokenContract, acct.address.Address))
+	require.Equal(t, big.NewInt(100e6), env.chain.TokenBalance(testTokenContract, common.HexToAddress(recipient)))
+
+	// A failed token transfer is not listed by Etherscan's tokentx, so its status comes from the
+	// receipt of the locally stored outgoing tx.
+	failed := send(t, env, acct, "100")
+	env.chain.FailOnMine(failed)
+	env.chain.Mine(1)
+	requireEventually(t, acct, func() bool {
+		return txStatus(acct, failed.Hex()) == accounts.TxStatusFailed
+	})
+	failedData := txByID(acct, failed.Hex())
+	require.Equal(t, int(env.chain.BlockNumber()), failedData.Height)
+	require.Equal(t, big.NewInt(900e6), balance(acct))
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
 	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
@@ -158,3 +159,25 @@ func TestTxProposal(t *testing.T) {
 		require.Equal(t, errors.ErrInvalidAddress, errp.Cause(err))
 	})
 }
+
+func TestAccountClient(t *testing.T) {
+	coinClient := &mocks.InterfaceMock{}
+	ethCoin := NewCoin(coinClient, coin.CodeGOETH, "Goerli", "GOETH", "GOETH", params.GoerliChainConfig, "", nil, nil)
+	accountConfig := &accounts.AccountConfig{
+		Config: &config.Account{Code: "accountcode", Name: "accountname"},
+	}
+	log := logging.Get().WithGroup("account_test")
+
+	acct := NewAccount(accountConfig, ethCoin, &http.Client{}, log)
+	require.Same(t, coinClient, acct.client)
+
+	accountClient := &mocks.InterfaceMock{}
+	httpClient := &http.Client{}
+	ethCoin.SetMakeAccountClient(func(client *http.Client) (rpcclient.Interface, TransactionsSource) {
+		require.Same(t, httpClient, client)
+		return accountClient, nil
+	})
+	acct = NewAccount(accountConfig, ethCoin, httpClient, log)
+	require.Same(t, accountClient, acct.client)
+	require.Nil(t, acct.transactionsSource)
+}
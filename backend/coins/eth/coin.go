@@ -17,6 +17,7 @@ package eth
 
 import (
 	"math/big"
+	"net/http"
 	"strings"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
@@ -55,6 +56,10 @@ type Coin struct {
 
 	transactionsSource TransactionsSource
 
+	// makeAccountClient, if set, creates the client and transactions source of an account using
+	// the account's HTTP client. See SetMakeAccountClient().
+	makeAccountClient func(*http.Client) (rpcclient.Interface, TransactionsSource)
+
 	log *logrus.Entry
 }
 
@@ -94,11 +99,22 @@ func NewCoin(
 // TstSetClient must only be used in unit tests to mock the RPC client.
 func (coin *Coin) TstSetClient(client rpcclient.Interface) {
 	coin.client = client
+	coin.makeAccountClient = nil
 }
 
 // TstSetTransactionsSource must only be used in unit tests to mock the transactions source.
 func (coin *Coin) TstSetTransactionsSource(ts TransactionsSource) {
 	coin.transactionsSource = ts
+	coin.makeAccountClient = nil
+}
+
+// SetMakeAccountClient sets the function used to create the client and transactions source of each
+// account from the account's HTTP client, so that the requests of different accounts are not made
+// over the same connection. If not set, accounts use the client and transactions source of the
+// coin.
+func (coin *Coin) SetMakeAccountClient(
+	makeAccountClient func(*http.Client) (rpcclient.Interface, TransactionsSource)) {
+	coin.makeAccountClient = makeAccountClient
 }
 
 // Net returns the network (mainnet, testnet, etc.).
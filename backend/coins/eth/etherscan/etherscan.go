@@ -393,6 +393,11 @@ func (etherScan *EtherScan) TransactionReceiptWithBlockNumber(
 	if err := etherScan.rpcCall(params, &result); err != nil {
 		return nil, err
 	}
+	// The embedded receipt's UnmarshalJSON is promoted, so it decodes the block number into the
+	// shadowed `Receipt.BlockNumber` field.
+	if result != nil && result.Receipt.BlockNumber != nil {
+		result.BlockNumber = result.Receipt.BlockNumber.Uint64()
+	}
 	return result, nil
 }
 
@@ -0,0 +1,429 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package etherscantest provides a scripted Ethereum chain and a local HTTP server serving it
+// through the subset of the Etherscan API used by `etherscan.EtherScan`. It is used to test
+// Ethereum accounts end to end.
+package etherscantest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/etherscan"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	// GasTransfer is the gas used by a plain ether transfer.
+	GasTransfer = 21000
+	// GasTokenTransfer is the gas used by an ERC20 transfer.
+	GasTokenTransfer = 50000
+
+	blockInterval = 12 * time.Second
+)
+
+var (
+	// erc20TransferSelector is the method selector of `transfer(address,uint256)`.
+	erc20TransferSelector = []byte{0xa9, 0x05, 0x9c, 0xbb}
+	// erc20BalanceOfSelector is the method selector of `balanceOf(address)`.
+	erc20BalanceOfSelector = []byte{0x70, 0xa0, 0x82, 0x31}
+
+	genesisTime = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// tokenTransfer is a decoded ERC20 `transfer(address,uint256)` call.
+type tokenTransfer struct {
+	recipient common.Address
+	amount    *big.Int
+}
+
+func decodeTokenTransfer(data []byte) (*tokenTransfer, bool) {
+	if len(data) != 4+32+32 || !bytes.Equal(data[:4], erc20TransferSelector) {
+		return nil, false
+	}
+	return &tokenTransfer{
+		recipient: common.BytesToAddress(data[4 : 4+32]),
+		amount:    new(big.Int).SetBytes(data[4+32:]),
+	}, true
+}
+
+// transaction is a transaction known to the chain.
+type transaction struct {
+	tx   *types.Transaction
+	from common.Address
+	// blockNumber is 0 while the transaction is pending.
+	blockNumber uint64
+	timestamp   time.Time
+	gasUsed     uint64
+	success     bool
+	// failOnMine makes the transaction fail (revert) when it is mined.
+	failOnMine bool
+	// tokenTransfer is set if the transaction calls `transfer()` on a known token contract.
+	tokenTransfer *tokenTransfer
+}
+
+// Chain is a scripted Ethereum chain. Transactions are added to the mempool by Broadcast(), Fund()
+// and FundToken(), and included in blocks by Mine(). Ether and ERC20 token balances are tracked for
+// all addresses. A faucet address with unlimited funds is used to fund addresses. It is safe for
+// concurrent use.
+type Chain struct {
+	net    *params.ChainConfig
+	signer types.Signer
+
+	faucetKey     *ecdsa.PrivateKey
+	faucetAddress common.Address
+
+	mu           sync.RWMutex
+	blockNumber  uint64
+	gasPrice     *big.Int
+	balances     map[common.Address]*big.Int
+	nonces       map[common.Address]uint64
+	tokens       map[common.Address]map[common.Address]*big.Int
+	transactions []*transaction
+	byHash       map[common.Hash]*transaction
+}
+
+// NewChain creates a new chain with the given chain config, starting at block number 1.
+func NewChain(net *params.ChainConfig) *Chain {
+	faucetKey, err := crypto.ToECDSA(crypto.Keccak256([]byte("etherscantest faucet")))
+	if err != nil {
+		panic(err)
+	}
+	return &Chain{
+		net:           net,
+		signer:        types.LatestSignerForChainID(net.ChainID),
+		faucetKey:     faucetKey,
+		faucetAddress: crypto.PubkeyToAddress(faucetKey.PublicKey),
+		blockNumber:   1,
+		gasPrice:      big.NewInt(params.GWei),
+		balances:      map[common.Address]*big.Int{},
+		nonces:        map[common.Address]uint64{},
+		tokens:        map[common.Address]map[common.Address]*big.Int{},
+		byHash:        map[common.Hash]*transaction{},
+	}
+}
+
+// FaucetAddress returns the address funding transactions are sent from.
+func (chain *Chain) FaucetAddress() common.Address {
+	return chain.faucetAddress
+}
+
+// AddToken registers an ERC20 token contract. Calls to `transfer()` on it are executed by the chain.
+func (chain *Chain) AddToken(contractAddress common.Address) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	if _, ok := chain.tokens[contractAddress]; !ok {
+		chain.tokens[contractAddress] = map[common.Address]*big.Int{}
+	}
+}
+
+// SetGasPrice sets the gas price returned by eth_gasPrice.
+func (chain *Chain) SetGasPrice(gasPrice *big.Int) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	chain.gasPrice = new(big.Int).Set(gasPrice)
+}
+
+// GasPrice returns the gas price returned by eth_gasPrice.
+func (chain *Chain) GasPrice() *big.Int {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return new(big.Int).Set(chain.gasPrice)
+}
+
+// BlockNumber returns the number of the latest block.
+func (chain *Chain) BlockNumber() uint64 {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return chain.blockNumber
+}
+
+func (chain *Chain) blockTime(blockNumber uint64) time.Time {
+	return genesisTime.Add(time.Duration(blockNumber) * blockInterval)
+}
+
+// Balance returns the ether balance of the address as of the latest block.
+func (chain *Chain) Balance(address common.Address) *big.Int {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return chain.balance(address)
+}
+
+func (chain *Chain) balance(address common.Address) *big.Int {
+	if balance, ok := chain.balances[address]; ok {
+		return new(big.Int).Set(balance)
+	}
+	return big.NewInt(0)
+}
+
+// TokenBalance returns the token balance of the address as of the latest block.
+func (chain *Chain) TokenBalance(contractAddress, address common.Address) *big.Int {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return chain.tokenBalance(contractAddress, address)
+}
+
+func (chain *Chain) tokenBalance(contractAddress, address common.Address) *big.Int {
+	if balance, ok := chain.tokens[contractAddress][address]; ok {
+		return new(big.Int).Set(balance)
+	}
+	return big.NewInt(0)
+}
+
+// PendingNonce returns the nonce to be used by the next transaction of the address, taking into
+// account the pending transactions.
+func (chain *Chain) PendingNonce(address common.Address) uint64 {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return chain.pendingNonce(address)
+}
+
+func (chain *Chain) pendingNonce(address common.Address) uint64 {
+	nonce := chain.nonces[address]
+	for _, tx := range chain.transactions {
+		if tx.blockNumber == 0 && tx.from == address {
+			nonce++
+		}
+	}
+	return nonce
+}
+
+// pendingSpent returns the maximum amount of ether the pending transactions of the address spend,
+// including fees.
+func (chain *Chain) pendingSpent(address common.Address) *big.Int {
+	spent := big.NewInt(0)
+	for _, tx := range chain.transactions {
+		if tx.blockNumber == 0 && tx.from == address {
+			spent.Add(spent, tx.tx.Cost())
+		}
+	}
+	return spent
+}
+
+func (chain *Chain) gasUsed(tx *types.Transaction) uint64 {
+	if tx.To() != nil {
+		if _, ok := chain.tokens[*tx.To()]; ok {
+			return GasTokenTransfer
+		}
+	}
+	return GasTransfer
+}
+
+// EstimateGas estimates the gas used by a call. It fails like a node would if a token transfer
+// exceeds the token balance of the sender.
+func (chain *Chain) EstimateGas(from common.Address, to common.Address, data []byte) (uint64, error) {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	if _, ok := chain.tokens[to]; !ok {
+		if len(data) != 0 {
+			return 0, errp.New("execution reverted")
+		}
+		return GasTransfer, nil
+	}
+	transfer, ok := decodeTokenTransfer(data)
+	if !ok {
+		return 0, errp.New("execution reverted")
+	}
+	if transfer.amount.Cmp(chain.tokenBalance(to, from)) > 0 {
+		return 0, errp.New(etherscan.ERC20GasErr)
+	}
+	return GasTokenTransfer, nil
+}
+
+// Call executes a read-only contract call. Only `balanceOf(address)` on known tokens is supported.
+func (chain *Chain) Call(to common.Address, data []byte) ([]byte, error) {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	if _, ok := chain.tokens[to]; !ok {
+		return []byte{}, nil
+	}
+	if len(data) != 4+32 || !bytes.Equal(data[:4], erc20BalanceOfSelector) {
+		return nil, errp.New("execution reverted")
+	}
+	balance := chain.tokenBalance(to, common.BytesToAddress(data[4:]))
+	return common.LeftPadBytes(balance.Bytes(), 32), nil
+}
+
+// Broadcast validates a signed transaction and adds it to the mempool.
+func (chain *Chain) Broadcast(tx *types.Transaction) error {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	return chain.broadcast(tx)
+}
+
+func (chain *Chain) broadcast(tx *types.Transaction) error {
+	if tx.ChainId().Cmp(chain.net.ChainID) != 0 {
+		return errp.New("invalid chain id for signer")
+	}
+	from, err := types.Sender(chain.signer, tx)
+	if err != nil {
+		return errp.New("invalid sender")
+	}
+	if _, ok := chain.byHash[tx.Hash()]; ok {
+		return errp.New("already known")
+	}
+	if tx.To() == nil {
+		return errp.New("contract creation is not supported")
+	}
+	if nonce := chain.pendingNonce(from); tx.Nonce() != nonce {
+		if tx.Nonce() < nonce {
+			return errp.New("nonce too low")
+		}
+		return errp.New("nonce too high")
+	}
+	if tx.Gas() < chain.gasUsed(tx) {
+		return errp.New("intrinsic gas too low")
+	}
+	if from != chain.faucetAddress {
+		available := new(big.Int).Sub(chain.balance(from), chain.pendingSpent(from))
+		if tx.Cost().Cmp(available) > 0 {
+			return errp.New(etherscan.ERC20GasErr)
+		}
+	}
+	record := &transaction{tx: tx, from: from}
+	if _, ok := chain.tokens[*tx.To()]; ok {
+		if transfer, ok := decodeTokenTransfer(tx.Data()); ok {
+			record.tokenTransfer = transfer
+		}
+	}
+	chain.transactions = append(chain.transactions, record)
+	chain.byHash[tx.Hash()] = record
+	return nil
+}
+
+func (chain *Chain) fromFaucet(to common.Address, value *big.Int, data []byte) *types.Transaction {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	unsigned := types.NewTransaction(
+		chain.pendingNonce(chain.faucetAddress), to, value, GasTokenTransfer, chain.gasPrice, data)
+	tx, err := types.SignTx(unsigned, chain.signer, chain.faucetKey)
+	if err != nil {
+		panic(err)
+	}
+	if err := chain.broadcast(tx); err != nil {
+		panic(err)
+	}
+	return tx
+}
+
+// Fund broadcasts a transaction sending `value` wei from the faucet to the address.
+func (chain *Chain) Fund(to common.Address, value *big.Int) *types.Transaction {
+	return chain.fromFaucet(to, value, nil)
+}
+
+// FundToken broadcasts a transaction transferring `amount` tokens from the faucet to the address.
+// The faucet is credited the amount first, so the transfer succeeds when mined.
+func (chain *Chain) FundToken(contractAddress, to common.Address, amount *big.Int) *types.Transaction {
+	chain.mu.Lock()
+	if _, ok := chain.tokens[contractAddress]; !ok {
+		chain.mu.Unlock()
+		panic("unknown token")
+	}
+	faucetBalance := chain.tokenBalance(contractAddress, chain.faucetAddress)
+	chain.tokens[contractAddress][chain.faucetAddress] = faucetBalance.Add(faucetBalance, amount)
+	chain.mu.Unlock()
+
+	data := append([]byte{}, erc20TransferSelector...)
+	data = append(data, common.LeftPadBytes(to.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
+	return chain.fromFaucet(contractAddress, big.NewInt(0), data)
+}
+
+// FailOnMine makes the pending transaction fail when it is mined, e.g. to simulate a reverted
+// contract call or an out-of-gas execution. The fee is still paid.
+func (chain *Chain) FailOnMine(txHash common.Hash) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	if tx, ok := chain.byHash[txHash]; ok && tx.blockNumber == 0 {
+		tx.failOnMine = true
+	}
+}
+
+// Drop removes a pending transaction from the mempool, simulating a broadcast transaction that
+// got lost. The node does not know the transaction anymore, so it can be broadcast again.
+func (chain *Chain) Drop(txHash common.Hash) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	tx, ok := chain.byHash[txHash]
+	if !ok || tx.blockNumber != 0 {
+		return
+	}
+	delete(chain.byHash, txHash)
+	transactions := []*transaction{}
+	for _, tx := range chain.transactions {
+		if tx.tx.Hash() != txHash {
+			transactions = append(transactions, tx)
+		}
+	}
+	chain.transactions = transactions
+}
+
+func (chain *Chain) credit(address common.Address, amount *big.Int) {
+	chain.balances[address] = new(big.Int).Add(chain.balance(address), amount)
+}
+
+func (chain *Chain) debit(address common.Address, amount *big.Int) {
+	if address == chain.faucetAddress {
+		return
+	}
+	chain.balances[address] = new(big.Int).Sub(chain.balance(address), amount)
+}
+
+// execute applies a pending transaction to the state.
+func (chain *Chain) execute(tx *transaction) {
+	tx.blockNumber = chain.blockNumber
+	tx.timestamp = chain.blockTime(chain.blockNumber)
+	tx.gasUsed = chain.gasUsed(tx.tx)
+	chain.nonces[tx.from]++
+	chain.debit(tx.from, new(big.Int).Mul(new(big.Int).SetUint64(tx.gasUsed), tx.tx.GasPrice()))
+
+	tx.success = !tx.failOnMine
+	if transfer := tx.tokenTransfer; transfer != nil && tx.success {
+		contract := *tx.tx.To()
+		senderBalance := chain.tokenBalance(contract, tx.from)
+		if senderBalance.Cmp(transfer.amount) < 0 {
+			tx.success = false
+		} else {
+			chain.tokens[contract][tx.from] = senderBalance.Sub(senderBalance, transfer.amount)
+			recipientBalance := chain.tokenBalance(contract, transfer.recipient)
+			chain.tokens[contract][transfer.recipient] = recipientBalance.Add(recipientBalance, transfer.amount)
+		}
+	}
+	if tx.success && tx.tx.Value().Sign() > 0 {
+		chain.debit(tx.from, tx.tx.Value())
+		chain.credit(*tx.tx.To(), tx.tx.Value())
+	}
+}
+
+// Mine mines `count` blocks. The first block contains all pending transactions.
+func (chain *Chain) Mine(count int) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	for i := 0; i < count; i++ {
+		chain.blockNumber++
+		for _, tx := range chain.transactions {
+			if tx.blockNumber == 0 {
+				chain.execute(tx)
+			}
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etherscantest
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Server serves a Chain through the Etherscan API on a local HTTP server. Only the endpoints used
+// by `etherscan.EtherScan` are implemented.
+type Server struct {
+	chain  *Chain
+	server *httptest.Server
+}
+
+// NewServer starts serving the chain. Call Close() to stop the server.
+func NewServer(chain *Chain) *Server {
+	server := &Server{chain: chain}
+	server.server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+// URL returns the API endpoint to be passed to `etherscan.NewEtherScan()`.
+func (server *Server) URL() string {
+	return server.server.URL + "/api"
+}
+
+// Close stops the server.
+func (server *Server) Close() {
+	server.server.Close()
+}
+
+type accountResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Result  interface{} `json:"result"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type proxyResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *rpcError   `json:"error,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+func (server *Server) handle(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	switch params.Get("module") {
+	case "account":
+		result, err := server.handleAccount(params)
+		if err != nil {
+			writeJSON(w, &accountResponse{Status: "0", Message: "NOTOK", Result: "Error! " + err.Error()})
+			return
+		}
+		if list, ok := result.([]map[string]string); ok && len(list) == 0 {
+			writeJSON(w, &accountResponse{Status: "0", Message: "No transactions found", Result: list})
+			return
+		}
+		writeJSON(w, &accountResponse{Status: "1", Message: "OK", Result: result})
+	case "proxy":
+		result, err := server.handleProxy(params)
+		if err != nil {
+			writeJSON(w, &proxyResponse{
+				JSONRPC: "2.0", ID: 1, Error: &rpcError{Code: -32000, Message: err.Error()}})
+			return
+		}
+		if result == nil {
+			result = json.RawMessage("null")
+		}
+		writeJSON(w, &proxyResponse{JSONRPC: "2.0", ID: 1, Result: result})
+	default:
+		http.Error(w, "unknown module", http.StatusBadRequest)
+	}
+}
+
+func parseAddress(params url.Values, key string) (common.Address, error) {
+	value := params.Get(key)
+	if !common.IsHexAddress(value) {
+		return common.Address{}, errp.Newf("invalid %s", key)
+	}
+	return common.HexToAddress(value), nil
+}
+
+func (server *Server) handleAccount(params url.Values) (interface{}, error) {
+	address, err := parseAddress(params, "address")
+	if err != nil {
+		return nil, err
+	}
+	switch action := params.Get("action"); action {
+	case "balance":
+		return server.chain.Balance(address).String(), nil
+	case "tokenbalance":
+		contractAddress, err := parseAddress(params, "contractaddress")
+		if err != nil {
+			return nil, err
+		}
+		return server.chain.TokenBalance(contractAddress, address).String(), nil
+	case "txlist", "tokentx":
+		endBlock, err := strconv.ParseUint(params.Get("endblock"), 10, 64)
+		if err != nil {
+			return nil, errp.New("invalid endblock")
+		}
+		var contractAddress *common.Address
+		if action == "tokentx" {
+			parsed, err := parseAddress(params, "contractaddress")
+			if err != nil {
+				return nil, err
+			}
+			contractAddress = &parsed
+		}
+		return server.chain.txList(address, contractAddress, endBlock), nil
+	case "txlistinternal":
+		// Internal transactions are not simulated.
+		return []map[string]string{}, nil
+	default:
+		return nil, errp.Newf("unknown action %s", action)
+	}
+}
+
+// txList returns the mined transactions of the address in the Etherscan format, ordered by
+// descending block number. If contractAddress is not nil, the successful token transfers of that
+// token are returned instead, like the `tokentx` action does.
+func (chain *Chain) txList(address common.Address, contractAddress *common.Address, endBlock uint64) []map[string]string {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	result := []map[string]string{}
+	for _, tx := range chain.transactions {
+		if tx.blockNumber == 0 || tx.blockNumber > endBlock {
+			continue
+		}
+		to := *tx.tx.To()
+		value := tx.tx.Value()
+		isError := "0"
+		if !tx.success {
+			isError = "1"
+		}
+		if contractAddress != nil {
+			if to != *contractAddress || tx.tokenTransfer == nil || !tx.success {
+				continue
+			}
+			to = tx.tokenTransfer.recipient
+			value = tx.tokenTransfer.amount
+		}
+		if tx.from != address && to != address {
+			continue
+		}
+		entry := map[string]string{
+			"blockNumber":     strconv.FormatUint(tx.blockNumber, 10),
+			"timeStamp":       strconv.FormatInt(tx.timestamp.Unix(), 10),
+			"hash":            tx.tx.Hash().Hex(),
+			"nonce":           strconv.FormatUint(tx.tx.Nonce(), 10),
+			"from":            tx.from.Hex(),
+			"to":              to.Hex(),
+			"value":           value.String(),
+			"gas":             strconv.FormatUint(tx.tx.Gas(), 10),
+			"gasPrice":        tx.tx.GasPrice().String(),
+			"gasUsed":         strconv.FormatUint(tx.gasUsed, 10),
+			"input":           hexutil.Encode(tx.tx.Data()),
+			"contractAddress": "",
+			"confirmations":   strconv.FormatUint(chain.blockNumber-tx.blockNumber+1, 10),
+		}
+		if contractAddress != nil {
+			entry["contractAddress"] = contractAddress.Hex()
+		} else {
+			entry["isError"] = isError
+			entry["txreceipt_status"] = map[bool]string{true: "1", false: "0"}[tx.success]
+		}
+		result = append(result, entry)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		heightI, _ := strconv.ParseUint(result[i]["blockNumber"], 10, 64)
+		heightJ, _ := strconv.ParseUint(result[j]["blockNumber"], 10, 64)
+		return heightI > heightJ
+	})
+	return result
+}
+
+func (server *Server) handleProxy(params url.Values) (interface{}, error) {
+	chain := server.chain
+	switch action := params.Get("action"); action {
+	case "eth_getBlockByNumber":
+		if params.Get("tag") != "latest" {
+			return nil, errp.New("only the latest block is supported")
+		}
+		return chain.latestHeader(), nil
+	case "eth_getTransactionReceipt":
+		return chain.receipt(common.HexToHash(params.Get("txhash"))), nil
+	case "eth_getTransactionByHash":
+		return chain.transactionByHash(common.HexToHash(params.Get("txhash")))
+	case "eth_getTransactionCount":
+		address, err := parseAddress(params, "address")
+		if err != nil {
+			return nil, err
+		}
+		return hexutil.Uint64(chain.PendingNonce(address)), nil
+	case "eth_gasPrice":
+		return (*hexutil.Big)(chain.GasPrice()), nil
+	case "eth_estimateGas", "eth_call":
+		from, err := parseAddress(params, "from")
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseAddress(params, "to")
+		if err != nil {
+			return nil, err
+		}
+		var data []byte
+		if params.Get("data") != "" {
+			data, err = hexutil.Decode(params.Get("data"))
+			if err != nil {
+				return nil, errp.WithStack(err)
+			}
+		}
+		if action == "eth_call" {
+			result, err := chain.Call(to, data)
+			if err != nil {
+				return nil, err
+			}
+			return hexutil.Bytes(result), nil
+		}
+		gas, err := chain.EstimateGas(from, to, data)
+		if err != nil {
+			return nil, err
+		}
+		return hexutil.Uint64(gas), nil
+	case "eth_sendRawTransaction":
+		rawTx, err := hexutil.Decode(params.Get("hex"))
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(rawTx); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if err := chain.Broadcast(tx); err != nil {
+			return nil, err
+		}
+		return tx.Hash().Hex(), nil
+	default:
+		return nil, errp.Newf("unknown action %s", action)
+	}
+}
+
+func (chain *Chain) latestHeader() *types.Header {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(chain.blockNumber),
+		Time:       uint64(chain.blockTime(chain.blockNumber).Unix()),
+		Difficulty: big.NewInt(0),
+		GasLimit:   30000000,
+	}
+}
+
+// receipt returns the receipt of a mined transaction, or nil if the transaction is unknown or
+// pending.
+func (chain *Chain) receipt(txHash common.Hash) *types.Receipt {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	tx, ok := chain.byHash[txHash]
+	if !ok || tx.blockNumber == 0 {
+		return nil
+	}
+	status := types.ReceiptStatusFailed
+	if tx.success {
+		status = types.ReceiptStatusSuccessful
+	}
+	return &types.Receipt{
+		Type:              tx.tx.Type(),
+		Status:            status,
+		CumulativeGasUsed: tx.gasUsed,
+		Logs:              []*types.Log{},
+		TxHash:            txHash,
+		GasUsed:           tx.gasUsed,
+		BlockNumber:       new(big.Int).SetUint64(tx.blockNumber),
+	}
+}
+
+// transactionByHash returns the transaction in the JSON-RPC format, or nil if it is unknown.
+func (chain *Chain) transactionByHash(txHash common.Hash) (interface{}, error) {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	tx, ok := chain.byHash[txHash]
+	if !ok {
+		return nil, nil
+	}
+	txJSON, err := tx.tx.MarshalJSON()
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(txJSON, &result); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	result["from"] = tx.from.Hex()
+	result["blockNumber"] = nil
+	if tx.blockNumber != 0 {
+		result["blockNumber"] = hexutil.Uint64(tx.blockNumber).String()
+	}
+	return result, nil
+}
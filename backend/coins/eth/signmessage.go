@@ -0,0 +1,169 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	accountErrors "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// MessageFormat is the format of a signed message.
+type MessageFormat string
+
+const (
+	// MessageFormatEIP191 is a message signed like with `personal_sign`.
+	MessageFormatEIP191 MessageFormat = "eip191"
+	// MessageFormatEIP712 is EIP-712 typed data signed like with `eth_signTypedData_v4`. The
+	// message is the typed data JSON.
+	MessageFormatEIP712 MessageFormat = "eip712"
+)
+
+// ErrInvalidMessageSignature is returned if a message signature does not match the address and
+// message.
+var ErrInvalidMessageSignature = errors.New("invalidSignature")
+
+// SignedMessage is a message signed by the address of the account.
+type SignedMessage struct {
+	Address string        `json:"address"`
+	Message string        `json:"message"`
+	Format  MessageFormat `json:"format"`
+	// Signature is the hex encoded 65 byte signature R, S and V, with V being 27 or 28.
+	Signature string `json:"signature"`
+}
+
+// ParseTypedData parses EIP-712 typed data JSON. Unlike apitypes.TypedData, it also accepts the
+// domain chain ID as a JSON number, as sent by most dapps.
+func ParseTypedData(data []byte) (*apitypes.TypedData, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if domain, ok := raw["domain"].(map[string]interface{}); ok {
+		if chainID, ok := domain["chainId"].(json.Number); ok {
+			domain["chainId"] = chainID.String()
+		}
+	}
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	var typedData apitypes.TypedData
+	if err := json.Unmarshal(normalized, &typedData); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return &typedData, nil
+}
+
+// messageHash returns the hash signed for the message in the given format.
+func messageHash(msg []byte, format MessageFormat) ([]byte, error) {
+	switch format {
+	case MessageFormatEIP191:
+		return accounts.TextHash(msg), nil
+	case MessageFormatEIP712:
+		typedData, err := ParseTypedData(msg)
+		if err != nil {
+			return nil, err
+		}
+		hash, _, err := apitypes.TypedDataAndHash(*typedData)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		return hash, nil
+	default:
+		return nil, errp.Newf("unknown message signature format: %s", format)
+	}
+}
+
+// SignMessage signs the message with the private key of the account address.
+func (account *Account) SignMessage(msg string, format MessageFormat) (*SignedMessage, error) {
+	if !account.isInitialized() {
+		return nil, errp.New("account must be initialized")
+	}
+	keystore := account.Config().Keystore
+	if keystore == nil {
+		return nil, errp.WithStack(accountErrors.ErrKeystoreNotConnected)
+	}
+	var signature []byte
+	var err error
+	switch format {
+	case MessageFormatEIP191:
+		if !keystore.CanSignMessage(account.coin.Code()) {
+			return nil, errp.New("the keystore does not support signing messages")
+		}
+		signature, err = keystore.SignETHMessage([]byte(msg), account.address.AbsoluteKeypath())
+	case MessageFormatEIP712:
+		signature, err = keystore.SignETHTypedMessage(
+			account.coin.ChainID(), []byte(msg), account.address.AbsoluteKeypath())
+	default:
+		return nil, errp.Newf("unknown message signature format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signedMessage := &SignedMessage{
+		Address:   account.address.EncodeForHumans(),
+		Message:   msg,
+		Format:    format,
+		Signature: hexutil.Encode(signature),
+	}
+	// Sanity check, e.g. that the keystore signed with the key of the address.
+	if err := VerifyMessage(
+		signedMessage.Address, []byte(msg), signedMessage.Signature, format); err != nil {
+		return nil, err
+	}
+	return signedMessage, nil
+}
+
+// VerifyMessage verifies the hex encoded signature of the message by the address. V can be 0/1
+// or 27/28.
+func VerifyMessage(address string, msg []byte, signature string, format MessageFormat) error {
+	if !common.IsHexAddress(address) {
+		return errp.Newf("invalid address: %s", address)
+	}
+	hash, err := messageHash(msg, format)
+	if err != nil {
+		return err
+	}
+	sig, err := hexutil.Decode(signature)
+	if err != nil && !strings.HasPrefix(signature, "0x") {
+		sig, err = hexutil.Decode("0x" + signature)
+	}
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return errp.WithStack(ErrInvalidMessageSignature)
+	}
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pubkey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return errp.WithStack(ErrInvalidMessageSignature)
+	}
+	if crypto.PubkeyToAddress(*pubkey) != common.HexToAddress(address) {
+		return errp.WithStack(ErrInvalidMessageSignature)
+	}
+	return nil
+}
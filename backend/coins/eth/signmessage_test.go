@@ -0,0 +1,94 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// eip712Mail is the example typed data of EIP-712.
+const eip712Mail = `{
+  "types": {
+    "EIP712Domain": [
+      {"name": "name", "type": "string"},
+      {"name": "version", "type": "string"},
+      {"name": "chainId", "type": "uint256"},
+      {"name": "verifyingContract", "type": "address"}
+    ],
+    "Person": [
+      {"name": "name", "type": "string"},
+      {"name": "wallet", "type": "address"}
+    ],
+    "Mail": [
+      {"name": "from", "type": "Person"},
+      {"name": "to", "type": "Person"},
+      {"name": "contents", "type": "string"}
+    ]
+  },
+  "primaryType": "Mail",
+  "domain": {
+    "name": "Ether Mail",
+    "version": "1",
+    "chainId": 1,
+    "verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+  },
+  "message": {
+    "from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+    "to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+    "contents": "Hello, Bob!"
+  }
+}`
+
+func TestVerifyMessage(t *testing.T) {
+	// Test vector from EIP-712, signed by the private key keccak256("cow").
+	const address = "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"
+	const signature = "0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c"
+	require.NoError(t, VerifyMessage(address, []byte(eip712Mail), signature, MessageFormatEIP712))
+	// Without 0x prefix and lowercase address.
+	require.NoError(t, VerifyMessage(
+		"0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826", []byte(eip712Mail), signature[2:],
+		MessageFormatEIP712))
+	require.Equal(t, ErrInvalidMessageSignature, errp.Cause(VerifyMessage(
+		"0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB", []byte(eip712Mail), signature,
+		MessageFormatEIP712)))
+	require.Equal(t, ErrInvalidMessageSignature, errp.Cause(VerifyMessage(
+		address, []byte(eip712Mail), signature, MessageFormatEIP191)))
+	require.Equal(t, ErrInvalidMessageSignature, errp.Cause(VerifyMessage(
+		address, []byte(eip712Mail), "0x1234", MessageFormatEIP712)))
+	require.Error(t, VerifyMessage(address, []byte("not json"), signature, MessageFormatEIP712))
+	require.Error(t, VerifyMessage("invalid", []byte(eip712Mail), signature, MessageFormatEIP712))
+	require.Error(t, VerifyMessage(address, []byte(eip712Mail), signature, "unknown"))
+
+	// EIP-191 with V being 0/1 or 27/28.
+	privateKey := crypto.Keccak256([]byte("cow"))
+	key, err := crypto.ToECDSA(privateKey)
+	require.NoError(t, err)
+	require.Equal(t, address, crypto.PubkeyToAddress(key.PublicKey).Hex())
+	msg := []byte("Hello World")
+	hash, err := messageHash(msg, MessageFormatEIP191)
+	require.NoError(t, err)
+	sig, err := crypto.Sign(hash, key)
+	require.NoError(t, err)
+	require.NoError(t, VerifyMessage(address, msg, hexutil.Encode(sig), MessageFormatEIP191))
+	sig[64] += 27
+	require.NoError(t, VerifyMessage(address, msg, hexutil.Encode(sig), MessageFormatEIP191))
+	require.Equal(t, ErrInvalidMessageSignature, errp.Cause(VerifyMessage(
+		address, []byte("Hello World!"), hexutil.Encode(sig), MessageFormatEIP191)))
+}
@@ -16,6 +16,8 @@
 package config
 
 import (
+	"encoding/hex"
+
 	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
@@ -41,6 +43,9 @@ type Account struct {
 	// only applies to ETH, and the elements are ERC20 token codes (e.g. "eth-erc20-usdt",
 	// "eth-erc20-bat", etc).
 	ActiveTokens []string `json:"activeTokens,omitempty"`
+	// NotificationsMuted is true if the user should not be notified about the transactions of the
+	// account. For ETH accounts, this applies to its ERC20 tokens as well.
+	NotificationsMuted bool `json:"notificationsMuted"`
 }
 
 // SetTokenActive activates/deactivates an token on an account. `tokenCode` must be an ERC20 token
@@ -65,6 +70,10 @@ func (acct *Account) SetTokenActive(tokenCode string, active bool) error {
 // AccountsConfig persists the list of accounts added to the app.
 type AccountsConfig struct {
 	Accounts []*Account `json:"accounts"`
+	// RememberedKeystores are the hex encoded root fingerprints of the keystores whose accounts are
+	// loaded even if the keystore is not connected, so that balances and transactions can be
+	// viewed without the device.
+	RememberedKeystores []string `json:"rememberedKeystores,omitempty"`
 }
 
 // newDefaultAccountsonfig returns the default accounts config.
@@ -74,6 +83,33 @@ func newDefaultAccountsonfig() AccountsConfig {
 	}
 }
 
+// IsKeystoreRemembered returns true if the keystore with the given root fingerprint is remembered.
+func (cfg AccountsConfig) IsKeystoreRemembered(rootFingerprint []byte) bool {
+	encoded := hex.EncodeToString(rootFingerprint)
+	for _, remembered := range cfg.RememberedKeystores {
+		if remembered == encoded {
+			return true
+		}
+	}
+	return false
+}
+
+// SetKeystoreRemembered adds or removes the keystore with the given root fingerprint to the
+// remembered keystores.
+func (cfg *AccountsConfig) SetKeystoreRemembered(rootFingerprint []byte, remembered bool) {
+	encoded := hex.EncodeToString(rootFingerprint)
+	rememberedKeystores := []string{}
+	for _, keystore := range cfg.RememberedKeystores {
+		if keystore != encoded {
+			rememberedKeystores = append(rememberedKeystores, keystore)
+		}
+	}
+	if remembered {
+		rememberedKeystores = append(rememberedKeystores, encoded)
+	}
+	cfg.RememberedKeystores = rememberedKeystores
+}
+
 // Lookup returns the account with the given code, or nil if no such account exists.
 // A reference is returned, so the account can be modified by the caller.
 func (cfg AccountsConfig) Lookup(code accountsTypes.Code) *Account {
@@ -91,3 +91,21 @@ func TestMigrateActiveToken(t *testing.T) {
 	// eth-erc20-sai0x89d was removed by the migration.
 	require.Equal(t, []string{"TOKEN-2"}, acct.ActiveTokens)
 }
+
+func TestSetKeystoreRemembered(t *testing.T) {
+	cfg := AccountsConfig{}
+	fingerprint1 := []byte{0x55, 0x55, 0x55, 0x55}
+	fingerprint2 := []byte{0x66, 0x66, 0x66, 0x66}
+	require.False(t, cfg.IsKeystoreRemembered(fingerprint1))
+
+	cfg.SetKeystoreRemembered(fingerprint1, true)
+	cfg.SetKeystoreRemembered(fingerprint2, true)
+	// Remembering twice has no effect.
+	cfg.SetKeystoreRemembered(fingerprint1, true)
+	require.Equal(t, []string{"66666666", "55555555"}, cfg.RememberedKeystores)
+	require.True(t, cfg.IsKeystoreRemembered(fingerprint1))
+
+	cfg.SetKeystoreRemembered(fingerprint1, false)
+	require.False(t, cfg.IsKeystoreRemembered(fingerprint1))
+	require.True(t, cfg.IsKeystoreRemembered(fingerprint2))
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/rates"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
@@ -39,9 +40,31 @@ func (s *ServerInfo) String() string {
 	return s.Server + ":p"
 }
 
+// FeePreset is a user-defined fee target, offered in addition to the default fee targets.
+type FeePreset struct {
+	// Name identifies the preset, e.g. "economy batch".
+	Name string `json:"name"`
+	// Blocks is the number of blocks in which the transaction should be confirmed, e.g. 1008 for
+	// one week.
+	Blocks int `json:"blocks"`
+}
+
+// FeeEstimation configures how the fee rates of the fee targets are estimated.
+type FeeEstimation struct {
+	// MempoolAPIURL, if not empty, is the base URL of a mempool.space compatible API, e.g. a
+	// local instance, which is queried for fee estimates before the Electrum servers.
+	MempoolAPIURL string `json:"mempoolAPIURL"`
+	// Presets are additional fee targets.
+	Presets []FeePreset `json:"presets"`
+}
+
 // btcCoinConfig holds configurations specific to a btc-based coin.
 type btcCoinConfig struct {
 	ElectrumServers []*ServerInfo `json:"electrumServers"`
+	// OnionElectrumServers are used instead of ElectrumServers when connecting through Tor. The
+	// ElectrumServers are tried afterwards unless Tor-only mode is enabled.
+	OnionElectrumServers []*ServerInfo `json:"onionElectrumServers"`
+	FeeEstimation        FeeEstimation `json:"feeEstimation"`
 }
 
 // ETHTransactionsSource  where to get Ethereum transactions from. See the list of consts
@@ -64,6 +87,97 @@ type ethCoinConfig struct {
 type proxyConfig struct {
 	UseProxy     bool   `json:"useProxy"`
 	ProxyAddress string `json:"proxyAddress"`
+	// TorOnly refuses all connections which do not go through the proxy, and the fallback from
+	// onion to clearnet endpoints.
+	TorOnly bool `json:"torOnly"`
+	// OnionUpdateURL, if not empty, is used instead of the default update file URL when connecting
+	// through Tor.
+	OnionUpdateURL string `json:"onionUpdateURL"`
+	// OnionRatesURL, if not empty, is used instead of the default CoinGecko API when connecting
+	// through Tor. It does not override the URL of a rates provider configured by the user.
+	OnionRatesURL string `json:"onionRatesURL"`
+}
+
+// RatesProvider configures a source of exchange rates.
+type RatesProvider struct {
+	// Name is one of "coingecko", "kraken" or "json".
+	Name string `json:"name"`
+	// URL overrides the default API URL. It is required for the "json" provider.
+	URL string `json:"url"`
+}
+
+// AlertType is the kind of condition of an alert. See the list of consts below.
+type AlertType string
+
+const (
+	// AlertTypePrice triggers when the price of a coin crosses the threshold.
+	AlertTypePrice AlertType = "price"
+	// AlertTypePortfolioChange triggers when the fiat value of all active accounts changes by at
+	// least the threshold in percent within 24 hours.
+	AlertTypePortfolioChange AlertType = "portfolioChange"
+	// AlertTypeBalanceBelow triggers when the balance of an account falls below the threshold.
+	AlertTypeBalanceBelow AlertType = "balanceBelow"
+)
+
+// Alert is a user-defined rule. The user is notified when its condition becomes true.
+type Alert struct {
+	// ID identifies the alert, e.g. in the triggered events. It is chosen by the frontend.
+	ID   string    `json:"id"`
+	Type AlertType `json:"type"`
+	// Disabled alerts are not evaluated.
+	Disabled bool `json:"disabled"`
+	// Coin is the coin unit of price alerts, e.g. "BTC".
+	Coin string `json:"coin,omitempty"`
+	// Fiat is the fiat of price and portfolio change alerts. If empty, MainFiat is used.
+	Fiat string `json:"fiat,omitempty"`
+	// Above is true if the alert triggers when the price or portfolio value rises, false if it
+	// falls. Portfolio change alerts with a nil Above trigger in both directions.
+	Above *bool `json:"above,omitempty"`
+	// Threshold is a decimal number: the price in fiat for price alerts, the change in percent for
+	// portfolio change alerts and the amount in the unit of the coin, e.g. "0.01" BTC, for
+	// balance alerts.
+	Threshold string `json:"threshold"`
+	// Account is the code of the account of balance alerts.
+	Account accountsTypes.Code `json:"account,omitempty"`
+}
+
+// TxNotifications configures the notifications about transactions.
+type TxNotifications struct {
+	// PerTransaction, if true, notifies about each new incoming transaction with its amount and
+	// fiat value, instead of only the number of new transactions.
+	PerTransaction bool `json:"perTransaction"`
+	// Confirmations are the numbers of confirmations of an incoming transaction at which the user
+	// is notified again, e.g. [1, 6].
+	Confirmations []int `json:"confirmations"`
+}
+
+// ExternalSigner configures an external signer process, see the `keystore/external` package.
+type ExternalSigner struct {
+	// Name identifies the signer.
+	Name string `json:"name"`
+	// Command is the executable of the signer, e.g. a wrapper script around HWI.
+	Command string `json:"command"`
+	// Args are passed to the command.
+	Args []string `json:"args"`
+}
+
+// ReadExternalSigners reads the external signers from the given file, which contains a JSON list
+// of ExternalSigner. The file is edited by the user and never written by the app, so that the
+// commands cannot be changed through the app config API. Returns no signers if the file does not
+// exist.
+func ReadExternalSigners(filename string) ([]ExternalSigner, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return []ExternalSigner{}, nil
+	}
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	signers := []ExternalSigner{}
+	if err := json.Unmarshal(data, &signers); err != nil {
+		return nil, errp.WithMessage(err, "invalid external signers file")
+	}
+	return signers, nil
 }
 
 // Backend holds the backend specific configuration.
@@ -92,6 +206,10 @@ type Backend struct {
 	// and transaction amounts.
 	MainFiat string `json:"mainFiat"`
 
+	// RatesProviders are the sources of exchange rates in order of priority. If one fails, the
+	// next one is used. If empty, CoinGecko is used.
+	RatesProviders []RatesProvider `json:"ratesProviders"`
+
 	// UserLanguage is the UI language preferred by the user.
 	// It may be missing from an app config.json if the user never selected one
 	// or set to empty by the frontend if its value matches native locale
@@ -100,6 +218,13 @@ type Backend struct {
 
 	// BtcUnit is the unit used to represent Bitcoin amounts. See `coin.BtcUnit` for details.
 	BtcUnit coin.BtcUnit `json:"btcUnit"`
+
+	// Alerts are the user-defined price and balance alerts.
+	Alerts []Alert `json:"alerts"`
+
+	// TxNotifications configures the notifications about transactions. Notifications of
+	// individual accounts can be muted in the accounts config.
+	TxNotifications TxNotifications `json:"txNotifications"`
 }
 
 // DeprecatedCoinActive returns the Active setting for a coin by code.  This call is should not be
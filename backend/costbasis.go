@@ -0,0 +1,45 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/costbasis"
+)
+
+// CostBasis computes the cost basis and gains of all active accounts together, so that transfers
+// between the accounts keep their cost basis. If fiat is empty, the main fiat currency is used.
+func (backend *Backend) CostBasis(fiat string, options costbasis.Options) (*costbasis.Report, error) {
+	if fiat == "" {
+		fiat = backend.Config().AppConfig().Backend.MainFiat
+	}
+	accountsData := []*costbasis.Account{}
+	for _, account := range backend.Accounts() {
+		if account.Config().Config.Inactive {
+			continue
+		}
+		if account.FatalError() {
+			continue
+		}
+		if err := account.Initialize(); err != nil {
+			return nil, err
+		}
+		accountData, err := costbasis.NewAccount(account)
+		if err != nil {
+			return nil, err
+		}
+		accountsData = append(accountsData, accountData)
+	}
+	return costbasis.Compute(accountsData, backend.RatesUpdater(), fiat, options)
+}
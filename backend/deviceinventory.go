@@ -0,0 +1,148 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox02"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/device"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/inventory"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+)
+
+// DeviceInventory returns all devices ever connected, most recently seen first.
+func (backend *Backend) DeviceInventory() ([]*inventory.Record, error) {
+	return backend.deviceInventory.Devices()
+}
+
+// DeviceInventoryLog returns the audit log of device connections, attestation results and the
+// wallets provided by the devices, oldest first. If id is not empty, only the entries of the device
+// with this stable ID are returned, see inventory.Record.ID.
+func (backend *Backend) DeviceInventoryLog(id string) ([]*inventory.Entry, error) {
+	return backend.deviceInventory.Log(id)
+}
+
+func (backend *Backend) notifyDeviceInventoryChanged() {
+	backend.Notify(observable.Event{
+		Subject: "devices/inventory",
+		Action:  action.Reload,
+	})
+}
+
+// handleDeviceInventoryWarnings logs and notifies the user about warnings of the audit log.
+func (backend *Backend) handleDeviceInventoryWarnings(entries []*inventory.Entry) {
+	for _, entry := range entries {
+		if !entry.Warning {
+			continue
+		}
+		log := backend.log.WithField("deviceID", entry.DeviceID).WithField("id", entry.ID)
+		switch entry.Type {
+		case inventory.EntryAttestationFailed:
+			log.Warn("device inventory: attestation failed")
+			backend.NotifyUser(
+				"The connected device could not be verified as a genuine device. Please contact support.")
+		case inventory.EntryRootFingerprintChanged:
+			log.WithField("rootFingerprint", entry.RootFingerprint).
+				WithField("previousRootFingerprint", entry.PreviousRootFingerprint).
+				Warn("device inventory: known device provides a different wallet")
+			backend.NotifyUser(fmt.Sprintf(
+				"The connected device provides a different wallet (%s) than the last time (%s).",
+				entry.RootFingerprint, entry.PreviousRootFingerprint))
+		}
+	}
+}
+
+// deviceInventoryID returns the stable ID of the device in the device inventory, or "" if it is not
+// known yet. The BitBox02 is identified by its noise static pubkey, which is known after the noise
+// handshake. Other devices have no stable ID, so the device identifier is used.
+func deviceInventoryID(theDevice device.Interface) string {
+	if bb02, ok := theDevice.(*bitbox02.Device); ok {
+		pubkey := bb02.NoiseStaticPubkey()
+		if pubkey == nil {
+			return ""
+		}
+		return hex.EncodeToString(pubkey)
+	}
+	return theDevice.Identifier()
+}
+
+// recordDeviceConnected records the connection of the device once its stable ID is known, together
+// with the attestation result of the BitBox02, which is checked before the noise handshake. It is
+// called when the device is registered and on each device event, and records each connection once.
+func (backend *Backend) recordDeviceConnected(theDevice device.Interface) {
+	deviceID := theDevice.Identifier()
+	id := deviceInventoryID(theDevice)
+	if id == "" {
+		return
+	}
+	backend.deviceInventoryIDsMu.Lock()
+	_, recorded := backend.deviceInventoryIDs[deviceID]
+	if !recorded {
+		backend.deviceInventoryIDs[deviceID] = id
+	}
+	backend.deviceInventoryIDsMu.Unlock()
+	if recorded {
+		return
+	}
+	if err := backend.deviceInventory.Connected(
+		id, deviceID, theDevice.ProductName()); err != nil {
+		backend.log.WithError(err).Error("device inventory: could not record device")
+		return
+	}
+	if bb02, ok := theDevice.(*bitbox02.Device); ok {
+		if attestation := bb02.Attestation(); attestation != nil {
+			entries, err := backend.deviceInventory.Attested(
+				id,
+				string(bb02.Product()),
+				bb02.Version().String(),
+				*attestation,
+			)
+			if err != nil {
+				backend.log.WithError(err).Error("device inventory: could not record attestation")
+			}
+			backend.handleDeviceInventoryWarnings(entries)
+		}
+	}
+	backend.notifyDeviceInventoryChanged()
+}
+
+// deviceInventoryDisconnected forgets the stable ID of the device, so that the next connection is
+// recorded.
+func (backend *Backend) deviceInventoryDisconnected(deviceID string) {
+	backend.deviceInventoryIDsMu.Lock()
+	defer backend.deviceInventoryIDsMu.Unlock()
+	delete(backend.deviceInventoryIDs, deviceID)
+}
+
+func (backend *Backend) recordDeviceKeystore(deviceID string, rootFingerprint []byte) {
+	backend.deviceInventoryIDsMu.Lock()
+	id, ok := backend.deviceInventoryIDs[deviceID]
+	backend.deviceInventoryIDsMu.Unlock()
+	if !ok {
+		backend.log.WithField("deviceID", deviceID).
+			Error("device inventory: keystore of an unrecorded device")
+		return
+	}
+	entries, err := backend.deviceInventory.KeystoreRegistered(id, rootFingerprint)
+	if err != nil {
+		backend.log.WithError(err).Error("device inventory: could not record keystore")
+		return
+	}
+	backend.handleDeviceInventoryWarnings(entries)
+	backend.notifyDeviceInventoryChanged()
+}
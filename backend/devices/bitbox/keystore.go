@@ -154,6 +154,9 @@ func (keystore *keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransact
 			return errp.New("There needs to be exactly one output being spent per input.")
 		}
 		address := btcProposedTx.GetAddress(spentOutput.ScriptHashHex())
+		if address == nil {
+			return errp.Newf("Input %d does not belong to the account", index)
+		}
 		isSegwit, subScript := address.ScriptForHashToSign()
 		var signatureHash []byte
 		if isSegwit {
@@ -245,6 +248,16 @@ func (keystore *keystore) CanSignMessage(coin.Code) bool {
 	return false
 }
 
+// CanSignBIP322 implements keystore.Keystore.
+func (keystore *keystore) CanSignBIP322(coin.Code) bool {
+	return false
+}
+
+// CanSignProofOfReserves implements keystore.Keystore.
+func (keystore *keystore) CanSignProofOfReserves(coin.Code) bool {
+	return false
+}
+
 // SignBTCMessage implements keystore.Keystore.
 func (keystore *keystore) SignBTCMessage(message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
 	return nil, errp.New("unsupported")
@@ -254,3 +267,8 @@ func (keystore *keystore) SignBTCMessage(message []byte, keypath signing.Absolut
 func (keystore *keystore) SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
 	return nil, errp.New("unsupported")
 }
+
+// SignETHTypedMessage implements keystore.Keystore.
+func (keystore *keystore) SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	return nil, errp.New("unsupported")
+}
@@ -16,9 +16,13 @@ package bitbox02
 
 import (
 	"bytes"
+	"encoding/hex"
+	"sort"
 	"sync"
+	"time"
 
 	fileconfig "github.com/digitalbitbox/bitbox-wallet-app/util/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/flynn/noise"
 )
 
@@ -30,15 +34,36 @@ type NoiseKeypair struct {
 	Public  []byte `json:"public"`
 }
 
+// PairingInfo holds metadata about a paired device.
+type PairingInfo struct {
+	Label    string    `json:"label"`
+	PairedAt time.Time `json:"pairedAt"`
+}
+
 // ConfigData holds the persisted app configuration related to bitbox02 devices.
 type ConfigData struct {
 	AppNoiseStaticKeypair    *NoiseKeypair `json:"appNoiseStaticKeypair"`
 	DeviceNoiseStaticPubkeys [][]byte      `json:"deviceNoiseStaticPubkeys"`
+	// DevicePairings holds the metadata of the device pubkeys in DeviceNoiseStaticPubkeys, keyed
+	// by the hex encoded pubkey. Pairings made before the metadata was introduced have no entry.
+	DevicePairings map[string]*PairingInfo `json:"devicePairings,omitempty"`
 }
 
+// Pairing is a paired device.
+type Pairing struct {
+	// DeviceNoiseStaticPubkey is the hex encoded noise static pubkey of the device.
+	DeviceNoiseStaticPubkey string `json:"deviceNoiseStaticPubkey"`
+	Label                   string `json:"label"`
+	// PairedAt is nil if the pairing date is unknown.
+	PairedAt *time.Time `json:"pairedAt"`
+}
+
+// configMu guards the config file, which is shared by all Config instances with the same
+// directory, e.g. the one of each connected device.
+var configMu sync.RWMutex
+
 // Config perists the bitbox02 related configuration in a file.
 type Config struct {
-	mu        sync.RWMutex
 	configDir string
 }
 
@@ -66,8 +91,8 @@ func (config *Config) storeConfig(conf *ConfigData) error {
 
 // ContainsDeviceStaticPubkey implements ConfigurationInterface.
 func (config *Config) ContainsDeviceStaticPubkey(pubkey []byte) bool {
-	config.mu.RLock()
-	defer config.mu.RUnlock()
+	configMu.RLock()
+	defer configMu.RUnlock()
 
 	for _, configPubkey := range config.readConfig().DeviceNoiseStaticPubkeys {
 		if bytes.Equal(configPubkey, pubkey) {
@@ -84,18 +109,22 @@ func (config *Config) AddDeviceStaticPubkey(pubkey []byte) error {
 		return nil
 	}
 
-	config.mu.Lock()
-	defer config.mu.Unlock()
+	configMu.Lock()
+	defer configMu.Unlock()
 
 	configData := config.readConfig()
 	configData.DeviceNoiseStaticPubkeys = append(configData.DeviceNoiseStaticPubkeys, pubkey)
+	if configData.DevicePairings == nil {
+		configData.DevicePairings = map[string]*PairingInfo{}
+	}
+	configData.DevicePairings[hex.EncodeToString(pubkey)] = &PairingInfo{PairedAt: time.Now()}
 	return config.storeConfig(configData)
 }
 
 // GetAppNoiseStaticKeypair implements ConfigurationInterface.
 func (config *Config) GetAppNoiseStaticKeypair() *noise.DHKey {
-	config.mu.RLock()
-	defer config.mu.RUnlock()
+	configMu.RLock()
+	defer configMu.RUnlock()
 
 	key := config.readConfig().AppNoiseStaticKeypair
 	if key == nil {
@@ -109,8 +138,8 @@ func (config *Config) GetAppNoiseStaticKeypair() *noise.DHKey {
 
 // SetAppNoiseStaticKeypair implements ConfigurationInterface.
 func (config *Config) SetAppNoiseStaticKeypair(key *noise.DHKey) error {
-	config.mu.Lock()
-	defer config.mu.Unlock()
+	configMu.Lock()
+	defer configMu.Unlock()
 
 	configData := config.readConfig()
 	configData.AppNoiseStaticKeypair = &NoiseKeypair{
@@ -119,3 +148,93 @@ func (config *Config) SetAppNoiseStaticKeypair(key *noise.DHKey) error {
 	}
 	return config.storeConfig(configData)
 }
+
+// Pairings returns all paired devices, most recently paired first. Pairings with an unknown
+// pairing date come last.
+func (config *Config) Pairings() []*Pairing {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	configData := config.readConfig()
+	pairings := []*Pairing{}
+	for _, pubkey := range configData.DeviceNoiseStaticPubkeys {
+		pairing := &Pairing{DeviceNoiseStaticPubkey: hex.EncodeToString(pubkey)}
+		if info, ok := configData.DevicePairings[pairing.DeviceNoiseStaticPubkey]; ok {
+			pairing.Label = info.Label
+			if !info.PairedAt.IsZero() {
+				pairedAt := info.PairedAt
+				pairing.PairedAt = &pairedAt
+			}
+		}
+		pairings = append(pairings, pairing)
+	}
+	sort.SliceStable(pairings, func(i, j int) bool {
+		if pairings[j].PairedAt == nil {
+			return pairings[i].PairedAt != nil
+		}
+		return pairings[i].PairedAt != nil && pairings[i].PairedAt.After(*pairings[j].PairedAt)
+	})
+	return pairings
+}
+
+// modifyPairing calls `f` with the index of the paired device pubkey in DeviceNoiseStaticPubkeys
+// and its DevicePairings key, and stores the modified config.
+func (config *Config) modifyPairing(
+	pubkeyHex string, f func(configData *ConfigData, index int, key string)) error {
+	pubkey, err := hex.DecodeString(pubkeyHex)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	configData := config.readConfig()
+	for index, configPubkey := range configData.DeviceNoiseStaticPubkeys {
+		if bytes.Equal(configPubkey, pubkey) {
+			f(configData, index, hex.EncodeToString(pubkey))
+			return config.storeConfig(configData)
+		}
+	}
+	return errp.Newf("device %s is not paired", pubkeyHex)
+}
+
+// SetPairingLabel sets the label of a paired device, so the user can tell the pairings apart.
+func (config *Config) SetPairingLabel(pubkeyHex string, label string) error {
+	return config.modifyPairing(pubkeyHex, func(configData *ConfigData, _ int, key string) {
+		if configData.DevicePairings == nil {
+			configData.DevicePairings = map[string]*PairingInfo{}
+		}
+		info, ok := configData.DevicePairings[key]
+		if !ok {
+			info = &PairingInfo{}
+			configData.DevicePairings[key] = info
+		}
+		info.Label = label
+	})
+}
+
+// RemovePairing forgets a paired device. The pairing code has to be verified again the next time
+// the device connects. A currently connected device stays usable until it is reconnected.
+func (config *Config) RemovePairing(pubkeyHex string) error {
+	return config.modifyPairing(pubkeyHex, func(configData *ConfigData, index int, key string) {
+		configData.DeviceNoiseStaticPubkeys = append(
+			configData.DeviceNoiseStaticPubkeys[:index],
+			configData.DeviceNoiseStaticPubkeys[index+1:]...)
+		delete(configData.DevicePairings, key)
+	})
+}
+
+// RotateAppNoiseStaticKeypair discards the app noise static keypair, so a new one is created the
+// next time a device connects. As the devices know the app only by its old pubkey, all pairings
+// are removed as well and every device needs to be paired again.
+func (config *Config) RotateAppNoiseStaticKeypair() error {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	configData := config.readConfig()
+	configData.AppNoiseStaticKeypair = nil
+	configData.DeviceNoiseStaticPubkeys = nil
+	configData.DevicePairings = nil
+	return config.storeConfig(configData)
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitbox02
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/flynn/noise"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigPairings(t *testing.T) {
+	config := NewConfig(test.TstTempDir("TestConfigPairings"))
+	require.Empty(t, config.Pairings())
+
+	pubkey1 := bytes.Repeat([]byte{1}, 32)
+	pubkey2 := bytes.Repeat([]byte{0xab}, 32)
+	require.NoError(t, config.SetAppNoiseStaticKeypair(&noise.DHKey{Private: []byte{3}, Public: []byte{4}}))
+	require.NoError(t, config.AddDeviceStaticPubkey(pubkey1))
+	require.NoError(t, config.AddDeviceStaticPubkey(pubkey2))
+	require.NoError(t, config.AddDeviceStaticPubkey(pubkey2))
+
+	// A pairing from before pairing dates were recorded.
+	configData := config.readConfig()
+	legacyPubkey := bytes.Repeat([]byte{5}, 32)
+	configData.DeviceNoiseStaticPubkeys = append(configData.DeviceNoiseStaticPubkeys, legacyPubkey)
+	require.NoError(t, config.storeConfig(configData))
+
+	pairings := config.Pairings()
+	require.Len(t, pairings, 3)
+	require.Equal(t, hex.EncodeToString(pubkey2), pairings[0].DeviceNoiseStaticPubkey)
+	require.NotNil(t, pairings[0].PairedAt)
+	require.Equal(t, hex.EncodeToString(pubkey1), pairings[1].DeviceNoiseStaticPubkey)
+	require.NotNil(t, pairings[1].PairedAt)
+	require.False(t, pairings[0].PairedAt.Before(*pairings[1].PairedAt))
+	require.Equal(t, hex.EncodeToString(legacyPubkey), pairings[2].DeviceNoiseStaticPubkey)
+	require.Nil(t, pairings[2].PairedAt)
+
+	require.NoError(t, config.SetPairingLabel(hex.EncodeToString(pubkey1), "office"))
+	require.NoError(t, config.SetPairingLabel(hex.EncodeToString(legacyPubkey), "old"))
+	// Uppercase hex is accepted.
+	require.NoError(t, config.SetPairingLabel(strings.ToUpper(hex.EncodeToString(pubkey2)), "home"))
+	require.Error(t, config.SetPairingLabel(hex.EncodeToString(bytes.Repeat([]byte{9}, 32)), "x"))
+	require.Error(t, config.SetPairingLabel("not hex", "x"))
+	pairings = config.Pairings()
+	require.Equal(t, "home", pairings[0].Label)
+	require.Equal(t, "office", pairings[1].Label)
+	require.Equal(t, "old", pairings[2].Label)
+	require.Nil(t, pairings[2].PairedAt)
+
+	require.NoError(t, config.RemovePairing(hex.EncodeToString(pubkey1)))
+	require.Error(t, config.RemovePairing(hex.EncodeToString(pubkey1)))
+	require.False(t, config.ContainsDeviceStaticPubkey(pubkey1))
+	require.True(t, config.ContainsDeviceStaticPubkey(pubkey2))
+	require.Len(t, config.Pairings(), 2)
+
+	require.NoError(t, config.RotateAppNoiseStaticKeypair())
+	require.Nil(t, config.GetAppNoiseStaticKeypair())
+	require.False(t, config.ContainsDeviceStaticPubkey(pubkey2))
+	require.Empty(t, config.Pairings())
+}
@@ -44,9 +44,33 @@ type Device struct {
 	onEvent  func(event.Event, interface{})
 	log      *logrus.Entry
 
+	// simulator is true if the device is the firmware simulator.
+	simulator bool
+	// testing is true if the app runs in testing mode, see `Init()`.
+	testing bool
+
+	config *deviceConfig
+
 	observable.Implementation
 }
 
+// deviceConfig wraps the config to remember the noise static pubkey of the device, which the
+// firmware API checks with ContainsDeviceStaticPubkey() after each handshake.
+type deviceConfig struct {
+	firmware.ConfigInterface
+
+	mu                      sync.RWMutex
+	deviceNoiseStaticPubkey []byte
+}
+
+// ContainsDeviceStaticPubkey implements firmware.ConfigInterface.
+func (config *deviceConfig) ContainsDeviceStaticPubkey(pubkey []byte) bool {
+	config.mu.Lock()
+	config.deviceNoiseStaticPubkey = append([]byte(nil), pubkey...)
+	config.mu.Unlock()
+	return config.ConfigInterface.ContainsDeviceStaticPubkey(pubkey)
+}
+
 // NewDevice creates a new instance of Device.
 func NewDevice(
 	deviceID string,
@@ -62,15 +86,17 @@ func NewDevice(
 		WithField("product", product)
 
 	log.Info("Plugged in device")
+	deviceConfig := &deviceConfig{ConfigInterface: config}
 	device := &Device{
 		Device: *firmware.NewDevice(
 			version,
 			&product,
-			config,
+			deviceConfig,
 			communication, logger{log},
 		),
 		deviceID: deviceID,
 		log:      log,
+		config:   deviceConfig,
 	}
 	device.Device.SetOnEvent(func(ev firmware.Event, meta interface{}) {
 		device.fireEvent(event.Event(ev))
@@ -80,13 +106,43 @@ func NewDevice(
 			case firmware.StatusInitialized:
 				device.fireEvent(event.EventKeystoreAvailable)
 			}
+		case firmware.EventChannelHashChanged:
+			device.maybeAutoConfirmPairing()
 		}
 	})
 	return device
 }
 
+// SetSimulator marks the device as the firmware simulator. The simulator confirms all prompts on
+// the device automatically. In testing mode, the app then also confirms the pairing code
+// automatically, so the device can be used in automated tests.
+func (device *Device) SetSimulator() {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	device.simulator = true
+}
+
+// maybeAutoConfirmPairing confirms the pairing code in the app once the device confirmed it, if
+// the device is the simulator and we are in testing mode.
+func (device *Device) maybeAutoConfirmPairing() {
+	device.mu.RLock()
+	autoConfirm := device.simulator && device.testing
+	device.mu.RUnlock()
+	if !autoConfirm || device.Device.Status() != firmware.StatusUnpaired {
+		return
+	}
+	if _, deviceVerified := device.Device.ChannelHash(); deviceVerified {
+		device.log.Info("simulator: confirming the pairing code automatically")
+		// Not in the event handler, as confirming the pairing queries the device.
+		go device.Device.ChannelHashVerify(true)
+	}
+}
+
 // Init implements device.Device.
 func (device *Device) Init(testing bool) error {
+	device.mu.Lock()
+	device.testing = testing
+	device.mu.Unlock()
 	device.init()
 	return nil
 }
@@ -99,6 +155,14 @@ func (device *Device) init() {
 	}()
 }
 
+// NoiseStaticPubkey returns the noise static pubkey of the device, which identifies the device
+// independently of the USB port it is plugged into. Returns nil before the noise handshake.
+func (device *Device) NoiseStaticPubkey() []byte {
+	device.config.mu.RLock()
+	defer device.config.mu.RUnlock()
+	return device.config.deviceNoiseStaticPubkey
+}
+
 // ProductName implements device.Device.
 func (device *Device) ProductName() string {
 	return ProductName
@@ -310,6 +310,9 @@ func (keystore *keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransact
 		}
 
 		inputAddress := btcProposedTx.GetAddress(prevOut.ScriptHashHex())
+		if inputAddress == nil {
+			return errp.Newf("Input %d does not belong to the account", inputIndex)
+		}
 
 		accountConfiguration := inputAddress.AccountConfiguration
 		msgScriptType, ok := btcMsgScriptTypeMap[accountConfiguration.ScriptType()]
@@ -493,6 +496,18 @@ func (keystore *keystore) CanSignMessage(code coinpkg.Code) bool {
 	return code == coinpkg.CodeBTC || code == coinpkg.CodeETH
 }
 
+// CanSignBIP322 implements keystore.Keystore. The BitBox02 rejects the virtual BIP322 transaction,
+// as it has version 0 and an OP_RETURN output.
+func (keystore *keystore) CanSignBIP322(coinpkg.Code) bool {
+	return false
+}
+
+// CanSignProofOfReserves implements keystore.Keystore. The BitBox02 only signs transactions
+// spending its own outputs and does not accept OP_TRUE outputs.
+func (keystore *keystore) CanSignProofOfReserves(coinpkg.Code) bool {
+	return false
+}
+
 // SignBTCMessage implements keystore.Keystore.
 func (keystore *keystore) SignBTCMessage(message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
 	sc, ok := btcMsgScriptTypeMap[scriptType]
@@ -514,3 +529,8 @@ func (keystore *keystore) SignBTCMessage(message []byte, keypath signing.Absolut
 func (keystore *keystore) SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
 	return keystore.device.ETHSignMessage(params.MainnetChainConfig.ChainID.Uint64(), keypath.ToUInt32(), message)
 }
+
+// SignETHTypedMessage implements keystore.Keystore.
+func (keystore *keystore) SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	return keystore.device.ETHSignTypedMessage(chainID, keypath.ToUInt32(), data)
+}
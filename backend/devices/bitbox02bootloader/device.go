@@ -129,6 +129,36 @@ func (device *Device) UpgradeFirmware() error {
 	return device.Device.UpgradeFirmware(binary)
 }
 
+// VerifyFirmwareFile checks that the signed firmware binary, e.g. loaded from a local file, can be
+// installed on the device. See UpgradeFirmwareFromFile().
+func (device *Device) VerifyFirmwareFile(binary []byte) (*FirmwareFileInfo, error) {
+	_, info, err := device.verifyFirmwareFile(binary)
+	return info, err
+}
+
+func (device *Device) verifyFirmwareFile(binary []byte) (*signedFirmware, *FirmwareFileInfo, error) {
+	installedFirmwareVersion, installedSigningPubkeysVersion, err := device.Device.Versions()
+	if err != nil {
+		return nil, nil, err
+	}
+	return verifyFirmwareFile(
+		&device.Device, binary, installedFirmwareVersion, installedSigningPubkeysVersion)
+}
+
+// UpgradeFirmwareFromFile uploads a signed bitbox02 firmware binary supplied by the user, e.g. to
+// upgrade without an internet connection. Before flashing, the firmware is verified to be for the
+// edition of the device, to be signed by the root keys and not to be a downgrade, which
+// the bootloader would reject only after the upload.
+func (device *Device) UpgradeFirmwareFromFile(binary []byte) error {
+	fw, info, err := device.verifyFirmwareFile(binary)
+	if err != nil {
+		return err
+	}
+	device.log.Infof("upgrading firmware from file: %s, version %d, hash %s",
+		info.Product, info.Version, info.Hash)
+	return device.Device.UpgradeFirmware(fw.binary)
+}
+
 // VersionInfo contains version information about the upgrade.
 type VersionInfo struct {
 	Erased     bool `json:"erased"`
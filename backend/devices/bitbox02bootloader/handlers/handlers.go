@@ -29,6 +29,8 @@ import (
 type BitBox02Bootloader interface {
 	Status() *bootloader.Status
 	UpgradeFirmware() error
+	VerifyFirmwareFile([]byte) (*bitbox02bootloader.FirmwareFileInfo, error)
+	UpgradeFirmwareFromFile([]byte) error
 	Reboot() error
 	ShowFirmwareHashEnabled() (bool, error)
 	SetShowFirmwareHashEnabled(bool) error
@@ -51,6 +53,8 @@ func NewHandlers(
 
 	handleFunc("/status", handlers.getStatusHandler).Methods("GET")
 	handleFunc("/upgrade-firmware", handlers.postUpgradeFirmwareHandler).Methods("POST")
+	handleFunc("/verify-firmware-file", handlers.postVerifyFirmwareFileHandler).Methods("POST")
+	handleFunc("/upgrade-firmware-from-file", handlers.postUpgradeFirmwareFromFileHandler).Methods("POST")
 	handleFunc("/reboot", handlers.postRebootHandler).Methods("POST")
 	handleFunc("/show-firmware-hash-enabled", handlers.getShowFirmwareHashEnabledHandler).Methods("GET")
 	handleFunc("/set-firmware-hash-enabled", handlers.postSetShowFirmwareHashEnabledHandler).Methods("POST")
@@ -81,6 +85,71 @@ func (handlers *Handlers) postUpgradeFirmwareHandler(_ *http.Request) (interface
 	return nil, handlers.device.UpgradeFirmware()
 }
 
+// firmwareFileErrorCodes are the errors returned as an error code when verifying a firmware file, so
+// the frontend can show a translated message.
+var firmwareFileErrorCodes = []error{
+	bitbox02bootloader.ErrFirmwareEditionMismatch,
+	bitbox02bootloader.ErrFirmwareUnknownSigningKeys,
+	bitbox02bootloader.ErrFirmwareInvalidSignature,
+	bitbox02bootloader.ErrFirmwareDowngrade,
+}
+
+type firmwareFileResponse struct {
+	Success      bool                                 `json:"success"`
+	Info         *bitbox02bootloader.FirmwareFileInfo `json:"info,omitempty"`
+	ErrorCode    string                               `json:"errorCode,omitempty"`
+	ErrorMessage string                               `json:"errorMessage,omitempty"`
+}
+
+func (handlers *Handlers) firmwareFileError(err error) firmwareFileResponse {
+	handlers.log.WithError(err).Error("firmware file")
+	result := firmwareFileResponse{Success: false, ErrorMessage: err.Error()}
+	for _, errorCode := range firmwareFileErrorCodes {
+		if errp.Cause(err) == errorCode {
+			result.ErrorCode = errorCode.Error()
+		}
+	}
+	return result
+}
+
+// readFirmwareFile returns the contents of the firmware file the user picked in the frontend,
+// which are sent base64 encoded in the request body.
+func readFirmwareFile(r *http.Request) ([]byte, error) {
+	var request struct {
+		Firmware []byte `json:"firmware"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if len(request.Firmware) == 0 {
+		return nil, errp.New("firmware file missing")
+	}
+	return request.Firmware, nil
+}
+
+func (handlers *Handlers) postVerifyFirmwareFileHandler(r *http.Request) (interface{}, error) {
+	binary, err := readFirmwareFile(r)
+	if err != nil {
+		return handlers.firmwareFileError(err), nil
+	}
+	info, err := handlers.device.VerifyFirmwareFile(binary)
+	if err != nil {
+		return handlers.firmwareFileError(err), nil
+	}
+	return firmwareFileResponse{Success: true, Info: info}, nil
+}
+
+func (handlers *Handlers) postUpgradeFirmwareFromFileHandler(r *http.Request) (interface{}, error) {
+	binary, err := readFirmwareFile(r)
+	if err != nil {
+		return handlers.firmwareFileError(err), nil
+	}
+	if err := handlers.device.UpgradeFirmwareFromFile(binary); err != nil {
+		return handlers.firmwareFileError(err), nil
+	}
+	return firmwareFileResponse{Success: true}, nil
+}
+
 func (handlers *Handlers) postRebootHandler(_ *http.Request) (interface{}, error) {
 	return nil, handlers.device.Reboot()
 }
@@ -0,0 +1,282 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitbox02bootloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox02-api-go/api/bootloader"
+	bitbox02common "github.com/digitalbitbox/bitbox02-api-go/api/common"
+)
+
+// The signed firmware format is:
+//
+//	magic (4 bytes, big endian, depends on the edition)
+//	signing pubkeys version (4 bytes, little endian)
+//	3 signing pubkeys (64 bytes each, uncompressed NIST P-256 points without prefix)
+//	3 root signatures of the signing pubkeys (64 bytes each, all zero if missing)
+//	firmware version (4 bytes, little endian, monotonically increasing)
+//	3 signatures of the firmware by the signing keys (64 bytes each, all zero if missing)
+//	firmware
+//
+// The magic and the firmware version are parsed by bootloader.Device.SignedFirmwareVersion().
+const (
+	firmwareMagicLen       = 4
+	firmwareVersionLen     = 4
+	firmwareNumKeys        = 3
+	firmwareSigLen         = 64
+	signingPubkeysDataLen  = firmwareVersionLen + 2*firmwareNumKeys*firmwareSigLen
+	firmwareDataLen        = firmwareVersionLen + firmwareNumKeys*firmwareSigLen
+	firmwareHeaderLen      = firmwareMagicLen + signingPubkeysDataLen + firmwareDataLen
+	maxFirmwareSize        = 884736
+	firmwareSigsThreshold  = 2
+	firmwareSigningKeysLen = firmwareNumKeys * firmwareSigLen
+)
+
+// rootPubkeys are the root keys of the bootloader per edition, which sign the signing keys, as
+// uncompressed NIST P-256 points without prefix. The key at index i verifies the i-th root
+// signature. No key is known for the second root signature, which the released firmwares do not
+// contain.
+//
+// The root keys of the Multi edition are not included yet, so its firmware files are rejected with
+// ErrFirmwareUnknownSigningKeys.
+var rootPubkeys = map[bitbox02common.Product][firmwareNumKeys]string{
+	bitbox02common.ProductBitBox02BTCOnly: {
+		"e730923f1904d3e83e0ab07f050d8e4e604c46ba36aebbdb9a4d3c96605b9ec39471035c0f8734bdcbe18f0caa6f6e3d8b7fa05e425ac2215e6e97975f48038b",
+		"",
+		"75987e69a5eda53f796316fa4700f99a8636b0a56c5728ee8ad3b3cc8f37e6acfca60823144aeab2e4a7629789d03ea4d2d18abf0fd7a007d796a16557284b3f",
+	},
+}
+
+var (
+	// ErrFirmwareEditionMismatch is returned if the file is not a firmware for the edition of the
+	// device, e.g. a Bitcoin-only firmware for a Multi edition device.
+	ErrFirmwareEditionMismatch = errors.New("firmwareEditionMismatch")
+	// ErrFirmwareUnknownSigningKeys is returned if the signing keys of the firmware are not signed
+	// by the root keys of the edition.
+	ErrFirmwareUnknownSigningKeys = errors.New("firmwareUnknownSigningKeys")
+	// ErrFirmwareInvalidSignature is returned if the firmware does not have enough valid
+	// signatures.
+	ErrFirmwareInvalidSignature = errors.New("firmwareInvalidSignature")
+	// ErrFirmwareDowngrade is returned if the monotonic version of the firmware or its signing keys
+	// is lower than the one installed on the device. The bootloader refuses to install it.
+	ErrFirmwareDowngrade = errors.New("firmwareDowngrade")
+)
+
+// signedFirmware is a parsed signed firmware binary.
+type signedFirmware struct {
+	// binary is the uncompressed signed firmware binary.
+	binary                []byte
+	product               bitbox02common.Product
+	signingPubkeysVersion uint32
+	// signingPubkeysData contains the signing pubkeys version, the pubkeys and their root
+	// signatures.
+	signingPubkeysData []byte
+	firmwareVersion    uint32
+	signatures         []byte
+	firmware           []byte
+}
+
+// parseSignedFirmware parses the signed firmware binary, which can also be gzip compressed, for the
+// edition of the bootloader.
+func parseSignedFirmware(bootloaderDevice *bootloader.Device, binaryData []byte) (
+	*signedFirmware, error) {
+	if bytes.HasPrefix(binaryData, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(binaryData))
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		binaryData, err = io.ReadAll(io.LimitReader(gz, firmwareHeaderLen+maxFirmwareSize+1))
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+	}
+	if len(binaryData) <= firmwareHeaderLen {
+		return nil, errp.New("firmware too small")
+	}
+	if len(binaryData) > firmwareHeaderLen+maxFirmwareSize {
+		return nil, errp.New("firmware too big")
+	}
+	firmwareVersion, err := bootloaderDevice.SignedFirmwareVersion(binaryData)
+	if err != nil {
+		return nil, errp.WithMessage(ErrFirmwareEditionMismatch, err.Error())
+	}
+	signingPubkeysData := binaryData[firmwareMagicLen:][:signingPubkeysDataLen]
+	firmwareData := binaryData[firmwareMagicLen+signingPubkeysDataLen:][:firmwareDataLen]
+	return &signedFirmware{
+		binary:                binaryData,
+		product:               bootloaderDevice.Product(),
+		signingPubkeysVersion: binary.LittleEndian.Uint32(signingPubkeysData[:firmwareVersionLen]),
+		signingPubkeysData:    signingPubkeysData,
+		firmwareVersion:       firmwareVersion,
+		signatures:            firmwareData[firmwareVersionLen:],
+		firmware:              binaryData[firmwareHeaderLen:],
+	}, nil
+}
+
+func (fw *signedFirmware) signingPubkeys() []byte {
+	return fw.signingPubkeysData[firmwareVersionLen:][:firmwareSigningKeysLen]
+}
+
+func (fw *signedFirmware) rootSignatures() []byte {
+	return fw.signingPubkeysData[firmwareVersionLen+firmwareSigningKeysLen:]
+}
+
+func doubleHash(data ...[]byte) []byte {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	first := h.Sum(nil)
+	second := sha256.Sum256(first)
+	return second[:]
+}
+
+// hash returns the firmware hash as computed and displayed by the bootloader:
+// sha256d(firmware version || firmware padded with 0xFF to the max firmware size).
+func (fw *signedFirmware) hash() []byte {
+	versionLE := make([]byte, firmwareVersionLen)
+	binary.LittleEndian.PutUint32(versionLE, fw.firmwareVersion)
+	return doubleHash(
+		versionLE,
+		fw.firmware,
+		bytes.Repeat([]byte{0xFF}, maxFirmwareSize-len(fw.firmware)))
+}
+
+// verifySignature verifies a signature by pubkey of the hash, which the bootloader verifies as
+// the signature of sha256(hash).
+func verifySignature(pubkey []byte, signature []byte, hash []byte) bool {
+	x := new(big.Int).SetBytes(pubkey[:32])
+	y := new(big.Int).SetBytes(pubkey[32:])
+	if !elliptic.P256().IsOnCurve(x, y) {
+		return false
+	}
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	signedHash := sha256.Sum256(hash)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	return ecdsa.Verify(publicKey, signedHash[:], r, s)
+}
+
+// verifySigningPubkeys checks that the signing keys are signed by at least
+// `firmwareSigsThreshold` root keys of the edition. The root keys sign
+// sha256d(signing pubkeys version || signing pubkeys).
+func (fw *signedFirmware) verifySigningPubkeys() error {
+	rootKeys, ok := rootPubkeys[fw.product]
+	if !ok {
+		return errp.WithMessage(ErrFirmwareUnknownSigningKeys, "no root keys known for the edition")
+	}
+	hash := doubleHash(fw.signingPubkeysData[:firmwareVersionLen+firmwareSigningKeysLen])
+	valid := 0
+	for i := 0; i < firmwareNumKeys; i++ {
+		signature := fw.rootSignatures()[i*firmwareSigLen:][:firmwareSigLen]
+		if rootKeys[i] == "" || bytes.Equal(signature, make([]byte, firmwareSigLen)) {
+			continue
+		}
+		pubkey, err := hex.DecodeString(rootKeys[i])
+		if err != nil {
+			panic(err)
+		}
+		if verifySignature(pubkey, signature, hash) {
+			valid++
+		}
+	}
+	if valid < firmwareSigsThreshold {
+		return errp.WithStack(ErrFirmwareUnknownSigningKeys)
+	}
+	return nil
+}
+
+// verifySignatures checks that the firmware is signed by at least `firmwareSigsThreshold` of its
+// signing keys. The signature of the i-th key is the i-th signature.
+func (fw *signedFirmware) verifySignatures() error {
+	hash := fw.hash()
+	valid := 0
+	for i := 0; i < firmwareNumKeys; i++ {
+		pubkey := fw.signingPubkeys()[i*firmwareSigLen:][:firmwareSigLen]
+		signature := fw.signatures[i*firmwareSigLen:][:firmwareSigLen]
+		if bytes.Equal(signature, make([]byte, firmwareSigLen)) {
+			continue
+		}
+		if !verifySignature(pubkey, signature, hash) {
+			return errp.WithStack(ErrFirmwareInvalidSignature)
+		}
+		valid++
+	}
+	if valid < firmwareSigsThreshold {
+		return errp.WithStack(ErrFirmwareInvalidSignature)
+	}
+	return nil
+}
+
+// FirmwareFileInfo describes a signed firmware file that was verified for a device.
+type FirmwareFileInfo struct {
+	Product bitbox02common.Product `json:"product"`
+	// Version is the monotonic firmware version, which is increased with each release.
+	Version uint32 `json:"version"`
+	// InstalledVersion is the monotonic version of the firmware installed on the device.
+	InstalledVersion uint32 `json:"installedVersion"`
+	// Hash is the firmware hash, which the bootloader can display to be compared.
+	Hash string `json:"hash"`
+}
+
+// verifyFirmwareFile verifies that the signed firmware binary can be installed on the device:
+// it must be for the device's edition, its signing keys must be signed by the root keys of the
+// edition, the firmware must be signed by the signing keys, and its versions must not be lower
+// than the installed ones.
+func verifyFirmwareFile(
+	bootloaderDevice *bootloader.Device,
+	binaryData []byte,
+	installedFirmwareVersion uint32,
+	installedSigningPubkeysVersion uint32,
+) (*signedFirmware, *FirmwareFileInfo, error) {
+	fw, err := parseSignedFirmware(bootloaderDevice, binaryData)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := fw.verifySigningPubkeys(); err != nil {
+		return nil, nil, err
+	}
+	if err := fw.verifySignatures(); err != nil {
+		return nil, nil, err
+	}
+	if fw.signingPubkeysVersion < installedSigningPubkeysVersion {
+		return nil, nil, errp.WithMessage(ErrFirmwareDowngrade, fmt.Sprintf(
+			"the signing keys version %d is lower than the installed version %d",
+			fw.signingPubkeysVersion, installedSigningPubkeysVersion))
+	}
+	if fw.firmwareVersion < installedFirmwareVersion {
+		return nil, nil, errp.WithMessage(ErrFirmwareDowngrade, fmt.Sprintf(
+			"the firmware version %d is lower than the installed version %d",
+			fw.firmwareVersion, installedFirmwareVersion))
+	}
+	return fw, &FirmwareFileInfo{
+		Product:          fw.product,
+		Version:          fw.firmwareVersion,
+		InstalledVersion: installedFirmwareVersion,
+		Hash:             fmt.Sprintf("%x", fw.hash()),
+	}, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitbox02bootloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox02-api-go/api/bootloader"
+	bitbox02common "github.com/digitalbitbox/bitbox02-api-go/api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyFirmwareFile(t *testing.T) {
+	multiDevice := bootloader.NewDevice(nil, bitbox02common.ProductBitBox02Multi, nil, nil)
+	btcOnlyDevice := bootloader.NewDevice(nil, bitbox02common.ProductBitBox02BTCOnly, nil, nil)
+	multi, err := bundledFirmware(bitbox02common.ProductBitBox02Multi)
+	require.NoError(t, err)
+	btcOnly, err := bundledFirmware(bitbox02common.ProductBitBox02BTCOnly)
+	require.NoError(t, err)
+
+	fw, info, err := verifyFirmwareFile(btcOnlyDevice, btcOnly, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, btcOnly, fw.binary)
+	require.Equal(t, bitbox02common.ProductBitBox02BTCOnly, info.Product)
+	require.Equal(t, uint32(33), info.Version)
+	require.Len(t, info.Hash, 64)
+
+	// The root keys of the Multi edition are not known.
+	_, _, err = verifyFirmwareFile(multiDevice, multi, 0, 0)
+	require.Equal(t, ErrFirmwareUnknownSigningKeys, errp.Cause(err))
+
+	// Gzip compressed.
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err = gz.Write(btcOnly)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	fw, _, err = verifyFirmwareFile(btcOnlyDevice, compressed.Bytes(), 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, btcOnly, fw.binary)
+
+	// Same version is allowed, e.g. to reinstall the firmware.
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, btcOnly, 33, 2)
+	require.NoError(t, err)
+
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, btcOnly, 34, 0)
+	require.Equal(t, ErrFirmwareDowngrade, errp.Cause(err))
+	require.Contains(t, err.Error(), "the firmware version 33 is lower than the installed version 34")
+
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, btcOnly, 0, 3)
+	require.Equal(t, ErrFirmwareDowngrade, errp.Cause(err))
+
+	_, _, err = verifyFirmwareFile(multiDevice, btcOnly, 0, 0)
+	require.Equal(t, ErrFirmwareEditionMismatch, errp.Cause(err))
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, multi, 0, 0)
+	require.Equal(t, ErrFirmwareEditionMismatch, errp.Cause(err))
+
+	// Tampered firmware.
+	tampered := append([]byte{}, btcOnly...)
+	tampered[len(tampered)-1] ^= 1
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, tampered, 0, 0)
+	require.Equal(t, ErrFirmwareInvalidSignature, errp.Cause(err))
+
+	// Tampered version.
+	tampered = append([]byte{}, btcOnly...)
+	tampered[firmwareMagicLen+signingPubkeysDataLen]++
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, tampered, 0, 0)
+	require.Equal(t, ErrFirmwareInvalidSignature, errp.Cause(err))
+
+	// Unknown signing key.
+	tampered = append([]byte{}, btcOnly...)
+	tampered[firmwareMagicLen+firmwareVersionLen]++
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, tampered, 0, 0)
+	require.Equal(t, ErrFirmwareUnknownSigningKeys, errp.Cause(err))
+
+	// Signed by signing keys which are not signed by the root keys.
+	tampered = append([]byte{}, btcOnly...)
+	signingKeys := tampered[firmwareMagicLen+firmwareVersionLen:][:firmwareSigningKeysLen]
+	signatures := tampered[firmwareMagicLen+signingPubkeysDataLen+firmwareVersionLen:][:firmwareNumKeys*firmwareSigLen]
+	fw, err = parseSignedFirmware(btcOnlyDevice, tampered)
+	require.NoError(t, err)
+	signedHash := sha256.Sum256(fw.hash())
+	for i := 0; i < firmwareNumKeys; i++ {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		privateKey.X.FillBytes(signingKeys[i*firmwareSigLen:][:32])
+		privateKey.Y.FillBytes(signingKeys[i*firmwareSigLen+32:][:32])
+		r, s, err := ecdsa.Sign(rand.Reader, privateKey, signedHash[:])
+		require.NoError(t, err)
+		r.FillBytes(signatures[i*firmwareSigLen:][:32])
+		s.FillBytes(signatures[i*firmwareSigLen+32:][:32])
+	}
+	fw, err = parseSignedFirmware(btcOnlyDevice, tampered)
+	require.NoError(t, err)
+	require.NoError(t, fw.verifySignatures())
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, tampered, 0, 0)
+	require.Equal(t, ErrFirmwareUnknownSigningKeys, errp.Cause(err))
+
+	// The root keys of one edition do not sign the signing keys of the other.
+	tampered = append([]byte{}, multi...)
+	copy(tampered, btcOnly[:firmwareMagicLen])
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, tampered, 0, 0)
+	require.Equal(t, ErrFirmwareUnknownSigningKeys, errp.Cause(err))
+
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, btcOnly[:100], 0, 0)
+	require.Error(t, err)
+	_, _, err = verifyFirmwareFile(btcOnlyDevice, btcOnly[1:], 0, 0)
+	require.Error(t, err)
+}
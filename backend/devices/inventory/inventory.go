@@ -0,0 +1,331 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inventory keeps a persistent record of all devices ever connected to the app, together
+// with an audit log of their connections, attestation results and the wallets (root fingerprints)
+// they provided.
+//
+// Devices are identified by a stable ID, e.g. the noise static pubkey of the BitBox02, so that a
+// device is recognized when plugged into a different USB port. The device identifier, which depends
+// on the USB port, is kept as metadata.
+package inventory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	bucketDevicesKey = "devices"
+	bucketLogKey     = "log"
+
+	// maxLogEntries is the number of audit log entries kept. Older entries are deleted.
+	maxLogEntries = 10000
+)
+
+// EntryType is the type of an audit log entry.
+type EntryType string
+
+const (
+	// EntryConnected is logged when a device is connected.
+	EntryConnected EntryType = "connected"
+	// EntryAttestation is logged when the attestation check of a device completed.
+	EntryAttestation EntryType = "attestation"
+	// EntryKeystore is logged when the keystore (wallet) of a device is registered.
+	EntryKeystore EntryType = "keystore"
+	// EntryAttestationFailed is a warning logged when the attestation check of a device failed,
+	// i.e. the device could not prove that it is a genuine device.
+	EntryAttestationFailed EntryType = "attestationFailed"
+	// EntryRootFingerprintChanged is a warning logged when a known device provides a different
+	// wallet than the last time it was connected, e.g. after a reset or if a different passphrase
+	// was used.
+	EntryRootFingerprintChanged EntryType = "rootFingerprintChanged"
+)
+
+// Entry is an entry of the audit log.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// ID is the stable ID of the device, see Record.ID.
+	ID string `json:"id"`
+	// DeviceID is the device identifier when the entry was logged, see Record.DeviceID.
+	DeviceID string    `json:"deviceID"`
+	Type     EntryType `json:"type"`
+	// Warning is true for entries which should be reviewed by the user.
+	Warning         bool   `json:"warning"`
+	ProductName     string `json:"productName,omitempty"`
+	Product         string `json:"product,omitempty"`
+	FirmwareVersion string `json:"firmwareVersion,omitempty"`
+	Attestation     *bool  `json:"attestation,omitempty"`
+	// RootFingerprint is the hex encoded root fingerprint of the keystore.
+	RootFingerprint string `json:"rootFingerprint,omitempty"`
+	// PreviousRootFingerprint is set for EntryRootFingerprintChanged.
+	PreviousRootFingerprint string `json:"previousRootFingerprint,omitempty"`
+}
+
+// Record is the inventory record of a device.
+type Record struct {
+	// ID is the stable ID of the device, e.g. the hex encoded noise static pubkey of the BitBox02.
+	ID string `json:"id"`
+	// DeviceID is the device identifier when the device was last connected, see
+	// device.Interface.Identifier(). It depends on the USB port.
+	DeviceID    string `json:"deviceID"`
+	ProductName string `json:"productName"`
+	// Product is the edition of the device, e.g. "bitbox02-btconly". Empty if unknown.
+	Product string `json:"product"`
+	// FirmwareVersion is the firmware version the device had when last connected.
+	FirmwareVersion string `json:"firmwareVersion"`
+	// Attestation is the latest attestation result, nil if the device does not support or did not
+	// complete the attestation check.
+	Attestation *bool `json:"attestation"`
+	// AttestationFailed is true if the attestation check of the device ever failed.
+	AttestationFailed bool `json:"attestationFailed"`
+	// RootFingerprint is the hex encoded root fingerprint of the last keystore provided by the
+	// device. Empty if the device never provided a keystore.
+	RootFingerprint string `json:"rootFingerprint"`
+	// RootFingerprints are all hex encoded root fingerprints ever provided by the device, in the
+	// order they were first seen.
+	RootFingerprints []string `json:"rootFingerprints"`
+	// RootFingerprintChanged is true if the device ever provided a different keystore than the time
+	// before.
+	RootFingerprintChanged bool      `json:"rootFingerprintChanged"`
+	FirstSeen              time.Time `json:"firstSeen"`
+	LastSeen               time.Time `json:"lastSeen"`
+}
+
+// Store persists the device inventory and audit log in a bbolt db.
+type Store struct {
+	db  *bbolt.DB
+	now func() time.Time
+	// maxLogEntries is the number of audit log entries kept.
+	maxLogEntries uint64
+}
+
+// NewStore opens or creates the database in the given file.
+func NewStore(dbFilename string) (*Store, error) {
+	db, err := bbolt.Open(dbFilename, 0600, nil)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return &Store{db: db, now: time.Now, maxLogEntries: maxLogEntries}, nil
+}
+
+// Close closes the database.
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
+// update loads the record of the device with the given ID, creating a new one if the device is
+// unknown, applies `f` to it, stores it and appends the log entries returned by `f`. The entries
+// returned by `f` only need to have the type and type specific fields set. The oldest log entries
+// are deleted so that at most `maxLogEntries` are kept.
+func (store *Store) update(id string, f func(record *Record) []*Entry) ([]*Entry, error) {
+	now := store.now()
+	var entries []*Entry
+	err := store.db.Update(func(tx *bbolt.Tx) error {
+		devicesBucket, err := tx.CreateBucketIfNotExists([]byte(bucketDevicesKey))
+		if err != nil {
+			return err
+		}
+		logBucket, err := tx.CreateBucketIfNotExists([]byte(bucketLogKey))
+		if err != nil {
+			return err
+		}
+		record := &Record{
+			ID:               id,
+			RootFingerprints: []string{},
+			FirstSeen:        now,
+		}
+		if value := devicesBucket.Get([]byte(id)); value != nil {
+			if err := json.Unmarshal(value, record); err != nil {
+				return err
+			}
+		}
+		record.LastSeen = now
+		entries = f(record)
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := devicesBucket.Put([]byte(id), value); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entry.Time = now
+			entry.ID = id
+			entry.DeviceID = record.DeviceID
+			value, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			sequence, err := logBucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, sequence)
+			if err := logBucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return store.pruneLog(logBucket)
+	})
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return entries, nil
+}
+
+// pruneLog deletes the oldest log entries so that at most `maxLogEntries` are kept. The keys are
+// the sequence numbers of the entries.
+func (store *Store) pruneLog(logBucket *bbolt.Bucket) error {
+	sequence := logBucket.Sequence()
+	if sequence <= store.maxLogEntries {
+		return nil
+	}
+	minKey := make([]byte, 8)
+	binary.BigEndian.PutUint64(minKey, sequence-store.maxLogEntries+1)
+	cursor := logBucket.Cursor()
+	for key, _ := cursor.First(); key != nil && bytes.Compare(key, minKey) < 0; key, _ = cursor.Next() {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Connected records that the device with the given stable ID was connected with the given device
+// identifier.
+func (store *Store) Connected(id string, deviceID string, productName string) error {
+	_, err := store.update(id, func(record *Record) []*Entry {
+		record.DeviceID = deviceID
+		record.ProductName = productName
+		return []*Entry{{Type: EntryConnected, ProductName: productName}}
+	})
+	return err
+}
+
+// Attested records the result of the attestation check of the device, together with its edition
+// and firmware version. The returned entries contain an EntryAttestationFailed warning if the
+// attestation failed.
+func (store *Store) Attested(
+	id string, product string, firmwareVersion string, attestation bool,
+) ([]*Entry, error) {
+	return store.update(id, func(record *Record) []*Entry {
+		record.Product = product
+		record.FirmwareVersion = firmwareVersion
+		record.Attestation = &attestation
+		entries := []*Entry{{
+			Type:            EntryAttestation,
+			Product:         product,
+			FirmwareVersion: firmwareVersion,
+			Attestation:     &attestation,
+		}}
+		if !attestation {
+			record.AttestationFailed = true
+			entries = append(entries, &Entry{
+				Type:            EntryAttestationFailed,
+				Warning:         true,
+				Product:         product,
+				FirmwareVersion: firmwareVersion,
+			})
+		}
+		return entries
+	})
+}
+
+// KeystoreRegistered records that the device provided the keystore with the given root
+// fingerprint. The returned entries contain an EntryRootFingerprintChanged warning if the device
+// provided a different keystore the last time.
+func (store *Store) KeystoreRegistered(id string, rootFingerprint []byte) ([]*Entry, error) {
+	fingerprint := hex.EncodeToString(rootFingerprint)
+	return store.update(id, func(record *Record) []*Entry {
+		entries := []*Entry{{Type: EntryKeystore, RootFingerprint: fingerprint}}
+		if record.RootFingerprint != "" && record.RootFingerprint != fingerprint {
+			record.RootFingerprintChanged = true
+			entries = append(entries, &Entry{
+				Type:                    EntryRootFingerprintChanged,
+				Warning:                 true,
+				RootFingerprint:         fingerprint,
+				PreviousRootFingerprint: record.RootFingerprint,
+			})
+		}
+		record.RootFingerprint = fingerprint
+		for _, seen := range record.RootFingerprints {
+			if seen == fingerprint {
+				return entries
+			}
+		}
+		record.RootFingerprints = append(record.RootFingerprints, fingerprint)
+		return entries
+	})
+}
+
+// Devices returns the records of all devices ever connected, most recently seen first.
+func (store *Store) Devices() ([]*Record, error) {
+	records := []*Record{}
+	err := store.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketDevicesKey))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, value []byte) error {
+			record := &Record{}
+			if err := json.Unmarshal(value, record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].LastSeen.After(records[j].LastSeen)
+	})
+	return records, nil
+}
+
+// Log returns the audit log, oldest entry first. If id is not empty, only the entries of the device
+// with this stable ID are returned.
+func (store *Store) Log(id string) ([]*Entry, error) {
+	entries := []*Entry{}
+	err := store.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketLogKey))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, value []byte) error {
+			entry := &Entry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				return err
+			}
+			if id == "" || entry.ID == id {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(filepath.Join(test.TstTempDir("TestInventoryStore"), "db"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, store.Close()) }()
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	records, err := store.Devices()
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	require.NoError(t, store.Connected("device1", "usb1", "bitbox02"))
+	entries, err := store.Attested("device1", "bitbox02-multi", "9.15.0", true)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.False(t, entries[0].Warning)
+	entries, err = store.KeystoreRegistered("device1", []byte{1, 2, 3, 4})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	firstSeen := now
+	now = now.Add(time.Hour)
+	require.NoError(t, store.Connected("device2", "usb2", "bitbox02"))
+	entries, err = store.Attested("device2", "bitbox02-btconly", "9.14.0", false)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, EntryAttestationFailed, entries[1].Type)
+	require.True(t, entries[1].Warning)
+	require.Equal(t, "device2", entries[1].ID)
+	require.Equal(t, "usb2", entries[1].DeviceID)
+
+	// Device 1 reconnects with the same wallet.
+	now = now.Add(time.Hour)
+	require.NoError(t, store.Connected("device1", "usb1", "bitbox02"))
+	entries, err = store.KeystoreRegistered("device1", []byte{1, 2, 3, 4})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// Device 1 reconnects on a different USB port with a different wallet.
+	now = now.Add(time.Hour)
+	require.NoError(t, store.Connected("device1", "usb3", "bitbox02"))
+	entries, err = store.KeystoreRegistered("device1", []byte{5, 6, 7, 8})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, EntryRootFingerprintChanged, entries[1].Type)
+	require.True(t, entries[1].Warning)
+	require.Equal(t, "01020304", entries[1].PreviousRootFingerprint)
+	require.Equal(t, "05060708", entries[1].RootFingerprint)
+
+	records, err = store.Devices()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "device1", records[0].ID)
+	require.Equal(t, "usb3", records[0].DeviceID)
+	require.Equal(t, "bitbox02-multi", records[0].Product)
+	require.Equal(t, "9.15.0", records[0].FirmwareVersion)
+	require.Equal(t, true, *records[0].Attestation)
+	require.False(t, records[0].AttestationFailed)
+	require.Equal(t, "05060708", records[0].RootFingerprint)
+	require.Equal(t, []string{"01020304", "05060708"}, records[0].RootFingerprints)
+	require.True(t, records[0].RootFingerprintChanged)
+	require.Equal(t, firstSeen, records[0].FirstSeen)
+	require.Equal(t, now, records[0].LastSeen)
+	require.Equal(t, "device2", records[1].ID)
+	require.True(t, records[1].AttestationFailed)
+	require.Empty(t, records[1].RootFingerprints)
+
+	log, err := store.Log("")
+	require.NoError(t, err)
+	require.Len(t, log, 11)
+	require.Equal(t, EntryConnected, log[0].Type)
+	require.Equal(t, "device1", log[0].ID)
+	require.Equal(t, "usb1", log[0].DeviceID)
+	require.Equal(t, "usb3", log[len(log)-1].DeviceID)
+	require.Equal(t, firstSeen, log[0].Time)
+
+	log, err = store.Log("device2")
+	require.NoError(t, err)
+	require.Len(t, log, 3)
+	for _, entry := range log {
+		require.Equal(t, "device2", entry.ID)
+	}
+}
+
+func TestStoreMaxLogEntries(t *testing.T) {
+	store, err := NewStore(filepath.Join(test.TstTempDir("TestInventoryStore"), "db"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, store.Close()) }()
+	store.maxLogEntries = 3
+
+	for _, productName := range []string{"1", "2", "3", "4", "5"} {
+		require.NoError(t, store.Connected("device1", "usb1", productName))
+	}
+	log, err := store.Log("")
+	require.NoError(t, err)
+	require.Len(t, log, 3)
+	for i, entry := range log {
+		require.Equal(t, []string{"3", "4", "5"}[i], entry.ProductName)
+	}
+}
@@ -203,13 +203,17 @@ func (manager *Manager) makeBitBox02(deviceInfo DeviceInfo) (*bitbox02.Device, e
 	if err != nil {
 		return nil, errp.WithMessage(err, "Failed to open device")
 	}
-	return bitbox02.NewDevice(
+	device := bitbox02.NewDevice(
 		deviceID,
 		version,
 		product,
 		bitbox02.NewConfig(manager.bitbox02ConfigDir),
 		u2fhid.NewCommunication(hidDevice, bitboxCMD),
-	), nil
+	)
+	if _, ok := deviceInfo.(simulatorDeviceInfo); ok {
+		device.SetSimulator()
+	}
+	return device, nil
 }
 
 func (manager *Manager) makeBitBox02Bootloader(deviceInfo DeviceInfo) (
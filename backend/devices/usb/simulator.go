@@ -0,0 +1,220 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usb
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	bitbox02common "github.com/digitalbitbox/bitbox02-api-go/api/common"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSimulatorAddress is the address the BitBox02 firmware simulator listens on by default.
+const DefaultSimulatorAddress = "127.0.0.1:15423"
+
+const (
+	// simulatorDialTimeout is the timeout for connecting to the simulator. The simulator runs
+	// locally, so it should accept connections immediately.
+	simulatorDialTimeout = 200 * time.Millisecond
+	// simulatorProbeInterval is the time to wait after the simulator could not be reached or the
+	// connection was lost before trying to connect again.
+	simulatorProbeInterval = 5 * time.Second
+)
+
+// Simulator provides access to a BitBox02 firmware simulator, which exchanges the same 64 byte HID
+// reports as the real device over a TCP connection. The simulator is initialized with a fixed seed
+// and confirms all prompts automatically.
+//
+// Simulator.DeviceInfos can be added to the device infos returned by the environment, so that the
+// simulator is registered like a BitBox02 plugged in via USB.
+type Simulator struct {
+	address string
+	// serial is the HID serial of the simulated device, which contains the firmware version.
+	serial string
+
+	mu sync.Mutex
+	// conn is the open connection, nil if the device is not opened.
+	conn *simulatorConn
+	// probed is the connection established when probing the simulator, which is used when the
+	// device is opened. nil if the simulator was not probed successfully or the device was opened.
+	probed net.Conn
+	// nextProbe is the time after which the simulator is probed again.
+	nextProbe time.Time
+
+	log *logrus.Entry
+}
+
+// NewSimulator creates a Simulator connecting to the simulator at the given address, e.g.
+// `DefaultSimulatorAddress`. version is the firmware version of the simulator, e.g. "9.15.0".
+func NewSimulator(address string, version string) *Simulator {
+	return &Simulator{
+		address: address,
+		serial:  "v" + version,
+		log:     logging.Get().WithGroup("simulator").WithField("address", address),
+	}
+}
+
+// DeviceInfos returns the simulated device if the simulator is reachable. If the device is not
+// opened, the simulator is probed by connecting to it, at most once every
+// `simulatorProbeInterval`. The device is not returned anymore after the connection to the
+// simulator was lost, so that the device is unregistered.
+func (simulator *Simulator) DeviceInfos() []DeviceInfo {
+	simulator.mu.Lock()
+	defer simulator.mu.Unlock()
+	deviceInfos := []DeviceInfo{simulatorDeviceInfo{simulator: simulator}}
+	if simulator.conn != nil {
+		if !simulator.conn.isBroken() {
+			return deviceInfos
+		}
+		simulator.log.Debug("Connection to the simulator lost")
+		_ = simulator.conn.Close()
+		simulator.conn = nil
+		simulator.nextProbe = time.Now().Add(simulatorProbeInterval)
+		return nil
+	}
+	if simulator.probed != nil {
+		return deviceInfos
+	}
+	if time.Now().Before(simulator.nextProbe) {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", simulator.address, simulatorDialTimeout)
+	if err != nil {
+		simulator.log.WithError(err).Debug("Simulator not reachable")
+		simulator.nextProbe = time.Now().Add(simulatorProbeInterval)
+		return nil
+	}
+	simulator.log.Debug("Simulator reachable")
+	simulator.probed = conn
+	return deviceInfos
+}
+
+// open returns the connection established when probing the simulator, or connects to the
+// simulator if it was not probed.
+func (simulator *Simulator) open() (io.ReadWriteCloser, error) {
+	simulator.mu.Lock()
+	defer simulator.mu.Unlock()
+	conn := simulator.probed
+	simulator.probed = nil
+	if conn == nil {
+		var err error
+		conn, err = net.DialTimeout("tcp", simulator.address, simulatorDialTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	simulator.conn = &simulatorConn{conn: conn}
+	return simulator.conn, nil
+}
+
+// simulatorConn reads full HID reports from the TCP connection and remembers if the connection
+// failed.
+type simulatorConn struct {
+	conn net.Conn
+
+	mu     sync.Mutex
+	broken bool
+	closed bool
+}
+
+func (conn *simulatorConn) isBroken() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.broken
+}
+
+func (conn *simulatorConn) checkErr(err error) {
+	if err != nil {
+		conn.mu.Lock()
+		conn.broken = true
+		conn.mu.Unlock()
+	}
+}
+
+// Read implements io.Reader. Unlike reading from a HID device, a TCP read can return only part of
+// a report, so we read until p is full.
+func (conn *simulatorConn) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(conn.conn, p)
+	conn.checkErr(err)
+	return n, err
+}
+
+// Write implements io.Writer.
+func (conn *simulatorConn) Write(p []byte) (int, error) {
+	n, err := conn.conn.Write(p)
+	conn.checkErr(err)
+	return n, err
+}
+
+// Close implements io.Closer. It can be called multiple times.
+func (conn *simulatorConn) Close() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.broken = true
+	if conn.closed {
+		return nil
+	}
+	conn.closed = true
+	_ = conn.conn.Close()
+	return nil
+}
+
+type simulatorDeviceInfo struct {
+	simulator *Simulator
+}
+
+// VendorID implements DeviceInfo.
+func (info simulatorDeviceInfo) VendorID() int {
+	return bitbox02VendorID
+}
+
+// ProductID implements DeviceInfo.
+func (info simulatorDeviceInfo) ProductID() int {
+	return bitbox02ProductID
+}
+
+// UsagePage implements DeviceInfo.
+func (info simulatorDeviceInfo) UsagePage() int {
+	return 0xffff
+}
+
+// Interface implements DeviceInfo.
+func (info simulatorDeviceInfo) Interface() int {
+	return 0
+}
+
+// Serial implements DeviceInfo.
+func (info simulatorDeviceInfo) Serial() string {
+	return info.simulator.serial
+}
+
+// Product implements DeviceInfo.
+func (info simulatorDeviceInfo) Product() string {
+	return bitbox02common.FirmwareHIDProductStringStandard
+}
+
+// Identifier implements DeviceInfo.
+func (info simulatorDeviceInfo) Identifier() string {
+	return "simulator-" + info.simulator.address
+}
+
+// Open implements DeviceInfo.
+func (info simulatorDeviceInfo) Open() (io.ReadWriteCloser, error) {
+	return info.simulator.open()
+}
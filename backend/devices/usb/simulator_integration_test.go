@@ -0,0 +1,157 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usb
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/digitalbitbox/bitbox02-api-go/api/firmware"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSimulator returns a simulator to run integration tests against. The test is skipped
+// unless BITBOX02_SIMULATOR is set to the path of the simulator binary, which is started, or
+// BITBOX02_SIMULATOR_ADDRESS is set to the address of a running simulator.
+// BITBOX02_SIMULATOR_VERSION can be set to the firmware version of the simulator.
+func newTestSimulator(t *testing.T) *Simulator {
+	t.Helper()
+	binary := os.Getenv("BITBOX02_SIMULATOR")
+	address := os.Getenv("BITBOX02_SIMULATOR_ADDRESS")
+	if binary == "" && address == "" {
+		t.Skip("BITBOX02_SIMULATOR or BITBOX02_SIMULATOR_ADDRESS not set")
+	}
+	if address == "" {
+		address = DefaultSimulatorAddress
+	}
+	version := os.Getenv("BITBOX02_SIMULATOR_VERSION")
+	if version == "" {
+		version = "9.15.0"
+	}
+	if binary != "" {
+		cmd := exec.Command(binary)
+		require.NoError(t, cmd.Start())
+		t.Cleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+	}
+	return NewSimulator(address, version)
+}
+
+// TestSimulatorSignBTCTransaction pairs with the simulator and signs a transaction with the
+// BitBox02 keystore. The simulator confirms all prompts automatically.
+func TestSimulatorSignBTCTransaction(t *testing.T) {
+	simulator := newTestSimulator(t)
+
+	// Wait for the simulator to accept connections.
+	var deviceInfos []DeviceInfo
+	require.Eventually(t, func() bool {
+		simulator.mu.Lock()
+		simulator.nextProbe = time.Time{}
+		simulator.mu.Unlock()
+		deviceInfos = simulator.DeviceInfos()
+		return len(deviceInfos) == 1
+	}, 10*time.Second, 100*time.Millisecond)
+
+	manager := NewManager(t.TempDir(), t.TempDir(), socksproxy.NewSocksProxy(false, ""),
+		simulator.DeviceInfos, nil, nil)
+	device, err := manager.makeBitBox02(deviceInfos[0])
+	require.NoError(t, err)
+	defer device.Close()
+	// In testing mode, the pairing is confirmed automatically.
+	require.NoError(t, device.Init(true))
+	require.Eventually(t, func() bool {
+		return device.Status() == firmware.StatusInitialized
+	}, 30*time.Second, 100*time.Millisecond)
+	keystore := device.Keystore()
+	require.NotNil(t, keystore)
+
+	tbtc := btc.NewCoin(coinpkg.CodeTBTC, "Bitcoin Testnet", "TBTC", coinpkg.BtcUnitDefault,
+		&chaincfg.TestNet3Params, t.TempDir(), []*config.ServerInfo{}, "",
+		socksproxy.NewSocksProxy(false, ""))
+	rootFingerprint, err := keystore.RootFingerprint()
+	require.NoError(t, err)
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/1'/0'")
+	require.NoError(t, err)
+	xpub, err := keystore.ExtendedPublicKey(tbtc, keypath)
+	require.NoError(t, err)
+	configuration := signing.NewBitcoinConfiguration(
+		signing.ScriptTypeP2WPKH, rootFingerprint, keypath, xpub)
+	log := logging.Get().WithGroup("simulator_integration_test")
+	inputAddress := addresses.NewAccountAddress(configuration,
+		signing.NewEmptyRelativeKeypath().Child(0, false).Child(0, false), tbtc.Net(), log)
+	recipient := addresses.NewAccountAddress(configuration,
+		signing.NewEmptyRelativeKeypath().Child(0, false).Child(1, false), tbtc.Net(), log)
+
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(100000, inputAddress.PubkeyScript()))
+	prevTxHash := prevTx.TxHash()
+	outPoint := wire.NewOutPoint(&prevTxHash, 0)
+	previousOutputs := maketx.PreviousOutputs{
+		*outPoint: &transactions.SpendableOutput{TxOut: prevTx.TxOut[0]},
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(outPoint, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, recipient.PubkeyScript()))
+
+	proposedTx := &btc.ProposedTransaction{
+		TXProposal: &maketx.TxProposal{
+			Coin:            tbtc,
+			Transaction:     tx,
+			PreviousOutputs: previousOutputs,
+		},
+		AccountSigningConfigurations: []*signing.Configuration{configuration},
+		GetAddress: func(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
+			if scriptHashHex == inputAddress.PubkeyScriptHashHex() {
+				return inputAddress
+			}
+			return nil
+		},
+		GetPrevTx: func(hash chainhash.Hash) (*wire.MsgTx, error) {
+			require.Equal(t, prevTxHash, hash)
+			return prevTx, nil
+		},
+		Signatures: make([]*types.Signature, len(tx.TxIn)),
+		SigHashes:  txscript.NewTxSigHashes(tx, previousOutputs),
+	}
+	require.NoError(t, keystore.SignTransaction(proposedTx))
+
+	tx.TxIn[0].SignatureScript, tx.TxIn[0].Witness = inputAddress.SignatureScript(
+		*proposedTx.Signatures[0])
+	engine, err := txscript.NewEngine(prevTx.TxOut[0].PkScript, tx, 0,
+		txscript.StandardVerifyFlags, nil, proposedTx.SigHashes, prevTx.TxOut[0].Value,
+		previousOutputs)
+	require.NoError(t, err)
+	require.NoError(t, engine.Execute())
+}
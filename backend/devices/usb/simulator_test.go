@@ -0,0 +1,90 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usb
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulator(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		accepted <- conn
+	}()
+
+	simulator := NewSimulator(listener.Addr().String(), "9.15.0")
+	deviceInfos := simulator.DeviceInfos()
+	require.Len(t, deviceInfos, 1)
+	deviceInfo := deviceInfos[0]
+	require.True(t, isBitBox02(deviceInfo))
+	require.Equal(t, "v9.15.0", deviceInfo.Serial())
+	// The connection of the probe is used when opening the device.
+	server := <-accepted
+	device, err := deviceInfo.Open()
+	require.NoError(t, err)
+
+	// A report sent in two parts is read as a whole.
+	report := make([]byte, 64)
+	report[0] = 1
+	report[63] = 2
+	go func() {
+		_, _ = server.Write(report[:10])
+		_, _ = server.Write(report[10:])
+	}()
+	read := make([]byte, 64)
+	n, err := device.Read(read)
+	require.NoError(t, err)
+	require.Equal(t, 64, n)
+	require.Equal(t, report, read)
+
+	// The device is removed after the simulator closed the connection, and the simulator is not
+	// probed again until the probe interval passed.
+	require.NoError(t, server.Close())
+	_, err = device.Read(read)
+	require.Error(t, err)
+	require.Empty(t, simulator.DeviceInfos())
+	require.Empty(t, simulator.DeviceInfos())
+	require.NoError(t, device.Close())
+
+	simulator.nextProbe = time.Time{}
+	go func() {
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		accepted <- conn
+	}()
+	require.Len(t, simulator.DeviceInfos(), 1)
+	require.NoError(t, (<-accepted).Close())
+}
+
+func TestSimulatorUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	simulator := NewSimulator(address, "9.15.0")
+	require.Empty(t, simulator.DeviceInfos())
+	require.True(t, simulator.nextProbe.After(time.Now()))
+}
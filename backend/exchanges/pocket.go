@@ -20,6 +20,7 @@ import (
 	"net/http"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
@@ -76,7 +77,8 @@ func PocketURL(devServers bool, locale string) string {
 // IsPocketSupported is true if coin.Code is supported by Pocket.
 func IsPocketSupported(account accounts.Interface) bool {
 	coinCode := account.Coin().Code()
-	canSign := account.Config().Keystore.CanSignMessage(coinCode)
+	keystore := account.Config().Keystore
+	canSign := keystore != nil && keystore.CanSignMessage(coinCode)
 	// Pocket would also support tbtc, but at the moment testnet address signing is disabled on firmware.
 	return (coinCode == coin.CodeBTC || coinCode == coin.CodeTBTC) && canSign
 }
@@ -151,6 +153,9 @@ func PocketWidgetSignAddress(account accounts.Interface, message string, format
 	}
 	addr := unused[signingConfigIdx].Addresses[0]
 
+	if account.Config().Keystore == nil {
+		return "", "", errp.WithStack(errors.ErrKeystoreNotConnected)
+	}
 	sig, err := account.Config().Keystore.SignBTCMessage(
 		[]byte(message),
 		addr.AbsoluteKeypath(),
@@ -0,0 +1,106 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/export"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// ExportArgs configure a portfolio-wide transaction export.
+type ExportArgs struct {
+	Format export.Format
+	Filter export.Filter
+	// AccountCodes are the accounts to export. All active accounts, including ERC20 token accounts,
+	// are exported if empty.
+	AccountCodes []accountsTypes.Code
+}
+
+// ExportTransactions exports the transactions of multiple accounts into one file, with fiat
+// values in the main fiat currency. The user is asked where to save the file, which is opened
+// afterwards. The returned path is empty if the user aborted.
+func (backend *Backend) ExportTransactions(args ExportArgs) (string, error) {
+	exporter, err := export.Lookup(args.Format)
+	if err != nil {
+		return "", err
+	}
+	selected := map[accountsTypes.Code]bool{}
+	for _, code := range args.AccountCodes {
+		selected[code] = true
+	}
+	fiat := backend.Config().AppConfig().Backend.MainFiat
+	inputs := []*export.Input{}
+	for _, account := range backend.Accounts() {
+		if account.Config().Config.Inactive || account.FatalError() {
+			continue
+		}
+		if len(selected) > 0 && !selected[account.Config().Config.Code] {
+			continue
+		}
+		if err := account.Initialize(); err != nil {
+			return "", err
+		}
+		transactions, err := account.Transactions()
+		if err != nil {
+			return "", err
+		}
+		inputs = append(inputs, &export.Input{
+			Account:      account,
+			Transactions: args.Filter.Apply(transactions),
+			Rates:        backend.RatesUpdater(),
+			Fiat:         fiat,
+		})
+	}
+	if len(inputs) == 0 {
+		return "", errp.New("no accounts to export")
+	}
+
+	name := fmt.Sprintf("%s-portfolio-export", time.Now().Format("2006-01-02-at-15-04-05"))
+	if args.Format != "" && args.Format != export.FormatCSV {
+		name += "-" + string(args.Format)
+	}
+	name += "." + exporter.FileExtension()
+	downloadsDir, err := config.DownloadsDir()
+	if err != nil {
+		return "", err
+	}
+	path := backend.environment.GetSaveFilename(filepath.Join(downloadsDir, name))
+	if path == "" {
+		return "", nil
+	}
+	backend.log.Infof("Export transactions of %d accounts to %s.", len(inputs), path)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", errp.WithStack(err)
+	}
+	if err := exporter.Export(file, inputs); err != nil {
+		_ = file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", errp.WithStack(err)
+	}
+	if err := backend.environment.SystemOpen(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/external"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+)
+
+// connectedExternalSigner is a running external signer registered as a keystore.
+type connectedExternalSigner struct {
+	process  *external.Process
+	keystore *external.Keystore
+}
+
+// ExternalSigner describes a configured external signer.
+type ExternalSigner struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	// SignerName and RootFingerprint are reported by the signer, and only set if it is connected.
+	SignerName      string `json:"signerName,omitempty"`
+	RootFingerprint string `json:"rootFingerprint,omitempty"`
+}
+
+func (backend *Backend) notifyExternalSignersChanged() {
+	backend.Notify(observable.Event{
+		Subject: "external-signers",
+		Action:  action.Reload,
+	})
+}
+
+// externalSignersConfig returns the external signers configured in the external signers file, see
+// config.ReadExternalSigners().
+func (backend *Backend) externalSignersConfig() []config.ExternalSigner {
+	signers, err := config.ReadExternalSigners(backend.arguments.ExternalSignersFilename())
+	if err != nil {
+		backend.log.WithError(err).Error("could not read the external signers")
+		return []config.ExternalSigner{}
+	}
+	return signers
+}
+
+// ExternalSigners returns the configured external signers.
+func (backend *Backend) ExternalSigners() []ExternalSigner {
+	signersConfig := backend.externalSignersConfig()
+	defer backend.accountsAndKeystoreLock.RLock()()
+	result := []ExternalSigner{}
+	for _, signerConfig := range signersConfig {
+		signer := ExternalSigner{Name: signerConfig.Name}
+		if connected, ok := backend.externalSigners[signerConfig.Name]; ok {
+			info := connected.keystore.Info()
+			signer.Connected = true
+			signer.SignerName = info.Name
+			signer.RootFingerprint = info.RootFingerprint
+		}
+		result = append(result, signer)
+	}
+	return result
+}
+
+// ConnectExternalSigner starts the configured external signer with the given name and registers it
+// as a keystore. The keystore is deregistered when the signer process exits.
+//
+// The signer is started and queried without holding the accountsAndKeystoreLock, so that a slow
+// signer does not block the accounts.
+func (backend *Backend) ConnectExternalSigner(name string) error {
+	var signerConfig *config.ExternalSigner
+	for _, cfg := range backend.externalSignersConfig() {
+		if cfg.Name == name {
+			cfg := cfg
+			signerConfig = &cfg
+			break
+		}
+	}
+	if signerConfig == nil {
+		return errp.Newf("unknown external signer %q", name)
+	}
+	log := backend.log.WithField("externalSigner", name)
+
+	isConnected := func() bool {
+		_, ok := backend.externalSigners[name]
+		return ok
+	}
+	alreadyConnected := func() bool {
+		defer backend.accountsAndKeystoreLock.RLock()()
+		return isConnected()
+	}()
+	if alreadyConnected {
+		return errp.Newf("external signer %q is already connected", name)
+	}
+	process, err := external.StartProcess(signerConfig.Command, signerConfig.Args, log,
+		func(process *external.Process) {
+			// Run in a goroutine as the process can exit while we hold the lock, e.g. in
+			// DisconnectExternalSigner().
+			go backend.externalSignerExited(name, process)
+		})
+	if err != nil {
+		return err
+	}
+	keystore, err := external.NewKeystore(process, log)
+	if err != nil {
+		process.Stop()
+		return err
+	}
+
+	defer backend.accountsAndKeystoreLock.Lock()()
+	if isConnected() {
+		process.Stop()
+		return errp.Newf("external signer %q is already connected", name)
+	}
+	// If the process exited before it was registered, externalSignerExited() did not find it.
+	if process.Exited() {
+		return errp.Newf("external signer %q exited", name)
+	}
+	connected := &connectedExternalSigner{process: process, keystore: keystore}
+	backend.externalSigners[name] = connected
+	log.Info("connected external signer")
+	backend.addKeystore(keystore)
+	backend.notifyExternalSignersChanged()
+	return nil
+}
+
+// externalSignerExited deregisters the keystore of the external signer after its process exited.
+func (backend *Backend) externalSignerExited(name string, process *external.Process) {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	connected, ok := backend.externalSigners[name]
+	if !ok || connected.process != process {
+		return
+	}
+	delete(backend.externalSigners, name)
+	backend.removeExternalSignerKeystore(connected)
+	backend.notifyExternalSignersChanged()
+}
+
+// removeExternalSignerKeystore deregisters the keystore of the signer if it is still registered,
+// i.e. if it was not replaced by another keystore with the same root fingerprint.
+// The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) removeExternalSignerKeystore(connected *connectedExternalSigner) {
+	rootFingerprint, err := connected.keystore.RootFingerprint()
+	if err != nil {
+		return
+	}
+	if backend.keystores.get(rootFingerprint) == connected.keystore {
+		backend.removeKeystore(rootFingerprint)
+	}
+}
+
+// DisconnectExternalSigner deregisters the keystore of the external signer and stops its process.
+func (backend *Backend) DisconnectExternalSigner(name string) error {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	connected, ok := backend.externalSigners[name]
+	if !ok {
+		return errp.Newf("external signer %q is not connected", name)
+	}
+	delete(backend.externalSigners, name)
+	backend.removeExternalSignerKeystore(connected)
+	connected.process.Stop()
+	backend.log.WithField("externalSigner", name).
+		WithField("rootFingerprint", connected.keystore.Info().RootFingerprint).
+		Info("disconnected external signer")
+	backend.notifyExternalSignersChanged()
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// validateFiats checks that the fiats added to the fiat list and a changed main fiat are supported
+// by the rates updater, see `rates.RateUpdater.SupportedQuotes()`. Fiats which are configured
+// already are kept even if they are currently not supported, e.g. because the supported quotes
+// could not be fetched while offline. The returned function reports whether a fiat is supported or
+// configured already, and is used to validate the fiats of the alerts.
+func (backend *Backend) validateFiats(
+	oldConfig, newConfig *config.Backend) (func(string) bool, error) {
+	ratesUpdater := backend.RatesUpdater()
+	configured := map[string]bool{}
+	for _, fiat := range append([]string{oldConfig.MainFiat}, oldConfig.FiatList...) {
+		configured[fiat] = true
+	}
+	isKnownFiat := func(fiat string) bool {
+		return fiat != "" && (configured[fiat] || ratesUpdater.IsSupportedQuote(fiat))
+	}
+	for _, fiat := range newConfig.FiatList {
+		if !isKnownFiat(fiat) {
+			return nil, errp.Newf("unsupported fiat %q", fiat)
+		}
+	}
+	if mainFiat := newConfig.MainFiat; mainFiat != "" && !isKnownFiat(mainFiat) {
+		return nil, errp.Newf("unsupported main fiat %q", mainFiat)
+	}
+	return isKnownFiat, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAppConfigFiats(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	appConfig := b.Config().AppConfig()
+	appConfig.Backend.FiatList = []string{"USD", "NOTAFIAT", "EUR"}
+	require.Error(t, b.SetAppConfig(appConfig))
+	appConfig.Backend.FiatList = []string{"USD"}
+	appConfig.Backend.MainFiat = "NOTAFIAT"
+	require.Error(t, b.SetAppConfig(appConfig))
+	require.Equal(t, "USD", b.Config().AppConfig().Backend.MainFiat)
+
+	appConfig.Backend.FiatList = []string{"USD", "CHF", "USDT"}
+	appConfig.Backend.MainFiat = "USDT"
+	require.NoError(t, b.SetAppConfig(appConfig))
+	require.Equal(t, []string{"USD", "CHF", "USDT"}, b.Config().AppConfig().Backend.FiatList)
+	require.Equal(t, "USDT", b.Config().AppConfig().Backend.MainFiat)
+}
+
+func TestSetAppConfigKeepsConfiguredFiats(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	// Fiats which are configured already, but currently not supported, e.g. because the supported
+	// quotes could not be fetched.
+	appConfig := b.Config().AppConfig()
+	appConfig.Backend.FiatList = []string{"USD", "NOTAFIAT"}
+	appConfig.Backend.MainFiat = "NOTAFIAT"
+	require.NoError(t, b.config.SetAppConfig(appConfig))
+
+	appConfig.Backend.Alerts = []config.Alert{
+		{ID: "1", Type: config.AlertTypePortfolioChange, Fiat: "NOTAFIAT", Threshold: "5"},
+	}
+	require.NoError(t, b.SetAppConfig(appConfig))
+	require.Equal(t, []string{"USD", "NOTAFIAT"}, b.Config().AppConfig().Backend.FiatList)
+	require.Equal(t, "NOTAFIAT", b.Config().AppConfig().Backend.MainFiat)
+
+	appConfig.Backend.FiatList = []string{"USD", "NOTAFIAT", "ALSONOTAFIAT"}
+	require.Error(t, b.SetAppConfig(appConfig))
+	appConfig.Backend.FiatList = []string{"USD", "NOTAFIAT"}
+	appConfig.Backend.MainFiat = "ALSONOTAFIAT"
+	require.Error(t, b.SetAppConfig(appConfig))
+}
@@ -17,19 +17,28 @@ package handlers
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math/big"
 	"net/http"
 	"runtime/debug"
+	"strings"
+	"time"
 
+	"github.com/btcsuite/btcd/btcutil"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/costbasis"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/export"
 	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/alerts"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/banners"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	accountHandlers "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/handlers"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/message"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/proofofreserves"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/util"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
@@ -42,8 +51,10 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox02bootloader"
 	bitbox02bootloaderHandlers "github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox02bootloader/handlers"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/device"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/inventory"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/exchanges"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/rates"
 	utilConfig "github.com/digitalbitbox/bitbox-wallet-app/util/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
@@ -69,14 +80,24 @@ type Backend interface {
 	Coin(coinpkg.Code) (coinpkg.Coin, error)
 	Testing() bool
 	Accounts() []accounts.Interface
-	Keystore() keystore.Keystore
+	Keystores() []keystore.Keystore
+	KeystoreByRootFingerprint([]byte) keystore.Keystore
+	KnownKeystores() []*backend.KnownKeystore
+	SetKeystoreRemembered(rootFingerprint []byte, remembered bool) error
+	SoftwareKeystores() []backend.SoftwareKeystore
+	CreateSoftwareKeystore(mnemonic, passphrase, password string) (string, error)
+	UnlockSoftwareKeystore(rootFingerprint []byte, password string) error
+	LockSoftwareKeystore(rootFingerprint []byte) error
+	ExternalSigners() []backend.ExternalSigner
+	ConnectExternalSigner(name string) error
+	DisconnectExternalSigner(name string) error
 	OnAccountInit(f func(accounts.Interface))
 	OnAccountUninit(f func(accounts.Interface))
 	OnDeviceInit(f func(device.Interface))
 	OnDeviceUninit(f func(deviceID string))
 	DevicesRegistered() map[string]device.Interface
 	Start() <-chan interface{}
-	DeregisterKeystore()
+	DeregisterTestKeystores()
 	Register(device device.Interface) error
 	Deregister(deviceID string)
 	RatesUpdater() *rates.RateUpdater
@@ -90,6 +111,24 @@ type Backend interface {
 	Banners() *banners.Banners
 	Environment() backend.Environment
 	ChartData() (*backend.Chart, error)
+	ChartBreakdown() (*backend.ChartBreakdown, error)
+	CostBasis(fiat string, options costbasis.Options) (*costbasis.Report, error)
+	ExportTransactions(args backend.ExportArgs) (string, error)
+	ExportRatesHistory() (string, error)
+	SetAppConfig(appConfig config.AppConfig) error
+	AlertsStatus() []*alerts.Status
+	SetAccountNotificationsMuted(accountCode accountsTypes.Code, muted bool) error
+	CreatePaymentRequest(accountCode accountsTypes.Code, args backend.PaymentRequestArgs) (*backend.PaymentRequest, error)
+	PaymentRequests(accountCode accountsTypes.Code) ([]*backend.PaymentRequest, error)
+	CancelPaymentRequest(accountCode accountsTypes.Code, id string) error
+	VerifyMessage(args backend.VerifyMessageArgs) (string, error)
+	VerifyProofOfReserves(coinCode coinpkg.Code, message string, proof string) (*proofofreserves.Result, error)
+	DeviceInventory() ([]*inventory.Record, error)
+	DeviceInventoryLog(id string) ([]*inventory.Entry, error)
+	BitBox02Pairings() []*bitbox02.Pairing
+	SetBitBox02PairingLabel(deviceNoiseStaticPubkey string, label string) error
+	RemoveBitBox02Pairing(deviceNoiseStaticPubkey string) error
+	RotateBitBox02AppNoiseKeypair() error
 	SupportedCoins(keystore.Keystore) []coinpkg.Code
 	CanAddAccount(coinpkg.Code, keystore.Keystore) (string, bool)
 	CreateAndPersistAccountConfig(coinCode coinpkg.Code, name string, keystore keystore.Keystore) (accountsTypes.Code, error)
@@ -197,17 +236,39 @@ func NewHandlers(
 	getAPIRouterNoError(apiRouter)("/testing", handlers.getTestingHandler).Methods("GET")
 	getAPIRouterNoError(apiRouter)("/account-add", handlers.postAddAccountHandler).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/keystores", handlers.getKeystoresHandler).Methods("GET")
+	getAPIRouterNoError(apiRouter)("/known-keystores", handlers.getKnownKeystoresHandler).Methods("GET")
+	getAPIRouterNoError(apiRouter)("/set-keystore-remembered", handlers.postSetKeystoreRememberedHandler).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/software-keystores", handlers.getSoftwareKeystores).Methods("GET")
+	getAPIRouterNoError(apiRouter)("/software-keystores/create", handlers.postCreateSoftwareKeystore).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/software-keystores/unlock", handlers.postUnlockSoftwareKeystore).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/software-keystores/lock", handlers.postLockSoftwareKeystore).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/external-signers", handlers.getExternalSigners).Methods("GET")
+	getAPIRouterNoError(apiRouter)("/external-signers/connect", handlers.postConnectExternalSigner).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/external-signers/disconnect", handlers.postDisconnectExternalSigner).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/accounts", handlers.getAccountsHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/accounts/total-balance", handlers.getAccountsTotalBalanceHandler).Methods("GET")
 	getAPIRouterNoError(apiRouter)("/set-account-active", handlers.postSetAccountActiveHandler).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/set-token-active", handlers.postSetTokenActiveHandler).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/rename-account", handlers.postRenameAccountHandler).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/set-account-notifications-muted", handlers.postSetAccountNotificationsMutedHandler).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/accounts/reinitialize", handlers.postAccountsReinitializeHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/account-summary", handlers.getAccountSummary).Methods("GET")
+	getAPIRouter(apiRouter)("/chart-breakdown", handlers.getChartBreakdown).Methods("GET")
+	getAPIRouter(apiRouter)("/cost-basis", handlers.getCostBasis).Methods("GET")
+	getAPIRouter(apiRouter)("/export", handlers.postExport).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/verify-message", handlers.postVerifyMessage).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/verify-proof-of-reserves", handlers.postVerifyProofOfReserves).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/supported-coins", handlers.getSupportedCoinsHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/test/register", handlers.postRegisterTestKeystoreHandler).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/test/deregister", handlers.postDeregisterTestKeystoreHandler).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/rates", handlers.getRatesHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/rates/history/import", handlers.postImportRatesHistory).Methods("POST")
+	getAPIRouter(apiRouter)("/rates/history/export", handlers.postExportRatesHistory).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/supported-fiats", handlers.getSupportedFiats).Methods("GET")
+	getAPIRouterNoError(apiRouter)("/alerts", handlers.getAlerts).Methods("GET")
+	getAPIRouter(apiRouter)("/payment-requests", handlers.getPaymentRequests).Methods("GET")
+	getAPIRouterNoError(apiRouter)("/payment-requests/create", handlers.postCreatePaymentRequest).Methods("POST")
+	getAPIRouterNoError(apiRouter)("/payment-requests/cancel", handlers.postCancelPaymentRequest).Methods("POST")
 	getAPIRouterNoError(apiRouter)("/coins/convert-to-plain-fiat", handlers.getConvertToPlainFiatHandler).Methods("GET")
 	getAPIRouterNoError(apiRouter)("/coins/convert-from-fiat", handlers.getConvertFromFiatHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/coins/tltc/headers/status", handlers.getHeadersStatus(coinpkg.CodeTLTC)).Methods("GET")
@@ -231,8 +292,15 @@ func NewHandlers(
 	getAPIRouterNoError(apiRouter)("/aopp/approve", handlers.postAOPPApproveHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/aopp/choose-account", handlers.postAOPPChooseAccountHandler).Methods("POST")
 
-	devicesRouter := getAPIRouterNoError(apiRouter.PathPrefix("/devices").Subrouter())
+	devicesSubrouter := apiRouter.PathPrefix("/devices").Subrouter()
+	devicesRouter := getAPIRouterNoError(devicesSubrouter)
 	devicesRouter("/registered", handlers.getDevicesRegisteredHandler).Methods("GET")
+	getAPIRouter(devicesSubrouter)("/inventory", handlers.getDeviceInventoryHandler).Methods("GET")
+	getAPIRouter(devicesSubrouter)("/inventory/log", handlers.getDeviceInventoryLogHandler).Methods("GET")
+	devicesRouter("/bitbox02/pairings", handlers.getBitBox02PairingsHandler).Methods("GET")
+	devicesRouter("/bitbox02/pairings/label", handlers.postBitBox02PairingLabelHandler).Methods("POST")
+	devicesRouter("/bitbox02/pairings/remove", handlers.postRemoveBitBox02PairingHandler).Methods("POST")
+	devicesRouter("/bitbox02/pairings/rotate-app-keypair", handlers.postRotateBitBox02AppNoiseKeypairHandler).Methods("POST")
 
 	handlersMapLock := locker.Locker{}
 
@@ -350,6 +418,9 @@ type accountJSON struct {
 	IsToken               bool               `json:"isToken"`
 	ActiveTokens          []activeToken      `json:"activeTokens,omitempty"`
 	BlockExplorerTxPrefix string             `json:"blockExplorerTxPrefix"`
+	// KeystoreConnected is false for the watch-only accounts of a remembered keystore which is not
+	// connected.
+	KeystoreConnected bool `json:"keystoreConnected"`
 }
 
 func newAccountJSON(account accounts.Interface, activeTokens []activeToken) *accountJSON {
@@ -365,6 +436,7 @@ func newAccountJSON(account accounts.Interface, activeTokens []activeToken) *acc
 		IsToken:               isToken,
 		ActiveTokens:          activeTokens,
 		BlockExplorerTxPrefix: account.Coin().BlockExplorerTransactionURLPrefix(),
+		KeystoreConnected:     account.Config().Keystore != nil,
 	}
 }
 
@@ -404,7 +476,7 @@ func (handlers *Handlers) postAppConfigHandler(r *http.Request) (interface{}, er
 	if err := json.NewDecoder(r.Body).Decode(&appConfig); err != nil {
 		return nil, errp.WithStack(err)
 	}
-	return nil, handlers.backend.Config().SetAppConfig(appConfig)
+	return nil, handlers.backend.SetAppConfig(appConfig)
 }
 
 // getNativeLocaleHandler returns user preferred UI language as reported
@@ -470,6 +542,9 @@ func (handlers *Handlers) postAddAccountHandler(r *http.Request) interface{} {
 	var jsonBody struct {
 		CoinCode coinpkg.Code `json:"coinCode"`
 		Name     string       `json:"name"`
+		// RootFingerprint is the hex encoded root fingerprint of the keystore to add the account
+		// to. If it is empty, the most recently registered keystore is used.
+		RootFingerprint string `json:"rootFingerprint"`
 	}
 
 	type response struct {
@@ -483,7 +558,7 @@ func (handlers *Handlers) postAddAccountHandler(r *http.Request) interface{} {
 		return response{Success: false, ErrorMessage: err.Error()}
 	}
 
-	keystore := handlers.backend.Keystore()
+	keystore := handlers.keystore(jsonBody.RootFingerprint)
 	if keystore == nil {
 		return response{Success: false, ErrorMessage: "Keystore not found"}
 	}
@@ -499,21 +574,194 @@ func (handlers *Handlers) postAddAccountHandler(r *http.Request) interface{} {
 	return response{Success: true, AccountCode: accountCode}
 }
 
+// keystore returns the registered keystore with the given hex encoded root fingerprint. If
+// rootFingerprint is empty, the most recently registered keystore is returned, e.g. the one of the
+// device the user just connected. Returns nil if no keystore matches.
+func (handlers *Handlers) keystore(rootFingerprint string) keystore.Keystore {
+	if rootFingerprint == "" {
+		keystores := handlers.backend.Keystores()
+		if len(keystores) == 0 {
+			return nil
+		}
+		return keystores[len(keystores)-1]
+	}
+	rootFingerprintBytes, err := hex.DecodeString(rootFingerprint)
+	if err != nil {
+		return nil
+	}
+	return handlers.backend.KeystoreByRootFingerprint(rootFingerprintBytes)
+}
+
 func (handlers *Handlers) getKeystoresHandler(_ *http.Request) interface{} {
 	type json struct {
-		Type keystore.Type `json:"type"`
+		Type            keystore.Type `json:"type"`
+		RootFingerprint string        `json:"rootFingerprint"`
 	}
 	keystores := []*json{}
 
-	keystore := handlers.backend.Keystore()
-	if keystore != nil {
+	for _, keystore := range handlers.backend.Keystores() {
+		rootFingerprint, err := keystore.RootFingerprint()
+		if err != nil {
+			handlers.log.WithError(err).Error("Could not retrieve root fingerprint")
+			continue
+		}
 		keystores = append(keystores, &json{
-			Type: keystore.Type(),
+			Type:            keystore.Type(),
+			RootFingerprint: hex.EncodeToString(rootFingerprint),
 		})
 	}
 	return keystores
 }
 
+func (handlers *Handlers) getKnownKeystoresHandler(_ *http.Request) interface{} {
+	return handlers.backend.KnownKeystores()
+}
+
+func (handlers *Handlers) postSetKeystoreRememberedHandler(r *http.Request) interface{} {
+	var jsonBody struct {
+		RootFingerprint string `json:"rootFingerprint"`
+		Remembered      bool   `json:"remembered"`
+	}
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	rootFingerprint, err := hex.DecodeString(jsonBody.RootFingerprint)
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	if err := handlers.backend.SetKeystoreRemembered(rootFingerprint, jsonBody.Remembered); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
+func (handlers *Handlers) getSoftwareKeystores(_ *http.Request) interface{} {
+	return handlers.backend.SoftwareKeystores()
+}
+
+func (handlers *Handlers) postCreateSoftwareKeystore(r *http.Request) interface{} {
+	var jsonBody struct {
+		// Mnemonic is the BIP39 mnemonic to import. If empty, a new one is generated.
+		Mnemonic   string `json:"mnemonic"`
+		Passphrase string `json:"passphrase"`
+		Password   string `json:"password"`
+	}
+
+	type response struct {
+		Success      bool   `json:"success"`
+		Mnemonic     string `json:"mnemonic,omitempty"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	mnemonic, err := handlers.backend.CreateSoftwareKeystore(
+		jsonBody.Mnemonic, jsonBody.Passphrase, jsonBody.Password)
+	if err != nil {
+		handlers.log.WithError(err).Error("Could not create software keystore")
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true, Mnemonic: mnemonic}
+}
+
+func (handlers *Handlers) postUnlockSoftwareKeystore(r *http.Request) interface{} {
+	var jsonBody struct {
+		RootFingerprint string `json:"rootFingerprint"`
+		Password        string `json:"password"`
+	}
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorCode    string `json:"errorCode,omitempty"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	rootFingerprint, err := hex.DecodeString(jsonBody.RootFingerprint)
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	err = handlers.backend.UnlockSoftwareKeystore(rootFingerprint, jsonBody.Password)
+	if errp.Cause(err) == software.ErrWrongPassword {
+		return response{Success: false, ErrorCode: software.ErrWrongPassword.Error()}
+	}
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
+func (handlers *Handlers) postLockSoftwareKeystore(r *http.Request) interface{} {
+	var jsonBody struct {
+		RootFingerprint string `json:"rootFingerprint"`
+	}
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	rootFingerprint, err := hex.DecodeString(jsonBody.RootFingerprint)
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	if err := handlers.backend.LockSoftwareKeystore(rootFingerprint); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
+func (handlers *Handlers) getExternalSigners(_ *http.Request) interface{} {
+	return handlers.backend.ExternalSigners()
+}
+
+func (handlers *Handlers) postConnectExternalSigner(r *http.Request) interface{} {
+	var name string
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&name); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	if err := handlers.backend.ConnectExternalSigner(name); err != nil {
+		handlers.log.WithError(err).Error("Could not connect external signer")
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
+func (handlers *Handlers) postDisconnectExternalSigner(r *http.Request) interface{} {
+	var name string
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&name); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	if err := handlers.backend.DisconnectExternalSigner(name); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
 func (handlers *Handlers) getAccountsHandler(_ *http.Request) interface{} {
 	accounts := []*accountJSON{}
 	persistedAccounts := handlers.backend.Config().AccountsConfig()
@@ -670,6 +918,26 @@ func (handlers *Handlers) postSetTokenActiveHandler(r *http.Request) interface{}
 	return response{Success: true}
 }
 
+func (handlers *Handlers) postSetAccountNotificationsMutedHandler(r *http.Request) interface{} {
+	var jsonBody struct {
+		AccountCode accountsTypes.Code `json:"accountCode"`
+		Muted       bool               `json:"muted"`
+	}
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	if err := handlers.backend.SetAccountNotificationsMuted(jsonBody.AccountCode, jsonBody.Muted); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
 func (handlers *Handlers) postRenameAccountHandler(r *http.Request) interface{} {
 	var jsonBody struct {
 		AccountCode accountsTypes.Code `json:"accountCode"`
@@ -707,6 +975,148 @@ func (handlers *Handlers) getDevicesRegisteredHandler(_ *http.Request) interface
 	return jsonDevices
 }
 
+func (handlers *Handlers) getDeviceInventoryHandler(_ *http.Request) (interface{}, error) {
+	return handlers.backend.DeviceInventory()
+}
+
+func (handlers *Handlers) getDeviceInventoryLogHandler(r *http.Request) (interface{}, error) {
+	return handlers.backend.DeviceInventoryLog(r.URL.Query().Get("id"))
+}
+
+func (handlers *Handlers) postVerifyMessage(r *http.Request) interface{} {
+	type response struct {
+		Success      bool   `json:"success"`
+		Format       string `json:"format,omitempty"`
+		ErrorCode    string `json:"errorCode,omitempty"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	var args backend.VerifyMessageArgs
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	format, err := handlers.backend.VerifyMessage(args)
+	if errp.Cause(err) == message.ErrInvalidSignature || errp.Cause(err) == eth.ErrInvalidMessageSignature {
+		return response{Success: false, Format: format, ErrorCode: "invalidSignature"}
+	}
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true, Format: format}
+}
+
+func (handlers *Handlers) postVerifyProofOfReserves(r *http.Request) interface{} {
+	type output struct {
+		OutPoint string                          `json:"outPoint"`
+		Amount   accountHandlers.FormattedAmount `json:"amount"`
+		Height   int                             `json:"height"`
+		Spent    bool                            `json:"spent"`
+	}
+	type response struct {
+		Success      bool                             `json:"success"`
+		Total        *accountHandlers.FormattedAmount `json:"total,omitempty"`
+		Unspent      *accountHandlers.FormattedAmount `json:"unspent,omitempty"`
+		Outputs      []output                         `json:"outputs,omitempty"`
+		ErrorCode    string                           `json:"errorCode,omitempty"`
+		ErrorMessage string                           `json:"errorMessage,omitempty"`
+	}
+
+	var jsonBody struct {
+		CoinCode coinpkg.Code `json:"coinCode"`
+		Message  string       `json:"message"`
+		Proof    string       `json:"proof"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	result, err := handlers.backend.VerifyProofOfReserves(jsonBody.CoinCode, jsonBody.Message, jsonBody.Proof)
+	if errp.Cause(err) == proofofreserves.ErrInvalidProof {
+		return response{Success: false, ErrorCode: proofofreserves.ErrInvalidProof.Error(), ErrorMessage: err.Error()}
+	}
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	proofCoin, err := handlers.backend.Coin(jsonBody.CoinCode)
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	formatAmount := func(amount btcutil.Amount) *accountHandlers.FormattedAmount {
+		return &accountHandlers.FormattedAmount{
+			Amount: proofCoin.FormatAmount(coinpkg.NewAmountFromInt64(int64(amount)), false),
+			Unit:   proofCoin.GetFormatUnit(false),
+		}
+	}
+	outputs := make([]output, len(result.Outputs))
+	for index, o := range result.Outputs {
+		outputs[index] = output{
+			OutPoint: o.OutPoint.String(),
+			Amount:   *formatAmount(o.Value),
+			Height:   o.Height,
+			Spent:    o.Spent,
+		}
+	}
+	return response{
+		Success: true,
+		Total:   formatAmount(result.Total),
+		Unspent: formatAmount(result.Unspent),
+		Outputs: outputs,
+	}
+}
+
+func (handlers *Handlers) getBitBox02PairingsHandler(_ *http.Request) interface{} {
+	return handlers.backend.BitBox02Pairings()
+}
+
+func (handlers *Handlers) postBitBox02PairingLabelHandler(r *http.Request) interface{} {
+	var jsonBody struct {
+		DeviceNoiseStaticPubkey string `json:"deviceNoiseStaticPubkey"`
+		Label                   string `json:"label"`
+	}
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	if err := handlers.backend.SetBitBox02PairingLabel(
+		jsonBody.DeviceNoiseStaticPubkey, jsonBody.Label); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
+func (handlers *Handlers) postRemoveBitBox02PairingHandler(r *http.Request) interface{} {
+	var deviceNoiseStaticPubkey string
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&deviceNoiseStaticPubkey); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	if err := handlers.backend.RemoveBitBox02Pairing(deviceNoiseStaticPubkey); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
+func (handlers *Handlers) postRotateBitBox02AppNoiseKeypairHandler(_ *http.Request) interface{} {
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := handlers.backend.RotateBitBox02AppNoiseKeypair(); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
 func (handlers *Handlers) postRegisterTestKeystoreHandler(r *http.Request) (interface{}, error) {
 	if !handlers.backend.Testing() {
 		return nil, errp.New("Test keystore not available")
@@ -721,7 +1131,7 @@ func (handlers *Handlers) postRegisterTestKeystoreHandler(r *http.Request) (inte
 }
 
 func (handlers *Handlers) postDeregisterTestKeystoreHandler(_ *http.Request) interface{} {
-	handlers.backend.DeregisterKeystore()
+	handlers.backend.DeregisterTestKeystores()
 	return nil
 }
 
@@ -1010,16 +1420,182 @@ func (handlers *Handlers) getAccountSummary(_ *http.Request) (interface{}, error
 	return handlers.backend.ChartData()
 }
 
+func (handlers *Handlers) getChartBreakdown(_ *http.Request) (interface{}, error) {
+	return handlers.backend.ChartBreakdown()
+}
+
+// getCostBasis returns the cost basis and gains of all active accounts. The `fiat` query parameter
+// defaults to the main fiat currency. The `method`, `fee` and `transfers` query parameters select
+// the options, see `costbasis.Options`.
+func (handlers *Handlers) getCostBasis(r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	report, err := handlers.backend.CostBasis(query.Get("fiat"), costbasis.Options{
+		Method:    costbasis.Method(query.Get("method")),
+		Fee:       costbasis.FeeTreatment(query.Get("fee")),
+		Transfers: costbasis.TransferTreatment(query.Get("transfers")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report.Format(util.FormatBtcAsSat(handlers.backend.Config().AppConfig().Backend.BtcUnit)), nil
+}
+
+// postExport exports the transactions of all or some active accounts into one file. The dates
+// `from` and `to` (inclusive) are in the format YYYY-MM-DD and are interpreted in local time.
+func (handlers *Handlers) postExport(r *http.Request) (interface{}, error) {
+	type result struct {
+		Success      bool   `json:"success"`
+		Path         string `json:"path"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	var jsonBody struct {
+		Format   export.Format        `json:"format"`
+		From     string               `json:"from"`
+		To       string               `json:"to"`
+		Accounts []accountsTypes.Code `json:"accounts"`
+		Types    []accounts.TxType    `json:"types"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	args := backend.ExportArgs{
+		Format:       jsonBody.Format,
+		Filter:       export.Filter{Types: jsonBody.Types},
+		AccountCodes: jsonBody.Accounts,
+	}
+	const dateLayout = "2006-01-02"
+	if jsonBody.From != "" {
+		from, err := time.ParseInLocation(dateLayout, jsonBody.From, time.Local)
+		if err != nil {
+			return result{ErrorMessage: err.Error()}, nil
+		}
+		args.Filter.From = from
+	}
+	if jsonBody.To != "" {
+		to, err := time.ParseInLocation(dateLayout, jsonBody.To, time.Local)
+		if err != nil {
+			return result{ErrorMessage: err.Error()}, nil
+		}
+		args.Filter.To = to.AddDate(0, 0, 1)
+	}
+	path, err := handlers.backend.ExportTransactions(args)
+	if err != nil {
+		handlers.log.WithError(err).Error("error exporting transactions")
+		return result{ErrorMessage: err.Error()}, nil
+	}
+	return result{Success: true, Path: path}, nil
+}
+
+// postImportRatesHistory imports historical exchange rates from the file contents in the request.
+// See `rates.RateUpdater.ImportHistory()` for the formats.
+func (handlers *Handlers) postImportRatesHistory(r *http.Request) (interface{}, error) {
+	type result struct {
+		Success      bool                        `json:"success"`
+		Results      []rates.HistoryImportResult `json:"results"`
+		ErrorMessage string                      `json:"errorMessage"`
+	}
+	var jsonBody struct {
+		Format    string `json:"format"`
+		Coin      string `json:"coin"`
+		Fiat      string `json:"fiat"`
+		Data      string `json:"data"`
+		Overwrite bool   `json:"overwrite"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	results, err := handlers.backend.RatesUpdater().ImportHistory(
+		strings.NewReader(jsonBody.Data), jsonBody.Format, jsonBody.Coin, jsonBody.Fiat, jsonBody.Overwrite)
+	if err != nil {
+		handlers.log.WithError(err).Error("error importing rates history")
+		return result{Results: results, ErrorMessage: err.Error()}, nil
+	}
+	return result{Success: true, Results: results}, nil
+}
+
+// getSupportedFiats returns all currencies which can be enabled as fiats, sorted alphabetically.
+func (handlers *Handlers) getSupportedFiats(*http.Request) interface{} {
+	return handlers.backend.RatesUpdater().SupportedQuotes()
+}
+
+// getAlerts returns the alerts of the app config and whether they are triggered. The alerts are
+// changed through the app config.
+func (handlers *Handlers) getAlerts(*http.Request) interface{} {
+	return handlers.backend.AlertsStatus()
+}
+
+func (handlers *Handlers) getPaymentRequests(r *http.Request) (interface{}, error) {
+	return handlers.backend.PaymentRequests(accountsTypes.Code(r.URL.Query().Get("accountCode")))
+}
+
+func (handlers *Handlers) postCreatePaymentRequest(r *http.Request) interface{} {
+	var jsonBody struct {
+		AccountCode accountsTypes.Code `json:"accountCode"`
+		backend.PaymentRequestArgs
+	}
+
+	type response struct {
+		Success        bool                    `json:"success"`
+		ErrorMessage   string                  `json:"errorMessage,omitempty"`
+		PaymentRequest *backend.PaymentRequest `json:"paymentRequest,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	paymentRequest, err := handlers.backend.CreatePaymentRequest(
+		jsonBody.AccountCode, jsonBody.PaymentRequestArgs)
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true, PaymentRequest: paymentRequest}
+}
+
+func (handlers *Handlers) postCancelPaymentRequest(r *http.Request) interface{} {
+	var jsonBody struct {
+		AccountCode accountsTypes.Code `json:"accountCode"`
+		ID          string             `json:"id"`
+	}
+
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	if err := handlers.backend.CancelPaymentRequest(jsonBody.AccountCode, jsonBody.ID); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}
+	}
+	return response{Success: true}
+}
+
+func (handlers *Handlers) postExportRatesHistory(_ *http.Request) (interface{}, error) {
+	type result struct {
+		Success      bool   `json:"success"`
+		Path         string `json:"path"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	path, err := handlers.backend.ExportRatesHistory()
+	if err != nil {
+		handlers.log.WithError(err).Error("error exporting rates history")
+		return result{ErrorMessage: err.Error()}, nil
+	}
+	return result{Success: true, Path: path}, nil
+}
+
 // getSupportedCoinsHandler returns an array of coin codes for which you can add an account.
-// Exactly one keystore must be connected, otherwise an empty array is returned.
-func (handlers *Handlers) getSupportedCoinsHandler(_ *http.Request) interface{} {
+// The keystore is selected by the `rootFingerprint` query param. If it is omitted, the most
+// recently registered keystore is used. If no keystore matches, an empty array is returned.
+func (handlers *Handlers) getSupportedCoinsHandler(r *http.Request) interface{} {
 	type element struct {
 		CoinCode             coinpkg.Code `json:"coinCode"`
 		Name                 string       `json:"name"`
 		CanAddAccount        bool         `json:"canAddAccount"`
 		SuggestedAccountName string       `json:"suggestedAccountName"`
 	}
-	keystore := handlers.backend.Keystore()
+	keystore := handlers.keystore(r.URL.Query().Get("rootFingerprint"))
 	if keystore == nil {
 		return []string{}
 	}
@@ -0,0 +1,316 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package external implements a keystore backed by an external signer process, so that signers
+// other than the BitBox can be used, e.g. hardware wallets of other vendors through a small
+// HWI-based wrapper script.
+//
+// The app starts the signer process and talks to it over stdin/stdout. Each request and each
+// response is one line of JSON:
+//
+//	-> {"id": 1, "method": "getxpub", "params": {"keypath": "m/84'/0'/0'", "chain": "main"}}
+//	<- {"id": 1, "result": {"xpub": "xpub..."}}
+//	<- {"id": 1, "error": {"code": "aborted", "message": "..."}}
+//
+// The methods are:
+//
+//   - getinfo: returns `Info`, the root fingerprint and capabilities of the signer.
+//   - getxpub: params `keypath`, `chain`. Returns `xpub`.
+//   - signtx: params `psbt` (base64), `chain`. Returns the `psbt` (base64) with partial signatures
+//     (BIP174) or Taproot key path signatures (BIP371) for all inputs.
+//   - displayaddress: params `keypath`, `scriptType`, `chain`. Displays the address on the signer.
+//   - displayxpub: params `keypath`, `scriptType`, `chain`. Displays the xpub on the signer.
+//   - signmessage: params `message` (base64), `keypath`, `scriptType`. Returns the
+//     `signature` (base64) of the message as a 65 byte Electrum compatible signature.
+//
+// The chain is one of "main", "test", "regtest". The error code "aborted" means the user aborted
+// the operation on the signer.
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	errorCodeAborted = "aborted"
+
+	// stopTimeout is how long we wait for the signer process to exit before killing it.
+	stopTimeout = 5 * time.Second
+	// getInfoTimeout is how long we wait for the response to `getinfo`, which does not require user
+	// interaction.
+	getInfoTimeout = 30 * time.Second
+)
+
+// Info describes the signer and its capabilities. It is returned by the signer in the `getinfo`
+// method.
+type Info struct {
+	// Name is the human readable name of the signer, e.g. the device model.
+	Name string `json:"name"`
+	// RootFingerprint is the hex encoded root fingerprint of the signer's seed.
+	RootFingerprint string `json:"rootFingerprint"`
+	// Coins are the supported coin codes, e.g. "btc", "tbtc", "rbtc".
+	Coins []string `json:"coins"`
+	// ScriptTypes are the supported script types, e.g. "p2wpkh", "p2tr".
+	ScriptTypes []string `json:"scriptTypes"`
+	// CanVerifyAddress is true if the signer can display addresses with `displayaddress`.
+	CanVerifyAddress bool `json:"canVerifyAddress"`
+	// CanVerifyExtendedPublicKey is true if the signer can display xpubs with `displayxpub`.
+	CanVerifyExtendedPublicKey bool `json:"canVerifyExtendedPublicKey"`
+	// CanSignMessage is true if the signer supports `signmessage`.
+	CanSignMessage bool `json:"canSignMessage"`
+	// SupportsUnifiedAccounts is true if the signer can sign transactions spending inputs of
+	// different script types.
+	SupportsUnifiedAccounts bool `json:"supportsUnifiedAccounts"`
+}
+
+type request struct {
+	ID     int         `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+type responseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// client sends requests to the signer and reads the responses. One request is processed at a
+// time.
+type client struct {
+	mu     sync.Mutex
+	writer io.Writer
+	nextID int
+	log    *logrus.Entry
+
+	// pendingMu guards pending and closed.
+	pendingMu sync.Mutex
+	// pending receives the response to the request in progress. It is nil if no request is in
+	// progress, and closed if the signer closed its output.
+	pending chan []byte
+	// closed is true once the signer closed its output.
+	closed bool
+	// readDone is closed once all output of the signer was read.
+	readDone chan struct{}
+}
+
+func newClient(writer io.Writer, reader io.Reader, log *logrus.Entry) *client {
+	client := &client{
+		writer:   writer,
+		nextID:   1,
+		log:      log,
+		readDone: make(chan struct{}),
+	}
+	go client.readResponses(reader)
+	return client
+}
+
+// readResponses reads the responses of the signer line by line until the signer closes its output
+// and passes them to the request in progress. Output while no request is in progress is dropped.
+func (client *client) readResponses(reader io.Reader) {
+	defer close(client.readDone)
+	bufReader := bufio.NewReader(reader)
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		client.pendingMu.Lock()
+		if err != nil {
+			client.closed = true
+			if client.pending != nil {
+				close(client.pending)
+				client.pending = nil
+			}
+			client.pendingMu.Unlock()
+			return
+		}
+		if client.pending != nil {
+			client.pending <- line
+			client.pending = nil
+		} else {
+			client.log.Warning("Dropping unexpected output of external signer")
+		}
+		client.pendingMu.Unlock()
+	}
+}
+
+// call invokes the method and unmarshals the result into result, which can be nil.
+// keystore.ErrSigningAborted is returned if the user aborted.
+func (client *client) call(method string, params interface{}, result interface{}) error {
+	return client.callWithTimeout(method, params, result, 0)
+}
+
+// callWithTimeout is like call, but fails if the signer did not respond within the timeout. A
+// timeout of 0 means no timeout, e.g. for requests waiting for the user to confirm on the signer.
+func (client *client) callWithTimeout(
+	method string, params interface{}, result interface{}, timeout time.Duration) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	id := client.nextID
+	client.nextID++
+	requestBytes, err := json.Marshal(request{ID: id, Method: method, Params: params})
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	client.log.WithField("method", method).Debug("Sending request to external signer")
+	pending, err := client.expectResponse()
+	if err != nil {
+		return err
+	}
+	if _, err := client.writer.Write(append(requestBytes, '\n')); err != nil {
+		client.clearPending(pending)
+		return errp.WithStack(err)
+	}
+	var timeoutChan <-chan time.Time
+	if timeout != 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	var resp response
+	for {
+		select {
+		case line, ok := <-pending:
+			if !ok {
+				return errp.New("external signer exited")
+			}
+			if err := json.Unmarshal(line, &resp); err != nil {
+				return errp.WithMessage(err, "invalid response from external signer")
+			}
+		case <-timeoutChan:
+			client.clearPending(pending)
+			return errp.Newf("external signer did not respond to %s within %s", method, timeout)
+		}
+		if resp.ID >= id {
+			break
+		}
+		// A late response to an earlier request which timed out.
+		client.log.WithField("id", resp.ID).Warning("Dropping late response of external signer")
+		if pending, err = client.expectResponse(); err != nil {
+			return err
+		}
+	}
+	if resp.ID != id {
+		return errp.Newf("expected response to request %d, got %d", id, resp.ID)
+	}
+	if resp.Error != nil {
+		if resp.Error.Code == errorCodeAborted {
+			return errp.WithStack(keystore.ErrSigningAborted)
+		}
+		return errp.Newf("external signer: %s", resp.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return errp.WithMessage(err, "invalid result from external signer")
+	}
+	return nil
+}
+
+// expectResponse returns the channel receiving the next response of the signer.
+func (client *client) expectResponse() (chan []byte, error) {
+	client.pendingMu.Lock()
+	defer client.pendingMu.Unlock()
+	if client.closed {
+		return nil, errp.New("external signer exited")
+	}
+	client.pending = make(chan []byte, 1)
+	return client.pending, nil
+}
+
+// clearPending stops waiting for the response of a request, so that a late response is dropped.
+func (client *client) clearPending(pending chan []byte) {
+	client.pendingMu.Lock()
+	defer client.pendingMu.Unlock()
+	if client.pending == pending {
+		client.pending = nil
+	}
+}
+
+// Process is a running external signer process.
+type Process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	client *client
+	done   chan struct{}
+}
+
+// StartProcess starts the signer process. onExit is called when the process exits.
+func StartProcess(
+	command string, args []string, log *logrus.Entry, onExit func(*Process)) (*Process, error) {
+	cmd := exec.Command(command, args...) // #nosec G204
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	process := &Process{
+		cmd:    cmd,
+		stdin:  stdin,
+		client: newClient(stdin, stdout, log),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		// Wait closes stdout, so it must only be called after all output was read.
+		<-process.client.readDone
+		err := cmd.Wait()
+		log.WithError(err).Info("External signer exited")
+		close(process.done)
+		if onExit != nil {
+			onExit(process)
+		}
+	}()
+	return process, nil
+}
+
+// Exited returns true if the process exited.
+func (process *Process) Exited() bool {
+	select {
+	case <-process.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop closes stdin of the process, which tells it to exit, and kills it if it has not exited
+// after a while.
+func (process *Process) Stop() {
+	_ = process.stdin.Close()
+	select {
+	case <-process.done:
+	case <-time.After(stopTimeout):
+		_ = process.cmd.Process.Kill()
+	}
+}
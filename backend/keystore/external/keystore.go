@@ -0,0 +1,535 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package external
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/psbt"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	keystorePkg "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/sirupsen/logrus"
+)
+
+// Keystore implements keystore.Keystore using an external signer.
+type Keystore struct {
+	client          *client
+	info            *Info
+	rootFingerprint []byte
+	log             *logrus.Entry
+}
+
+// NewKeystore queries the info of the signer reachable through the process and returns a keystore
+// using it. It fails if the signer does not respond within `getInfoTimeout`.
+func NewKeystore(process *Process, log *logrus.Entry) (*Keystore, error) {
+	return newKeystore(process.client, log)
+}
+
+func newKeystore(client *client, log *logrus.Entry) (*Keystore, error) {
+	info := &Info{}
+	if err := client.callWithTimeout("getinfo", nil, info, getInfoTimeout); err != nil {
+		return nil, err
+	}
+	rootFingerprint, err := hex.DecodeString(info.RootFingerprint)
+	if err != nil || len(rootFingerprint) != 4 {
+		return nil, errp.Newf("invalid root fingerprint %q", info.RootFingerprint)
+	}
+	return &Keystore{
+		client:          client,
+		info:            info,
+		rootFingerprint: rootFingerprint,
+		log:             log.WithField("rootFingerprint", info.RootFingerprint),
+	}, nil
+}
+
+// Info returns the info about the signer.
+func (keystore *Keystore) Info() *Info {
+	return keystore.info
+}
+
+func chainName(coin coinpkg.Coin) (string, error) {
+	btcCoin, ok := coin.(*btc.Coin)
+	if !ok {
+		return "", errp.Newf("unsupported coin %s", coin.Code())
+	}
+	switch btcCoin.Net().Net {
+	case chaincfg.MainNetParams.Net:
+		return "main", nil
+	case chaincfg.TestNet3Params.Net:
+		return "test", nil
+	case chaincfg.RegressionNetParams.Net:
+		return "regtest", nil
+	default:
+		return "", errp.Newf("unsupported network %s", btcCoin.Net().Name)
+	}
+}
+
+// Type implements keystore.Keystore.
+func (keystore *Keystore) Type() keystorePkg.Type {
+	return keystorePkg.TypeHardware
+}
+
+// RootFingerprint implements keystore.Keystore.
+func (keystore *Keystore) RootFingerprint() ([]byte, error) {
+	return keystore.rootFingerprint, nil
+}
+
+// SupportsCoin implements keystore.Keystore. Only Bitcoin-like coins are supported, as signing is
+// done with PSBTs.
+func (keystore *Keystore) SupportsCoin(coin coinpkg.Coin) bool {
+	if _, ok := coin.(*btc.Coin); !ok {
+		return false
+	}
+	for _, code := range keystore.info.Coins {
+		if coinpkg.Code(code) == coin.Code() {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsAccount implements keystore.Keystore.
+func (keystore *Keystore) SupportsAccount(coin coinpkg.Coin, meta interface{}) bool {
+	if !keystore.SupportsCoin(coin) {
+		return false
+	}
+	scriptType, ok := meta.(signing.ScriptType)
+	if !ok {
+		return false
+	}
+	for _, supported := range keystore.info.ScriptTypes {
+		if signing.ScriptType(supported) == scriptType {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsUnifiedAccounts implements keystore.Keystore.
+func (keystore *Keystore) SupportsUnifiedAccounts() bool {
+	return keystore.info.SupportsUnifiedAccounts
+}
+
+// SupportsMultipleAccounts implements keystore.Keystore.
+func (keystore *Keystore) SupportsMultipleAccounts() bool {
+	return true
+}
+
+// CanVerifyAddress implements keystore.Keystore.
+func (keystore *Keystore) CanVerifyAddress(coin coinpkg.Coin) (bool, bool, error) {
+	const optional = false
+	return keystore.info.CanVerifyAddress && keystore.SupportsCoin(coin), optional, nil
+}
+
+// VerifyAddress implements keystore.Keystore.
+func (keystore *Keystore) VerifyAddress(configuration *signing.Configuration, coin coinpkg.Coin) error {
+	chain, err := chainName(coin)
+	if err != nil {
+		return err
+	}
+	err = keystore.client.call("displayaddress", map[string]interface{}{
+		"keypath":    configuration.AbsoluteKeypath().Encode(),
+		"scriptType": configuration.ScriptType(),
+		"chain":      chain,
+	}, nil)
+	if errp.Cause(err) == keystorePkg.ErrSigningAborted {
+		// No special action on user abort.
+		return nil
+	}
+	return err
+}
+
+// CanVerifyExtendedPublicKey implements keystore.Keystore.
+func (keystore *Keystore) CanVerifyExtendedPublicKey() bool {
+	return keystore.info.CanVerifyExtendedPublicKey
+}
+
+// VerifyExtendedPublicKey implements keystore.Keystore.
+func (keystore *Keystore) VerifyExtendedPublicKey(
+	coin coinpkg.Coin, configuration *signing.Configuration) error {
+	if !keystore.CanVerifyExtendedPublicKey() {
+		panic("CanVerifyExtendedPublicKey must be true")
+	}
+	chain, err := chainName(coin)
+	if err != nil {
+		return err
+	}
+	err = keystore.client.call("displayxpub", map[string]interface{}{
+		"keypath":    configuration.AbsoluteKeypath().Encode(),
+		"scriptType": configuration.ScriptType(),
+		"chain":      chain,
+	}, nil)
+	if errp.Cause(err) == keystorePkg.ErrSigningAborted {
+		return nil
+	}
+	return err
+}
+
+// ExtendedPublicKey implements keystore.Keystore.
+func (keystore *Keystore) ExtendedPublicKey(
+	coin coinpkg.Coin, keypath signing.AbsoluteKeypath) (*hdkeychain.ExtendedKey, error) {
+	chain, err := chainName(coin)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		XPub string `json:"xpub"`
+	}
+	err = keystore.client.call("getxpub", map[string]interface{}{
+		"keypath": keypath.Encode(),
+		"chain":   chain,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	xpub, err := hdkeychain.NewKeyFromString(result.XPub)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if xpub.IsPrivate() {
+		return nil, errp.New("the external signer returned a private key")
+	}
+	// Like for the other keystores, the xpub version is used for all networks.
+	return xpub.CloneWithVersion(chaincfg.MainNetParams.HDPublicKeyID[:])
+}
+
+// CanSignMessage implements keystore.Keystore.
+func (keystore *Keystore) CanSignMessage(code coinpkg.Code) bool {
+	if !keystore.info.CanSignMessage {
+		return false
+	}
+	switch code {
+	case coinpkg.CodeBTC, coinpkg.CodeTBTC, coinpkg.CodeRBTC:
+		for _, supported := range keystore.info.Coins {
+			if coinpkg.Code(supported) == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanSignBIP322 implements keystore.Keystore. The virtual transaction is signed like any other PSBT.
+func (keystore *Keystore) CanSignBIP322(code coinpkg.Code) bool {
+	switch code {
+	case coinpkg.CodeBTC, coinpkg.CodeTBTC, coinpkg.CodeRBTC:
+		for _, supported := range keystore.info.Coins {
+			if coinpkg.Code(supported) == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanSignProofOfReserves implements keystore.Keystore. The commitment input of the proof is sent
+// without key information, so the signer only signs the inputs of the account.
+func (keystore *Keystore) CanSignProofOfReserves(code coinpkg.Code) bool {
+	switch code {
+	case coinpkg.CodeBTC, coinpkg.CodeTBTC, coinpkg.CodeRBTC:
+		for _, supported := range keystore.info.Coins {
+			if coinpkg.Code(supported) == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SignBTCMessage implements keystore.Keystore.
+func (keystore *Keystore) SignBTCMessage(
+	message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
+	if !keystore.info.CanSignMessage {
+		return nil, errp.New("the external signer does not support signing messages")
+	}
+	var result struct {
+		Signature string `json:"signature"`
+	}
+	err := keystore.client.call("signmessage", map[string]interface{}{
+		"message":    base64.StdEncoding.EncodeToString(message),
+		"keypath":    keypath.Encode(),
+		"scriptType": scriptType,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(result.Signature)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if len(signature) != 65 {
+		return nil, errp.Newf("expected a 65 byte signature, got %d bytes", len(signature))
+	}
+	return signature, nil
+}
+
+// SignETHMessage implements keystore.Keystore.
+func (keystore *Keystore) SignETHMessage([]byte, signing.AbsoluteKeypath) ([]byte, error) {
+	return nil, errp.New("unsupported")
+}
+
+// SignETHTypedMessage implements keystore.Keystore.
+func (keystore *Keystore) SignETHTypedMessage(uint64, []byte, signing.AbsoluteKeypath) ([]byte, error) {
+	return nil, errp.New("unsupported")
+}
+
+// SignTransaction implements keystore.Keystore.
+func (keystore *Keystore) SignTransaction(proposedTransaction interface{}) error {
+	btcProposedTx, ok := proposedTransaction.(*btc.ProposedTransaction)
+	if !ok {
+		return errp.New("unsupported transaction")
+	}
+	chain, err := chainName(btcProposedTx.TXProposal.Coin)
+	if err != nil {
+		return err
+	}
+	packet, err := keystore.makePSBT(btcProposedTx)
+	if err != nil {
+		return err
+	}
+	serialized, err := packet.Serialize()
+	if err != nil {
+		return err
+	}
+	keystore.log.Info("Sign transaction.")
+	var result struct {
+		PSBT string `json:"psbt"`
+	}
+	err = keystore.client.call("signtx", map[string]interface{}{
+		"psbt":  base64.StdEncoding.EncodeToString(serialized),
+		"chain": chain,
+	}, &result)
+	if err != nil {
+		return err
+	}
+	signedBytes, err := base64.StdEncoding.DecodeString(result.PSBT)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	signed, err := psbt.Parse(signedBytes)
+	if err != nil {
+		return err
+	}
+	signatures, err := signaturesFromPSBT(btcProposedTx, signed)
+	if err != nil {
+		return err
+	}
+	btcProposedTx.Signatures = signatures
+	return nil
+}
+
+// makePSBT creates the PSBT to be signed by the external signer, containing the previous outputs
+// and the keypaths of the inputs and of the change output.
+func (keystore *Keystore) makePSBT(btcProposedTx *btc.ProposedTransaction) (*psbt.Packet, error) {
+	txProposal := btcProposedTx.TXProposal
+	unsignedTx := txProposal.Transaction.Copy()
+	for _, txIn := range unsignedTx.TxIn {
+		txIn.SignatureScript = nil
+		txIn.Witness = nil
+	}
+	packet, err := psbt.New(unsignedTx)
+	if err != nil {
+		return nil, err
+	}
+	for index, txIn := range unsignedTx.TxIn {
+		spentOutput, ok := txProposal.PreviousOutputs[txIn.PreviousOutPoint]
+		if !ok {
+			return nil, errp.New("There needs to be exactly one output being spent per input.")
+		}
+		address := btcProposedTx.GetAddress(spentOutput.ScriptHashHex())
+		input := &packet.Inputs[index]
+		if address == nil {
+			if !btcProposedTx.SkipForeignInputs {
+				return nil, errp.Newf("unknown address of input %d", index)
+			}
+			// The spent output is still needed to compute the Taproot signature hashes.
+			var txOutBuf bytes.Buffer
+			if err := wire.WriteTxOut(&txOutBuf, 0, 0, spentOutput.TxOut); err != nil {
+				return nil, errp.WithStack(err)
+			}
+			input.Add(psbt.InWitnessUTXO, nil, txOutBuf.Bytes())
+			continue
+		}
+
+		// The previous transaction allows the signer to verify the input amount, also for segwit
+		// inputs.
+		prevTx, err := btcProposedTx.GetPrevTx(txIn.PreviousOutPoint.Hash)
+		if err != nil {
+			return nil, err
+		}
+		var prevTxBuf bytes.Buffer
+		if err := prevTx.Serialize(&prevTxBuf); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		input.Add(psbt.InNonWitnessUTXO, nil, prevTxBuf.Bytes())
+		scriptType := address.Configuration.ScriptType()
+		if scriptType != signing.ScriptTypeP2PKH {
+			var txOutBuf bytes.Buffer
+			if err := wire.WriteTxOut(&txOutBuf, 0, 0, spentOutput.TxOut); err != nil {
+				return nil, errp.WithStack(err)
+			}
+			input.Add(psbt.InWitnessUTXO, nil, txOutBuf.Bytes())
+		}
+		addKeyInfo(input, address, true)
+	}
+
+	if changeAddress := txProposal.ChangeAddress; changeAddress != nil {
+		for index, txOut := range unsignedTx.TxOut {
+			if bytes.Equal(txOut.PkScript, changeAddress.PubkeyScript()) {
+				addKeyInfo(&packet.Outputs[index], changeAddress, false)
+			}
+		}
+	}
+	return packet, nil
+}
+
+// addKeyInfo adds the redeem script and key derivation of the address to the input or output map.
+func addKeyInfo(m *psbt.Map, address *addresses.AccountAddress, isInput bool) {
+	configuration := address.Configuration
+	derivation := psbt.BIP32Derivation(configuration.RootFingerprint(), configuration.AbsoluteKeypath().ToUInt32())
+	publicKey := configuration.PublicKey()
+	switch configuration.ScriptType() {
+	case signing.ScriptTypeP2TR:
+		xOnly := schnorr.SerializePubKey(publicKey)
+		// No leaf hashes, only the key path is used.
+		tapDerivation := append([]byte{0x00}, derivation...)
+		if isInput {
+			m.Add(psbt.InTapInternalKey, nil, xOnly)
+			m.Add(psbt.InTapBIP32Derivation, xOnly, tapDerivation)
+		} else {
+			m.Add(psbt.OutTapInternalKey, nil, xOnly)
+			m.Add(psbt.OutTapBIP32Derivation, xOnly, tapDerivation)
+		}
+	default:
+		if configuration.ScriptType() == signing.ScriptTypeP2WPKHP2SH {
+			_, redeemScript := address.ScriptForHashToSign()
+			if isInput {
+				m.Add(psbt.InRedeemScript, nil, redeemScript)
+			} else {
+				m.Add(psbt.OutRedeemScript, nil, redeemScript)
+			}
+		}
+		if isInput {
+			m.Add(psbt.InBIP32Derivation, publicKey.SerializeCompressed(), derivation)
+		} else {
+			m.Add(psbt.OutBIP32Derivation, publicKey.SerializeCompressed(), derivation)
+		}
+	}
+}
+
+// signaturesFromPSBT extracts and verifies the signatures of all inputs of the signed PSBT.
+func signaturesFromPSBT(btcProposedTx *btc.ProposedTransaction, signed *psbt.Packet) ([]*types.Signature, error) {
+	transaction := btcProposedTx.TXProposal.Transaction
+	if signed.UnsignedTx.TxHash() != transaction.TxHash() {
+		return nil, errp.New("the external signer returned a different transaction")
+	}
+	previousOutputs := btcProposedTx.TXProposal.PreviousOutputs
+	signatures := make([]*types.Signature, len(transaction.TxIn))
+	for index, txIn := range transaction.TxIn {
+		spentOutput := previousOutputs[txIn.PreviousOutPoint]
+		address := btcProposedTx.GetAddress(spentOutput.ScriptHashHex())
+		if address == nil {
+			// Foreign input, only allowed if SkipForeignInputs is set, see makePSBT().
+			continue
+		}
+		publicKey := address.Configuration.PublicKey()
+		input := signed.Inputs[index]
+
+		if address.Configuration.ScriptType() == signing.ScriptTypeP2TR {
+			sigBytes, ok := input.Find(psbt.InTapKeySig, nil)
+			if !ok {
+				return nil, errp.Newf("input %d was not signed", index)
+			}
+			// A 65th byte is the sighash type, which must be SIGHASH_DEFAULT.
+			if len(sigBytes) == 65 && sigBytes[64] == byte(txscript.SigHashDefault) {
+				sigBytes = sigBytes[:64]
+			}
+			if len(sigBytes) != 64 {
+				return nil, errp.Newf("invalid signature of input %d", index)
+			}
+			signatureHash, err := txscript.CalcTaprootSignatureHash(
+				btcProposedTx.SigHashes, txscript.SigHashDefault, transaction,
+				index, previousOutputs)
+			if err != nil {
+				return nil, errp.WithStack(err)
+			}
+			signature, err := schnorr.ParseSignature(sigBytes)
+			if err != nil {
+				return nil, errp.WithStack(err)
+			}
+			if !signature.Verify(signatureHash, txscript.ComputeTaprootKeyNoScript(publicKey)) {
+				return nil, errp.Newf("invalid signature of input %d", index)
+			}
+			signatures[index] = &types.Signature{
+				R: new(big.Int).SetBytes(sigBytes[:32]),
+				S: new(big.Int).SetBytes(sigBytes[32:]),
+			}
+			continue
+		}
+
+		sigBytes, ok := input.Find(psbt.InPartialSig, publicKey.SerializeCompressed())
+		if !ok {
+			return nil, errp.Newf("input %d was not signed", index)
+		}
+		if len(sigBytes) == 0 || sigBytes[len(sigBytes)-1] != byte(txscript.SigHashAll) {
+			return nil, errp.Newf("signature of input %d is not SIGHASH_ALL", index)
+		}
+		der := sigBytes[:len(sigBytes)-1]
+		var signatureHash []byte
+		isSegwit, subScript := address.ScriptForHashToSign()
+		var err error
+		if isSegwit {
+			signatureHash, err = txscript.CalcWitnessSigHash(subScript, btcProposedTx.SigHashes,
+				txscript.SigHashAll, transaction, index, spentOutput.Value)
+		} else {
+			signatureHash, err = txscript.CalcSignatureHash(
+				subScript, txscript.SigHashAll, transaction, index)
+		}
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		signature, err := ecdsa.ParseDERSignature(der)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if !signature.Verify(signatureHash, publicKey) {
+			return nil, errp.Newf("invalid signature of input %d", index)
+		}
+		var rs struct {
+			R *big.Int
+			S *big.Int
+		}
+		if _, err := asn1.Unmarshal(der, &rs); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		signatures[index] = &types.Signature{R: rs.R, S: rs.S}
+	}
+	return signatures, nil
+}
@@ -0,0 +1,301 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package external
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/psbt"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	keystorePkg "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/stretchr/testify/require"
+)
+
+var tbtc = btc.NewCoin(coinpkg.CodeTBTC, "Bitcoin Testnet", "TBTC", coinpkg.BtcUnitDefault,
+	&chaincfg.TestNet3Params, ".", []*config.ServerInfo{}, "", socksproxy.NewSocksProxy(false, ""))
+
+// fakeSigner serves requests like an external signer process, signing with a software keystore.
+type fakeSigner struct {
+	t        *testing.T
+	keystore *software.Keystore
+	// proposedTx is signed by the software keystore when a PSBT is signed.
+	proposedTx *btc.ProposedTransaction
+	abort      bool
+}
+
+func (signer *fakeSigner) serve(requests io.Reader, responses io.Writer) {
+	scanner := bufio.NewScanner(requests)
+	for scanner.Scan() {
+		var req struct {
+			ID     int                        `json:"id"`
+			Method string                     `json:"method"`
+			Params map[string]json.RawMessage `json:"params"`
+		}
+		require.NoError(signer.t, json.Unmarshal(scanner.Bytes(), &req))
+		resp := map[string]interface{}{"id": req.ID}
+		if signer.abort {
+			resp["error"] = map[string]string{"code": "aborted", "message": "aborted by the user"}
+		} else {
+			resp["result"] = signer.handle(req.Method, req.Params)
+		}
+		respBytes, err := json.Marshal(resp)
+		require.NoError(signer.t, err)
+		_, err = responses.Write(append(respBytes, '\n'))
+		require.NoError(signer.t, err)
+	}
+}
+
+func (signer *fakeSigner) handle(method string, params map[string]json.RawMessage) interface{} {
+	t := signer.t
+	switch method {
+	case "getinfo":
+		return Info{
+			Name:            "Fake signer",
+			RootFingerprint: "fb7089bd",
+			Coins:           []string{"tbtc"},
+			ScriptTypes:     []string{"p2wpkh", "p2wpkh-p2sh", "p2tr"},
+			CanSignMessage:  true,
+		}
+	case "getxpub":
+		var keypath signing.AbsoluteKeypath
+		require.NoError(t, json.Unmarshal(params["keypath"], &keypath))
+		xpub, err := signer.keystore.ExtendedPublicKey(tbtc, keypath)
+		require.NoError(t, err)
+		testnetXpub, err := xpub.CloneWithVersion(chaincfg.TestNet3Params.HDPublicKeyID[:])
+		require.NoError(t, err)
+		return map[string]string{"xpub": testnetXpub.String()}
+	case "signtx":
+		var psbtBase64 string
+		require.NoError(t, json.Unmarshal(params["psbt"], &psbtBase64))
+		psbtBytes, err := base64.StdEncoding.DecodeString(psbtBase64)
+		require.NoError(t, err)
+		packet, err := psbt.Parse(psbtBytes)
+		require.NoError(t, err)
+		require.Equal(t, signer.proposedTx.TXProposal.Transaction.TxHash(), packet.UnsignedTx.TxHash())
+
+		proposedTx := *signer.proposedTx
+		require.NoError(t, signer.keystore.SignTransaction(&proposedTx))
+		for index, txIn := range packet.UnsignedTx.TxIn {
+			spentOutput := proposedTx.TXProposal.PreviousOutputs[txIn.PreviousOutPoint]
+			address := proposedTx.GetAddress(spentOutput.ScriptHashHex())
+			publicKey := address.Configuration.PublicKey()
+			signature := proposedTx.Signatures[index]
+			if address.Configuration.ScriptType() == signing.ScriptTypeP2TR {
+				_, ok := packet.Inputs[index].Find(psbt.InTapInternalKey, nil)
+				require.True(t, ok)
+				packet.Inputs[index].Add(psbt.InTapKeySig, nil, signature.SerializeCompact())
+			} else {
+				_, ok := packet.Inputs[index].Find(psbt.InBIP32Derivation, publicKey.SerializeCompressed())
+				require.True(t, ok)
+				packet.Inputs[index].Add(psbt.InPartialSig, publicKey.SerializeCompressed(),
+					append(signature.SerializeDER(), byte(txscript.SigHashAll)))
+			}
+		}
+		serialized, err := packet.Serialize()
+		require.NoError(t, err)
+		return map[string]string{"psbt": base64.StdEncoding.EncodeToString(serialized)}
+	case "displayaddress":
+		return map[string]string{}
+	default:
+		require.Fail(t, "unexpected method "+method)
+		return nil
+	}
+}
+
+func newTestKeystore(t *testing.T) (*Keystore, *fakeSigner) {
+	t.Helper()
+	rootXprv, err := hdkeychain.NewKeyFromString("xprv9s21ZrQH143K3uDh9hiNXB3a9GVzcCujEmCwmZA9g8m4i5nUDVdLHJjsLMPzV26vj8Q7ceGrUhX119Y3XzGhJqq5K6LWP1h6gjv2cbkMEH1")
+	require.NoError(t, err)
+	signer := &fakeSigner{t: t, keystore: software.NewKeystore(rootXprv)}
+	requestsReader, requestsWriter := io.Pipe()
+	responsesReader, responsesWriter := io.Pipe()
+	go signer.serve(requestsReader, responsesWriter)
+	t.Cleanup(func() {
+		_ = requestsWriter.Close()
+	})
+	keystore, err := newKeystore(
+		newClient(requestsWriter, responsesReader, logging.Get().WithGroup("external")),
+		logging.Get().WithGroup("external"))
+	require.NoError(t, err)
+	return keystore, signer
+}
+
+func TestKeystoreCapabilities(t *testing.T) {
+	keystore, signer := newTestKeystore(t)
+	rootFingerprint, err := keystore.RootFingerprint()
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xfb, 0x70, 0x89, 0xbd}, rootFingerprint)
+	require.Equal(t, keystorePkg.TypeHardware, keystore.Type())
+	require.True(t, keystore.SupportsCoin(tbtc))
+	require.True(t, keystore.SupportsAccount(tbtc, signing.ScriptTypeP2TR))
+	require.False(t, keystore.SupportsAccount(tbtc, signing.ScriptTypeP2PKH))
+	require.False(t, keystore.SupportsUnifiedAccounts())
+	canVerify, _, err := keystore.CanVerifyAddress(tbtc)
+	require.NoError(t, err)
+	require.False(t, canVerify)
+	require.False(t, keystore.CanVerifyExtendedPublicKey())
+	require.True(t, keystore.CanSignMessage(coinpkg.CodeTBTC))
+	require.False(t, keystore.CanSignMessage(coinpkg.CodeETH))
+	require.True(t, keystore.CanSignBIP322(coinpkg.CodeTBTC))
+	require.False(t, keystore.CanSignBIP322(coinpkg.CodeETH))
+	require.True(t, keystore.CanSignProofOfReserves(coinpkg.CodeTBTC))
+	require.False(t, keystore.CanSignProofOfReserves(coinpkg.CodeETH))
+
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/1'/0'")
+	require.NoError(t, err)
+	xpub, err := keystore.ExtendedPublicKey(tbtc, keypath)
+	require.NoError(t, err)
+	expectedXpub, err := signer.keystore.ExtendedPublicKey(tbtc, keypath)
+	require.NoError(t, err)
+	require.Equal(t, expectedXpub.String(), xpub.String())
+}
+
+func TestSignTransaction(t *testing.T) {
+	keystore, signer := newTestKeystore(t)
+	rootFingerprint, err := keystore.RootFingerprint()
+	require.NoError(t, err)
+	log := logging.Get().WithGroup("external_test")
+
+	makeAddress := func(scriptType signing.ScriptType, accountKeypath string, change uint32) *addresses.AccountAddress {
+		keypath, err := signing.NewAbsoluteKeypath(accountKeypath)
+		require.NoError(t, err)
+		xpub, err := keystore.ExtendedPublicKey(tbtc, keypath)
+		require.NoError(t, err)
+		configuration := signing.NewBitcoinConfiguration(scriptType, rootFingerprint, keypath, xpub)
+		return addresses.NewAccountAddress(
+			configuration,
+			signing.NewEmptyRelativeKeypath().Child(change, false).Child(0, false),
+			tbtc.Net(), log)
+	}
+	inputAddresses := []*addresses.AccountAddress{
+		makeAddress(signing.ScriptTypeP2WPKH, "m/84'/1'/0'", 0),
+		makeAddress(signing.ScriptTypeP2WPKHP2SH, "m/49'/1'/0'", 0),
+		makeAddress(signing.ScriptTypeP2TR, "m/86'/1'/0'", 0),
+	}
+	changeAddress := makeAddress(signing.ScriptTypeP2WPKH, "m/84'/1'/0'", 1)
+	addressesByScriptHash := map[blockchain.ScriptHashHex]*addresses.AccountAddress{}
+	for _, address := range append(inputAddresses, changeAddress) {
+		addressesByScriptHash[address.PubkeyScriptHashHex()] = address
+	}
+
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	for _, address := range inputAddresses {
+		prevTx.AddTxOut(wire.NewTxOut(100000, address.PubkeyScript()))
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	previousOutputs := maketx.PreviousOutputs{}
+	for index := range inputAddresses {
+		outPoint := wire.NewOutPoint(&[]chainhash.Hash{prevTx.TxHash()}[0], uint32(index))
+		tx.AddTxIn(wire.NewTxIn(outPoint, nil, nil))
+		previousOutputs[*outPoint] = &transactions.SpendableOutput{TxOut: prevTx.TxOut[index]}
+	}
+	tx.AddTxOut(wire.NewTxOut(200000, inputAddresses[0].PubkeyScript()))
+	tx.AddTxOut(wire.NewTxOut(90000, changeAddress.PubkeyScript()))
+
+	proposedTx := &btc.ProposedTransaction{
+		TXProposal: &maketx.TxProposal{
+			Coin:            tbtc,
+			Transaction:     tx,
+			ChangeAddress:   changeAddress,
+			PreviousOutputs: previousOutputs,
+		},
+		GetAddress: func(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
+			return addressesByScriptHash[scriptHashHex]
+		},
+		GetPrevTx: func(hash chainhash.Hash) (*wire.MsgTx, error) {
+			require.Equal(t, prevTx.TxHash(), hash)
+			return prevTx, nil
+		},
+		Signatures: make([]*types.Signature, len(tx.TxIn)),
+		SigHashes:  txscript.NewTxSigHashes(tx, previousOutputs),
+	}
+	signer.proposedTx = proposedTx
+
+	// The PSBT contains the keypath of the change output.
+	packet, err := keystore.makePSBT(proposedTx)
+	require.NoError(t, err)
+	_, ok := packet.Outputs[1].Find(psbt.OutBIP32Derivation,
+		changeAddress.Configuration.PublicKey().SerializeCompressed())
+	require.True(t, ok)
+	require.Empty(t, packet.Outputs[0])
+
+	require.NoError(t, keystore.SignTransaction(proposedTx))
+	for index, txIn := range tx.TxIn {
+		address := inputAddresses[index]
+		txIn.SignatureScript, txIn.Witness = address.SignatureScript(*proposedTx.Signatures[index])
+	}
+	for index := range tx.TxIn {
+		engine, err := txscript.NewEngine(prevTx.TxOut[index].PkScript, tx, index,
+			txscript.StandardVerifyFlags, nil, proposedTx.SigHashes, prevTx.TxOut[index].Value,
+			previousOutputs)
+		require.NoError(t, err)
+		require.NoError(t, engine.Execute())
+	}
+
+	signer.abort = true
+	require.True(t, errors.Is(keystore.SignTransaction(proposedTx), keystorePkg.ErrSigningAborted))
+}
+
+func TestCallTimeout(t *testing.T) {
+	requestsReader, requestsWriter := io.Pipe()
+	responsesReader, responsesWriter := io.Pipe()
+	go func() { _, _ = io.Copy(io.Discard, requestsReader) }()
+	defer requestsWriter.Close()
+	client := newClient(requestsWriter, responsesReader, logging.Get().WithGroup("external"))
+
+	// The signer does not respond.
+	err := client.callWithTimeout("getinfo", nil, nil, 10*time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "did not respond")
+
+	// A late response is dropped and does not become the response to the next request.
+	_, err = responsesWriter.Write([]byte(`{"id":1,"result":{}}` + "\n"))
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = responsesWriter.Write([]byte(`{"id":2,"result":{}}` + "\n"))
+	}()
+	require.NoError(t, client.callWithTimeout("getinfo", nil, nil, time.Second))
+
+	// The signer exits.
+	require.NoError(t, responsesWriter.Close())
+	<-client.readDone
+	err = client.call("getinfo", nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exited")
+}
@@ -87,6 +87,12 @@ type Keystore interface {
 
 	// CanSignMessage returns true if the keystore can sign a message for a coin.
 	CanSignMessage(coin.Code) bool
+	// CanSignBIP322 returns true if the keystore can sign a BIP322 message signature for a coin,
+	// i.e. the virtual version 0 transaction with an OP_RETURN output.
+	CanSignBIP322(coin.Code) bool
+	// CanSignProofOfReserves returns true if the keystore can sign a BIP127 proof of reserves for
+	// a coin, i.e. a transaction with an unsignable commitment input and an OP_TRUE output.
+	CanSignProofOfReserves(coin.Code) bool
 	// SignBTCMessage signs the message using the private key at the keypath. The scriptType is
 	// required to compute and verify the address. The returned signature is a 65 byte signature in
 	// Electrum format.
@@ -95,6 +101,10 @@ type Keystore interface {
 	// 65 byte signature. The first 64 bytes are the secp256k1 signature in / compact format (R and
 	// S values), and the last byte is the recoverable id (recid).
 	SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error)
+	// SignETHTypedMessage signs the EIP-712 typed data, given as JSON like for
+	// `eth_signTypedData_v4`, using the private key at the keypath. The result is a 65 byte
+	// signature like for SignETHMessage.
+	SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error)
 
 	// SignTransaction signs the given transaction proposal. Returns ErrSigningAborted if the user
 	// aborts.
@@ -21,9 +21,15 @@ var _ keystore.Keystore = &KeystoreMock{}
 //
 //		// make and configure a mocked keystore.Keystore
 //		mockedKeystore := &KeystoreMock{
+//			CanSignBIP322Func: func(code coin.Code) bool {
+//				panic("mock out the CanSignBIP322 method")
+//			},
 //			CanSignMessageFunc: func(code coin.Code) bool {
 //				panic("mock out the CanSignMessage method")
 //			},
+//			CanSignProofOfReservesFunc: func(code coin.Code) bool {
+//				panic("mock out the CanSignProofOfReserves method")
+//			},
 //			CanVerifyAddressFunc: func(coinMoqParam coin.Coin) (bool, bool, error) {
 //				panic("mock out the CanVerifyAddress method")
 //			},
@@ -42,6 +48,9 @@ var _ keystore.Keystore = &KeystoreMock{}
 //			SignETHMessageFunc: func(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
 //				panic("mock out the SignETHMessage method")
 //			},
+//			SignETHTypedMessageFunc: func(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+//				panic("mock out the SignETHTypedMessage method")
+//			},
 //			SignTransactionFunc: func(ifaceVal interface{}) error {
 //				panic("mock out the SignTransaction method")
 //			},
@@ -73,9 +82,15 @@ var _ keystore.Keystore = &KeystoreMock{}
 //
 //	}
 type KeystoreMock struct {
+	// CanSignBIP322Func mocks the CanSignBIP322 method.
+	CanSignBIP322Func func(code coin.Code) bool
+
 	// CanSignMessageFunc mocks the CanSignMessage method.
 	CanSignMessageFunc func(code coin.Code) bool
 
+	// CanSignProofOfReservesFunc mocks the CanSignProofOfReserves method.
+	CanSignProofOfReservesFunc func(code coin.Code) bool
+
 	// CanVerifyAddressFunc mocks the CanVerifyAddress method.
 	CanVerifyAddressFunc func(coinMoqParam coin.Coin) (bool, bool, error)
 
@@ -94,6 +109,9 @@ type KeystoreMock struct {
 	// SignETHMessageFunc mocks the SignETHMessage method.
 	SignETHMessageFunc func(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error)
 
+	// SignETHTypedMessageFunc mocks the SignETHTypedMessage method.
+	SignETHTypedMessageFunc func(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error)
+
 	// SignTransactionFunc mocks the SignTransaction method.
 	SignTransactionFunc func(ifaceVal interface{}) error
 
@@ -120,11 +138,21 @@ type KeystoreMock struct {
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// CanSignBIP322 holds details about calls to the CanSignBIP322 method.
+		CanSignBIP322 []struct {
+			// Code is the code argument value.
+			Code coin.Code
+		}
 		// CanSignMessage holds details about calls to the CanSignMessage method.
 		CanSignMessage []struct {
 			// Code is the code argument value.
 			Code coin.Code
 		}
+		// CanSignProofOfReserves holds details about calls to the CanSignProofOfReserves method.
+		CanSignProofOfReserves []struct {
+			// Code is the code argument value.
+			Code coin.Code
+		}
 		// CanVerifyAddress holds details about calls to the CanVerifyAddress method.
 		CanVerifyAddress []struct {
 			// CoinMoqParam is the coinMoqParam argument value.
@@ -159,6 +187,15 @@ type KeystoreMock struct {
 			// Keypath is the keypath argument value.
 			Keypath signing.AbsoluteKeypath
 		}
+		// SignETHTypedMessage holds details about calls to the SignETHTypedMessage method.
+		SignETHTypedMessage []struct {
+			// ChainID is the chainID argument value.
+			ChainID uint64
+			// Data is the data argument value.
+			Data []byte
+			// Keypath is the keypath argument value.
+			Keypath signing.AbsoluteKeypath
+		}
 		// SignTransaction holds details about calls to the SignTransaction method.
 		SignTransaction []struct {
 			// IfaceVal is the ifaceVal argument value.
@@ -200,13 +237,16 @@ type KeystoreMock struct {
 			Configuration *signing.Configuration
 		}
 	}
+	lockCanSignBIP322              sync.RWMutex
 	lockCanSignMessage             sync.RWMutex
+	lockCanSignProofOfReserves     sync.RWMutex
 	lockCanVerifyAddress           sync.RWMutex
 	lockCanVerifyExtendedPublicKey sync.RWMutex
 	lockExtendedPublicKey          sync.RWMutex
 	lockRootFingerprint            sync.RWMutex
 	lockSignBTCMessage             sync.RWMutex
 	lockSignETHMessage             sync.RWMutex
+	lockSignETHTypedMessage        sync.RWMutex
 	lockSignTransaction            sync.RWMutex
 	lockSupportsAccount            sync.RWMutex
 	lockSupportsCoin               sync.RWMutex
@@ -217,6 +257,38 @@ type KeystoreMock struct {
 	lockVerifyExtendedPublicKey    sync.RWMutex
 }
 
+// CanSignBIP322 calls CanSignBIP322Func.
+func (mock *KeystoreMock) CanSignBIP322(code coin.Code) bool {
+	if mock.CanSignBIP322Func == nil {
+		panic("KeystoreMock.CanSignBIP322Func: method is nil but Keystore.CanSignBIP322 was just called")
+	}
+	callInfo := struct {
+		Code coin.Code
+	}{
+		Code: code,
+	}
+	mock.lockCanSignBIP322.Lock()
+	mock.calls.CanSignBIP322 = append(mock.calls.CanSignBIP322, callInfo)
+	mock.lockCanSignBIP322.Unlock()
+	return mock.CanSignBIP322Func(code)
+}
+
+// CanSignBIP322Calls gets all the calls that were made to CanSignBIP322.
+// Check the length with:
+//
+//	len(mockedKeystore.CanSignBIP322Calls())
+func (mock *KeystoreMock) CanSignBIP322Calls() []struct {
+	Code coin.Code
+} {
+	var calls []struct {
+		Code coin.Code
+	}
+	mock.lockCanSignBIP322.RLock()
+	calls = mock.calls.CanSignBIP322
+	mock.lockCanSignBIP322.RUnlock()
+	return calls
+}
+
 // CanSignMessage calls CanSignMessageFunc.
 func (mock *KeystoreMock) CanSignMessage(code coin.Code) bool {
 	if mock.CanSignMessageFunc == nil {
@@ -249,6 +321,38 @@ func (mock *KeystoreMock) CanSignMessageCalls() []struct {
 	return calls
 }
 
+// CanSignProofOfReserves calls CanSignProofOfReservesFunc.
+func (mock *KeystoreMock) CanSignProofOfReserves(code coin.Code) bool {
+	if mock.CanSignProofOfReservesFunc == nil {
+		panic("KeystoreMock.CanSignProofOfReservesFunc: method is nil but Keystore.CanSignProofOfReserves was just called")
+	}
+	callInfo := struct {
+		Code coin.Code
+	}{
+		Code: code,
+	}
+	mock.lockCanSignProofOfReserves.Lock()
+	mock.calls.CanSignProofOfReserves = append(mock.calls.CanSignProofOfReserves, callInfo)
+	mock.lockCanSignProofOfReserves.Unlock()
+	return mock.CanSignProofOfReservesFunc(code)
+}
+
+// CanSignProofOfReservesCalls gets all the calls that were made to CanSignProofOfReserves.
+// Check the length with:
+//
+//	len(mockedKeystore.CanSignProofOfReservesCalls())
+func (mock *KeystoreMock) CanSignProofOfReservesCalls() []struct {
+	Code coin.Code
+} {
+	var calls []struct {
+		Code coin.Code
+	}
+	mock.lockCanSignProofOfReserves.RLock()
+	calls = mock.calls.CanSignProofOfReserves
+	mock.lockCanSignProofOfReserves.RUnlock()
+	return calls
+}
+
 // CanVerifyAddress calls CanVerifyAddressFunc.
 func (mock *KeystoreMock) CanVerifyAddress(coinMoqParam coin.Coin) (bool, bool, error) {
 	if mock.CanVerifyAddressFunc == nil {
@@ -447,6 +551,46 @@ func (mock *KeystoreMock) SignETHMessageCalls() []struct {
 	return calls
 }
 
+// SignETHTypedMessage calls SignETHTypedMessageFunc.
+func (mock *KeystoreMock) SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	if mock.SignETHTypedMessageFunc == nil {
+		panic("KeystoreMock.SignETHTypedMessageFunc: method is nil but Keystore.SignETHTypedMessage was just called")
+	}
+	callInfo := struct {
+		ChainID uint64
+		Data    []byte
+		Keypath signing.AbsoluteKeypath
+	}{
+		ChainID: chainID,
+		Data:    data,
+		Keypath: keypath,
+	}
+	mock.lockSignETHTypedMessage.Lock()
+	mock.calls.SignETHTypedMessage = append(mock.calls.SignETHTypedMessage, callInfo)
+	mock.lockSignETHTypedMessage.Unlock()
+	return mock.SignETHTypedMessageFunc(chainID, data, keypath)
+}
+
+// SignETHTypedMessageCalls gets all the calls that were made to SignETHTypedMessage.
+// Check the length with:
+//
+//	len(mockedKeystore.SignETHTypedMessageCalls())
+func (mock *KeystoreMock) SignETHTypedMessageCalls() []struct {
+	ChainID uint64
+	Data    []byte
+	Keypath signing.AbsoluteKeypath
+} {
+	var calls []struct {
+		ChainID uint64
+		Data    []byte
+		Keypath signing.AbsoluteKeypath
+	}
+	mock.lockSignETHTypedMessage.RLock()
+	calls = mock.calls.SignETHTypedMessage
+	mock.lockSignETHTypedMessage.RUnlock()
+	return calls
+}
+
 // SignTransaction calls SignTransactionFunc.
 func (mock *KeystoreMock) SignTransaction(ifaceVal interface{}) error {
 	if mock.SignTransactionFunc == nil {
@@ -0,0 +1,125 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package software
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed" // Needed for the go:embed directive below.
+	"math/big"
+	"strings"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// bip39EnglishWordlist is the BIP39 English wordlist from
+// https://github.com/bitcoin/bips/blob/master/bip-0039/english.txt.
+//
+//go:embed bip39_english.txt
+var bip39EnglishWordlist string
+
+var bip39Words = strings.Fields(bip39EnglishWordlist)
+
+var bip39WordIndices = func() map[string]int64 {
+	indices := make(map[string]int64, len(bip39Words))
+	for index, word := range bip39Words {
+		indices[word] = int64(index)
+	}
+	return indices
+}()
+
+// validMnemonicLength returns true if a mnemonic can have the given number of words.
+func validMnemonicLength(numWords int) bool {
+	return numWords >= 12 && numWords <= 24 && numWords%3 == 0
+}
+
+// NewMnemonic returns a new random BIP39 mnemonic with the given number of words, which must be 12,
+// 15, 18, 21 or 24.
+func NewMnemonic(numWords int) (string, error) {
+	if !validMnemonicLength(numWords) {
+		return "", errp.Newf("invalid number of words %d", numWords)
+	}
+	entropy := make([]byte, numWords*4/3)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", errp.WithStack(err)
+	}
+	return entropyToMnemonic(entropy), nil
+}
+
+// entropyToMnemonic encodes the entropy, followed by its checksum, in words of 11 bits each.
+func entropyToMnemonic(entropy []byte) string {
+	checksumBits := len(entropy) / 4
+	hash := sha256.Sum256(entropy)
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, uint(checksumBits))
+	bits.Or(bits, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	words := make([]string, (len(entropy)*8+checksumBits)/11)
+	wordMask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = bip39Words[new(big.Int).And(bits, wordMask).Int64()]
+		bits.Rsh(bits, 11)
+	}
+	return strings.Join(words, " ")
+}
+
+// mnemonicToEntropy decodes the mnemonic and verifies its checksum.
+func mnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if !validMnemonicLength(len(words)) {
+		return nil, errp.Newf("invalid number of words %d", len(words))
+	}
+	bits := new(big.Int)
+	for _, word := range words {
+		index, ok := bip39WordIndices[word]
+		if !ok {
+			return nil, errp.Newf("invalid word %q", word)
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(index))
+	}
+	checksumBits := len(words) / 3
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1)).Uint64()
+	bits.Rsh(bits, uint(checksumBits))
+	entropy := bits.FillBytes(make([]byte, len(words)*4/3))
+	hash := sha256.Sum256(entropy)
+	if uint64(hash[0]>>(8-checksumBits)) != checksum {
+		return nil, errp.New("invalid mnemonic checksum")
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic returns an error if the mnemonic is not a valid BIP39 mnemonic.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := mnemonicToEntropy(mnemonic)
+	return err
+}
+
+// MnemonicToSeed returns the BIP39 seed of the mnemonic and the optional passphrase. Only ASCII
+// passphrases are supported, as they do not change under the NFKD normalization required by BIP39.
+func MnemonicToSeed(mnemonic string, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	for _, char := range passphrase {
+		if char > 127 {
+			return nil, errp.New("only ASCII characters are supported in the passphrase")
+		}
+	}
+	normalized := strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package software
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBIP39Wordlist(t *testing.T) {
+	require.Len(t, bip39Words, 2048)
+	require.Equal(t, "abandon", bip39Words[0])
+	require.Equal(t, "zoo", bip39Words[2047])
+}
+
+func TestMnemonicToSeed(t *testing.T) {
+	// Test vectors from https://github.com/trezor/python-mnemonic/blob/master/vectors.json.
+	vectors := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+			"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		},
+	}
+	for _, vector := range vectors {
+		entropy, err := hex.DecodeString(vector.entropy)
+		require.NoError(t, err)
+		require.Equal(t, vector.mnemonic, entropyToMnemonic(entropy))
+		decoded, err := mnemonicToEntropy(vector.mnemonic)
+		require.NoError(t, err)
+		require.Equal(t, entropy, decoded)
+		seed, err := MnemonicToSeed(vector.mnemonic, "TREZOR")
+		require.NoError(t, err)
+		require.Equal(t, vector.seed, hex.EncodeToString(seed))
+	}
+
+	// Same mnemonic as in TestRootFingerprint.
+	seed, err := MnemonicToSeed(
+		"awkward squirrel wait rubber biology escape toe daring still pause fitness vendor", "")
+	require.NoError(t, err)
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	require.Equal(t,
+		"xprv9s21ZrQH143K3uDh9hiNXB3a9GVzcCujEmCwmZA9g8m4i5nUDVdLHJjsLMPzV26vj8Q7ceGrUhX119Y3XzGhJqq5K6LWP1h6gjv2cbkMEH1",
+		master.String())
+}
+
+func TestValidateMnemonic(t *testing.T) {
+	mnemonic, err := NewMnemonic(24)
+	require.NoError(t, err)
+	require.NoError(t, ValidateMnemonic(mnemonic))
+	mnemonic, err = NewMnemonic(12)
+	require.NoError(t, err)
+	require.NoError(t, ValidateMnemonic(mnemonic))
+	_, err = NewMnemonic(13)
+	require.Error(t, err)
+
+	// Invalid checksum.
+	require.Error(t, ValidateMnemonic(
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon"))
+	// Unknown word.
+	require.Error(t, ValidateMnemonic(
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon bitbox"))
+	// Too short.
+	require.Error(t, ValidateMnemonic("abandon about"))
+
+	_, err = MnemonicToSeed(
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "ä")
+	require.Error(t, err)
+}
@@ -0,0 +1,421 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package software
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	keystorePkg "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/crypto"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrLocked is returned if the seed is needed, e.g. to sign a transaction, but the keystore is
+	// locked. The keystore needs to be unlocked with the password first.
+	ErrLocked = errors.New("keystoreLocked")
+	// ErrWrongPassword is returned when unlocking the keystore with a wrong password.
+	ErrWrongPassword = errors.New("wrongPassword")
+)
+
+// DefaultIdleTimeout is the time after which an unlocked keystore is locked again if it is not
+// used.
+const DefaultIdleTimeout = 5 * time.Minute
+
+const encryptedSeedFileVersion = 1
+
+// scryptParams are the parameters to derive the encryption keys from the password. N=2^15, r=8,
+// p=1 take about 100ms and 32MB of memory.
+type scryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// defaultScryptN can be lowered in unit tests to speed them up.
+var defaultScryptN = 1 << 15
+
+// encryptedSeedFile is the format of the file storing the encrypted seed.
+type encryptedSeedFile struct {
+	Version int `json:"version"`
+	// RootFingerprint is hex encoded and stored in plaintext, so that the keystore can be identified
+	// while it is locked.
+	RootFingerprint string       `json:"rootFingerprint"`
+	Scrypt          scryptParams `json:"scrypt"`
+	// EncryptedSeed is the BIP39 seed, encrypted with AES-256-CBC and authenticated with
+	// HMAC-SHA256, see `crypto.EncryptThenMAC()`. The 64 byte scrypt output is split into the
+	// encryption and the authentication key.
+	EncryptedSeed []byte `json:"encryptedSeed"`
+}
+
+// deriveKeys derives the encryption and authentication keys from the password.
+func (params *scryptParams) deriveKeys(password string) ([]byte, []byte, error) {
+	key, err := scrypt.Key([]byte(password), params.Salt, params.N, params.R, params.P, 64)
+	if err != nil {
+		return nil, nil, errp.WithStack(err)
+	}
+	return key[:32], key[32:], nil
+}
+
+// EncryptedKeystore is a software keystore whose seed is stored on disk, encrypted with a password.
+// The seed is only kept in memory while the keystore is unlocked. It is locked again
+// automatically when it was not used for the idle timeout.
+//
+// Extended public keys which were derived while the keystore was unlocked are cached, so that
+// accounts can be loaded while it is locked.
+type EncryptedKeystore struct {
+	rootFingerprint []byte
+	file            *encryptedSeedFile
+	idleTimeout     time.Duration
+	log             *logrus.Entry
+
+	mu sync.Mutex
+	// unlocked is nil while the keystore is locked.
+	unlocked  *Keystore
+	lockTimer *time.Timer
+	xpubs     map[string]*hdkeychain.ExtendedKey
+	onLock    func()
+}
+
+// CreateEncryptedKeystore stores the seed of the BIP39 mnemonic and the optional passphrase in a
+// new file, encrypted with the password. The returned keystore is unlocked.
+func CreateEncryptedKeystore(
+	filename string, mnemonic string, passphrase string, password string, idleTimeout time.Duration,
+) (*EncryptedKeystore, error) {
+	if password == "" {
+		return nil, errp.New("the password must not be empty")
+	}
+	seed, err := MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	unlocked := NewKeystore(master)
+	rootFingerprint, err := unlocked.RootFingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	params := scryptParams{N: defaultScryptN, R: 8, P: 1, Salt: salt}
+	encryptionKey, authenticationKey, err := params.deriveKeys(password)
+	if err != nil {
+		return nil, err
+	}
+	encryptedSeed, err := crypto.EncryptThenMAC(seed, encryptionKey, authenticationKey)
+	if err != nil {
+		return nil, err
+	}
+	file := &encryptedSeedFile{
+		Version:         encryptedSeedFileVersion,
+		RootFingerprint: hex.EncodeToString(rootFingerprint),
+		Scrypt:          params,
+		EncryptedSeed:   encryptedSeed,
+	}
+	jsonBytes, err := json.Marshal(file)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	// O_EXCL: never overwrite an existing seed.
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if _, err := f.Write(jsonBytes); err != nil {
+		_ = f.Close()
+		return nil, errp.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, errp.WithStack(err)
+	}
+
+	keystore := newEncryptedKeystore(rootFingerprint, file, idleTimeout)
+	keystore.mu.Lock()
+	keystore.setUnlocked(unlocked)
+	keystore.mu.Unlock()
+	return keystore, nil
+}
+
+// LoadEncryptedKeystore loads a keystore stored with `CreateEncryptedKeystore()`. The returned
+// keystore is locked.
+func LoadEncryptedKeystore(filename string, idleTimeout time.Duration) (*EncryptedKeystore, error) {
+	jsonBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	file := &encryptedSeedFile{}
+	if err := json.Unmarshal(jsonBytes, file); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if file.Version != encryptedSeedFileVersion {
+		return nil, errp.Newf("unsupported version %d", file.Version)
+	}
+	rootFingerprint, err := hex.DecodeString(file.RootFingerprint)
+	if err != nil || len(rootFingerprint) != 4 {
+		return nil, errp.Newf("invalid root fingerprint %q", file.RootFingerprint)
+	}
+	return newEncryptedKeystore(rootFingerprint, file, idleTimeout), nil
+}
+
+func newEncryptedKeystore(
+	rootFingerprint []byte, file *encryptedSeedFile, idleTimeout time.Duration) *EncryptedKeystore {
+	return &EncryptedKeystore{
+		rootFingerprint: rootFingerprint,
+		file:            file,
+		idleTimeout:     idleTimeout,
+		log: logging.Get().WithGroup("software").
+			WithField("rootFingerprint", file.RootFingerprint),
+		xpubs: map[string]*hdkeychain.ExtendedKey{},
+	}
+}
+
+// SetOnLock sets a callback which is called when the keystore is locked, e.g. after the idle
+// timeout.
+func (keystore *EncryptedKeystore) SetOnLock(onLock func()) {
+	keystore.mu.Lock()
+	defer keystore.mu.Unlock()
+	keystore.onLock = onLock
+}
+
+// setUnlocked keeps the decrypted keystore and (re)starts the idle timer. mu must be held.
+func (keystore *EncryptedKeystore) setUnlocked(unlocked *Keystore) {
+	keystore.unlocked = unlocked
+	if keystore.lockTimer != nil {
+		keystore.lockTimer.Stop()
+	}
+	keystore.lockTimer = time.AfterFunc(keystore.idleTimeout, keystore.Lock)
+}
+
+// Unlock decrypts the seed with the password. ErrWrongPassword is returned if the password is
+// wrong.
+func (keystore *EncryptedKeystore) Unlock(password string) error {
+	encryptionKey, authenticationKey, err := keystore.file.Scrypt.deriveKeys(password)
+	if err != nil {
+		return err
+	}
+	// The seed is decrypted in place, so we work on a copy.
+	encryptedSeed := append([]byte{}, keystore.file.EncryptedSeed...)
+	seed, err := crypto.MACThenDecrypt(encryptedSeed, encryptionKey, authenticationKey)
+	if err != nil {
+		return errp.WithStack(ErrWrongPassword)
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	unlocked := NewKeystore(master)
+	rootFingerprint, err := unlocked.RootFingerprint()
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(rootFingerprint) != keystore.file.RootFingerprint {
+		return errp.New("the decrypted seed does not match the root fingerprint")
+	}
+	keystore.mu.Lock()
+	defer keystore.mu.Unlock()
+	keystore.setUnlocked(unlocked)
+	keystore.log.Info("unlocked")
+	return nil
+}
+
+// Lock removes the decrypted seed from memory.
+func (keystore *EncryptedKeystore) Lock() {
+	keystore.mu.Lock()
+	if keystore.unlocked == nil {
+		keystore.mu.Unlock()
+		return
+	}
+	keystore.unlocked = nil
+	if keystore.lockTimer != nil {
+		keystore.lockTimer.Stop()
+		keystore.lockTimer = nil
+	}
+	onLock := keystore.onLock
+	keystore.mu.Unlock()
+	keystore.log.Info("locked")
+	if onLock != nil {
+		onLock()
+	}
+}
+
+// Locked returns true if the keystore is locked.
+func (keystore *EncryptedKeystore) Locked() bool {
+	keystore.mu.Lock()
+	defer keystore.mu.Unlock()
+	return keystore.unlocked == nil
+}
+
+// withUnlocked calls f with the decrypted keystore and resets the idle timer. ErrLocked is returned
+// if the keystore is locked.
+func (keystore *EncryptedKeystore) withUnlocked(f func(*Keystore) error) error {
+	keystore.mu.Lock()
+	defer keystore.mu.Unlock()
+	if keystore.unlocked == nil {
+		return errp.WithStack(ErrLocked)
+	}
+	keystore.lockTimer.Reset(keystore.idleTimeout)
+	return f(keystore.unlocked)
+}
+
+// Type implements keystore.Keystore.
+func (keystore *EncryptedKeystore) Type() keystorePkg.Type {
+	return keystorePkg.TypeSoftware
+}
+
+// RootFingerprint implements keystore.Keystore. It is available while the keystore is locked.
+func (keystore *EncryptedKeystore) RootFingerprint() ([]byte, error) {
+	return keystore.rootFingerprint, nil
+}
+
+// SupportsCoin implements keystore.Keystore.
+func (keystore *EncryptedKeystore) SupportsCoin(coin coin.Coin) bool {
+	return (*Keystore)(nil).SupportsCoin(coin)
+}
+
+// SupportsAccount implements keystore.Keystore.
+func (keystore *EncryptedKeystore) SupportsAccount(coin coin.Coin, meta interface{}) bool {
+	return (*Keystore)(nil).SupportsAccount(coin, meta)
+}
+
+// SupportsUnifiedAccounts implements keystore.Keystore.
+func (keystore *EncryptedKeystore) SupportsUnifiedAccounts() bool {
+	return true
+}
+
+// SupportsMultipleAccounts implements keystore.Keystore.
+func (keystore *EncryptedKeystore) SupportsMultipleAccounts() bool {
+	return true
+}
+
+// CanVerifyAddress implements keystore.Keystore.
+func (keystore *EncryptedKeystore) CanVerifyAddress(coin.Coin) (bool, bool, error) {
+	return false, false, nil
+}
+
+// VerifyAddress implements keystore.Keystore.
+func (keystore *EncryptedKeystore) VerifyAddress(*signing.Configuration, coin.Coin) error {
+	return errp.New("The software-based keystore has no secure output to display the address.")
+}
+
+// CanVerifyExtendedPublicKey implements keystore.Keystore.
+func (keystore *EncryptedKeystore) CanVerifyExtendedPublicKey() bool {
+	return false
+}
+
+// VerifyExtendedPublicKey implements keystore.Keystore.
+func (keystore *EncryptedKeystore) VerifyExtendedPublicKey(coin.Coin, *signing.Configuration) error {
+	return errp.New("The software-based keystore has no secure output to display the public key.")
+}
+
+// ExtendedPublicKey implements keystore.Keystore. Keys derived before are available while the
+// keystore is locked.
+func (keystore *EncryptedKeystore) ExtendedPublicKey(
+	coin coin.Coin, absoluteKeypath signing.AbsoluteKeypath,
+) (*hdkeychain.ExtendedKey, error) {
+	keystore.mu.Lock()
+	xpub, ok := keystore.xpubs[absoluteKeypath.Encode()]
+	keystore.mu.Unlock()
+	if ok {
+		return xpub, nil
+	}
+	err := keystore.withUnlocked(func(unlocked *Keystore) error {
+		var err error
+		xpub, err = unlocked.ExtendedPublicKey(coin, absoluteKeypath)
+		if err != nil {
+			return err
+		}
+		keystore.xpubs[absoluteKeypath.Encode()] = xpub
+		return nil
+	})
+	return xpub, err
+}
+
+// CanSignMessage implements keystore.Keystore.
+func (keystore *EncryptedKeystore) CanSignMessage(code coin.Code) bool {
+	return (*Keystore)(nil).CanSignMessage(code)
+}
+
+// CanSignBIP322 implements keystore.Keystore.
+func (keystore *EncryptedKeystore) CanSignBIP322(code coin.Code) bool {
+	return (*Keystore)(nil).CanSignBIP322(code)
+}
+
+// CanSignProofOfReserves implements keystore.Keystore.
+func (keystore *EncryptedKeystore) CanSignProofOfReserves(code coin.Code) bool {
+	return (*Keystore)(nil).CanSignProofOfReserves(code)
+}
+
+// SignBTCMessage implements keystore.Keystore.
+func (keystore *EncryptedKeystore) SignBTCMessage(
+	message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
+	var signature []byte
+	err := keystore.withUnlocked(func(unlocked *Keystore) error {
+		var err error
+		signature, err = unlocked.SignBTCMessage(message, keypath, scriptType)
+		return err
+	})
+	return signature, err
+}
+
+// SignETHMessage implements keystore.Keystore.
+func (keystore *EncryptedKeystore) SignETHMessage(
+	message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	var signature []byte
+	err := keystore.withUnlocked(func(unlocked *Keystore) error {
+		var err error
+		signature, err = unlocked.SignETHMessage(message, keypath)
+		return err
+	})
+	return signature, err
+}
+
+// SignETHTypedMessage implements keystore.Keystore.
+func (keystore *EncryptedKeystore) SignETHTypedMessage(
+	chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	var signature []byte
+	err := keystore.withUnlocked(func(unlocked *Keystore) error {
+		var err error
+		signature, err = unlocked.SignETHTypedMessage(chainID, data, keypath)
+		return err
+	})
+	return signature, err
+}
+
+// SignTransaction implements keystore.Keystore.
+func (keystore *EncryptedKeystore) SignTransaction(proposedTransaction interface{}) error {
+	return keystore.withUnlocked(func(unlocked *Keystore) error {
+		return unlocked.SignTransaction(proposedTransaction)
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package software
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+const testMnemonic = "awkward squirrel wait rubber biology escape toe daring still pause fitness vendor"
+
+func init() {
+	defaultScryptN = 1 << 4
+}
+
+func TestEncryptedKeystore(t *testing.T) {
+	filename := filepath.Join(test.TstTempDir("encrypted-keystore"), "keystore.json")
+	keystore, err := CreateEncryptedKeystore(filename, testMnemonic, "", "password", time.Hour)
+	require.NoError(t, err)
+	require.False(t, keystore.Locked())
+
+	// The seed is never overwritten.
+	_, err = CreateEncryptedKeystore(filename, testMnemonic, "", "password", time.Hour)
+	require.Error(t, err)
+
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/0'/0'")
+	require.NoError(t, err)
+	xpub, err := keystore.ExtendedPublicKey(nil, keypath)
+	require.NoError(t, err)
+
+	loaded, err := LoadEncryptedKeystore(filename, time.Hour)
+	require.NoError(t, err)
+	require.True(t, loaded.Locked())
+	rootFingerprint, err := loaded.RootFingerprint()
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xfb, 0x70, 0x89, 0xbd}, rootFingerprint)
+	_, err = loaded.ExtendedPublicKey(nil, keypath)
+	require.True(t, errors.Is(err, ErrLocked))
+	require.True(t, errors.Is(loaded.SignTransaction(nil), ErrLocked))
+
+	require.True(t, errors.Is(loaded.Unlock("wrong"), ErrWrongPassword))
+	require.True(t, loaded.Locked())
+	require.NoError(t, loaded.Unlock("password"))
+	require.False(t, loaded.Locked())
+	loadedXpub, err := loaded.ExtendedPublicKey(nil, keypath)
+	require.NoError(t, err)
+	require.Equal(t, xpub.String(), loadedXpub.String())
+
+	// Derived xpubs remain available while locked.
+	locked := make(chan struct{})
+	loaded.SetOnLock(func() { close(locked) })
+	loaded.Lock()
+	<-locked
+	require.True(t, loaded.Locked())
+	loadedXpub, err = loaded.ExtendedPublicKey(nil, keypath)
+	require.NoError(t, err)
+	require.Equal(t, xpub.String(), loadedXpub.String())
+}
+
+func TestEncryptedKeystoreIdleTimeout(t *testing.T) {
+	filename := filepath.Join(test.TstTempDir("encrypted-keystore"), "keystore.json")
+	keystore, err := CreateEncryptedKeystore(filename, testMnemonic, "", "password", 10*time.Millisecond)
+	require.NoError(t, err)
+	locked := make(chan struct{})
+	keystore.SetOnLock(func() { close(locked) })
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "keystore was not locked after the idle timeout")
+	}
+	require.True(t, keystore.Locked())
+}
+
+func TestEncryptedKeystoreSignMessage(t *testing.T) {
+	filename := filepath.Join(test.TstTempDir("encrypted-keystore"), "keystore.json")
+	keystore, err := CreateEncryptedKeystore(filename, testMnemonic, "", "password", time.Hour)
+	require.NoError(t, err)
+	message := []byte("message")
+
+	keypath, err := signing.NewAbsoluteKeypath("m/44'/60'/0'/0/0")
+	require.NoError(t, err)
+	signature, err := keystore.SignETHMessage(message, keypath)
+	require.NoError(t, err)
+	require.Len(t, signature, 65)
+	require.Contains(t, []byte{27, 28}, signature[64])
+	signature[64] -= 27
+	pubKey, err := crypto.SigToPub(accounts.TextHash(message), signature)
+	require.NoError(t, err)
+	xpub, err := keystore.ExtendedPublicKey(nil, keypath)
+	require.NoError(t, err)
+	expectedPubKey, err := xpub.ECPubKey()
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(*expectedPubKey.ToECDSA()), crypto.PubkeyToAddress(*pubKey))
+
+	keypath, err = signing.NewAbsoluteKeypath("m/84'/0'/0'/0/0")
+	require.NoError(t, err)
+	signature, err = keystore.SignBTCMessage(message, keypath, signing.ScriptTypeP2WPKH)
+	require.NoError(t, err)
+	require.Len(t, signature, 65)
+	// varstr("Bitcoin Signed Message:\n") || varstr(message)
+	msg := append([]byte("\x18Bitcoin Signed Message:\n"), byte(len(message)))
+	msg = append(msg, message...)
+	recovered, compressed, err := ecdsa.RecoverCompact(signature, chainhash.DoubleHashB(msg))
+	require.NoError(t, err)
+	require.True(t, compressed)
+	xpub, err = keystore.ExtendedPublicKey(nil, keypath)
+	require.NoError(t, err)
+	expectedPubKey, err = xpub.ECPubKey()
+	require.NoError(t, err)
+	require.True(t, expectedPubKey.IsEqual(recovered))
+}
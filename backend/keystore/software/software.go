@@ -16,23 +16,32 @@
 package software
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"math/big"
 
+	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
 	keystorePkg "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/ethereum/go-ethereum/accounts"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -98,7 +107,7 @@ func (keystore *Keystore) Configuration() *signing.Configuration {
 // SupportsCoin implements keystore.Keystore.
 func (keystore *Keystore) SupportsCoin(coin coin.Coin) bool {
 	switch coin.(type) {
-	case *btc.Coin:
+	case *btc.Coin, *eth.Coin:
 		return true
 	default:
 		return false
@@ -117,7 +126,8 @@ func (keystore *Keystore) SupportsAccount(coin coin.Coin, meta interface{}) bool
 			scriptType == signing.ScriptTypeP2WPKHP2SH ||
 			scriptType == signing.ScriptTypeP2WPKH ||
 			scriptType == signing.ScriptTypeP2TR
-
+	case *eth.Coin:
+		return true
 	default:
 		return false
 	}
@@ -169,14 +179,48 @@ func (keystore *Keystore) ExtendedPublicKey(
 	return extendedPrivateKey.Neuter()
 }
 
+// privateKey returns the private key at the given keypath.
+func (keystore *Keystore) privateKey(keypath signing.AbsoluteKeypath) (*btcec.PrivateKey, error) {
+	xprv, err := keypath.Derive(keystore.master)
+	if err != nil {
+		return nil, err
+	}
+	prv, err := xprv.ECPrivKey()
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return prv, nil
+}
+
 // SignTransaction implements keystore.Keystore.
 func (keystore *Keystore) SignTransaction(
 	proposedTransaction interface{},
 ) error {
-	btcProposedTx, ok := proposedTransaction.(*btc.ProposedTransaction)
-	if !ok {
-		panic("Only BTC supported for now.")
+	switch specificProposedTx := proposedTransaction.(type) {
+	case *btc.ProposedTransaction:
+		return keystore.signBTCTransaction(specificProposedTx)
+	case *eth.TxProposal:
+		return keystore.signETHTransaction(specificProposedTx)
+	default:
+		panic("unknown proposal type")
+	}
+}
+
+func (keystore *Keystore) signETHTransaction(txProposal *eth.TxProposal) error {
+	keystore.log.Info("Sign ETH transaction.")
+	prv, err := keystore.privateKey(txProposal.Keypath)
+	if err != nil {
+		return err
 	}
+	signedTx, err := ethtypes.SignTx(txProposal.Tx, txProposal.Signer, prv.ToECDSA())
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	txProposal.Tx = signedTx
+	return nil
+}
+
+func (keystore *Keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransaction) error {
 	keystore.log.Info("Sign transaction.")
 	transaction := btcProposedTx.TXProposal.Transaction
 	signatures := make([]*types.Signature, len(transaction.TxIn))
@@ -187,15 +231,17 @@ func (keystore *Keystore) SignTransaction(
 			return errp.New("There needs to be exactly one output being spent per input.")
 		}
 		address := btcProposedTx.GetAddress(spentOutput.ScriptHashHex())
+		if address == nil {
+			if !btcProposedTx.SkipForeignInputs {
+				return errp.Newf("Input %d does not belong to the account", index)
+			}
+			continue
+		}
 
-		xprv, err := address.Configuration.AbsoluteKeypath().Derive(keystore.master)
+		prv, err := keystore.privateKey(address.Configuration.AbsoluteKeypath())
 		if err != nil {
 			return err
 		}
-		prv, err := xprv.ECPrivKey()
-		if err != nil {
-			return errp.WithStack(err)
-		}
 
 		if address.Configuration.ScriptType() == signing.ScriptTypeP2TR {
 			prv = txscript.TweakTaprootPrivKey(*prv, nil)
@@ -251,16 +297,95 @@ func (keystore *Keystore) SignTransaction(
 }
 
 // CanSignMessage implements keystore.Keystore.
-func (keystore *Keystore) CanSignMessage(coin.Code) bool {
-	return false
+func (keystore *Keystore) CanSignMessage(code coin.Code) bool {
+	switch code {
+	case coin.CodeBTC, coin.CodeTBTC, coin.CodeRBTC, coin.CodeETH, coin.CodeGOETH, coin.CodeSEPETH:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanSignBIP322 implements keystore.Keystore.
+func (keystore *Keystore) CanSignBIP322(code coin.Code) bool {
+	switch code {
+	case coin.CodeBTC, coin.CodeTBTC, coin.CodeRBTC:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanSignProofOfReserves implements keystore.Keystore.
+func (keystore *Keystore) CanSignProofOfReserves(code coin.Code) bool {
+	switch code {
+	case coin.CodeBTC, coin.CodeTBTC, coin.CodeRBTC:
+		return true
+	default:
+		return false
+	}
 }
 
-// SignBTCMessage implements keystore.Keystore.
+// SignBTCMessage implements keystore.Keystore. Like the BitBox02, it returns a 65 byte
+// Electrum-compatible signature: the recoverable header byte followed by R and S.
 func (keystore *Keystore) SignBTCMessage(message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
-	return nil, errp.New("unsupported")
+	if scriptType == signing.ScriptTypeP2TR {
+		return nil, errp.Newf("scriptType not supported: %s", scriptType)
+	}
+	prv, err := keystore.privateKey(keypath)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := wire.WriteVarString(&buf, 0, "Bitcoin Signed Message:\n"); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := wire.WriteVarBytes(&buf, 0, message); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return ecdsa.SignCompact(prv, chainhash.DoubleHashB(buf.Bytes()), true)
 }
 
-// SignETHMessage implements keystore.Keystore.
+// SignETHMessage implements keystore.Keystore. The message is signed according to EIP-191 like by
+// `personal_sign`. The returned signature is R, S and V, with V being 27 or 28.
 func (keystore *Keystore) SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
-	return nil, errp.New("unsupported")
+	prv, err := keystore.privateKey(keypath)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := crypto.Sign(accounts.TextHash(message), prv.ToECDSA())
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	// 27 is the magic constant to add to the recoverable ID to denote an uncompressed pubkey.
+	signature[64] += 27
+	return signature, nil
+}
+
+// SignETHTypedMessage implements keystore.Keystore. Like SignETHMessage, V is 27 or 28.
+func (keystore *Keystore) SignETHTypedMessage(
+	chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	typedData, err := eth.ParseTypedData(data)
+	if err != nil {
+		return nil, err
+	}
+	if typedData.Domain.ChainId != nil &&
+		(*big.Int)(typedData.Domain.ChainId).Cmp(new(big.Int).SetUint64(chainID)) != 0 {
+		return nil, errp.Newf("typed data is for chain ID %s, expected %d",
+			(*big.Int)(typedData.Domain.ChainId), chainID)
+	}
+	hash, _, err := apitypes.TypedDataAndHash(*typedData)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	prv, err := keystore.privateKey(keypath)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := crypto.Sign(hash, prv.ToECDSA())
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	signature[64] += 27
+	return signature, nil
 }
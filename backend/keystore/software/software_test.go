@@ -15,9 +15,30 @@
 package software
 
 import (
+	"math/big"
 	"testing"
 
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,3 +53,154 @@ func TestRootFingerprint(t *testing.T) {
 	// Verified by comparing to the root fingerprint produced by the BitBox02 and Electrum.
 	require.Equal(t, []byte{0xfb, 0x70, 0x89, 0xbd}, rootFingerprint)
 }
+
+func TestSignETHTypedMessage(t *testing.T) {
+	rootXprv, err := hdkeychain.NewKeyFromString("xprv9s21ZrQH143K3uDh9hiNXB3a9GVzcCujEmCwmZA9g8m4i5nUDVdLHJjsLMPzV26vj8Q7ceGrUhX119Y3XzGhJqq5K6LWP1h6gjv2cbkMEH1")
+	require.NoError(t, err)
+	keystore := NewKeystore(rootXprv)
+	keypath, err := signing.NewAbsoluteKeypath("m/44'/60'/0'/0/0")
+	require.NoError(t, err)
+	prv, err := keystore.privateKey(keypath)
+	require.NoError(t, err)
+	address := crypto.PubkeyToAddress(prv.ToECDSA().PublicKey).Hex()
+
+	typedData := []byte(`{
+		"types": {
+			"EIP712Domain": [{"name": "name", "type": "string"}, {"name": "chainId", "type": "uint256"}],
+			"Proof": [{"name": "contents", "type": "string"}]
+		},
+		"primaryType": "Proof",
+		"domain": {"name": "Audit", "chainId": 1},
+		"message": {"contents": "I control this address"}
+	}`)
+	signature, err := keystore.SignETHTypedMessage(1, typedData, keypath)
+	require.NoError(t, err)
+	require.Len(t, signature, 65)
+	require.Contains(t, []byte{27, 28}, signature[64])
+	require.NoError(t, eth.VerifyMessage(
+		address, typedData, hexutil.Encode(signature), eth.MessageFormatEIP712))
+
+	// Wrong chain.
+	_, err = keystore.SignETHTypedMessage(5, typedData, keypath)
+	require.Error(t, err)
+	_, err = keystore.SignETHTypedMessage(1, []byte("not json"), keypath)
+	require.Error(t, err)
+}
+
+func TestSignETHTransaction(t *testing.T) {
+	rootXprv, err := hdkeychain.NewKeyFromString("xprv9s21ZrQH143K3uDh9hiNXB3a9GVzcCujEmCwmZA9g8m4i5nUDVdLHJjsLMPzV26vj8Q7ceGrUhX119Y3XzGhJqq5K6LWP1h6gjv2cbkMEH1")
+	require.NoError(t, err)
+	keystore := NewKeystore(rootXprv)
+	keypath, err := signing.NewAbsoluteKeypath("m/44'/60'/0'/0/0")
+	require.NoError(t, err)
+	prv, err := keystore.privateKey(keypath)
+	require.NoError(t, err)
+	address := crypto.PubkeyToAddress(prv.ToECDSA().PublicKey)
+	recipient := common.HexToAddress("0xa29163852021BF4C139D03Dff59ae763AC73e84e")
+	signer := ethtypes.NewLondonSigner(big.NewInt(1))
+
+	for _, unsignedTx := range []*ethtypes.Transaction{
+		ethtypes.NewTx(&ethtypes.LegacyTx{
+			Nonce:    3,
+			GasPrice: big.NewInt(20e9),
+			Gas:      21000,
+			To:       &recipient,
+			Value:    big.NewInt(1e17),
+		}),
+		ethtypes.NewTx(&ethtypes.DynamicFeeTx{
+			ChainID:   big.NewInt(1),
+			Nonce:     4,
+			GasTipCap: big.NewInt(1e9),
+			GasFeeCap: big.NewInt(30e9),
+			Gas:       21000,
+			To:        &recipient,
+			Value:     big.NewInt(1e17),
+		}),
+	} {
+		txProposal := &eth.TxProposal{
+			Tx:      unsignedTx,
+			Signer:  signer,
+			Keypath: keypath,
+		}
+		require.NoError(t, keystore.SignTransaction(txProposal))
+		require.Equal(t, signer.Hash(unsignedTx), signer.Hash(txProposal.Tx))
+		require.Equal(t, big.NewInt(1), txProposal.Tx.ChainId())
+		sender, err := ethtypes.Sender(signer, txProposal.Tx)
+		require.NoError(t, err)
+		require.Equal(t, address, sender)
+	}
+}
+
+func TestSignBTCTransaction(t *testing.T) {
+	rootXprv, err := hdkeychain.NewKeyFromString("xprv9s21ZrQH143K3uDh9hiNXB3a9GVzcCujEmCwmZA9g8m4i5nUDVdLHJjsLMPzV26vj8Q7ceGrUhX119Y3XzGhJqq5K6LWP1h6gjv2cbkMEH1")
+	require.NoError(t, err)
+	keystore := NewKeystore(rootXprv)
+	rootFingerprint, err := keystore.RootFingerprint()
+	require.NoError(t, err)
+	tbtc := btc.NewCoin(coinpkg.CodeTBTC, "Bitcoin Testnet", "TBTC", coinpkg.BtcUnitDefault,
+		&chaincfg.TestNet3Params, ".", []*config.ServerInfo{}, "", socksproxy.NewSocksProxy(false, ""))
+	log := logging.Get().WithGroup("software_test")
+
+	inputAddresses := []*addresses.AccountAddress{}
+	addressesByScriptHash := map[blockchain.ScriptHashHex]*addresses.AccountAddress{}
+	for scriptType, accountKeypath := range map[signing.ScriptType]string{
+		signing.ScriptTypeP2WPKH:     "m/84'/1'/0'",
+		signing.ScriptTypeP2WPKHP2SH: "m/49'/1'/0'",
+		signing.ScriptTypeP2TR:       "m/86'/1'/0'",
+	} {
+		keypath, err := signing.NewAbsoluteKeypath(accountKeypath)
+		require.NoError(t, err)
+		xpub, err := keystore.ExtendedPublicKey(tbtc, keypath)
+		require.NoError(t, err)
+		address := addresses.NewAccountAddress(
+			signing.NewBitcoinConfiguration(scriptType, rootFingerprint, keypath, xpub),
+			signing.NewEmptyRelativeKeypath().Child(0, false).Child(0, false),
+			tbtc.Net(), log)
+		inputAddresses = append(inputAddresses, address)
+		addressesByScriptHash[address.PubkeyScriptHashHex()] = address
+	}
+
+	// The last spent output does not belong to the account.
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	for _, address := range inputAddresses {
+		prevTx.AddTxOut(wire.NewTxOut(100000, address.PubkeyScript()))
+	}
+	prevTx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+	tx := wire.NewMsgTx(wire.TxVersion)
+	previousOutputs := maketx.PreviousOutputs{}
+	for index := range prevTx.TxOut {
+		outPoint := wire.NewOutPoint(&[]chainhash.Hash{prevTx.TxHash()}[0], uint32(index))
+		tx.AddTxIn(wire.NewTxIn(outPoint, nil, nil))
+		previousOutputs[*outPoint] = &transactions.SpendableOutput{TxOut: prevTx.TxOut[index]}
+	}
+	tx.AddTxOut(wire.NewTxOut(290000, inputAddresses[0].PubkeyScript()))
+
+	proposedTx := &btc.ProposedTransaction{
+		TXProposal: &maketx.TxProposal{
+			Coin:            tbtc,
+			Transaction:     tx,
+			PreviousOutputs: previousOutputs,
+		},
+		GetAddress: func(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
+			return addressesByScriptHash[scriptHashHex]
+		},
+		Signatures: make([]*types.Signature, len(tx.TxIn)),
+		SigHashes:  txscript.NewTxSigHashes(tx, previousOutputs),
+	}
+	// Foreign inputs must be allowed explicitly.
+	require.Error(t, keystore.SignTransaction(proposedTx))
+
+	proposedTx.SkipForeignInputs = true
+	require.NoError(t, keystore.SignTransaction(proposedTx))
+	require.Nil(t, proposedTx.Signatures[len(inputAddresses)])
+	for index, address := range inputAddresses {
+		tx.TxIn[index].SignatureScript, tx.TxIn[index].Witness = address.SignatureScript(
+			*proposedTx.Signatures[index])
+		engine, err := txscript.NewEngine(prevTx.TxOut[index].PkScript, tx, index,
+			txscript.StandardVerifyFlags, nil, proposedTx.SigHashes, prevTx.TxOut[index].Value,
+			previousOutputs)
+		require.NoError(t, err)
+		require.NoError(t, engine.Execute())
+	}
+}
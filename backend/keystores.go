@@ -0,0 +1,168 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+)
+
+// registeredKeystore is a keystore registered at the backend, together with its root fingerprint.
+type registeredKeystore struct {
+	rootFingerprint []byte
+	keystore        keystore.Keystore
+}
+
+// keystores holds the registered keystores, keyed by their root fingerprint. The
+// accountsAndKeystoreLock must be held when using it.
+type keystores struct {
+	// entries are in the order the keystores were registered.
+	entries []*registeredKeystore
+}
+
+// get returns the keystore with the given root fingerprint, or nil if there is none.
+func (ks *keystores) get(rootFingerprint []byte) keystore.Keystore {
+	for _, entry := range ks.entries {
+		if bytes.Equal(entry.rootFingerprint, rootFingerprint) {
+			return entry.keystore
+		}
+	}
+	return nil
+}
+
+// add adds the keystore, replacing the keystore with the same root fingerprint.
+func (ks *keystores) add(rootFingerprint []byte, keystore keystore.Keystore) {
+	for _, entry := range ks.entries {
+		if bytes.Equal(entry.rootFingerprint, rootFingerprint) {
+			entry.keystore = keystore
+			return
+		}
+	}
+	ks.entries = append(ks.entries, &registeredKeystore{
+		rootFingerprint: rootFingerprint,
+		keystore:        keystore,
+	})
+}
+
+// remove removes the keystore with the given root fingerprint and returns false if there was none.
+func (ks *keystores) remove(rootFingerprint []byte) bool {
+	for i, entry := range ks.entries {
+		if bytes.Equal(entry.rootFingerprint, rootFingerprint) {
+			ks.entries = append(ks.entries[:i], ks.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the keystores in the order they were registered.
+func (ks *keystores) list() []keystore.Keystore {
+	result := make([]keystore.Keystore, len(ks.entries))
+	for i, entry := range ks.entries {
+		result[i] = entry.keystore
+	}
+	return result
+}
+
+// forAccount returns the keystore the account belongs to, i.e. the first registered keystore whose
+// root fingerprint is part of the account's signing configurations, or nil if there is none.
+func (ks *keystores) forAccount(account *config.Account) *registeredKeystore {
+	for _, entry := range ks.entries {
+		if account.SigningConfigurations.ContainsRootFingerprint(entry.rootFingerprint) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// KnownKeystore is a keystore which has persisted accounts.
+type KnownKeystore struct {
+	// RootFingerprint is hex encoded.
+	RootFingerprint string `json:"rootFingerprint"`
+	Connected       bool   `json:"connected"`
+	// Remembered is true if the accounts of the keystore stay loaded watch-only when the keystore
+	// is not connected.
+	Remembered bool `json:"remembered"`
+}
+
+// KnownKeystores returns the keystores which have persisted accounts, in the order of their first
+// account.
+func (backend *Backend) KnownKeystores() []*KnownKeystore {
+	defer backend.accountsAndKeystoreLock.RLock()()
+	accountsConfig := backend.config.AccountsConfig()
+	result := []*KnownKeystore{}
+	seen := map[string]bool{}
+	for _, account := range accountsConfig.Accounts {
+		for _, signingConfig := range account.SigningConfigurations {
+			rootFingerprint := signingConfig.RootFingerprint()
+			encoded := hex.EncodeToString(rootFingerprint)
+			if seen[encoded] {
+				continue
+			}
+			seen[encoded] = true
+			result = append(result, &KnownKeystore{
+				RootFingerprint: encoded,
+				Connected:       backend.keystores.get(rootFingerprint) != nil,
+				Remembered:      accountsConfig.IsKeystoreRemembered(rootFingerprint),
+			})
+		}
+	}
+	return result
+}
+
+// SetKeystoreRemembered sets whether the accounts of the keystore with the given root fingerprint
+// stay loaded when the keystore is not connected. Such accounts are watch-only: balances,
+// transactions and receive addresses can be viewed, but sending requires connecting the keystore.
+func (backend *Backend) SetKeystoreRemembered(rootFingerprint []byte, remembered bool) error {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	err := backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
+		known := false
+		for _, account := range accountsConfig.Accounts {
+			if account.SigningConfigurations.ContainsRootFingerprint(rootFingerprint) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errp.Newf("unknown keystore %x", rootFingerprint)
+		}
+		accountsConfig.SetKeystoreRemembered(rootFingerprint, remembered)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	backend.Notify(observable.Event{
+		Subject: "keystores",
+		Action:  action.Reload,
+	})
+	if backend.keystores.get(rootFingerprint) != nil {
+		// The accounts of a connected keystore are loaded anyway.
+		return nil
+	}
+	backend.uninitKeystoreAccounts(rootFingerprint)
+	if remembered {
+		backend.initKeystoreAccounts(rootFingerprint, nil)
+	}
+	backend.emitAccountsStatusChanged()
+	backend.configureHistoryExchangeRates()
+	return nil
+}
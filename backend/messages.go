@@ -0,0 +1,61 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/message"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// VerifyMessageArgs are the arguments to verify a signed message.
+type VerifyMessageArgs struct {
+	CoinCode  coinpkg.Code `json:"coinCode"`
+	Address   string       `json:"address"`
+	Message   string       `json:"message"`
+	Signature string       `json:"signature"`
+	// Format is "eip191" or "eip712" for Ethereum. For Bitcoin, the format is detected from the
+	// signature.
+	Format string `json:"format"`
+}
+
+// VerifyMessage verifies a message signature by an address, without needing a keystore or a
+// network connection. It returns the format of the signature. The error cause is
+// message.ErrInvalidSignature or eth.ErrInvalidMessageSignature if the signature is invalid.
+func (backend *Backend) VerifyMessage(args VerifyMessageArgs) (string, error) {
+	coin, err := backend.Coin(args.CoinCode)
+	if err != nil {
+		return "", err
+	}
+	switch specificCoin := coin.(type) {
+	case *btc.Coin:
+		switch specificCoin.Code() {
+		case coinpkg.CodeBTC, coinpkg.CodeTBTC, coinpkg.CodeRBTC:
+		default:
+			return "", errp.Newf("message verification is not supported for %s", args.CoinCode)
+		}
+		format, err := message.Verify(
+			args.Address, []byte(args.Message), args.Signature, specificCoin.Net())
+		return string(format), err
+	case *eth.Coin:
+		format := eth.MessageFormat(args.Format)
+		return string(format), eth.VerifyMessage(
+			args.Address, []byte(args.Message), args.Signature, format)
+	default:
+		return "", errp.Newf("message verification is not supported for %s", args.CoinCode)
+	}
+}
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
@@ -26,6 +27,7 @@ import (
 const (
 	bucketUnnotifiedKey = "unnotified"
 	bucketSeenKey       = "seen"
+	bucketProgressKey   = "progress"
 )
 
 // Notifier implements accounts.Notifier, storing the data of all accounts in a bbolt db.
@@ -160,3 +162,63 @@ func (notifier *notifierForAccount) MarkAllNotified() error {
 		return nil
 	})
 }
+
+// txProgress is what the user was notified about a transaction.
+type txProgress struct {
+	// Confirmations is the highest confirmation milestone notified.
+	Confirmations int `json:"confirmations"`
+	// Failed is true if the failure of the transaction was notified.
+	Failed bool `json:"failed"`
+}
+
+// updateTxProgress calls f with the notified progress of the transactions of the account, keyed
+// by internal transaction ID, and persists the changes f makes to the map. known is false if no
+// progress was stored for the account before, e.g. when the account was just added.
+func (notifier *Notifier) updateTxProgress(
+	accountCode accountsTypes.Code, f func(progress map[string]*txProgress, known bool)) error {
+	tx, err := notifier.db.Begin(true)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	bucketAccount, err := tx.CreateBucketIfNotExists([]byte(fmt.Sprintf("account-%s", accountCode)))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	known := bucketAccount.Bucket([]byte(bucketProgressKey)) != nil
+	bucketProgress, err := bucketAccount.CreateBucketIfNotExists([]byte(bucketProgressKey))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	stored := map[string]txProgress{}
+	err = bucketProgress.ForEach(func(k, v []byte) error {
+		var progress txProgress
+		if err := json.Unmarshal(v, &progress); err != nil {
+			return errp.WithStack(err)
+		}
+		stored[string(k)] = progress
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	progress := make(map[string]*txProgress, len(stored))
+	for id, txProgress := range stored {
+		txProgress := txProgress
+		progress[id] = &txProgress
+	}
+	f(progress, known)
+	for id, txProgress := range progress {
+		if oldProgress, ok := stored[id]; ok && oldProgress == *txProgress {
+			continue
+		}
+		value, err := json.Marshal(txProgress)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		if err := bucketProgress.Put([]byte(id), value); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	return errp.WithStack(tx.Commit())
+}
@@ -0,0 +1,329 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/paymentrequests"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+)
+
+// PaymentRequestArgs are the arguments to create a payment request.
+type PaymentRequestArgs struct {
+	Label string `json:"label"`
+	// Amount is the requested amount in the unit shown to the user, e.g. "0.001" for BTC or
+	// "100000" if the BTC unit is sat. Empty requests any amount.
+	Amount string `json:"amount"`
+	// FiatAmount, if not empty, is the requested amount in Fiat. It is converted to the coin using
+	// the latest exchange rate and takes precedence over Amount.
+	FiatAmount string `json:"fiatAmount"`
+	// Fiat defaults to the main fiat currency.
+	Fiat string `json:"fiat"`
+	// ExpiresIn is the number of seconds until the request expires. 0 means it never expires.
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+// PaymentRequest is a payment request together with its payment state.
+type PaymentRequest struct {
+	*paymentrequests.Request
+	*paymentrequests.State
+	// URI is the payment URI, e.g. a BIP21 URI for Bitcoin. It can be shown as a QR code using
+	// the "qr" endpoint.
+	URI               string `json:"uri"`
+	FormattedAmount   string `json:"formattedAmount"`
+	FormattedReceived string `json:"formattedReceived"`
+	Unit              string `json:"unit"`
+}
+
+// paymentURI returns the URI the payer can scan to pay the request.
+func paymentURI(accountCoin coinpkg.Coin, request *paymentrequests.Request) string {
+	amount := request.AmountBigInt()
+	if ethCoin, ok := accountCoin.(*eth.Coin); ok {
+		tokenContract := ""
+		if token := ethCoin.ERC20Token(); token != nil {
+			tokenContract = token.ContractAddress().Hex()
+		}
+		return paymentrequests.EIP681URI(request.Address, tokenContract, amount)
+	}
+	scheme := "bitcoin"
+	switch accountCoin.Code() {
+	case coinpkg.CodeLTC, coinpkg.CodeTLTC:
+		scheme = "litecoin"
+	}
+	decimals := int(accountCoin.Decimals(false))
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return paymentrequests.BIP21URI(
+		scheme, request.Address, new(big.Rat).SetFrac(amount, unit), decimals, request.Label)
+}
+
+func newPaymentRequest(
+	account accounts.Interface,
+	request *paymentrequests.Request,
+	txs []*accounts.TransactionData,
+	now time.Time,
+) *PaymentRequest {
+	accountCoin := account.Coin()
+	state := request.State(txs, now)
+	return &PaymentRequest{
+		Request:           request,
+		State:             state,
+		URI:               paymentURI(accountCoin, request),
+		FormattedAmount:   accountCoin.FormatAmount(coinpkg.NewAmount(request.AmountBigInt()), false),
+		FormattedReceived: accountCoin.FormatAmount(coinpkg.NewAmount(state.Received), false),
+		Unit:              accountCoin.GetFormatUnit(false),
+	}
+}
+
+// requestedAmount converts the amount of the args to the smallest unit of the coin.
+func (backend *Backend) requestedAmount(
+	accountCoin coinpkg.Coin, args *PaymentRequestArgs) (*big.Int, error) {
+	if args.FiatAmount != "" {
+		fiatAmount, ok := new(big.Rat).SetString(args.FiatAmount)
+		if !ok || fiatAmount.Sign() <= 0 {
+			return nil, errp.Newf("invalid fiat amount %q", args.FiatAmount)
+		}
+		price, err := backend.RatesUpdater().LatestPriceForPair(accountCoin.Unit(false), args.Fiat)
+		if err != nil {
+			return nil, err
+		}
+		if price == 0 {
+			return nil, errp.Newf("no exchange rate available for %s", args.Fiat)
+		}
+		coinAmount := new(big.Rat).Quo(fiatAmount, new(big.Rat).SetFloat64(price))
+		return accountCoin.SetAmount(coinAmount, false).BigInt(), nil
+	}
+	if args.Amount == "" {
+		return new(big.Int), nil
+	}
+	amount, err := accountCoin.ParseAmount(args.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if amount.BigInt().Sign() < 0 {
+		return nil, errp.Newf("invalid amount %q", args.Amount)
+	}
+	return amount.BigInt(), nil
+}
+
+// CreatePaymentRequest creates a payment request in the given account. A receive address which
+// is not used by any other request is reserved for it. Accounts with only one address, like
+// Ethereum accounts, can only have one open request at a time.
+func (backend *Backend) CreatePaymentRequest(
+	accountCode accountsTypes.Code, args PaymentRequestArgs) (*PaymentRequest, error) {
+	account, err := backend.GetAccountFromCode(string(accountCode))
+	if err != nil {
+		return nil, err
+	}
+	if !account.Synced() {
+		return nil, errp.New("account is not synced yet")
+	}
+	if err := paymentrequests.ValidateLabel(args.Label); err != nil {
+		return nil, err
+	}
+	if args.ExpiresIn < 0 {
+		return nil, errp.Newf("invalid expiry %d", args.ExpiresIn)
+	}
+	if args.Fiat == "" {
+		args.Fiat = backend.Config().AppConfig().Backend.MainFiat
+	}
+	accountCoin := account.Coin()
+	amount, err := backend.requestedAmount(accountCoin, &args)
+	if err != nil {
+		return nil, err
+	}
+	backend.paymentRequestsMu.Lock()
+	defer backend.paymentRequestsMu.Unlock()
+	txs, err := account.Transactions()
+	if err != nil {
+		return nil, err
+	}
+	requests, err := backend.paymentRequests.List(accountCode)
+	if err != nil {
+		return nil, err
+	}
+	id, err := paymentrequests.NewID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	request := &paymentrequests.Request{
+		ID:             id,
+		AccountCode:    accountCode,
+		Label:          args.Label,
+		Amount:         amount.String(),
+		CreatedAt:      now,
+		NotifiedStatus: paymentrequests.StatusOpen,
+	}
+	if args.FiatAmount != "" {
+		request.FiatAmount = args.FiatAmount
+		request.Fiat = args.Fiat
+	}
+	if args.ExpiresIn > 0 {
+		expiresAt := now.Add(time.Duration(args.ExpiresIn) * time.Second)
+		request.ExpiresAt = &expiresAt
+	}
+
+	addressLists := account.GetUnusedReceiveAddresses()
+	var address accounts.Address
+	if _, ok := accountCoin.(*eth.Coin); ok {
+		if len(addressLists) == 0 || len(addressLists[0].Addresses) == 0 {
+			return nil, errp.New("no receive address available")
+		}
+		if open := paymentrequests.OpenSharedRequest(requests, txs, now); open != nil {
+			return nil, errp.Newf("payment request %s is still open", open.ID)
+		}
+		request.AddressShared = true
+		address = addressLists[0].Addresses[0]
+	} else {
+		// There is one list per subaccount, the first one being the default script type. The
+		// addresses of the other subaccounts are used once all of the first one are reserved.
+		reserved := paymentrequests.ReservedAddressIDs(requests, txs, now)
+	addressListsLoop:
+		for _, addressList := range addressLists {
+			for _, candidate := range addressList.Addresses {
+				if !reserved[candidate.ID()] {
+					address = candidate
+					break addressListsLoop
+				}
+			}
+		}
+		if address == nil {
+			return nil, errp.New("all unused receive addresses are reserved by payment requests")
+		}
+	}
+	request.AddressID = address.ID()
+	request.Address = address.EncodeForHumans()
+
+	if err := backend.paymentRequests.Put(request); err != nil {
+		return nil, err
+	}
+	backend.notifyPaymentRequestsChanged(accountCode)
+	return newPaymentRequest(account, request, txs, now), nil
+}
+
+// PaymentRequests returns the payment requests of the given account, newest first.
+func (backend *Backend) PaymentRequests(accountCode accountsTypes.Code) ([]*PaymentRequest, error) {
+	account, err := backend.GetAccountFromCode(string(accountCode))
+	if err != nil {
+		return nil, err
+	}
+	requests, err := backend.paymentRequests.List(accountCode)
+	if err != nil {
+		return nil, err
+	}
+	var txs []*accounts.TransactionData
+	if account.Synced() {
+		txs, err = account.Transactions()
+		if err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	result := make([]*PaymentRequest, len(requests))
+	for i, request := range requests {
+		result[i] = newPaymentRequest(account, request, txs, now)
+	}
+	return result, nil
+}
+
+// CancelPaymentRequest cancels a payment request. Its address stays reserved if anything was
+// received on it already.
+func (backend *Backend) CancelPaymentRequest(accountCode accountsTypes.Code, id string) error {
+	backend.paymentRequestsMu.Lock()
+	defer backend.paymentRequestsMu.Unlock()
+	request, err := backend.paymentRequests.Get(accountCode, id)
+	if err != nil {
+		return err
+	}
+	request.Cancelled = true
+	request.NotifiedStatus = paymentrequests.StatusCancelled
+	if err := backend.paymentRequests.Put(request); err != nil {
+		return err
+	}
+	backend.notifyPaymentRequestsChanged(accountCode)
+	return nil
+}
+
+func (backend *Backend) notifyPaymentRequestsChanged(accountCode accountsTypes.Code) {
+	backend.Notify(observable.Event{
+		Subject: fmt.Sprintf("account/%s/payment-requests", accountCode),
+		Action:  action.Reload,
+	})
+}
+
+// checkPaymentRequests updates the payment requests of the account after it was synced, and
+// notifies the user when a request was paid, partially paid or expired.
+func (backend *Backend) checkPaymentRequests(account accounts.Interface) {
+	accountCode := account.Config().Config.Code
+	backend.paymentRequestsMu.Lock()
+	defer backend.paymentRequestsMu.Unlock()
+	requests, err := backend.paymentRequests.List(accountCode)
+	if err != nil {
+		backend.log.WithError(err).Error("could not list payment requests")
+		return
+	}
+	if len(requests) == 0 {
+		return
+	}
+	txs, err := account.Transactions()
+	if err != nil {
+		backend.log.WithError(err).Error("could not get transactions for payment requests")
+		return
+	}
+	accountCoin := account.Coin()
+	now := time.Now()
+	changed := false
+	for _, request := range requests {
+		state := request.State(txs, now)
+		if state.Status == request.NotifiedStatus {
+			continue
+		}
+		request.NotifiedStatus = state.Status
+		if err := backend.paymentRequests.Put(request); err != nil {
+			backend.log.WithError(err).Error("could not update payment request")
+			return
+		}
+		changed = true
+		name := request.Label
+		if name == "" {
+			name = request.Address
+		}
+		received := fmt.Sprintf("%s %s",
+			accountCoin.FormatAmount(coinpkg.NewAmount(state.Received), false),
+			accountCoin.GetFormatUnit(false))
+		switch state.Status {
+		case paymentrequests.StatusPaid:
+			backend.NotifyUser(fmt.Sprintf("Payment request %s was paid: received %s", name, received))
+		case paymentrequests.StatusOverpaid:
+			backend.NotifyUser(fmt.Sprintf("Payment request %s was overpaid: received %s", name, received))
+		case paymentrequests.StatusPartial:
+			backend.NotifyUser(fmt.Sprintf("Payment request %s was partially paid: received %s", name, received))
+		case paymentrequests.StatusExpired:
+			backend.NotifyUser(fmt.Sprintf("Payment request %s expired", name))
+		}
+	}
+	if changed {
+		backend.notifyPaymentRequestsChanged(accountCode)
+	}
+}
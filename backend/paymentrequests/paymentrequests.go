@@ -0,0 +1,263 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package paymentrequests manages payment requests, which ask for a payment to a receive address
+// reserved for the request, and tracks whether they are paid.
+package paymentrequests
+
+import (
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// Status is the payment status of a request. See the list of consts below.
+type Status string
+
+const (
+	// StatusOpen means nothing was received yet.
+	StatusOpen Status = "open"
+	// StatusPartial means less than the requested amount was received.
+	StatusPartial Status = "partial"
+	// StatusPaid means the requested amount was received, or anything if no amount was requested.
+	StatusPaid Status = "paid"
+	// StatusOverpaid means more than the requested amount was received.
+	StatusOverpaid Status = "overpaid"
+	// StatusExpired means the request expired before the requested amount was received.
+	StatusExpired Status = "expired"
+	// StatusCancelled means the request was cancelled by the user.
+	StatusCancelled Status = "cancelled"
+)
+
+// Request is a payment request of an account.
+type Request struct {
+	ID          string             `json:"id"`
+	AccountCode accountsTypes.Code `json:"accountCode"`
+	Label       string             `json:"label"`
+	// Amount is the requested amount in the smallest unit of the coin, e.g. satoshi, as a decimal
+	// number. Zero requests any amount.
+	Amount string `json:"amount"`
+	// FiatAmount is the requested amount in Fiat if the amount was requested in fiat. Amount is
+	// converted from it using the exchange rate at CreatedAt.
+	FiatAmount string `json:"fiatAmount,omitempty"`
+	Fiat       string `json:"fiat,omitempty"`
+	AddressID  string `json:"addressID"`
+	Address    string `json:"address"`
+	// AddressShared is true if the address is the only address of the account, e.g. for
+	// Ethereum. Payments can then not be told apart from other incoming transactions: every
+	// incoming transaction between CreatedAt and ExpiresAt counts towards the request, even if it
+	// was not sent to pay it.
+	AddressShared bool      `json:"addressShared"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// ExpiresAt is nil if the request never expires.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Cancelled bool       `json:"cancelled"`
+	// NotifiedStatus is the status the user was last notified about.
+	NotifiedStatus Status `json:"notifiedStatus"`
+}
+
+// AmountBigInt returns the requested amount in the smallest unit of the coin.
+func (request *Request) AmountBigInt() *big.Int {
+	amount, ok := new(big.Int).SetString(request.Amount, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return amount
+}
+
+// State is the payment state of a request.
+type State struct {
+	Status Status `json:"status"`
+	// Received is the amount received in the smallest unit of the coin.
+	Received *big.Int `json:"-"`
+	// Confirmed is true if all payments are complete, i.e. have enough confirmations.
+	Confirmed bool `json:"confirmed"`
+	// TxIDs are the IDs of the transactions paying the request.
+	TxIDs []string `json:"txIDs"`
+}
+
+// reservesAddress returns true if the address of the request must not be used for another
+// request. The address is released once the request was cancelled or expired without receiving
+// anything.
+func (request *Request) reservesAddress(state *State) bool {
+	return state.Status == StatusOpen || state.Received.Sign() != 0
+}
+
+// State computes the payment state of the request from the transactions of its account.
+func (request *Request) State(txs []*accounts.TransactionData, now time.Time) *State {
+	state := &State{Received: new(big.Int), Confirmed: true, TxIDs: []string{}}
+	for _, tx := range txs {
+		received := request.receivedIn(tx)
+		if received == nil {
+			continue
+		}
+		state.Received.Add(state.Received, received)
+		state.TxIDs = append(state.TxIDs, tx.TxID)
+		if tx.Status != accounts.TxStatusComplete {
+			state.Confirmed = false
+		}
+	}
+	amount := request.AmountBigInt()
+	expired := request.ExpiresAt != nil && now.After(*request.ExpiresAt)
+	switch {
+	case request.Cancelled:
+		state.Status = StatusCancelled
+	case state.Received.Sign() == 0 && expired:
+		state.Status = StatusExpired
+	case state.Received.Sign() == 0:
+		state.Status = StatusOpen
+	case amount.Sign() == 0:
+		state.Status = StatusPaid
+	case state.Received.Cmp(amount) < 0 && expired:
+		state.Status = StatusExpired
+	case state.Received.Cmp(amount) < 0:
+		state.Status = StatusPartial
+	case state.Received.Cmp(amount) == 0:
+		state.Status = StatusPaid
+	default:
+		state.Status = StatusOverpaid
+	}
+	if len(state.TxIDs) == 0 {
+		state.Confirmed = false
+	}
+	return state
+}
+
+// receivedIn returns the amount the transaction pays to the request, or nil if it doesn't pay to
+// it.
+func (request *Request) receivedIn(tx *accounts.TransactionData) *big.Int {
+	if tx.Status == accounts.TxStatusFailed {
+		return nil
+	}
+	if request.AddressShared {
+		if tx.Type != accounts.TxTypeReceive {
+			return nil
+		}
+		txTime := tx.Timestamp
+		if txTime == nil {
+			txTime = tx.CreatedTimestamp
+		}
+		if txTime != nil && txTime.Before(request.CreatedAt) {
+			return nil
+		}
+		if txTime != nil && request.ExpiresAt != nil && txTime.After(*request.ExpiresAt) {
+			return nil
+		}
+		return tx.Amount.BigInt()
+	}
+	if tx.Type != accounts.TxTypeReceive && tx.Type != accounts.TxTypeSendSelf {
+		return nil
+	}
+	var result *big.Int
+	for _, output := range tx.Addresses {
+		if !output.Ours || output.Address != request.Address {
+			continue
+		}
+		if result == nil {
+			result = new(big.Int)
+		}
+		result.Add(result, output.Amount.BigInt())
+	}
+	return result
+}
+
+// ReservedAddressIDs returns the IDs of the addresses which are reserved by the requests and must
+// not be used for new requests.
+func ReservedAddressIDs(requests []*Request, txs []*accounts.TransactionData, now time.Time) map[string]bool {
+	result := map[string]bool{}
+	for _, request := range requests {
+		if request.reservesAddress(request.State(txs, now)) {
+			result[request.AddressID] = true
+		}
+	}
+	return result
+}
+
+// OpenSharedRequest returns a request of a shared address which can still be paid, or nil if
+// there is none. Only one such request can be open at a time, as payments to the same address
+// could not be told apart.
+func OpenSharedRequest(requests []*Request, txs []*accounts.TransactionData, now time.Time) *Request {
+	for _, request := range requests {
+		if !request.AddressShared {
+			continue
+		}
+		switch request.State(txs, now).Status {
+		case StatusOpen, StatusPartial:
+			return request
+		}
+	}
+	return nil
+}
+
+// uriEscape percent-encodes a URI parameter value, encoding spaces as "%20" as required by BIP21.
+func uriEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// BIP21URI returns a BIP21 payment URI, e.g. "bitcoin:bc1q...?amount=0.001&label=Coffee".
+// amount is in the unit of the coin, e.g. BTC. It is left out if zero.
+func BIP21URI(scheme, address string, amount *big.Rat, decimals int, label string) string {
+	params := []string{}
+	if amount.Sign() != 0 {
+		params = append(params, "amount="+formatDecimal(amount, decimals))
+	}
+	if label != "" {
+		params = append(params, "label="+uriEscape(label))
+	}
+	uri := scheme + ":" + address
+	if len(params) != 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri
+}
+
+// EIP681URI returns an EIP-681 payment URI. amount is in the smallest unit, e.g. wei. If
+// tokenContract is not empty, the URI requests an ERC20 token transfer.
+func EIP681URI(address string, tokenContract string, amount *big.Int) string {
+	if tokenContract != "" {
+		uri := "ethereum:" + tokenContract + "/transfer?address=" + address
+		if amount.Sign() != 0 {
+			uri += "&uint256=" + amount.String()
+		}
+		return uri
+	}
+	uri := "ethereum:" + address
+	if amount.Sign() != 0 {
+		uri += "?value=" + amount.String()
+	}
+	return uri
+}
+
+// formatDecimal formats the number with at most the given decimals, without trailing zeros.
+func formatDecimal(value *big.Rat, decimals int) string {
+	formatted := value.FloatString(decimals)
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
+
+// ValidateLabel checks that the label is not too long to be shown in wallets.
+func ValidateLabel(label string) error {
+	const maxLabelLength = 100
+	if len(label) > maxLabelLength {
+		return errp.Newf("label too long (max %d characters)", maxLabelLength)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package paymentrequests
+
+import (
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveTx(txID string, address string, amount int64, status accounts.TxStatus) *accounts.TransactionData {
+	return &accounts.TransactionData{
+		TxID:   txID,
+		Type:   accounts.TxTypeReceive,
+		Status: status,
+		Amount: coin.NewAmountFromInt64(amount),
+		Addresses: []accounts.AddressAndAmount{
+			{Address: address, Amount: coin.NewAmountFromInt64(amount), Ours: true},
+			{Address: "other", Amount: coin.NewAmountFromInt64(1000), Ours: true},
+		},
+	}
+}
+
+func TestState(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+	request := &Request{
+		Address:   "addr",
+		AddressID: "addr-id",
+		Amount:    "10000",
+		CreatedAt: now,
+		ExpiresAt: &expiresAt,
+	}
+
+	state := request.State(nil, now)
+	require.Equal(t, StatusOpen, state.Status)
+	require.False(t, state.Confirmed)
+	require.Equal(t, StatusExpired, request.State(nil, now.Add(2*time.Hour)).Status)
+
+	txs := []*accounts.TransactionData{
+		receiveTx("tx1", "addr", 4000, accounts.TxStatusComplete),
+		receiveTx("unrelated", "addr2", 50000, accounts.TxStatusComplete),
+		receiveTx("failed", "addr", 50000, accounts.TxStatusFailed),
+	}
+	state = request.State(txs, now)
+	require.Equal(t, StatusPartial, state.Status)
+	require.Equal(t, big.NewInt(4000), state.Received)
+	require.Equal(t, []string{"tx1"}, state.TxIDs)
+	require.True(t, state.Confirmed)
+	require.Equal(t, StatusExpired, request.State(txs, now.Add(2*time.Hour)).Status)
+
+	txs = append(txs, receiveTx("tx2", "addr", 6000, accounts.TxStatusPending))
+	state = request.State(txs, now.Add(2*time.Hour))
+	require.Equal(t, StatusPaid, state.Status)
+	require.False(t, state.Confirmed)
+
+	txs = append(txs, receiveTx("tx3", "addr", 1, accounts.TxStatusComplete))
+	require.Equal(t, StatusOverpaid, request.State(txs, now).Status)
+
+	request.Cancelled = true
+	require.Equal(t, StatusCancelled, request.State(txs, now).Status)
+
+	// Any amount.
+	anyAmount := &Request{Address: "addr", Amount: "0", CreatedAt: now}
+	require.Equal(t, StatusOpen, anyAmount.State(nil, now).Status)
+	require.Equal(t, StatusPaid, anyAmount.State(txs[:1], now).Status)
+}
+
+func TestStateSharedAddress(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Minute)
+	after := now.Add(time.Minute)
+	request := &Request{Address: "0xabc", Amount: "100", AddressShared: true, CreatedAt: now}
+	oldTx := receiveTx("old", "0xabc", 100, accounts.TxStatusComplete)
+	oldTx.Timestamp = &before
+	newTx := receiveTx("new", "0xabc", 60, accounts.TxStatusComplete)
+	newTx.Timestamp = &after
+	pendingTx := receiveTx("pending", "0xabc", 40, accounts.TxStatusPending)
+	pendingTx.CreatedTimestamp = &after
+
+	state := request.State([]*accounts.TransactionData{oldTx, newTx}, now)
+	require.Equal(t, StatusPartial, state.Status)
+	require.Equal(t, []string{"new"}, state.TxIDs)
+	require.Equal(t, StatusPaid,
+		request.State([]*accounts.TransactionData{oldTx, newTx, pendingTx}, now).Status)
+
+	requests := []*Request{request}
+	require.Equal(t, request, OpenSharedRequest(requests, []*accounts.TransactionData{newTx}, now))
+	require.Nil(t, OpenSharedRequest(requests, []*accounts.TransactionData{newTx, pendingTx}, now))
+
+	// Transactions received after the expiry don't count.
+	expiresAt := now.Add(30 * time.Second)
+	request.ExpiresAt = &expiresAt
+	state = request.State([]*accounts.TransactionData{oldTx, newTx}, after)
+	require.Equal(t, StatusExpired, state.Status)
+	require.Empty(t, state.TxIDs)
+}
+
+func TestReservedAddressIDs(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	expiredAt := now.Add(-time.Minute)
+	requests := []*Request{
+		{AddressID: "open", Address: "open", Amount: "1"},
+		{AddressID: "cancelled", Address: "cancelled", Amount: "1", Cancelled: true},
+		{AddressID: "cancelled-paid", Address: "cancelled-paid", Amount: "1", Cancelled: true},
+		{AddressID: "expired", Address: "expired", Amount: "1", ExpiresAt: &expiredAt},
+		{AddressID: "expired-partial", Address: "expired-partial", Amount: "2", ExpiresAt: &expiredAt},
+	}
+	txs := []*accounts.TransactionData{
+		receiveTx("tx", "cancelled-paid", 1, accounts.TxStatusComplete),
+		receiveTx("tx2", "expired-partial", 1, accounts.TxStatusComplete),
+	}
+	require.Equal(t,
+		map[string]bool{"open": true, "cancelled-paid": true, "expired-partial": true},
+		ReservedAddressIDs(requests, txs, now))
+}
+
+func TestURIs(t *testing.T) {
+	require.Equal(t, "bitcoin:bc1qaddr", BIP21URI("bitcoin", "bc1qaddr", new(big.Rat), 8, ""))
+	require.Equal(t,
+		"bitcoin:bc1qaddr?amount=0.001&label=Coffee%20%26%20cake",
+		BIP21URI("bitcoin", "bc1qaddr", big.NewRat(1, 1000), 8, "Coffee & cake"))
+	require.Equal(t,
+		"litecoin:ltc1addr?amount=2",
+		BIP21URI("litecoin", "ltc1addr", big.NewRat(2, 1), 8, ""))
+
+	require.Equal(t, "ethereum:0xabc", EIP681URI("0xabc", "", new(big.Int)))
+	require.Equal(t, "ethereum:0xabc?value=1000", EIP681URI("0xabc", "", big.NewInt(1000)))
+	require.Equal(t,
+		"ethereum:0xtoken/transfer?address=0xabc&uint256=5",
+		EIP681URI("0xabc", "0xtoken", big.NewInt(5)))
+}
+
+func TestValidateLabel(t *testing.T) {
+	require.NoError(t, ValidateLabel("Invoice 42"))
+	require.Error(t, ValidateLabel(strings.Repeat("x", 101)))
+}
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(filepath.Join(test.TstTempDir("TestPaymentRequestsStore"), "db"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, store.Close()) }()
+
+	list, err := store.List("btc-0")
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	id1, err := NewID()
+	require.NoError(t, err)
+	id2, err := NewID()
+	require.NoError(t, err)
+	require.NotEqual(t, id1, id2)
+
+	older := &Request{ID: id1, AccountCode: "btc-0", Amount: "1", CreatedAt: now}
+	newer := &Request{ID: id2, AccountCode: "btc-0", Amount: "2", CreatedAt: now.Add(time.Hour)}
+	require.NoError(t, store.Put(older))
+	require.NoError(t, store.Put(newer))
+	require.NoError(t, store.Put(&Request{ID: id1, AccountCode: "ltc-0", CreatedAt: now}))
+
+	list, err = store.List("btc-0")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, id2, list[0].ID)
+	require.Equal(t, id1, list[1].ID)
+
+	older.Cancelled = true
+	require.NoError(t, store.Put(older))
+	request, err := store.Get("btc-0", id1)
+	require.NoError(t, err)
+	require.True(t, request.Cancelled)
+	require.Equal(t, "1", request.Amount)
+
+	_, err = store.Get("btc-0", "unknown")
+	require.Error(t, err)
+	_, err = store.Get("eth-0", id1)
+	require.Error(t, err)
+}
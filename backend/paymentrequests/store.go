@@ -0,0 +1,124 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package paymentrequests
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"go.etcd.io/bbolt"
+)
+
+// Store persists the payment requests of all accounts in a bbolt db, with one bucket per account.
+type Store struct {
+	db *bbolt.DB
+}
+
+// NewStore opens or creates the database in the given file.
+func NewStore(dbFilename string) (*Store, error) {
+	db, err := bbolt.Open(dbFilename, 0600, nil)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
+func accountBucketKey(accountCode accountsTypes.Code) []byte {
+	return []byte(fmt.Sprintf("account-%s", accountCode))
+}
+
+// NewID returns a new random request ID.
+func NewID() (string, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", errp.WithStack(err)
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+// Put stores the request, replacing the request with the same ID.
+func (store *Store) Put(request *Request) error {
+	value, err := json.Marshal(request)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	return errp.WithStack(store.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(accountBucketKey(request.AccountCode))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(request.ID), value)
+	}))
+}
+
+// Get returns the request with the given ID of the account.
+func (store *Store) Get(accountCode accountsTypes.Code, id string) (*Request, error) {
+	var request *Request
+	err := store.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(accountBucketKey(accountCode))
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		request = &Request{}
+		return json.Unmarshal(value, request)
+	})
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if request == nil {
+		return nil, errp.Newf("payment request %s not found", id)
+	}
+	return request, nil
+}
+
+// List returns all requests of the account, newest first.
+func (store *Store) List(accountCode accountsTypes.Code) ([]*Request, error) {
+	requests := []*Request{}
+	err := store.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(accountBucketKey(accountCode))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, value []byte) error {
+			request := &Request{}
+			if err := json.Unmarshal(value, request); err != nil {
+				return err
+			}
+			requests = append(requests, request)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.After(requests[j].CreatedAt)
+	})
+	return requests, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"sync"
+	"testing"
+
+	accountsMocks "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/mocks"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/stretchr/testify/require"
+)
+
+// newPaymentRequestsBackend returns a backend with a synced BTC account with two subaccounts.
+func newPaymentRequestsBackend(t *testing.T) (*Backend, accountsTypes.Code) {
+	t.Helper()
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	fingerprint := []byte{0x55, 0x55, 0x55, 0x55}
+	xpub := mustXKey("xpub6Cxa67Bfe1Aw5VvLM1Ppua9x28CXH1zUYoAuBzFRjR6hWnA6aUcny84KYkeVcZWnWXxKSkxCEyMA8xic54ydBPWm5oziXpsXq6nX8FELMQn")
+
+	coin, err := b.Coin(coinpkg.CodeBTC)
+	require.NoError(t, err)
+	accountCode := accountsTypes.Code("test-btc-account-code")
+	b.createAndAddAccount(
+		coin,
+		&config.Account{
+			Code: accountCode,
+			Name: "Bitcoin account name",
+			SigningConfigurations: signing.Configurations{
+				signing.NewBitcoinConfiguration(signing.ScriptTypeP2WPKH, fingerprint, mustKeypath("m/84'/0'/0'"), xpub),
+				signing.NewBitcoinConfiguration(signing.ScriptTypeP2TR, fingerprint, mustKeypath("m/86'/0'/0'"), xpub),
+			},
+		},
+	)
+	require.Len(t, b.accounts, 1)
+	account := b.accounts[0].(*accountsMocks.InterfaceMock)
+	account.SyncedFunc = func() bool { return true }
+	return b, accountCode
+}
+
+func TestCreatePaymentRequestSubaccounts(t *testing.T) {
+	b, accountCode := newPaymentRequestsBackend(t)
+	defer b.Close()
+	// The mocked account has one unused address per subaccount.
+	addressLists := b.accounts[0].GetUnusedReceiveAddresses()
+	require.Len(t, addressLists, 2)
+
+	request, err := b.CreatePaymentRequest(accountCode, PaymentRequestArgs{Label: "first"})
+	require.NoError(t, err)
+	require.Equal(t, addressLists[0].Addresses[0].ID(), request.AddressID)
+	require.False(t, request.AddressShared)
+
+	// The address of the first subaccount is reserved, so the one of the second is used.
+	request, err = b.CreatePaymentRequest(accountCode, PaymentRequestArgs{Label: "second"})
+	require.NoError(t, err)
+	require.Equal(t, addressLists[1].Addresses[0].ID(), request.AddressID)
+
+	_, err = b.CreatePaymentRequest(accountCode, PaymentRequestArgs{Label: "third"})
+	require.Error(t, err)
+}
+
+func TestCreatePaymentRequestConcurrently(t *testing.T) {
+	b, accountCode := newPaymentRequestsBackend(t)
+	defer b.Close()
+
+	// There are only two addresses, so only two of the concurrent requests can be created, each
+	// reserving a different address.
+	var wg sync.WaitGroup
+	requests := make(chan *PaymentRequest, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, err := b.CreatePaymentRequest(accountCode, PaymentRequestArgs{})
+			if err == nil {
+				requests <- request
+			}
+		}()
+	}
+	wg.Wait()
+	close(requests)
+	addressIDs := map[string]bool{}
+	for request := range requests {
+		addressIDs[request.AddressID] = true
+	}
+	require.Len(t, addressIDs, 2)
+
+	// Cancelling a request releases its address.
+	list, err := b.PaymentRequests(accountCode)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.NoError(t, b.CancelPaymentRequest(accountCode, list[0].ID))
+	b.checkPaymentRequests(b.accounts[0])
+	request, err := b.CreatePaymentRequest(accountCode, PaymentRequestArgs{})
+	require.NoError(t, err)
+	require.Equal(t, list[0].AddressID, request.AddressID)
+}
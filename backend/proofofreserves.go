@@ -0,0 +1,39 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/proofofreserves"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// VerifyProofOfReserves verifies a proof of reserves created for the message, e.g. a proof
+// created by btc.Account.ProofOfReserves(), looking up the covered outputs on the blockchain of
+// the coin. The error cause is proofofreserves.ErrInvalidProof if the proof is invalid.
+func (backend *Backend) VerifyProofOfReserves(
+	coinCode coinpkg.Code, message string, proof string) (*proofofreserves.Result, error) {
+	coin, err := backend.Coin(coinCode)
+	if err != nil {
+		return nil, err
+	}
+	btcCoin, ok := coin.(*btc.Coin)
+	if !ok {
+		return nil, errp.Newf("proofs of reserves are not supported for %s", coinCode)
+	}
+	btcCoin.Initialize()
+	return proofofreserves.Verify(proof, message, btcCoin.Blockchain())
+}
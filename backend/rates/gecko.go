@@ -1,6 +1,21 @@
 package rates
 
-import "time"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/ratelimit"
+	"github.com/sirupsen/logrus"
+)
 
 const (
 	// See the following for docs and details: https://www.coingecko.com/en/api.
@@ -77,52 +92,188 @@ var (
 		"wrapped-bitcoin":       "WBTC",
 		"pax-gold":              "PAXG",
 	}
+)
+
+// coinGecko provides exchange rates using the CoinGecko API.
+type coinGecko struct {
+	url        string
+	httpClient *http.Client
+	// All requests to url are rate-limited using limiter.
+	limiter *ratelimit.LimitedCall
+	log     *logrus.Entry
+}
 
-	// Copied from https://api.coingecko.com/api/v3/simple/supported_vs_currencies.
-	// The keys are BitBoxApp fiat codes. Values are CoinGecko fiat codes.
-	toGeckoFiat = map[string]string{
-		"USD": "usd",
-		"EUR": "eur",
-		"CHF": "chf",
-		"GBP": "gbp",
-		"JPY": "jpy",
-		"KRW": "krw",
-		"CNY": "cny",
-		"RUB": "rub",
-		"CAD": "cad",
-		"AUD": "aud",
-		"ILS": "ils",
-		"BTC": "btc",
-		"SGD": "sgd",
-		"HKD": "hkd",
-		"BRL": "brl",
-		"NOK": "nok",
-		"SEK": "sek",
-		"PLN": "pln",
-		"CZK": "czk",
-	}
-
-	// Copied from https://api.coingecko.com/api/v3/simple/supported_vs_currencies.
-	// The keys are CoinGecko fiat codes. Values are BitBoxApp fiat codes.
-	fromGeckoFiat = map[string]string{
-		"usd": "USD",
-		"eur": "EUR",
-		"chf": "CHF",
-		"gbp": "GBP",
-		"jpy": "JPY",
-		"krw": "KRW",
-		"cny": "CNY",
-		"rub": "RUB",
-		"cad": "CAD",
-		"aud": "AUD",
-		"ils": "ILS",
-		"btc": "BTC",
-		"sgd": "SGD",
-		"hkd": "HKD",
-		"brl": "BRL",
-		"nok": "NOK",
-		"sek": "SEK",
-		"pln": "PLN",
-		"czk": "CZK",
+func newCoinGecko(url string, httpClient *http.Client) *coinGecko {
+	return &coinGecko{
+		url:        url,
+		httpClient: httpClient,
+		limiter:    ratelimit.NewLimitedCall(apiRateLimit(url)),
+		log:        logging.Get().WithGroup("rates"),
 	}
-)
+}
+
+// setURL changes the API URL and its rate limit.
+func (gecko *coinGecko) setURL(url string) {
+	gecko.url = url
+	gecko.limiter = ratelimit.NewLimitedCall(apiRateLimit(url))
+}
+
+// Name implements Provider.
+func (gecko *coinGecko) Name() string {
+	return ProviderCoinGecko
+}
+
+// LatestRates implements Provider.
+func (gecko *coinGecko) LatestRates(ctx context.Context, quotes []string) (map[string]map[string]float64, error) {
+	geckoQuotes := make([]string, len(quotes))
+	for i, quote := range quotes {
+		geckoQuotes[i] = strings.ToLower(quote)
+	}
+	param := url.Values{
+		"ids":           {simplePriceAllIDs},
+		"vs_currencies": {strings.Join(geckoQuotes, ",")},
+	}
+	endpoint := fmt.Sprintf("%s/simple/price?%s", gecko.url, param.Encode())
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errp.WithMessage(err, "could not create request")
+	}
+
+	var geckoRates map[string]map[string]float64
+	callErr := gecko.limiter.Call(ctx, "updateLast", func() error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		res, err := gecko.httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		defer res.Body.Close() //nolint:errcheck
+		if res.StatusCode != http.StatusOK {
+			return errp.Newf("bad response code %d", res.StatusCode)
+		}
+		const max = 65536
+		responseBody, err := io.ReadAll(io.LimitReader(res.Body, max+1))
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		if len(responseBody) > max {
+			return errp.Newf("rates response too long (> %d bytes)", max)
+		}
+		if err := json.Unmarshal(responseBody, &geckoRates); err != nil {
+			return errp.WithMessage(err,
+				fmt.Sprintf("could not parse rates response: %s", string(responseBody)))
+		}
+		return nil
+	})
+	if callErr != nil {
+		return nil, callErr
+	}
+	// Convert the map with coingecko coin/fiat codes to a map of coin/fiat units.
+	rates := map[string]map[string]float64{}
+	for coin, val := range geckoRates {
+		coinUnit := geckoCoinToUnit[coin]
+		if coinUnit == "" {
+			gecko.log.Errorf("unsupported CoinGecko coin: %s", coin)
+			continue
+		}
+		newVal := map[string]float64{}
+		for geckoFiat, rates := range val {
+			newVal[strings.ToUpper(geckoFiat)] = rates
+		}
+		rates[coinUnit] = newVal
+	}
+	return rates, nil
+}
+
+// SupportedQuotes implements quoteLister, using CoinGecko's "simple/supported_vs_currencies" API.
+func (gecko *coinGecko) SupportedQuotes(ctx context.Context) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/simple/supported_vs_currencies", gecko.url)
+	var geckoQuotes []string
+	callErr := gecko.limiter.Call(ctx, "supportedQuotes", func() error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		res, err := gecko.httpClient.Do(req)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		defer res.Body.Close() //nolint:errcheck
+		if res.StatusCode != http.StatusOK {
+			return errp.Newf("bad response code %d", res.StatusCode)
+		}
+		return errp.WithStack(json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&geckoQuotes))
+	})
+	if callErr != nil {
+		return nil, callErr
+	}
+	if len(geckoQuotes) == 0 {
+		return nil, errp.New("no supported currencies")
+	}
+	quotes := make([]string, len(geckoQuotes))
+	for i, quote := range geckoQuotes {
+		quotes[i] = strings.ToUpper(quote)
+	}
+	return quotes, nil
+}
+
+// HistoricalRates implements Provider, using CoinGecko's "market_chart/range" API.
+func (gecko *coinGecko) HistoricalRates(ctx context.Context, coin, fiat string, start, end time.Time) ([]HistoricalRate, error) {
+	// Prepare a request URL to call the upstream API.
+	gcoin := geckoCoin[coin]
+	if gcoin == "" {
+		return nil, fmt.Errorf("fetchGeckoMarketRange: unsupported coin %s", coin)
+	}
+	gfiat := strings.ToLower(fiat)
+	if gfiat == "" {
+		return nil, fmt.Errorf("fetchGeckoMarketRange: unsupported fiat %s", fiat)
+	}
+
+	// Make the call, abiding the upstream rate limits.
+	msg := fmt.Sprintf("fetch coingecko coin=%s fiat=%s start=%s", coin, fiat, start)
+	var jsonBody struct{ Prices [][2]float64 } // [timestamp in milliseconds, value]
+	callErr := gecko.limiter.Call(ctx, msg, func() error {
+		param := url.Values{
+			"from":        {strconv.FormatInt(start.Unix(), 10)},
+			"to":          {strconv.FormatInt(end.Unix(), 10)},
+			"vs_currency": {gfiat},
+		}
+		endpoint := fmt.Sprintf("%s/coins/%s/market_chart/range?%s", gecko.url, gcoin, param.Encode())
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		res, err := gecko.httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close() //nolint:errcheck
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("fetchGeckoMarketRange: bad response code %d", res.StatusCode)
+		}
+		// 1Mb is more than enough for a single response, but make sure initial
+		// download with empty cache fits here. See maxGeckoRange.
+		return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&jsonBody)
+	})
+	if callErr != nil {
+		return nil, callErr
+	}
+	return pricesToHistoricalRates(jsonBody.Prices), nil
+}
+
+// pricesToHistoricalRates converts pairs of [timestamp in milliseconds, value].
+func pricesToHistoricalRates(prices [][2]float64) []HistoricalRate {
+	rates := make([]HistoricalRate, len(prices))
+	for i, v := range prices {
+		rates[i] = HistoricalRate{
+			Value:     v[1],
+			Timestamp: time.Unix(int64(v[0])/1000, 0), // local timezone
+		}
+	}
+	return rates
+}
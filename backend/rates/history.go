@@ -2,23 +2,18 @@ package rates
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
 	"math/rand"
-	"net/http"
-	"net/url"
 	"sort"
-	"strconv"
 	"time"
 )
 
 // ReconfigureHistory resets all currently running historical rates goroutines.
 // The end result is only coin/fiat pairs present in the arguments are active.
-// Duplicate or unsupported values in coins and fiats are ignored.
-// Supported fiats are currently hardcoded in the unexported geckoFiat map in this package.
+// Duplicate or unsupported values in coins and fiats are ignored. See SupportedQuotes for the
+// supported fiats. The latest rates are fetched for the fiats as well.
 func (updater *RateUpdater) ReconfigureHistory(coins, fiats []string) {
 	updater.log.Printf("ReconfigureHistory: coins=%q; fiats=%q", coins, fiats)
+	updater.setActiveQuotes(fiats)
 	updater.historyMu.Lock()
 	defer updater.historyMu.Unlock()
 	// Stop all running history goroutines.
@@ -33,7 +28,7 @@ func (updater *RateUpdater) ReconfigureHistory(coins, fiats []string) {
 			continue
 		}
 		for _, fiat := range fiats {
-			if toGeckoFiat[fiat] == "" {
+			if !updater.IsSupportedQuote(fiat) {
 				updater.log.Errorf("ReconfigureHistory: unsupported fiat %q", fiat)
 				continue
 			}
@@ -165,7 +160,7 @@ func (updater *RateUpdater) backfillHistory(ctx context.Context, coin, fiat stri
 // for later use. It returns the number of the newly fetched and stored entries.
 // The data is stored in updater.history.
 func (updater *RateUpdater) updateHistory(ctx context.Context, coin, fiat string, t fetchTimeRange) (n int, err error) {
-	fetchedRates, err := updater.fetchGeckoMarketRange(ctx, coin, fiat, t)
+	fetchedRates, err := updater.fetchHistory(ctx, coin, fiat, t)
 	if err != nil {
 		return 0, err
 	}
@@ -241,59 +236,72 @@ func fixedTimeRange(start, end time.Time) fetchTimeRange {
 	}
 }
 
-// fetchGeckoMarketRange slurps historical exchange rates in the specified time range
-// using CoinGecko's "market_chart/range" API.
-func (updater *RateUpdater) fetchGeckoMarketRange(ctx context.Context, coin, fiat string, timeRange fetchTimeRange) ([]exchangeRate, error) {
-	// Prepare a request URL to call the upstream API.
-	gcoin := geckoCoin[coin]
-	if gcoin == "" {
-		return nil, fmt.Errorf("fetchGeckoMarketRange: unsupported coin %s", coin)
+// fetchHistory fetches historical exchange rates in the specified time range from the first
+// provider able to serve them. Rates of derived quotes are computed from the USD rates, see
+// derivedQuotes.
+func (updater *RateUpdater) fetchHistory(ctx context.Context, coin, fiat string, timeRange fetchTimeRange) ([]exchangeRate, error) {
+	quoteCoin := updater.derivedQuoteCoin(fiat)
+	if quoteCoin == "" {
+		return updater.fetchProviderHistory(ctx, coin, fiat, timeRange)
 	}
-	gfiat := toGeckoFiat[fiat]
-	if gfiat == "" {
-		return nil, fmt.Errorf("fetchGeckoMarketRange: unsupported fiat %s", fiat)
+	end := timeRange.end()
+	timeRange = fixedTimeRange(timeRange.start, end)
+	coinRates, err := updater.fetchProviderHistory(ctx, coin, USD.String(), timeRange)
+	if err != nil {
+		return nil, err
+	}
+	quoteRates, err := updater.fetchProviderHistory(ctx, quoteCoin, USD.String(), timeRange)
+	if err != nil {
+		return nil, err
 	}
+	return divideRates(coinRates, quoteRates), nil
+}
 
-	// Make the call, abiding the upstream rate limits.
-	msg := fmt.Sprintf("fetch coingecko coin=%s fiat=%s start=%s", coin, fiat, timeRange.start)
-	var jsonBody struct{ Prices [][2]float64 } // [timestamp in milliseconds, value]
-	callErr := updater.geckoLimiter.Call(ctx, msg, func() error {
-		param := url.Values{
-			"from":        {strconv.FormatInt(timeRange.start.Unix(), 10)},
-			"to":          {strconv.FormatInt(timeRange.end().Unix(), 10)},
-			"vs_currency": {gfiat},
-		}
-		endpoint := fmt.Sprintf("%s/coins/%s/market_chart/range?%s", updater.coingeckoURL, gcoin, param.Encode())
-		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
-		if err != nil {
-			return err
+// divideRates divides each rate by the rate of divisors at the same time, linearly interpolating
+// between the divisors. Rates outside of the time range of the divisors are left out.
+func divideRates(rates, divisors []exchangeRate) []exchangeRate {
+	var result []exchangeRate
+	j := 0
+	for _, rate := range rates {
+		for j < len(divisors) && divisors[j].timestamp.Before(rate.timestamp) {
+			j++
 		}
-
-		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-		defer cancel()
-		res, err := updater.httpClient.Do(req.WithContext(ctx))
-		if err != nil {
-			return err
+		var divisor float64
+		switch {
+		case j == len(divisors):
+			continue
+		case divisors[j].timestamp.Equal(rate.timestamp):
+			divisor = divisors[j].value
+		case j == 0:
+			continue
+		default:
+			a, b := divisors[j-1], divisors[j]
+			x := float64(rate.timestamp.Unix()-a.timestamp.Unix()) / float64(b.timestamp.Unix()-a.timestamp.Unix())
+			divisor = a.value + x*(b.value-a.value)
 		}
-		defer res.Body.Close() //nolint:errcheck
-		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf("fetchGeckoMarketRange: bad response code %d", res.StatusCode)
+		if divisor <= 0 {
+			continue
 		}
-		// 1Mb is more than enough for a single response, but make sure initial
-		// download with empty cache fits here. See maxGeckoRange.
-		return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&jsonBody)
-	})
-	if callErr != nil {
-		return nil, callErr
+		result = append(result, exchangeRate{value: rate.value / divisor, timestamp: rate.timestamp})
 	}
+	return result
+}
 
-	// Transform the response into a usable result.
-	rates := make([]exchangeRate, len(jsonBody.Prices))
-	for i, v := range jsonBody.Prices {
-		rates[i] = exchangeRate{
-			value:     v[1],
-			timestamp: time.Unix(int64(v[0])/1000, 0), // local timezone
-		}
+// fetchProviderHistory fetches historical exchange rates in the specified time range from the
+// first provider able to serve them.
+func (updater *RateUpdater) fetchProviderHistory(ctx context.Context, coin, fiat string, timeRange fetchTimeRange) ([]exchangeRate, error) {
+	var fetched []HistoricalRate
+	err := updater.withProviders(ctx, func(provider Provider) error {
+		var err error
+		fetched, err = provider.HistoricalRates(ctx, coin, fiat, timeRange.start, timeRange.end())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	rates := make([]exchangeRate, len(fetched))
+	for i, rate := range fetched {
+		rates[i] = exchangeRate{value: rate.Value, timestamp: rate.Timestamp}
 	}
 	return rates, nil
 }
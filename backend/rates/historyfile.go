@@ -0,0 +1,370 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rates
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const (
+	// HistoryFormatCSV is a CSV file with the columns time and price, with an optional header
+	// row. The time is a unix timestamp in seconds or milliseconds, a RFC3339 time or a date
+	// (YYYY-MM-DD, UTC).
+	HistoryFormatCSV = "csv"
+	// HistoryFormatJSON is either a JSON object in the CoinGecko market chart format,
+	// `{"prices": [[<unix milliseconds>, <price>], ...]}`, or a file created by `ExportHistory()`.
+	HistoryFormatJSON = "json"
+)
+
+// historyFileVersion is the version of the files created by `ExportHistory()`.
+const historyFileVersion = 1
+
+// earliestHistoryTime is the earliest plausible time of an exchange rate.
+var earliestHistoryTime = time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)
+
+// maxHistoryImportGap is the longest time allowed between the imported rates and the rates in the
+// database cache. The history goroutines only fetch rates after the latest and before the earliest
+// rate, so a longer gap would never be filled and the prices in it would be interpolated.
+const maxHistoryImportGap = 24 * time.Hour
+
+// historyFilePair contains the rates of one coin/fiat pair in a file created by
+// `ExportHistory()`.
+type historyFilePair struct {
+	Coin   string       `json:"coin"`
+	Fiat   string       `json:"fiat"`
+	Prices [][2]float64 `json:"prices"`
+}
+
+// historyFile is the format of the files created by `ExportHistory()`.
+type historyFile struct {
+	Version int               `json:"version"`
+	Rates   []historyFilePair `json:"rates"`
+}
+
+// HistoryImportResult reports the result of importing the rates of one coin/fiat pair.
+type HistoryImportResult struct {
+	Coin string `json:"coin"`
+	Fiat string `json:"fiat"`
+	// Imported is the number of rates which were added or replaced.
+	Imported int `json:"imported"`
+	// Skipped is the number of rates which were already present.
+	Skipped int `json:"skipped"`
+}
+
+// ImportHistory imports historical exchange rates from a file in one of the HistoryFormat*
+// formats into the history database cache, so charts and fiat values are available without
+// network access. coin and fiat select the pair for files which contain only the prices, e.g.
+// "btc" and "USD". They are ignored for files created by `ExportHistory()`, which contain the
+// pairs.
+//
+// The file is validated completely before anything is imported. Existing rates at the same
+// timestamp are kept, unless overwrite is true. The imported rates must overlap or be adjacent to
+// the rates in the database cache, see maxHistoryImportGap.
+func (updater *RateUpdater) ImportHistory(
+	r io.Reader, format, coin, fiat string, overwrite bool) ([]HistoryImportResult, error) {
+	pairs, err := updater.parseHistoryFile(r, format, coin, fiat)
+	if err != nil {
+		return nil, err
+	}
+	existing := make([][]exchangeRate, len(pairs))
+	for i, pair := range pairs {
+		existing[i], err = updater.loadHistoryBucket(pair.Coin + pair.Fiat)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if err := checkHistoryGap(pair, existing[i]); err != nil {
+			return nil, err
+		}
+	}
+	results := []HistoryImportResult{}
+	for i, pair := range pairs {
+		result, err := updater.importHistoryPair(pair, existing[i], overwrite)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// checkHistoryGap returns an error if there would be a gap longer than maxHistoryImportGap
+// between the imported prices and the existing rates, which are sorted by timestamp.
+func checkHistoryGap(pair historyFilePair, existing []exchangeRate) error {
+	if len(existing) == 0 || len(pair.Prices) == 0 {
+		return nil
+	}
+	first := time.UnixMilli(int64(pair.Prices[0][0]))
+	last := first
+	for _, price := range pair.Prices {
+		timestamp := time.UnixMilli(int64(price[0]))
+		if timestamp.Before(first) {
+			first = timestamp
+		}
+		if timestamp.After(last) {
+			last = timestamp
+		}
+	}
+	existingFirst := existing[0].timestamp
+	existingLast := existing[len(existing)-1].timestamp
+	if first.Sub(existingLast) > maxHistoryImportGap || existingFirst.Sub(last) > maxHistoryImportGap {
+		return errp.Newf(
+			"%s/%s: the imported rates from %s to %s leave a gap to the existing rates from %s to %s",
+			pair.Coin, pair.Fiat, first.UTC(), last.UTC(), existingFirst.UTC(), existingLast.UTC())
+	}
+	return nil
+}
+
+// importHistoryPair merges the rates into the in-memory history and the database cache. existing
+// are the rates of the pair in the database cache.
+func (updater *RateUpdater) importHistoryPair(
+	pair historyFilePair, existing []exchangeRate, overwrite bool) (HistoryImportResult, error) {
+	result := HistoryImportResult{Coin: pair.Coin, Fiat: pair.Fiat}
+	key := pair.Coin + pair.Fiat
+
+	existingTimestamps := make(map[int64]bool, len(existing))
+	for _, rate := range existing {
+		existingTimestamps[rate.timestamp.Unix()] = true
+	}
+	imported := []exchangeRate{}
+	for _, price := range pair.Prices {
+		rate := exchangeRate{
+			timestamp: time.Unix(int64(price[0])/1000, 0),
+			value:     price[1],
+		}
+		if existingTimestamps[rate.timestamp.Unix()] && !overwrite {
+			result.Skipped++
+			continue
+		}
+		imported = append(imported, rate)
+	}
+	result.Imported = len(imported)
+	if len(imported) == 0 {
+		return result, nil
+	}
+	if err := updater.dumpHistoryBucket(key, imported); err != nil {
+		return result, errp.WithStack(err)
+	}
+
+	updater.historyMu.Lock()
+	defer updater.historyMu.Unlock()
+	current := updater.history[key]
+	if len(current) == 0 {
+		// The history of this pair is not loaded, e.g. because it is not in use.
+		current = existing
+	}
+	updater.history[key] = mergeRates(current, imported, overwrite)
+	return result, nil
+}
+
+// mergeRates merges the rates b into a, sorted by timestamp and without duplicate timestamps. On
+// conflict, the rate of b is used if overwrite is true.
+func mergeRates(a, b []exchangeRate, overwrite bool) []exchangeRate {
+	byTimestamp := make(map[int64]exchangeRate, len(a)+len(b))
+	for _, rate := range a {
+		byTimestamp[rate.timestamp.Unix()] = rate
+	}
+	for _, rate := range b {
+		if _, exists := byTimestamp[rate.timestamp.Unix()]; exists && !overwrite {
+			continue
+		}
+		byTimestamp[rate.timestamp.Unix()] = rate
+	}
+	merged := make([]exchangeRate, 0, len(byTimestamp))
+	for _, rate := range byTimestamp {
+		merged = append(merged, rate)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].timestamp.Before(merged[j].timestamp)
+	})
+	return merged
+}
+
+// ExportHistory writes all historical exchange rates in the database cache as a JSON file which
+// can be imported with `ImportHistory()`.
+func (updater *RateUpdater) ExportHistory(w io.Writer) error {
+	keys, err := updater.historyBucketKeys()
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	sort.Strings(keys)
+	file := historyFile{Version: historyFileVersion, Rates: []historyFilePair{}}
+	for _, key := range keys {
+		coin, fiat, ok := splitHistoryKey(key)
+		if !ok {
+			updater.log.Errorf("ExportHistory: skipping unknown bucket %q", key)
+			continue
+		}
+		rates, err := updater.loadHistoryBucket(key)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		pair := historyFilePair{Coin: coin, Fiat: fiat, Prices: make([][2]float64, len(rates))}
+		for i, rate := range rates {
+			pair.Prices[i] = [2]float64{float64(rate.timestamp.UnixMilli()), rate.value}
+		}
+		file.Rates = append(file.Rates, pair)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errp.WithStack(encoder.Encode(file))
+}
+
+// splitHistoryKey splits a history key into the coin and fiat, e.g. "btcUSD" into "btc" and
+// "USD". Coin codes are lowercase and fiat codes uppercase, which also tells history buckets apart
+// from other buckets such as quotesBucket.
+func splitHistoryKey(key string) (string, string, bool) {
+	index := strings.IndexFunc(key, func(r rune) bool { return r >= 'A' && r <= 'Z' })
+	if index <= 0 {
+		return "", "", false
+	}
+	coin, fiat := key[:index], key[index:]
+	if geckoCoin[coin] == "" || strings.ToUpper(fiat) != fiat {
+		return "", "", false
+	}
+	return coin, fiat, true
+}
+
+// parseHistoryFile parses and validates a history file.
+func (updater *RateUpdater) parseHistoryFile(r io.Reader, format, coin, fiat string) ([]historyFilePair, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	var pairs []historyFilePair
+	switch format {
+	case HistoryFormatCSV:
+		prices, err := parseHistoryCSV(data)
+		if err != nil {
+			return nil, err
+		}
+		pairs = []historyFilePair{{Coin: coin, Fiat: fiat, Prices: prices}}
+	case HistoryFormatJSON:
+		var file struct {
+			historyFile
+			Prices [][2]float64 `json:"prices"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, errp.Newf("invalid JSON: %v", err)
+		}
+		switch {
+		case file.Version != 0:
+			if file.Version > historyFileVersion {
+				return nil, errp.Newf("unsupported file version %d", file.Version)
+			}
+			pairs = file.Rates
+		case file.Prices != nil:
+			pairs = []historyFilePair{{Coin: coin, Fiat: fiat, Prices: file.Prices}}
+		default:
+			return nil, errp.New("no prices found")
+		}
+	default:
+		return nil, errp.Newf("unknown format %q", format)
+	}
+	for _, pair := range pairs {
+		if err := updater.validateHistoryPair(pair); err != nil {
+			return nil, err
+		}
+	}
+	return pairs, nil
+}
+
+// validateHistoryPair checks that the pair is supported and the rates are plausible.
+func (updater *RateUpdater) validateHistoryPair(pair historyFilePair) error {
+	if geckoCoin[pair.Coin] == "" {
+		return errp.Newf("unsupported coin %q", pair.Coin)
+	}
+	if !updater.IsSupportedQuote(pair.Fiat) {
+		return errp.Newf("unsupported fiat %q", pair.Fiat)
+	}
+	if len(pair.Prices) == 0 {
+		return errp.Newf("no prices for %s/%s", pair.Coin, pair.Fiat)
+	}
+	latest := time.Now().Add(time.Hour)
+	seen := make(map[int64]bool, len(pair.Prices))
+	for _, price := range pair.Prices {
+		timestamp := time.UnixMilli(int64(price[0]))
+		if timestamp.Before(earliestHistoryTime) || timestamp.After(latest) {
+			return errp.Newf("%s/%s: implausible time %s", pair.Coin, pair.Fiat, timestamp.UTC())
+		}
+		if math.IsNaN(price[1]) || math.IsInf(price[1], 0) || price[1] <= 0 {
+			return errp.Newf("%s/%s: invalid price %v at %s", pair.Coin, pair.Fiat, price[1], timestamp.UTC())
+		}
+		if seen[timestamp.Unix()] {
+			return errp.Newf("%s/%s: duplicate time %s", pair.Coin, pair.Fiat, timestamp.UTC())
+		}
+		seen[timestamp.Unix()] = true
+	}
+	return nil
+}
+
+// parseHistoryCSV parses a CSV file in the HistoryFormatCSV format. The returned prices are in
+// the same format as the CoinGecko market chart prices.
+func parseHistoryCSV(data []byte) ([][2]float64, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errp.Newf("invalid CSV: %v", err)
+	}
+	prices := [][2]float64{}
+	for i, record := range records {
+		if len(record) < 2 {
+			return nil, errp.Newf("line %d: expected time and price", i+1)
+		}
+		timestamp, timeErr := parseHistoryTime(record[0])
+		price, priceErr := strconv.ParseFloat(record[1], 64)
+		if i == 0 && (timeErr != nil || priceErr != nil) {
+			// Header row.
+			continue
+		}
+		if timeErr != nil {
+			return nil, errp.Newf("line %d: %v", i+1, timeErr)
+		}
+		if priceErr != nil {
+			return nil, errp.Newf("line %d: invalid price %q", i+1, record[1])
+		}
+		prices = append(prices, [2]float64{float64(timestamp.UnixMilli()), price})
+	}
+	return prices, nil
+}
+
+// parseHistoryTime parses the time column of a CSV history file.
+func parseHistoryTime(value string) (time.Time, error) {
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// Unix timestamps in seconds have at most 10 digits until the year 2286.
+		if number > 1e10 {
+			return time.UnixMilli(number), nil
+		}
+		return time.Unix(number, 0), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
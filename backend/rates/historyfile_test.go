@@ -0,0 +1,161 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rates
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHistoryCSV(t *testing.T) {
+	prices, err := parseHistoryCSV([]byte(`time,price
+1598832000,1.5
+1598918400000, 2
+2020-09-02T00:00:00Z,3
+2020-09-03 00:00:00,4
+2020-09-04,5
+`))
+	require.NoError(t, err)
+	require.Equal(t, [][2]float64{
+		{1598832000000, 1.5},
+		{1598918400000, 2},
+		{1599004800000, 3},
+		{1599091200000, 4},
+		{1599177600000, 5},
+	}, prices)
+
+	_, err = parseHistoryCSV([]byte("1598832000,1\nyesterday,2\n"))
+	require.Error(t, err)
+	_, err = parseHistoryCSV([]byte("1598832000,1\n1598918400,a lot\n"))
+	require.Error(t, err)
+	_, err = parseHistoryCSV([]byte("1598832000\n"))
+	require.Error(t, err)
+}
+
+func TestImportHistoryInvalid(t *testing.T) {
+	updater := NewRateUpdater(nil, "/dev/null")
+	defer updater.Stop()
+	tests := []struct {
+		format, coin, fiat, data string
+	}{
+		{"xml", "btc", "USD", "<prices/>"},
+		{HistoryFormatCSV, "doge", "USD", "1598832000,1"},
+		{HistoryFormatCSV, "btc", "XYZ", "1598832000,1"},
+		{HistoryFormatCSV, "btc", "USD", ""},
+		{HistoryFormatCSV, "btc", "USD", "1598832000,-1"},
+		{HistoryFormatCSV, "btc", "USD", "1598832000,0"},
+		{HistoryFormatCSV, "btc", "USD", "1598832000,NaN"},
+		{HistoryFormatCSV, "btc", "USD", "1598832000,1\n1598832000,2"},
+		{HistoryFormatCSV, "btc", "USD", "2001-01-01,1"},
+		{HistoryFormatCSV, "btc", "USD", "2200-01-01,1"},
+		{HistoryFormatJSON, "btc", "USD", `{"prices": [[1598832000000, 1]`},
+		{HistoryFormatJSON, "btc", "USD", `{}`},
+		{HistoryFormatJSON, "btc", "USD", `{"version": 2, "rates": []}`},
+		{HistoryFormatJSON, "btc", "USD",
+			`{"version": 1, "rates": [{"coin": "btc", "fiat": "USD", "prices": [[1598832000000, -1]]}]}`},
+	}
+	for _, test := range tests {
+		_, err := updater.ImportHistory(strings.NewReader(test.data), test.format, test.coin, test.fiat, false)
+		require.Error(t, err, test.data)
+	}
+	require.Empty(t, updater.history)
+}
+
+func TestImportExportHistory(t *testing.T) {
+	dbdir := test.TstTempDir("TestImportExportHistory")
+	defer os.RemoveAll(dbdir)
+	day1 := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	day3 := day1.AddDate(0, 0, 2)
+
+	updater := NewRateUpdater(nil, dbdir)
+	require.NoError(t, updater.dumpHistoryBucket("btcUSD", []exchangeRate{{value: 10, timestamp: day1}}))
+
+	results, err := updater.ImportHistory(
+		strings.NewReader("2020-09-01,1\n2020-09-02,2\n2020-09-03,3\n"), HistoryFormatCSV, "btc", "USD", false)
+	require.NoError(t, err)
+	require.Equal(t, []HistoryImportResult{{Coin: "btc", Fiat: "USD", Imported: 2, Skipped: 1}}, results)
+	// The existing rate is kept.
+	require.Equal(t, 10., updater.HistoricalPriceAt("btc", "USD", day1))
+	require.Equal(t, 2., updater.HistoricalPriceAt("btc", "USD", day2))
+	require.Equal(t, 2.5, updater.HistoricalPriceAt("btc", "USD", day2.Add(12*time.Hour)))
+	require.Equal(t, 3., updater.HistoricalPriceAt("btc", "USD", day3))
+
+	results, err = updater.ImportHistory(
+		strings.NewReader(`{"prices": [[1599004800000, 20], [1598918400000, 100]]}`),
+		HistoryFormatJSON, "btc", "USD", true)
+	require.NoError(t, err)
+	require.Equal(t, []HistoryImportResult{{Coin: "btc", Fiat: "USD", Imported: 2}}, results)
+	require.Equal(t, 100., updater.HistoricalPriceAt("btc", "USD", day1))
+	require.Equal(t, 20., updater.HistoricalPriceAt("btc", "USD", day2))
+	require.Len(t, updater.history["btcUSD"], 3)
+
+	// Rates which would leave a gap to the existing rates are rejected, as the gap would never be
+	// filled.
+	_, err = updater.ImportHistory(
+		strings.NewReader("2020-09-05,5\n2020-09-06,6\n"), HistoryFormatCSV, "btc", "USD", false)
+	require.Error(t, err)
+	_, err = updater.ImportHistory(
+		strings.NewReader("2020-08-29,5\n2020-08-30,6\n"), HistoryFormatCSV, "btc", "USD", false)
+	require.Error(t, err)
+	require.Len(t, updater.history["btcUSD"], 3)
+	results, err = updater.ImportHistory(
+		strings.NewReader("2020-08-30,5\n2020-08-31,6\n"), HistoryFormatCSV, "btc", "USD", false)
+	require.NoError(t, err)
+	require.Equal(t, []HistoryImportResult{{Coin: "btc", Fiat: "USD", Imported: 2}}, results)
+
+	_, err = updater.ImportHistory(
+		strings.NewReader("1598918400,1000\n"), HistoryFormatCSV, "eth", "CHF", false)
+	require.NoError(t, err)
+
+	var exported bytes.Buffer
+	require.NoError(t, updater.ExportHistory(&exported))
+	updater.Stop()
+
+	// Import the export into an empty cache.
+	dbdir2 := test.TstTempDir("TestImportExportHistory2")
+	defer os.RemoveAll(dbdir2)
+	updater2 := NewRateUpdater(nil, dbdir2)
+	defer updater2.Stop()
+	results, err = updater2.ImportHistory(&exported, HistoryFormatJSON, "", "", false)
+	require.NoError(t, err)
+	require.Equal(t, []HistoryImportResult{
+		{Coin: "btc", Fiat: "USD", Imported: 5},
+		{Coin: "eth", Fiat: "CHF", Imported: 1},
+	}, results)
+	require.Equal(t, 100., updater2.HistoricalPriceAt("btc", "USD", day1))
+	require.Equal(t, 3., updater2.HistoricalPriceAt("btc", "USD", day3))
+	require.Equal(t, 1000., updater2.HistoricalPriceAt("eth", "CHF", day1))
+	rates, err := updater2.loadHistoryBucket("btcUSD")
+	require.NoError(t, err)
+	require.Len(t, rates, 5)
+}
+
+func TestSplitHistoryKey(t *testing.T) {
+	coin, fiat, ok := splitHistoryKey("eth-erc20-usdtEUR")
+	require.True(t, ok)
+	require.Equal(t, "eth-erc20-usdt", coin)
+	require.Equal(t, "EUR", fiat)
+	_, _, ok = splitHistoryKey("USD")
+	require.False(t, ok)
+	_, _, ok = splitHistoryKey("dogeUSD")
+	require.False(t, ok)
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/ratelimit"
+)
+
+// jsonProvider provides exchange rates from a self-hosted endpoint serving:
+//
+//   - GET <url>/latest: the latest rates keyed by coin unit and fiat, e.g. {"BTC": {"USD": 30000}}.
+//   - GET <url>/history?coin=btc&fiat=USD&from=<unix>&to=<unix>: the historical rates in the
+//     CoinGecko "market_chart/range" format, e.g. {"prices": [[<unix milliseconds>, 30000]]}.
+type jsonProvider struct {
+	url        string
+	httpClient *http.Client
+	limiter    *ratelimit.LimitedCall
+}
+
+func newJSONProvider(url string, httpClient *http.Client) *jsonProvider {
+	url = strings.TrimRight(url, "/")
+	return &jsonProvider{
+		url:        url,
+		httpClient: httpClient,
+		limiter:    ratelimit.NewLimitedCall(apiRateLimit(url)),
+	}
+}
+
+// Name implements Provider.
+func (provider *jsonProvider) Name() string {
+	return ProviderJSON
+}
+
+func (provider *jsonProvider) get(ctx context.Context, endpoint string, result interface{}) error {
+	return provider.limiter.Call(ctx, endpoint, func() error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		res, err := provider.httpClient.Do(req)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		defer res.Body.Close() //nolint:errcheck
+		if res.StatusCode != http.StatusOK {
+			return errp.Newf("%s: bad response code %d", endpoint, res.StatusCode)
+		}
+		return errp.WithStack(json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(result))
+	})
+}
+
+// LatestRates implements Provider.
+func (provider *jsonProvider) LatestRates(ctx context.Context, _ []string) (map[string]map[string]float64, error) {
+	var rates map[string]map[string]float64
+	if err := provider.get(ctx, provider.url+"/latest", &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// HistoricalRates implements Provider.
+func (provider *jsonProvider) HistoricalRates(ctx context.Context, coin, fiat string, start, end time.Time) ([]HistoricalRate, error) {
+	params := url.Values{
+		"coin": {coin},
+		"fiat": {fiat},
+		"from": {strconv.FormatInt(start.Unix(), 10)},
+		"to":   {strconv.FormatInt(end.Unix(), 10)},
+	}
+	var jsonBody struct{ Prices [][2]float64 }
+	if err := provider.get(ctx, fmt.Sprintf("%s/history?%s", provider.url, params.Encode()), &jsonBody); err != nil {
+		return nil, err
+	}
+	return pricesToHistoricalRates(jsonBody.Prices), nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/ratelimit"
+)
+
+// krakenAPI is the public Kraken REST API. See https://docs.kraken.com/rest/.
+const krakenAPI = "https://api.kraken.com/0/public"
+
+var (
+	// krakenAsset maps BitBoxApp coin units to Kraken asset codes.
+	krakenAsset = map[string]string{
+		"BTC":  "XBT",
+		"LTC":  "LTC",
+		"ETH":  "ETH",
+		"DAI":  "DAI",
+		"LINK": "LINK",
+		"USDC": "USDC",
+		"USDT": "USDT",
+	}
+
+	// krakenCoinUnit maps the coin codes of historical rates to BitBoxApp coin units.
+	krakenCoinUnit = map[string]string{
+		"btc":                 "BTC",
+		"tbtc":                "BTC",
+		"rbtc":                "BTC",
+		"ltc":                 "LTC",
+		"tltc":                "LTC",
+		"eth":                 "ETH",
+		"goeth":               "ETH",
+		"sepeth":              "ETH",
+		"eth-erc20-dai0x6b17": "DAI",
+		"eth-erc20-link":      "LINK",
+		"eth-erc20-usdc":      "USDC",
+		"eth-erc20-usdt":      "USDT",
+	}
+
+	// krakenLatestPairs are the coin units and fiats of the latest rates. Kraken fails the whole
+	// request if one of the pairs does not exist, so only well-known pairs are listed.
+	krakenLatestPairs = map[string][]string{
+		"BTC":  {"USD", "EUR", "GBP", "CHF", "CAD", "AUD", "JPY"},
+		"ETH":  {"USD", "EUR", "GBP", "CHF", "CAD", "AUD", "JPY"},
+		"LTC":  {"USD", "EUR"},
+		"DAI":  {"USD", "EUR"},
+		"LINK": {"USD", "EUR"},
+		"USDC": {"USD", "EUR"},
+		"USDT": {"USD", "EUR"},
+	}
+
+	// krakenFiats are the fiats of historical rates.
+	krakenFiats = map[string]bool{
+		"USD": true, "EUR": true, "GBP": true, "CHF": true, "CAD": true, "AUD": true, "JPY": true,
+	}
+)
+
+// kraken provides exchange rates using Kraken's Ticker and OHLC endpoints.
+type kraken struct {
+	url        string
+	httpClient *http.Client
+	limiter    *ratelimit.LimitedCall
+}
+
+func newKraken(url string, httpClient *http.Client) *kraken {
+	return &kraken{
+		url:        url,
+		httpClient: httpClient,
+		limiter:    ratelimit.NewLimitedCall(time.Second),
+	}
+}
+
+// Name implements Provider.
+func (k *kraken) Name() string {
+	return ProviderKraken
+}
+
+// krakenPairKeys returns the keys Kraken may use for the given pair in responses. Legacy assets
+// are prefixed with X and legacy fiats with Z, e.g. "XXBTZUSD" for the "XBTUSD" pair.
+func krakenPairKeys(asset, fiat string) []string {
+	return []string{asset + fiat, "X" + asset + "Z" + fiat, asset + "Z" + fiat}
+}
+
+// get calls the endpoint and decodes the result of the response.
+func (k *kraken) get(ctx context.Context, endpoint string, params url.Values, result interface{}) error {
+	return k.limiter.Call(ctx, "kraken "+endpoint, func() error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(
+			ctx, http.MethodGet, fmt.Sprintf("%s/%s?%s", k.url, endpoint, params.Encode()), nil)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		res, err := k.httpClient.Do(req)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		defer res.Body.Close() //nolint:errcheck
+		if res.StatusCode != http.StatusOK {
+			return errp.Newf("kraken %s: bad response code %d", endpoint, res.StatusCode)
+		}
+		var response struct {
+			Error  []string        `json:"error"`
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&response); err != nil {
+			return errp.WithStack(err)
+		}
+		if len(response.Error) != 0 {
+			return errp.Newf("kraken %s: %s", endpoint, strings.Join(response.Error, ", "))
+		}
+		return errp.WithStack(json.Unmarshal(response.Result, result))
+	})
+}
+
+// LatestRates implements Provider.
+func (k *kraken) LatestRates(ctx context.Context, _ []string) (map[string]map[string]float64, error) {
+	type unitFiat struct{ unit, fiat string }
+	keys := map[string]unitFiat{}
+	pairs := []string{}
+	for unit, fiats := range krakenLatestPairs {
+		for _, fiat := range fiats {
+			asset := krakenAsset[unit]
+			pairs = append(pairs, asset+fiat)
+			for _, key := range krakenPairKeys(asset, fiat) {
+				keys[key] = unitFiat{unit: unit, fiat: fiat}
+			}
+		}
+	}
+	var result map[string]struct {
+		// Last trade closed: [price, lot volume].
+		Close []string `json:"c"`
+	}
+	if err := k.get(ctx, "Ticker", url.Values{"pair": {strings.Join(pairs, ",")}}, &result); err != nil {
+		return nil, err
+	}
+	rates := map[string]map[string]float64{}
+	for key, ticker := range result {
+		pair, ok := keys[key]
+		if !ok || len(ticker.Close) == 0 {
+			continue
+		}
+		price, err := strconv.ParseFloat(ticker.Close[0], 64)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if rates[pair.unit] == nil {
+			rates[pair.unit] = map[string]float64{}
+		}
+		rates[pair.unit][pair.fiat] = price
+	}
+	return rates, nil
+}
+
+// HistoricalRates implements Provider. Kraken only returns the 720 most recent OHLC entries, so
+// hourly rates are available for the last 30 days and daily rates for almost two years. Older
+// ranges are not supported.
+func (k *kraken) HistoricalRates(ctx context.Context, coin, fiat string, start, end time.Time) ([]HistoricalRate, error) {
+	unit, ok := krakenCoinUnit[coin]
+	if !ok || !krakenFiats[fiat] {
+		return nil, errUnsupported
+	}
+	const entries = 720
+	var interval time.Duration
+	switch {
+	case time.Since(start) < (entries-1)*time.Hour:
+		interval = time.Hour
+	case time.Since(start) < (entries-1)*24*time.Hour:
+		interval = 24 * time.Hour
+	default:
+		return nil, errUnsupported
+	}
+	asset := krakenAsset[unit]
+	params := url.Values{
+		"pair":     {asset + fiat},
+		"interval": {strconv.Itoa(int(interval.Minutes()))},
+		"since":    {strconv.FormatInt(start.Unix(), 10)},
+	}
+	var result map[string]json.RawMessage
+	if err := k.get(ctx, "OHLC", params, &result); err != nil {
+		return nil, err
+	}
+	var ohlc [][]interface{}
+	for _, key := range krakenPairKeys(asset, fiat) {
+		if raw, ok := result[key]; ok {
+			if err := json.Unmarshal(raw, &ohlc); err != nil {
+				return nil, errp.WithStack(err)
+			}
+			break
+		}
+	}
+	rates := []HistoricalRate{}
+	for _, entry := range ohlc {
+		// [time, open, high, low, close, vwap, volume, count]
+		if len(entry) < 5 {
+			return nil, errp.New("kraken OHLC: invalid entry")
+		}
+		timestamp, ok := entry[0].(float64)
+		closeString, ok2 := entry[4].(string)
+		if !ok || !ok2 {
+			return nil, errp.New("kraken OHLC: invalid entry")
+		}
+		value, err := strconv.ParseFloat(closeString, 64)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		at := time.Unix(int64(timestamp), 0)
+		if at.Before(start) || at.After(end) {
+			continue
+		}
+		rates = append(rates, HistoricalRate{Value: value, Timestamp: at})
+	}
+	return rates, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rates
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const (
+	// ProviderCoinGecko is the name of the CoinGecko provider.
+	ProviderCoinGecko = "coingecko"
+	// ProviderKraken is the name of the Kraken provider.
+	ProviderKraken = "kraken"
+	// ProviderJSON is the name of the provider querying a self-hosted JSON endpoint.
+	ProviderJSON = "json"
+
+	// providerBackoff is how long a failing provider is tried only after all other providers.
+	providerBackoff = 5 * time.Minute
+)
+
+// errUnsupported is returned by providers which can't serve a request, e.g. an unsupported
+// coin/fiat pair or time range. It does not cause a backoff of the provider.
+var errUnsupported = errors.New("not supported by this provider")
+
+// HistoricalRate is an exchange rate at a point in time.
+type HistoricalRate struct {
+	Value     float64
+	Timestamp time.Time
+}
+
+// Provider is a source of exchange rates.
+type Provider interface {
+	// Name identifies the provider in logs.
+	Name() string
+	// LatestRates returns the most recent conversion rates to the given fiats, keyed by coin unit
+	// and fiat, e.g. rates["BTC"]["USD"]. Providers may leave out pairs they don't support.
+	LatestRates(ctx context.Context, fiats []string) (map[string]map[string]float64, error)
+	// HistoricalRates returns the conversion rates of the coin, e.g. "btc", to the fiat, e.g.
+	// "USD", in the given time range. An empty result means no data is available in the range.
+	HistoricalRates(ctx context.Context, coin, fiat string, start, end time.Time) ([]HistoricalRate, error)
+}
+
+// NewProvider creates the provider with the given name. The URL is required for ProviderJSON. For
+// the other providers, it overrides the default API URL if not empty.
+func NewProvider(name string, url string, httpClient *http.Client) (Provider, error) {
+	switch name {
+	case ProviderCoinGecko:
+		if url == "" {
+			url = shiftGeckoMirrorAPIV3
+		}
+		return newCoinGecko(url, httpClient), nil
+	case ProviderKraken:
+		if url == "" {
+			url = krakenAPI
+		}
+		return newKraken(url, httpClient), nil
+	case ProviderJSON:
+		if url == "" {
+			return nil, errp.New("the json rates provider requires a URL")
+		}
+		return newJSONProvider(url, httpClient), nil
+	default:
+		return nil, errp.Newf("unknown rates provider %q", name)
+	}
+}
+
+// SetProviders replaces the providers, in order of priority. It must be called before the
+// updater is started.
+func (updater *RateUpdater) SetProviders(providers ...Provider) {
+	updater.providers = providers
+}
+
+// withProviders calls f with each provider until it succeeds, in order of priority. Providers
+// which failed recently are tried last. The error of the last call is returned if all fail.
+func (updater *RateUpdater) withProviders(ctx context.Context, f func(Provider) error) error {
+	updater.backoffMu.Lock()
+	now := time.Now()
+	var healthy, failing []Provider
+	for _, provider := range updater.providers {
+		if now.Before(updater.backoff[provider]) {
+			failing = append(failing, provider)
+		} else {
+			healthy = append(healthy, provider)
+		}
+	}
+	updater.backoffMu.Unlock()
+
+	err := errp.New("no rates providers")
+	for _, provider := range append(healthy, failing...) {
+		err = f(provider)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, errUnsupported):
+			continue
+		}
+		updater.log.WithError(err).Warningf("rates provider %s failed", provider.Name())
+		updater.backoffMu.Lock()
+		updater.backoff[provider] = time.Now().Add(providerBackoff)
+		updater.backoffMu.Unlock()
+	}
+	return err
+}
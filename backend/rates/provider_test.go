@@ -0,0 +1,197 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rates
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockProvider struct {
+	name    string
+	latest  map[string]map[string]float64
+	err     error
+	calls   int
+	history []HistoricalRate
+}
+
+func (provider *mockProvider) Name() string {
+	return provider.name
+}
+
+func (provider *mockProvider) LatestRates(context.Context, []string) (map[string]map[string]float64, error) {
+	provider.calls++
+	return provider.latest, provider.err
+}
+
+func (provider *mockProvider) HistoricalRates(context.Context, string, string, time.Time, time.Time) ([]HistoricalRate, error) {
+	provider.calls++
+	return provider.history, provider.err
+}
+
+func TestProviderFallback(t *testing.T) {
+	updater := NewRateUpdater(nil, "/dev/null")
+	defer updater.Stop()
+
+	failing := &mockProvider{name: "failing", err: fmt.Errorf("rate limited")}
+	unsupported := &mockProvider{name: "unsupported", err: errUnsupported}
+	working := &mockProvider{
+		name:   "working",
+		latest: map[string]map[string]float64{"BTC": {"USD": 30000}},
+		history: []HistoricalRate{
+			{Value: 1, Timestamp: time.Unix(1598832062, 0)},
+		},
+	}
+	updater.SetProviders(failing, unsupported, working)
+
+	updater.updateLast(context.Background())
+	require.Equal(t, 30000., updater.last["BTC"]["USD"])
+	require.Equal(t, 30000., updater.last["TBTC"]["USD"])
+	require.Equal(t, 1, failing.calls)
+	require.Equal(t, 1, unsupported.calls)
+	require.Equal(t, 1, working.calls)
+
+	// The failing provider is tried last during its backoff.
+	n, err := updater.updateHistory(context.Background(), "btc", "USD",
+		fixedTimeRange(time.Unix(1598832000, 0), time.Unix(1598833000, 0)))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, 1, failing.calls)
+	require.Equal(t, 2, unsupported.calls)
+	require.Equal(t, 2, working.calls)
+
+	// All fail.
+	working.err = fmt.Errorf("down")
+	updater.updateLast(context.Background())
+	require.Nil(t, updater.last)
+	require.Equal(t, 2, failing.calls)
+
+	updater.SetProviders()
+	_, err = updater.fetchHistory(context.Background(), "btc", "USD",
+		fixedTimeRange(time.Unix(1598832000, 0), time.Unix(1598833000, 0)))
+	require.Error(t, err)
+}
+
+func TestNewProvider(t *testing.T) {
+	for _, name := range []string{ProviderCoinGecko, ProviderKraken} {
+		provider, err := NewProvider(name, "", http.DefaultClient)
+		require.NoError(t, err)
+		require.Equal(t, name, provider.Name())
+	}
+	_, err := NewProvider(ProviderJSON, "", http.DefaultClient)
+	require.Error(t, err)
+	provider, err := NewProvider(ProviderJSON, "http://localhost/rates", http.DefaultClient)
+	require.NoError(t, err)
+	require.Equal(t, ProviderJSON, provider.Name())
+	_, err = NewProvider("unknown", "", http.DefaultClient)
+	require.Error(t, err)
+}
+
+func TestKraken(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Ticker":
+			fmt.Fprintln(w, `{"error": [], "result": {
+				"XXBTZUSD": {"c": ["30000.1", "0.001"]},
+				"XETHZEUR": {"c": ["1800.5", "0.1"]},
+				"USDTZUSD": {"c": ["1.0001", "10"]},
+				"UNKNOWN": {"c": ["1", "1"]}
+			}}`)
+		case "/OHLC":
+			require.Equal(t, "XBTUSD", r.URL.Query().Get("pair"))
+			require.Equal(t, "60", r.URL.Query().Get("interval"))
+			fmt.Fprintf(w, `{"error": [], "result": {
+				"XXBTZUSD": [
+					[%d, "1", "1", "1", "100.5", "1", "1", 1],
+					[%d, "1", "1", "1", "101.5", "1", "1", 1],
+					[%d, "1", "1", "1", "102.5", "1", "1", 1]
+				],
+				"last": 0
+			}}`, now.Add(-3*time.Hour).Unix(), now.Add(-2*time.Hour).Unix(), now.Add(-time.Hour).Unix())
+		default:
+			fmt.Fprintln(w, `{"error": ["EQuery:Unknown asset pair"]}`)
+		}
+	}))
+	defer ts.Close()
+
+	k := newKraken(ts.URL, http.DefaultClient)
+	latest, err := k.LatestRates(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]float64{
+		"BTC":  {"USD": 30000.1},
+		"ETH":  {"EUR": 1800.5},
+		"USDT": {"USD": 1.0001},
+	}, latest)
+
+	history, err := k.HistoricalRates(context.Background(), "tbtc", "USD",
+		now.Add(-150*time.Minute), now)
+	require.NoError(t, err)
+	require.Equal(t, []HistoricalRate{
+		{Value: 101.5, Timestamp: now.Add(-2 * time.Hour)},
+		{Value: 102.5, Timestamp: now.Add(-time.Hour)},
+	}, history)
+
+	_, err = k.HistoricalRates(context.Background(), "btc", "USD",
+		now.Add(-3*365*24*time.Hour), now.Add(-2*365*24*time.Hour))
+	require.ErrorIs(t, err, errUnsupported)
+	_, err = k.HistoricalRates(context.Background(), "eth-erc20-bat", "USD", now.Add(-time.Hour), now)
+	require.ErrorIs(t, err, errUnsupported)
+	_, err = k.HistoricalRates(context.Background(), "btc", "BRL", now.Add(-time.Hour), now)
+	require.ErrorIs(t, err, errUnsupported)
+
+	_, err = newKraken(ts.URL+"/unknown", http.DefaultClient).LatestRates(context.Background(), nil)
+	require.Error(t, err)
+}
+
+func TestJSONProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rates/latest":
+			fmt.Fprintln(w, `{"BTC": {"USD": 30000, "CHF": 27000}}`)
+		case "/rates/history":
+			require.Equal(t, "btc", r.URL.Query().Get("coin"))
+			require.Equal(t, "CHF", r.URL.Query().Get("fiat"))
+			require.Equal(t, "1598918400", r.URL.Query().Get("from"))
+			require.Equal(t, "1598922000", r.URL.Query().Get("to"))
+			fmt.Fprintln(w, `{"prices": [[1598918700000, 10000.0], [1598922000000, 10001.0]]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	provider := newJSONProvider(ts.URL+"/rates/", http.DefaultClient)
+	latest, err := provider.LatestRates(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]float64{"BTC": {"USD": 30000, "CHF": 27000}}, latest)
+
+	history, err := provider.HistoricalRates(context.Background(), "btc", "CHF",
+		time.Unix(1598918400, 0), time.Unix(1598922000, 0))
+	require.NoError(t, err)
+	require.Equal(t, []HistoricalRate{
+		{Value: 10000, Timestamp: time.Unix(1598918700, 0)},
+		{Value: 10001, Timestamp: time.Unix(1598922000, 0)},
+	}, history)
+
+	_, err = newJSONProvider(ts.URL, http.DefaultClient).LatestRates(context.Background(), nil)
+	require.Error(t, err)
+}
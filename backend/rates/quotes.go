@@ -0,0 +1,254 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rates
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// quotesBucket is the historyDB bucket caching the quote currencies supported by the
+	// providers. It is lowercase so it can't be mistaken for a coin+fiat history bucket.
+	quotesBucket = "quotes"
+	// quotesUpdateInterval is how often the supported quote currencies are refreshed.
+	quotesUpdateInterval = 24 * time.Hour
+)
+
+var (
+	// defaultQuotes are the quote currencies used until the providers' supported currencies are
+	// known, e.g. when offline. The latest rates are always fetched for these.
+	defaultQuotes = []string{
+		USD.String(), EUR.String(), CHF.String(), GBP.String(), JPY.String(), KRW.String(),
+		CNY.String(), RUB.String(), CAD.String(), AUD.String(), ILS.String(), BTC.String(),
+		SGD.String(), HKD.String(), BRL.String(), NOK.String(), SEK.String(), PLN.String(),
+		CZK.String(),
+	}
+
+	// derivedQuotes are quote currencies which the providers don't offer directly. Their rates
+	// are derived from the USD rates using the value of the coin, keyed by quote and valued by
+	// the coin code, e.g. the BTC/USDT rate is the BTC/USD rate divided by the USDT/USD rate.
+	derivedQuotes = map[string]string{
+		"ETH":  "eth",
+		"USDT": "eth-erc20-usdt",
+		"USDC": "eth-erc20-usdc",
+		"DAI":  "eth-erc20-dai0x6b17",
+	}
+)
+
+// quoteLister is implemented by providers which can list the quote currencies they support.
+type quoteLister interface {
+	// SupportedQuotes returns the supported quote currencies as uppercase codes, e.g. "USD".
+	SupportedQuotes(ctx context.Context) ([]string, error)
+}
+
+// SupportedQuotes returns all currencies which can be used as a fiat, sorted alphabetically. The
+// list is fetched from the providers and cached. Until it is available, a default list of common
+// fiat currencies is returned. Crypto currencies such as BTC, ETH and stablecoins are included.
+func (updater *RateUpdater) SupportedQuotes() []string {
+	updater.quotesMu.RLock()
+	defer updater.quotesMu.RUnlock()
+	quotes := []string{}
+	for quote := range updater.nativeQuotesLocked() {
+		quotes = append(quotes, quote)
+	}
+	for quote := range derivedQuotes {
+		if !updater.isNativeQuoteLocked(quote) {
+			quotes = append(quotes, quote)
+		}
+	}
+	sort.Strings(quotes)
+	return quotes
+}
+
+// IsSupportedQuote returns true if the currency can be used as a fiat, e.g. "USD" or "USDT". See
+// SupportedQuotes.
+func (updater *RateUpdater) IsSupportedQuote(quote string) bool {
+	updater.quotesMu.RLock()
+	defer updater.quotesMu.RUnlock()
+	return updater.isNativeQuoteLocked(quote) || derivedQuotes[quote] != ""
+}
+
+// derivedQuoteCoin returns the coin code whose USD rate is used to derive the rates of the quote
+// currency, or an empty string if the providers support the quote directly.
+func (updater *RateUpdater) derivedQuoteCoin(quote string) string {
+	updater.quotesMu.RLock()
+	defer updater.quotesMu.RUnlock()
+	if updater.isNativeQuoteLocked(quote) {
+		return ""
+	}
+	return derivedQuotes[quote]
+}
+
+// nativeQuotesLocked returns the quote currencies the providers support directly.
+// The quotesMu must be held when calling this function.
+func (updater *RateUpdater) nativeQuotesLocked() map[string]bool {
+	if len(updater.quotes) > 0 {
+		return updater.quotes
+	}
+	quotes := make(map[string]bool, len(defaultQuotes))
+	for _, quote := range defaultQuotes {
+		quotes[quote] = true
+	}
+	return quotes
+}
+
+// isNativeQuoteLocked returns true if the providers support the quote currency directly.
+// The quotesMu must be held when calling this function.
+func (updater *RateUpdater) isNativeQuoteLocked(quote string) bool {
+	if len(updater.quotes) > 0 {
+		return updater.quotes[quote]
+	}
+	for _, defaultQuote := range defaultQuotes {
+		if defaultQuote == quote {
+			return true
+		}
+	}
+	return false
+}
+
+// latestQuotes returns the quote currencies for which the latest rates are fetched: the default
+// quotes, the quotes of the configured history and USD, needed for derived quotes.
+func (updater *RateUpdater) latestQuotes() []string {
+	updater.quotesMu.RLock()
+	defer updater.quotesMu.RUnlock()
+	seen := map[string]bool{}
+	var quotes []string
+	for _, quote := range append(append([]string{}, defaultQuotes...), updater.activeQuotes...) {
+		if seen[quote] || !updater.isNativeQuoteLocked(quote) {
+			continue
+		}
+		seen[quote] = true
+		quotes = append(quotes, quote)
+	}
+	return quotes
+}
+
+// setActiveQuotes sets the additional quote currencies for which the latest rates are fetched.
+func (updater *RateUpdater) setActiveQuotes(quotes []string) {
+	updater.quotesMu.Lock()
+	defer updater.quotesMu.Unlock()
+	updater.activeQuotes = append([]string{}, quotes...)
+}
+
+// addDerivedQuotes adds the rates of the active derived quote currencies to the latest rates,
+// using the USD rates of the coins.
+func (updater *RateUpdater) addDerivedQuotes(rates map[string]map[string]float64) {
+	updater.quotesMu.RLock()
+	activeQuotes := updater.activeQuotes
+	updater.quotesMu.RUnlock()
+	for _, quote := range activeQuotes {
+		coinCode := updater.derivedQuoteCoin(quote)
+		if coinCode == "" {
+			continue
+		}
+		quoteUSD := rates[geckoCoinToUnit[geckoCoin[coinCode]]][USD.String()]
+		if quoteUSD == 0 {
+			continue
+		}
+		for _, coinRates := range rates {
+			if coinUSD, ok := coinRates[USD.String()]; ok {
+				coinRates[quote] = coinUSD / quoteUSD
+			}
+		}
+	}
+}
+
+// loadQuotes loads the supported quote currencies cached in historyDB.
+func (updater *RateUpdater) loadQuotes() {
+	var quotes []string
+	err := updater.historyDB.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(quotesBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, _ []byte) error {
+			quotes = append(quotes, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		updater.log.Errorf("loadQuotes: %v", err)
+		return
+	}
+	updater.setQuotes(quotes)
+}
+
+// updateQuotes fetches the supported quote currencies from the first provider able to list them
+// and caches them in historyDB. It returns false if the quotes should be fetched again soon.
+func (updater *RateUpdater) updateQuotes(ctx context.Context) bool {
+	var quotes []string
+	err := updater.withProviders(ctx, func(provider Provider) error {
+		lister, ok := provider.(quoteLister)
+		if !ok {
+			return errUnsupported
+		}
+		var err error
+		quotes, err = lister.SupportedQuotes(ctx)
+		return err
+	})
+	if errors.Is(err, errUnsupported) {
+		return true // none of the providers can list them; stick to the defaults
+	}
+	if err != nil {
+		updater.log.WithError(err).Errorf("updateQuotes")
+		return false
+	}
+	updater.setQuotes(quotes)
+	err = updater.historyDB.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(quotesBucket)) != nil {
+			if err := tx.DeleteBucket([]byte(quotesBucket)); err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket([]byte(quotesBucket))
+		if err != nil {
+			return err
+		}
+		for _, quote := range quotes {
+			if quote == "" {
+				continue
+			}
+			if err := bucket.Put([]byte(strings.ToUpper(quote)), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Non-critical: the quotes are fetched again on the next start.
+		updater.log.Errorf("updateQuotes: caching failed: %v", err)
+	}
+	return true
+}
+
+// setQuotes replaces the quote currencies supported directly by the providers. An empty list
+// resets them to the defaults.
+func (updater *RateUpdater) setQuotes(quotes []string) {
+	set := make(map[string]bool, len(quotes))
+	for _, quote := range quotes {
+		if quote != "" {
+			set[strings.ToUpper(quote)] = true
+		}
+	}
+	updater.quotesMu.Lock()
+	defer updater.quotesMu.Unlock()
+	updater.quotes = set
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rates
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+type mockQuoteProvider struct {
+	mockProvider
+	quotes []string
+}
+
+func (provider *mockQuoteProvider) SupportedQuotes(context.Context) ([]string, error) {
+	return provider.quotes, provider.err
+}
+
+func TestSupportedQuotes(t *testing.T) {
+	dbdir := test.TstTempDir("TestSupportedQuotes")
+	updater := NewRateUpdater(nil, dbdir)
+
+	// Defaults until fetched.
+	require.True(t, updater.IsSupportedQuote("CHF"))
+	require.True(t, updater.IsSupportedQuote("USDT"))
+	require.True(t, updater.IsSupportedQuote("ETH"))
+	require.False(t, updater.IsSupportedQuote("MXN"))
+	require.Contains(t, updater.SupportedQuotes(), "BTC")
+	require.Equal(t, "eth", updater.derivedQuoteCoin("ETH"))
+
+	updater.SetProviders(&mockQuoteProvider{quotes: []string{"USD", "mxn", "INR", "ETH", ""}})
+	require.True(t, updater.updateQuotes(context.Background()))
+	require.Equal(t, []string{"DAI", "ETH", "INR", "MXN", "USD", "USDC", "USDT"}, updater.SupportedQuotes())
+	require.False(t, updater.IsSupportedQuote("CHF"))
+	require.Equal(t, "", updater.derivedQuoteCoin("ETH"))
+	require.Equal(t, "eth-erc20-usdt", updater.derivedQuoteCoin("USDT"))
+	updater.Stop()
+
+	// The quotes are cached.
+	updater = NewRateUpdater(nil, dbdir)
+	defer updater.Stop()
+	require.True(t, updater.IsSupportedQuote("INR"))
+	require.False(t, updater.IsSupportedQuote("CHF"))
+
+	// Providers which can't list the quotes keep the cached ones.
+	updater.SetProviders(&mockProvider{})
+	require.True(t, updater.updateQuotes(context.Background()))
+	require.True(t, updater.IsSupportedQuote("INR"))
+}
+
+func TestLatestDerivedQuotes(t *testing.T) {
+	updater := NewRateUpdater(nil, "/dev/null")
+	defer updater.Stop()
+	updater.ReconfigureHistory(nil, []string{"CHF", "USDT", "MXN", "BTC"})
+	require.Equal(t, defaultQuotes, updater.latestQuotes())
+
+	updater.setQuotes([]string{"USD", "CHF", "MXN", "BTC"})
+	require.Equal(t, []string{"USD", "CHF", "BTC", "MXN"}, updater.latestQuotes())
+
+	provider := &mockProvider{latest: map[string]map[string]float64{
+		"BTC":  {"USD": 30000, "MXN": 500000},
+		"USDT": {"USD": 0.5},
+	}}
+	updater.SetProviders(provider)
+	updater.updateLast(context.Background())
+	require.Equal(t, 60000., updater.last["BTC"]["USDT"])
+	require.Equal(t, 1., updater.last["USDT"]["USDT"])
+	require.Equal(t, 500000., updater.last["BTC"]["MXN"])
+}
+
+func TestDivideRates(t *testing.T) {
+	rates := []exchangeRate{
+		{value: 100, timestamp: time.Unix(100, 0)},
+		{value: 200, timestamp: time.Unix(200, 0)},
+		{value: 300, timestamp: time.Unix(300, 0)},
+		{value: 400, timestamp: time.Unix(400, 0)},
+	}
+	divisors := []exchangeRate{
+		{value: 1, timestamp: time.Unix(150, 0)},
+		{value: 2, timestamp: time.Unix(250, 0)},
+		{value: 4, timestamp: time.Unix(300, 0)},
+	}
+	require.Equal(t, []exchangeRate{
+		{value: 200. / 1.5, timestamp: time.Unix(200, 0)},
+		{value: 75, timestamp: time.Unix(300, 0)},
+	}, divideRates(rates, divisors))
+	require.Nil(t, divideRates(rates, nil))
+}
+
+func TestDerivedQuoteHistory(t *testing.T) {
+	updater := NewRateUpdater(nil, "/dev/null")
+	defer updater.Stop()
+	updater.SetProviders(&mockProvider{history: []HistoricalRate{
+		{Value: 2, Timestamp: time.Unix(1598832000, 0)},
+		{Value: 4, Timestamp: time.Unix(1598918400, 0)},
+	}})
+	rates, err := updater.fetchHistory(context.Background(), "btc", "USDC",
+		fixedTimeRange(time.Unix(1598832000, 0), time.Unix(1598918400, 0)))
+	require.NoError(t, err)
+	require.Equal(t, []exchangeRate{
+		{value: 1, timestamp: time.Unix(1598832000, 0)},
+		{value: 1, timestamp: time.Unix(1598918400, 0)},
+	}, rates)
+}
+
+func TestCoinGeckoSupportedQuotes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/simple/supported_vs_currencies", r.URL.Path)
+		_, _ = w.Write([]byte(`["btc","eth","usd","mxn","zar"]`))
+	}))
+	defer ts.Close()
+	quotes, err := newCoinGecko(ts.URL, http.DefaultClient).SupportedQuotes(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"BTC", "ETH", "USD", "MXN", "ZAR"}, quotes)
+}
@@ -17,11 +17,7 @@ package rates
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
-	"net/url"
 	"reflect"
 	"sort"
 	"sync"
@@ -31,15 +27,13 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
-	"github.com/digitalbitbox/bitbox-wallet-app/util/ratelimit"
 	"github.com/sirupsen/logrus"
 	"go.etcd.io/bbolt"
 )
 
 const (
-	// Latest rates are fetched for all these (coin, fiat) pairs.
-	simplePriceAllIDs        = "bitcoin,litecoin,ethereum,basic-attention-token,dai,chainlink,maker,usd-coin,tether,0x,wrapped-bitcoin,pax-gold"
-	simplePriceAllCurrencies = "usd,eur,chf,gbp,jpy,krw,cny,rub,cad,aud,ils,btc,sgd,hkd,brl,nok,sek,pln,czk"
+	// Latest rates are fetched from CoinGecko for all these coins.
+	simplePriceAllIDs = "bitcoin,litecoin,ethereum,basic-attention-token,dai,chainlink,maker,usd-coin,tether,0x,wrapped-bitcoin,pax-gold"
 	// RatesEventSubject is the Subject of the event generated by new rates fetching.
 	RatesEventSubject = "rates"
 )
@@ -59,7 +53,8 @@ func (f Fiat) String() string {
 	return string(f)
 }
 
-// supported Fiat.
+// Commonly used Fiat. Any currency returned by `RateUpdater.SupportedQuotes()` can be used as a
+// fiat as well.
 const (
 	AUD Fiat = "AUD"
 	BRL Fiat = "BRL"
@@ -108,11 +103,21 @@ type RateUpdater struct {
 	// For example, BTC/EUR pair's key is "btcEUR".
 	historyGo map[string]context.CancelFunc
 
-	// CoinGecko is where updater gets the historical conversion rates.
-	// See https://www.coingecko.com/en/api for details.
-	coingeckoURL string
-	// All requests to coingeckoURL are rate-limited using geckoLimiter.
-	geckoLimiter *ratelimit.LimitedCall
+	// providers are the sources of the conversion rates, in order of priority. If one fails, the
+	// next one is used.
+	providers []Provider
+	// backoff contains the time until which a provider is tried only after the others because it
+	// failed recently.
+	backoff   map[Provider]time.Time
+	backoffMu sync.Mutex
+
+	quotesMu sync.RWMutex // guards both quotes and activeQuotes
+	// quotes contains the quote currencies supported directly by the providers. If empty,
+	// defaultQuotes are used.
+	quotes map[string]bool
+	// activeQuotes are the quote currencies of the configured history. The latest rates are
+	// fetched for them in addition to defaultQuotes.
+	activeQuotes []string
 }
 
 // NewRateUpdater returns a new rates updater.
@@ -139,22 +144,27 @@ func NewRateUpdater(client *http.Client, dbdir string) *RateUpdater {
 		// An unopened DB will simply return bbolt.ErrDatabaseNotOpen on all operations.
 		db = &bbolt.DB{}
 	}
-	apiURL := shiftGeckoMirrorAPIV3
-	return &RateUpdater{
-		last:         make(map[string]map[string]float64),
-		history:      make(map[string][]exchangeRate),
-		historyGo:    make(map[string]context.CancelFunc),
-		historyDB:    db,
-		log:          log,
-		httpClient:   client,
-		coingeckoURL: apiURL,
-		geckoLimiter: ratelimit.NewLimitedCall(apiRateLimit(apiURL)),
+	updater := &RateUpdater{
+		last:       make(map[string]map[string]float64),
+		history:    make(map[string][]exchangeRate),
+		historyGo:  make(map[string]context.CancelFunc),
+		historyDB:  db,
+		log:        log,
+		httpClient: client,
+		providers:  []Provider{newCoinGecko(shiftGeckoMirrorAPIV3, client)},
+		backoff:    make(map[Provider]time.Time),
 	}
+	updater.loadQuotes()
+	return updater
 }
 
-// SetCoingeckoURL overrides the default URL the rates updater connects to. Useful for testing.
+// SetCoingeckoURL overrides the default URL the CoinGecko providers connect to. Useful for testing.
 func (updater *RateUpdater) SetCoingeckoURL(url string) {
-	updater.coingeckoURL = url
+	for _, provider := range updater.providers {
+		if gecko, ok := provider.(*coinGecko); ok {
+			gecko.setURL(url)
+		}
+	}
 }
 
 // LatestPrice returns the most recent conversion rates.
@@ -242,7 +252,11 @@ func (updater *RateUpdater) Stop() {
 // lastUpdateLoop periodically updates most recent exchange rates.
 // It never returns until the context is done.
 func (updater *RateUpdater) lastUpdateLoop(ctx context.Context) {
+	var quotesUpdated time.Time
 	for {
+		if time.Since(quotesUpdated) > quotesUpdateInterval && updater.updateQuotes(ctx) {
+			quotesUpdated = time.Now()
+		}
 		updater.updateLast(ctx)
 		select {
 		case <-ctx.Done():
@@ -254,68 +268,19 @@ func (updater *RateUpdater) lastUpdateLoop(ctx context.Context) {
 }
 
 func (updater *RateUpdater) updateLast(ctx context.Context) {
-	param := url.Values{
-		"ids":           {simplePriceAllIDs},
-		"vs_currencies": {simplePriceAllCurrencies},
-	}
-	endpoint := fmt.Sprintf("%s/simple/price?%s", updater.coingeckoURL, param.Encode())
-	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
-	if err != nil {
-		updater.log.WithError(err).Error("could not create request")
-		updater.last = nil
-		return
-	}
-
-	var geckoRates map[string]map[string]float64
-	callErr := updater.geckoLimiter.Call(ctx, "updateLast", func() error {
-		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-		defer cancel()
-		res, err := updater.httpClient.Do(req.WithContext(ctx))
-		if err != nil {
-			return errp.WithStack(err)
-		}
-		defer res.Body.Close() //nolint:errcheck
-		if res.StatusCode != http.StatusOK {
-			return errp.Newf("bad response code %d", res.StatusCode)
-		}
-		const max = 10240
-		responseBody, err := io.ReadAll(io.LimitReader(res.Body, max+1))
-		if err != nil {
-			return errp.WithStack(err)
-		}
-		if len(responseBody) > max {
-			return errp.Newf("rates response too long (> %d bytes)", max)
-		}
-		if err := json.Unmarshal(responseBody, &geckoRates); err != nil {
-			return errp.WithMessage(err,
-				fmt.Sprintf("could not parse rates response: %s", string(responseBody)))
-		}
-		return nil
+	var rates map[string]map[string]float64
+	quotes := updater.latestQuotes()
+	err := updater.withProviders(ctx, func(provider Provider) error {
+		var err error
+		rates, err = provider.LatestRates(ctx, quotes)
+		return err
 	})
-	if callErr != nil {
-		updater.log.WithError(callErr).Errorf("updateLast")
+	if err != nil {
+		updater.log.WithError(err).Errorf("updateLast")
 		updater.last = nil
 		return
 	}
-	// Convert the map with coingecko coin/fiat codes to a map of coin/fiat units.
-	rates := map[string]map[string]float64{}
-	for coin, val := range geckoRates {
-		coinUnit := geckoCoinToUnit[coin]
-		if coinUnit == "" {
-			updater.log.Errorf("unsupported CoinGecko coin: %s", coin)
-			continue
-		}
-		newVal := map[string]float64{}
-		for geckoFiat, rates := range val {
-			fiat, ok := fromGeckoFiat[geckoFiat]
-			if !ok {
-				updater.log.Errorf("unsupported fiat: %s", geckoFiat)
-				continue
-			}
-			newVal[fiat] = rates
-		}
-		rates[coinUnit] = newVal
-	}
+	updater.addDerivedQuotes(rates)
 
 	// Provide conversion rates for testnets as well, useful for testing.
 	for _, testnetUnit := range []string{"TBTC", "RBTC", "TLTC", "GOETH", "SEPETH"} {
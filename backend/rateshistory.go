@@ -0,0 +1,50 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// ExportRatesHistory exports the cached historical exchange rates to a file chosen by the user,
+// which can be imported on another machine, e.g. one without network access. The returned path
+// is empty if the user aborted.
+func (backend *Backend) ExportRatesHistory() (string, error) {
+	name := fmt.Sprintf("%s-rates-history.json", time.Now().Format("2006-01-02-at-15-04-05"))
+	downloadsDir, err := config.DownloadsDir()
+	if err != nil {
+		return "", err
+	}
+	path := backend.environment.GetSaveFilename(filepath.Join(downloadsDir, name))
+	if path == "" {
+		return "", nil
+	}
+	backend.log.Infof("Export rates history to %s.", path)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", errp.WithStack(err)
+	}
+	if err := backend.RatesUpdater().ExportHistory(file); err != nil {
+		_ = file.Close()
+		return "", err
+	}
+	return path, errp.WithStack(file.Close())
+}
@@ -157,6 +157,14 @@ func (configuration *Configuration) ExtendedPublicKey() *hdkeychain.ExtendedKey
 	return configuration.EthereumSimple.KeyInfo.ExtendedPublicKey
 }
 
+// RootFingerprint returns the root fingerprint of the keystore the configuration belongs to.
+func (configuration *Configuration) RootFingerprint() []byte {
+	if configuration.BitcoinSimple != nil {
+		return configuration.BitcoinSimple.KeyInfo.RootFingerprint
+	}
+	return configuration.EthereumSimple.KeyInfo.RootFingerprint
+}
+
 // AccountNumber returns the account number as present in the BIP44 keypath.
 // The configuration keypath must be a BIP44 keypath:
 // m/purpose'/coin'/account' for Bitcoin-based coins.
@@ -0,0 +1,181 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+)
+
+// SoftwareKeystore describes a password-encrypted software keystore stored by the app.
+type SoftwareKeystore struct {
+	RootFingerprint string `json:"rootFingerprint"`
+	Locked          bool   `json:"locked"`
+}
+
+func (backend *Backend) softwareKeystoresDirectory() string {
+	return filepath.Join(backend.arguments.MainDirectoryPath(), "software-keystores")
+}
+
+// loadSoftwareKeystores loads and registers the stored software keystores. They are locked until
+// they are unlocked with their password.
+// The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) loadSoftwareKeystores() {
+	entries, err := os.ReadDir(backend.softwareKeystoresDirectory())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			backend.log.WithError(err).Error("Could not read the software keystores")
+		}
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		keystore, err := software.LoadEncryptedKeystore(
+			filepath.Join(backend.softwareKeystoresDirectory(), entry.Name()),
+			software.DefaultIdleTimeout)
+		if err != nil {
+			backend.log.WithError(err).WithField("file", entry.Name()).
+				Error("Could not load software keystore")
+			continue
+		}
+		backend.addSoftwareKeystore(keystore)
+	}
+}
+
+// addSoftwareKeystore registers the software keystore.
+// The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) addSoftwareKeystore(keystore *software.EncryptedKeystore) {
+	keystore.SetOnLock(backend.notifySoftwareKeystoresChanged)
+	rootFingerprint := backend.addKeystore(keystore)
+	if rootFingerprint == nil {
+		return
+	}
+	backend.softwareKeystores[hex.EncodeToString(rootFingerprint)] = keystore
+	backend.notifySoftwareKeystoresChanged()
+}
+
+func (backend *Backend) notifySoftwareKeystoresChanged() {
+	backend.Notify(observable.Event{
+		Subject: "software-keystores",
+		Action:  action.Reload,
+	})
+}
+
+// SoftwareKeystores returns the stored software keystores, sorted by root fingerprint.
+func (backend *Backend) SoftwareKeystores() []SoftwareKeystore {
+	defer backend.accountsAndKeystoreLock.RLock()()
+	result := []SoftwareKeystore{}
+	for rootFingerprint, keystore := range backend.softwareKeystores {
+		result = append(result, SoftwareKeystore{
+			RootFingerprint: rootFingerprint,
+			Locked:          keystore.Locked(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].RootFingerprint < result[j].RootFingerprint
+	})
+	return result
+}
+
+// CreateSoftwareKeystore stores and registers a software keystore for the BIP39 mnemonic and the
+// optional BIP39 passphrase. The seed is encrypted with the password. If the mnemonic is empty, a
+// new 24 word mnemonic is generated. The mnemonic is returned so it can be backed up.
+func (backend *Backend) CreateSoftwareKeystore(mnemonic, passphrase, password string) (string, error) {
+	if mnemonic == "" {
+		var err error
+		mnemonic, err = software.NewMnemonic(24)
+		if err != nil {
+			return "", err
+		}
+	}
+	seed, err := software.MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return "", err
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return "", errp.WithStack(err)
+	}
+	rootFingerprint, err := software.NewKeystore(master).RootFingerprint()
+	if err != nil {
+		return "", err
+	}
+
+	defer backend.accountsAndKeystoreLock.Lock()()
+	if _, ok := backend.softwareKeystores[hex.EncodeToString(rootFingerprint)]; ok {
+		return "", errp.New("this software keystore already exists")
+	}
+	if err := os.MkdirAll(backend.softwareKeystoresDirectory(), 0700); err != nil {
+		return "", errp.WithStack(err)
+	}
+	keystore, err := software.CreateEncryptedKeystore(
+		filepath.Join(backend.softwareKeystoresDirectory(), hex.EncodeToString(rootFingerprint)+".json"),
+		mnemonic, passphrase, password, software.DefaultIdleTimeout)
+	if err != nil {
+		return "", err
+	}
+	backend.addSoftwareKeystore(keystore)
+	return mnemonic, nil
+}
+
+func (backend *Backend) softwareKeystore(rootFingerprint []byte) (*software.EncryptedKeystore, error) {
+	defer backend.accountsAndKeystoreLock.RLock()()
+	keystore, ok := backend.softwareKeystores[hex.EncodeToString(rootFingerprint)]
+	if !ok {
+		return nil, errp.Newf("unknown software keystore %x", rootFingerprint)
+	}
+	return keystore, nil
+}
+
+// UnlockSoftwareKeystore decrypts the seed of the software keystore so it can sign. It is locked
+// again automatically after being idle for `software.DefaultIdleTimeout`.
+func (backend *Backend) UnlockSoftwareKeystore(rootFingerprint []byte, password string) error {
+	keystore, err := backend.softwareKeystore(rootFingerprint)
+	if err != nil {
+		return err
+	}
+	if err := keystore.Unlock(password); err != nil {
+		return err
+	}
+	defer backend.accountsAndKeystoreLock.Lock()()
+	if backend.keystores.get(rootFingerprint) == nil {
+		// E.g. deregistered with `DeregisterKeystores()`.
+		backend.addKeystore(keystore)
+	}
+	backend.notifySoftwareKeystoresChanged()
+	return nil
+}
+
+// LockSoftwareKeystore removes the decrypted seed of the software keystore from memory.
+func (backend *Backend) LockSoftwareKeystore(rootFingerprint []byte) error {
+	keystore, err := backend.softwareKeystore(rootFingerprint)
+	if err != nil {
+		return err
+	}
+	keystore.Lock()
+	return nil
+}
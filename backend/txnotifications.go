@@ -0,0 +1,196 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsTypes "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/util"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+)
+
+// TxNotificationKind is the reason of a TxNotification. See the list of consts below.
+type TxNotificationKind string
+
+const (
+	// TxNotificationReceived is sent for a new incoming transaction.
+	TxNotificationReceived TxNotificationKind = "received"
+	// TxNotificationConfirmations is sent when an incoming transaction reaches one of the
+	// configured numbers of confirmations.
+	TxNotificationConfirmations TxNotificationKind = "confirmations"
+	// TxNotificationFailed is sent when a transaction failed, e.g. an ETH transaction which ran
+	// out of gas.
+	TxNotificationFailed TxNotificationKind = "failed"
+)
+
+// TxNotification is a notification about a single transaction. It is sent as the
+// "transactions/notification" event, in addition to the notification to the user.
+type TxNotification struct {
+	Kind        TxNotificationKind `json:"kind"`
+	AccountCode accountsTypes.Code `json:"accountCode"`
+	AccountName string             `json:"accountName"`
+	TxID        string             `json:"txID"`
+	InternalID  string             `json:"internalID"`
+	// Amount is the formatted amount in Unit.
+	Amount string `json:"amount"`
+	Unit   string `json:"unit"`
+	// FiatValue is the formatted value of the amount in Fiat at the latest rates. It is empty if
+	// the rates are not available.
+	FiatValue     string `json:"fiatValue"`
+	Fiat          string `json:"fiat"`
+	Confirmations int    `json:"confirmations"`
+	// Message describes the notification for the user.
+	Message string `json:"message"`
+}
+
+// confirmationMilestone returns the highest of the milestones which is reached with the given
+// number of confirmations, or 0 if none is reached.
+func confirmationMilestone(milestones []int, confirmations int) int {
+	result := 0
+	for _, milestone := range milestones {
+		if milestone <= confirmations && milestone > result {
+			result = milestone
+		}
+	}
+	return result
+}
+
+// notifyTxProgress notifies the user about new incoming transactions if per-transaction
+// notifications are enabled, about incoming transactions reaching a confirmation milestone and
+// about failed transactions. Each of these is notified only once, also across restarts. The
+// transactions present when the account is synced for the first time are not notified about.
+func (backend *Backend) notifyTxProgress(account accounts.Interface) {
+	txs, err := account.Transactions()
+	if err != nil {
+		backend.log.WithError(err).Error("could not get transactions for notifications")
+		return
+	}
+	settings := backend.Config().AppConfig().Backend.TxNotifications
+	muted := account.Config().Config.NotificationsMuted
+	var notifications []*TxNotification
+	err = backend.notifier.updateTxProgress(
+		account.Config().Config.Code,
+		func(progress map[string]*txProgress, known bool) {
+			for _, tx := range txs {
+				if tx.InternalID == "" {
+					continue
+				}
+				milestone := 0
+				if tx.Type == accounts.TxTypeReceive {
+					milestone = confirmationMilestone(settings.Confirmations, tx.NumConfirmations)
+				}
+				failed := tx.Status == accounts.TxStatusFailed
+				notified, ok := progress[tx.InternalID]
+				if !ok {
+					progress[tx.InternalID] = &txProgress{Confirmations: milestone, Failed: failed}
+					if known && !muted && settings.PerTransaction && tx.Type == accounts.TxTypeReceive {
+						notifications = append(notifications,
+							backend.newTxNotification(account, tx, TxNotificationReceived))
+					}
+					continue
+				}
+				if milestone > notified.Confirmations {
+					notified.Confirmations = milestone
+					if !muted {
+						notifications = append(notifications,
+							backend.newTxNotification(account, tx, TxNotificationConfirmations))
+					}
+				}
+				if failed && !notified.Failed {
+					notified.Failed = true
+					if !muted {
+						notifications = append(notifications,
+							backend.newTxNotification(account, tx, TxNotificationFailed))
+					}
+				}
+			}
+		})
+	if err != nil {
+		backend.log.WithError(err).Error("could not update the notified transactions")
+		return
+	}
+	for _, notification := range notifications {
+		backend.NotifyUser(notification.Message)
+		backend.Notify(observable.Event{
+			Subject: "transactions/notification",
+			Action:  action.Replace,
+			Object:  notification,
+		})
+	}
+}
+
+// newTxNotification assembles the notification of the given kind about the transaction.
+func (backend *Backend) newTxNotification(
+	account accounts.Interface, tx *accounts.TransactionData, kind TxNotificationKind) *TxNotification {
+	accountCoin := account.Coin()
+	appConfig := backend.Config().AppConfig().Backend
+	notification := &TxNotification{
+		Kind:          kind,
+		AccountCode:   account.Config().Config.Code,
+		AccountName:   account.Config().Config.Name,
+		TxID:          tx.TxID,
+		InternalID:    tx.InternalID,
+		Amount:        accountCoin.FormatAmount(tx.Amount, false),
+		Unit:          accountCoin.GetFormatUnit(false),
+		Fiat:          appConfig.MainFiat,
+		Confirmations: tx.NumConfirmations,
+	}
+	price, err := backend.RatesUpdater().LatestPriceForPair(accountCoin.Unit(false), appConfig.MainFiat)
+	if err == nil && price != 0 {
+		value := new(big.Rat).Mul(
+			new(big.Rat).SetFloat64(accountCoin.ToUnit(tx.Amount, false)),
+			new(big.Rat).SetFloat64(price),
+		)
+		notification.FiatValue = coin.FormatAsCurrency(
+			value, appConfig.MainFiat, util.FormatBtcAsSat(appConfig.BtcUnit))
+	}
+	amount := fmt.Sprintf("%s %s", notification.Amount, notification.Unit)
+	switch kind {
+	case TxNotificationReceived:
+		if notification.FiatValue != "" {
+			amount = fmt.Sprintf("%s (%s %s)", amount, notification.FiatValue, notification.Fiat)
+		}
+		notification.Message = fmt.Sprintf("Received %s in %s", amount, notification.AccountName)
+	case TxNotificationConfirmations:
+		notification.Message = fmt.Sprintf("Incoming %s in %s has %d confirmations",
+			amount, notification.AccountName, tx.NumConfirmations)
+	case TxNotificationFailed:
+		notification.Message = fmt.Sprintf("Transaction of %s in %s failed",
+			amount, notification.AccountName)
+	}
+	return notification
+}
+
+// validateTxNotifications checks that the confirmation milestones are positive and unique.
+func validateTxNotifications(confirmations []int) error {
+	sorted := append([]int{}, confirmations...)
+	sort.Ints(sorted)
+	for i, milestone := range sorted {
+		if milestone <= 0 {
+			return errp.Newf("invalid number of confirmations %d", milestone)
+		}
+		if i > 0 && sorted[i-1] == milestone {
+			return errp.Newf("duplicate number of confirmations %d", milestone)
+		}
+	}
+	return nil
+}
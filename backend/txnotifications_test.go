@@ -0,0 +1,125 @@
+// Copyright 2023 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	accountsMocks "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	coinMocks "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmationMilestone(t *testing.T) {
+	require.Equal(t, 0, confirmationMilestone(nil, 10))
+	require.Equal(t, 0, confirmationMilestone([]int{1, 6}, 0))
+	require.Equal(t, 1, confirmationMilestone([]int{6, 1}, 5))
+	require.Equal(t, 6, confirmationMilestone([]int{6, 1}, 100))
+
+	require.NoError(t, validateTxNotifications(nil))
+	require.NoError(t, validateTxNotifications([]int{6, 1, 3}))
+	require.Error(t, validateTxNotifications([]int{0}))
+	require.Error(t, validateTxNotifications([]int{6, 1, 6}))
+}
+
+func TestNotifyTxProgress(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	appConfig := b.Config().AppConfig()
+	appConfig.Backend.TxNotifications = config.TxNotifications{
+		PerTransaction: true,
+		Confirmations:  []int{1, 6},
+	}
+	require.NoError(t, b.SetAppConfig(appConfig))
+
+	mockCoin := &coinMocks.CoinMock{
+		UnitFunc:          func(isFee bool) string { return "BTC" },
+		GetFormatUnitFunc: func(isFee bool) string { return "BTC" },
+		ToUnitFunc: func(amount coin.Amount, isFee bool) float64 {
+			result, _ := new(big.Rat).SetFrac(amount.BigInt(), big.NewInt(1e8)).Float64()
+			return result
+		},
+		FormatAmountFunc: func(amount coin.Amount, isFee bool) string {
+			return new(big.Rat).SetFrac(amount.BigInt(), big.NewInt(1e8)).FloatString(8)
+		},
+	}
+	accountConfig := &config.Account{Code: "v0-test-btc-0", Name: "Bitcoin"}
+	txs := []*accounts.TransactionData{
+		{InternalID: "old", Type: accounts.TxTypeReceive, Amount: coin.NewAmountFromInt64(1e8), NumConfirmations: 10},
+	}
+	account := &accountsMocks.InterfaceMock{
+		CoinFunc: func() coin.Coin { return mockCoin },
+		ConfigFunc: func() *accounts.AccountConfig {
+			return &accounts.AccountConfig{Config: accountConfig}
+		},
+		TransactionsFunc: func() (accounts.OrderedTransactions, error) { return txs, nil },
+	}
+	var notifications []*TxNotification
+	b.Observe(func(event observable.Event) {
+		if event.Subject == "transactions/notification" {
+			notifications = append(notifications, event.Object.(*TxNotification))
+		}
+	})
+
+	// The transactions of the first sync are not notified.
+	b.notifyTxProgress(account)
+	require.Empty(t, notifications)
+
+	// A new incoming transaction.
+	txs = append(txs,
+		&accounts.TransactionData{InternalID: "new", TxID: "new", Type: accounts.TxTypeReceive, Amount: coin.NewAmountFromInt64(5e6)},
+		&accounts.TransactionData{InternalID: "send", TxID: "send", Type: accounts.TxTypeSend, Amount: coin.NewAmountFromInt64(1e6)},
+	)
+	b.notifyTxProgress(account)
+	require.Len(t, notifications, 1)
+	require.Equal(t, TxNotificationReceived, notifications[0].Kind)
+	require.Equal(t, "0.05000000", notifications[0].Amount)
+	require.Equal(t, "Received 0.05000000 BTC in Bitcoin", notifications[0].Message)
+
+	// Milestones are notified once.
+	txs[1].NumConfirmations = 2
+	txs[2].NumConfirmations = 2
+	b.notifyTxProgress(account)
+	b.notifyTxProgress(account)
+	require.Len(t, notifications, 2)
+	require.Equal(t, TxNotificationConfirmations, notifications[1].Kind)
+	require.Equal(t, "Incoming 0.05000000 BTC in Bitcoin has 2 confirmations", notifications[1].Message)
+	txs[1].NumConfirmations = 7
+	b.notifyTxProgress(account)
+	require.Len(t, notifications, 3)
+	require.Equal(t, 7, notifications[2].Confirmations)
+
+	// Failed transactions.
+	txs[2].Status = accounts.TxStatusFailed
+	b.notifyTxProgress(account)
+	b.notifyTxProgress(account)
+	require.Len(t, notifications, 4)
+	require.Equal(t, TxNotificationFailed, notifications[3].Kind)
+	require.Equal(t, "Transaction of 0.01000000 BTC in Bitcoin failed", notifications[3].Message)
+
+	// Muted accounts are not notified, and not later when unmuted either.
+	accountConfig.NotificationsMuted = true
+	txs = append(txs, &accounts.TransactionData{InternalID: "muted", Type: accounts.TxTypeReceive, Amount: coin.NewAmountFromInt64(1)})
+	b.notifyTxProgress(account)
+	accountConfig.NotificationsMuted = false
+	b.notifyTxProgress(account)
+	require.Len(t, notifications, 4)
+}
@@ -45,12 +45,17 @@ type UpdateFile struct {
 // checkForUpdate checks whether a newer version of this application has been released.
 // It returns the retrieved update file if a newer version has been released and nil otherwise.
 func (backend *Backend) checkForUpdate() (*UpdateFile, error) {
-	client, err := backend.socksProxy.GetHTTPClient()
+	socksProxy := backend.socksProxy.Isolated("update")
+	client, err := socksProxy.GetHTTPClient()
 	if err != nil {
 		return nil, errp.WithStack(err)
 	}
+	updateURL, err := socksProxy.SelectEndpoint(updateFileURL, backend.config.AppConfig().Backend.Proxy.OnionUpdateURL)
+	if err != nil {
+		return nil, err
+	}
 
-	response, err := client.Get(updateFileURL)
+	response, err := client.Get(updateURL)
 	if err != nil {
 		return nil, errp.WithStack(err)
 	}
@@ -41,6 +41,8 @@ const (
 
 // webdevEnvironment implements backend.Environment.
 type webdevEnvironment struct {
+	// simulator is the BitBox02 firmware simulator, nil if not enabled.
+	simulator *usb.Simulator
 }
 
 // NotifyUser implements backend.Environment.
@@ -66,8 +68,12 @@ func (webdevEnvironment) NotifyUser(text string) {
 }
 
 // DeviceInfos implements backend.Environment.
-func (webdevEnvironment) DeviceInfos() []usb.DeviceInfo {
-	return usb.DeviceInfos()
+func (env webdevEnvironment) DeviceInfos() []usb.DeviceInfo {
+	deviceInfos := usb.DeviceInfos()
+	if env.simulator != nil {
+		deviceInfos = append(deviceInfos, env.simulator.DeviceInfos()...)
+	}
+	return deviceInfos
 }
 
 // SystemOpen implements backend.Environment.
@@ -118,6 +124,12 @@ func main() {
 	devservers := flag.Bool("devservers", true, "switch to dev servers")
 	gapLimitsReceive := flag.Uint("gapLimitReceive", 0, "gap limit for receive addresses")
 	gapLimitsChange := flag.Uint("gapLimitChange", 0, "gap limit for change addresses")
+	simulator := flag.Bool("simulator", false,
+		"connect to the BitBox02 firmware simulator. In testnet mode, pairing is confirmed automatically")
+	simulatorAddress := flag.String("simulatorAddress", usb.DefaultSimulatorAddress,
+		"address of the BitBox02 firmware simulator")
+	simulatorVersion := flag.String("simulatorVersion", "9.15.0",
+		"firmware version of the BitBox02 firmware simulator")
 	flag.Parse()
 
 	var gapLimits *btctypes.GapLimits
@@ -139,6 +151,11 @@ func main() {
 		}
 	}(log)
 	log.Info("--------------- Started application --------------")
+	environment := webdevEnvironment{}
+	if *simulator {
+		log.WithField("address", *simulatorAddress).Info("Using the BitBox02 simulator")
+		environment.simulator = usb.NewSimulator(*simulatorAddress, *simulatorVersion)
+	}
 	// since we are in dev-mode, we can drop the authorization token
 	connectionData := backendHandlers.NewConnectionData(-1, "")
 	backend, err := backend.NewBackend(
@@ -149,7 +166,7 @@ func main() {
 			*devservers,
 			gapLimits,
 		),
-		webdevEnvironment{})
+		environment)
 	if err != nil {
 		log.WithField("error", err).Panic(err)
 	}
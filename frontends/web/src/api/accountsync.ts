@@ -76,3 +76,19 @@ export const syncdone = (
     }
   });
 };
+
+/**
+ * Fired when previously confirmed transactions of an account were in a block
+ * that got orphaned by a chain reorg. They are pending again until they are
+ * confirmed in the new chain.
+ * Returns a method to unsubscribe.
+ */
+export const transactionsReorged = (
+  cb: (code: string) => void,
+): TUnsubscribe => {
+  return subscribeLegacy('transactionsReorged', event => {
+    if (event.type === 'account' && event.code) {
+      cb(event.code);
+    }
+  });
+};
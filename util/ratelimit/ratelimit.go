@@ -55,6 +55,16 @@ func NewRateLimitedHTTPTransport(
 	}
 }
 
+// WithLimiter creates a new HTTP client wrapping base, sharing the given limiter with other
+// clients. This is useful to rate limit requests made over different transports to the same API.
+// If base is nil, http.DefaultTransport is used.
+func WithLimiter(base http.RoundTripper, limiter *LimitedCall) *http.Client {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &http.Client{Transport: &RateLimitedHTTPTransport{base: base, callLimiter: limiter}}
+}
+
 // RoundTrip implements http.RoundTripper, rate limiting the requests.
 func (transport *RateLimitedHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	var callRes *http.Response
@@ -15,25 +15,49 @@
 package socksproxy
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/proxy"
 )
 
+// ErrClearnetRefused is returned when a connection would bypass the proxy while the user enabled
+// the Tor-only mode.
+var ErrClearnetRefused = errors.New("clearnet connections are disabled in Tor-only mode")
+
 // SocksProxy holds the proxy address and wether to use it.
 type SocksProxy struct {
 	useProxy         bool
 	proxyAddress     string
 	fullProxyAddress string
-	log              *logrus.Entry
+	// torOnly, if true, refuses all connections not going through the proxy.
+	torOnly bool
+	// isolationID, if not empty, is sent as the SOCKS5 username so that Tor, which isolates streams
+	// by their SOCKS credentials (IsolateSOCKSAuth), uses a dedicated circuit for this proxy.
+	isolationID string
+	log         *logrus.Entry
 }
 
 const defaultProxyAddress = "127.0.0.1:9050"
 
+// isolationPassword is the SOCKS5 password of isolated streams. It is random per process so that
+// the circuits are not shared across app restarts.
+var isolationPassword = func() string {
+	password := make([]byte, 16)
+	if _, err := rand.Read(password); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(password)
+}()
+
 // NewSocksProxy returns a new socks proxy instance. If proxyAddress is the empty string, the default
 // address '127.0.0.1:9050' will be used.
 func NewSocksProxy(useProxy bool, proxyAddress string) SocksProxy {
@@ -49,6 +73,93 @@ func NewSocksProxy(useProxy bool, proxyAddress string) SocksProxy {
 	return proxy
 }
 
+// WithTorOnly returns a copy of the proxy which, if torOnly is true, refuses to make connections
+// that are not proxied.
+func (socksProxy SocksProxy) WithTorOnly(torOnly bool) SocksProxy {
+	socksProxy.torOnly = torOnly
+	return socksProxy
+}
+
+// Isolated returns a copy of the proxy whose connections use circuits separate from the ones of
+// other isolation IDs, e.g. one per account code, so that an observer at the exit node can't
+// correlate them.
+func (socksProxy SocksProxy) Isolated(id string) SocksProxy {
+	socksProxy.isolationID = id
+	return socksProxy
+}
+
+// UsesTor returns true if connections are proxied. The proxy is assumed to be Tor.
+func (socksProxy SocksProxy) UsesTor() bool {
+	return socksProxy.useProxy
+}
+
+// TorOnly returns true if connections not going through the proxy are refused.
+func (socksProxy SocksProxy) TorOnly() bool {
+	return socksProxy.torOnly
+}
+
+// CheckClearnet returns ErrClearnetRefused if the Tor-only mode is enabled but connections would
+// not be proxied.
+func (socksProxy SocksProxy) CheckClearnet() error {
+	if socksProxy.torOnly && !socksProxy.useProxy {
+		return ErrClearnetRefused
+	}
+	return nil
+}
+
+// SelectEndpoint returns the onion endpoint if connections are proxied and it is not empty, and
+// the clearnet endpoint otherwise. If connections are proxied, the clearnet endpoint is reached
+// through Tor. ErrClearnetRefused is returned if the clearnet endpoint would be used in Tor-only
+// mode without the proxy.
+func (socksProxy SocksProxy) SelectEndpoint(clearnet string, onion string) (string, error) {
+	if socksProxy.useProxy && onion != "" {
+		return onion, nil
+	}
+	if err := socksProxy.CheckClearnet(); err != nil {
+		return "", err
+	}
+	return clearnet, nil
+}
+
+// IsOnion returns true if the host of the address, which can be a URL or a host:port pair, is a Tor
+// onion service.
+func IsOnion(address string) bool {
+	host := address
+	if parsed, err := url.Parse(address); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.HasSuffix(strings.ToLower(host), ".onion")
+}
+
+// auth returns the SOCKS5 credentials used for stream isolation, or nil if the proxy is not
+// isolated.
+func (socksProxy *SocksProxy) auth() *proxy.Auth {
+	if socksProxy.isolationID == "" {
+		return nil
+	}
+	return &proxy.Auth{User: socksProxy.isolationID, Password: isolationPassword}
+}
+
+// refusingDialer is used in Tor-only mode when the proxy is disabled.
+type refusingDialer struct{}
+
+// Dial implements proxy.Dialer.
+func (refusingDialer) Dial(network, addr string) (net.Conn, error) {
+	return nil, ErrClearnetRefused
+}
+
+// refusingHTTPClient returns a client which fails all requests with ErrClearnetRefused.
+func refusingHTTPClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, ErrClearnetRefused
+		},
+	}}
+}
+
 // Validate validates the socks5 proxy endpoint.
 // We check if we could instantiate a proxied http client.
 // Currently, no actual connectivity checks as performed.
@@ -68,13 +179,16 @@ func (socksProxy SocksProxy) Validate() error {
 func (socksProxy *SocksProxy) GetTCPProxyDialer() proxy.Dialer {
 	if socksProxy.useProxy {
 		// Create a proxy that uses Tor's SocksPort.
-		dialer, err := proxy.SOCKS5("tcp", socksProxy.proxyAddress, nil, nil)
+		dialer, err := proxy.SOCKS5("tcp", socksProxy.proxyAddress, socksProxy.auth(), nil)
 		if err != nil {
 			// TODO: Remove this panic.
 			socksProxy.log.WithError(err).Panic("Failed to create SOCKS5 TCP dialer")
 		}
 		return dialer
 	}
+	if socksProxy.torOnly {
+		return refusingDialer{}
+	}
 	return &net.Dialer{}
 }
 
@@ -85,16 +199,18 @@ func (socksProxy *SocksProxy) GetHTTPClient() (*http.Client, error) {
 		tbProxyURL, err := url.Parse(socksProxy.fullProxyAddress)
 		if err != nil {
 			socksProxy.log.WithError(err).Error("Failed to parse proxy URL")
-			return &http.Client{}, err
+			return socksProxy.fallbackHTTPClient(), err
 		}
 		// Get a proxy Dialer that will create the connection on our
-		// behalf via the SOCKS5 proxy.  Specify the authentication
-		// and re-create the dialer/transport/client if tor's
-		// IsolateSOCKSAuth is needed.
+		// behalf via the SOCKS5 proxy. The authentication, if any, makes
+		// tor use a separate circuit (IsolateSOCKSAuth).
+		if auth := socksProxy.auth(); auth != nil {
+			tbProxyURL.User = url.UserPassword(auth.User, auth.Password)
+		}
 		tbDialer, err := proxy.FromURL(tbProxyURL, proxy.Direct)
 		if err != nil {
 			socksProxy.log.WithError(err).Error("Failed to obtain proxy dialer")
-			return &http.Client{}, err
+			return socksProxy.fallbackHTTPClient(), err
 		}
 
 		// Make a http.Transport that uses the proxy dialer, and a
@@ -103,5 +219,13 @@ func (socksProxy *SocksProxy) GetHTTPClient() (*http.Client, error) {
 		client := &http.Client{Transport: tbTransport}
 		return client, nil
 	}
-	return &http.Client{}, nil
+	return socksProxy.fallbackHTTPClient(), nil
+}
+
+// fallbackHTTPClient returns the client to use if requests can't be proxied.
+func (socksProxy *SocksProxy) fallbackHTTPClient() *http.Client {
+	if socksProxy.torOnly {
+		return refusingHTTPClient()
+	}
+	return &http.Client{}
 }
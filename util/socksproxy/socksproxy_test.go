@@ -28,3 +28,52 @@ func TestValidate(t *testing.T) {
 	require.Error(t, NewSocksProxy(true, "127.0.0.1:XXXX").Validate())
 	require.Error(t, NewSocksProxy(true, "127.0.0.1:9050 ").Validate())
 }
+
+func TestIsOnion(t *testing.T) {
+	require.True(t, IsOnion("abcdef.onion:50002"))
+	require.True(t, IsOnion("http://abcdef.onion/updates/desktop.json"))
+	require.True(t, IsOnion("ABCDEF.ONION"))
+	require.False(t, IsOnion("btc1.shiftcrypto.io:443"))
+	require.False(t, IsOnion("https://bitbox.swiss/updates/desktop.json"))
+	require.False(t, IsOnion("onion.example.com:443"))
+}
+
+func TestTorOnly(t *testing.T) {
+	direct := NewSocksProxy(false, "").WithTorOnly(true)
+	require.ErrorIs(t, direct.CheckClearnet(), ErrClearnetRefused)
+	_, err := direct.GetTCPProxyDialer().Dial("tcp", "127.0.0.1:1")
+	require.ErrorIs(t, err, ErrClearnetRefused)
+	client, err := direct.GetHTTPClient()
+	require.NoError(t, err)
+	_, err = client.Get("http://127.0.0.1:1")
+	require.ErrorIs(t, err, ErrClearnetRefused)
+	_, err = direct.SelectEndpoint("https://clearnet", "http://abc.onion")
+	require.ErrorIs(t, err, ErrClearnetRefused)
+
+	require.NoError(t, NewSocksProxy(false, "").CheckClearnet())
+	require.NoError(t, NewSocksProxy(true, "").WithTorOnly(true).CheckClearnet())
+}
+
+func TestSelectEndpoint(t *testing.T) {
+	endpoint, err := NewSocksProxy(true, "").SelectEndpoint("https://clearnet", "http://abc.onion")
+	require.NoError(t, err)
+	require.Equal(t, "http://abc.onion", endpoint)
+
+	endpoint, err = NewSocksProxy(true, "").WithTorOnly(true).SelectEndpoint("https://clearnet", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://clearnet", endpoint)
+
+	endpoint, err = NewSocksProxy(false, "").SelectEndpoint("https://clearnet", "http://abc.onion")
+	require.NoError(t, err)
+	require.Equal(t, "https://clearnet", endpoint)
+}
+
+func TestIsolated(t *testing.T) {
+	proxy := NewSocksProxy(true, "")
+	require.Nil(t, proxy.auth())
+	isolated := proxy.Isolated("btc-0-abc")
+	require.Equal(t, "btc-0-abc", isolated.auth().User)
+	require.NotEmpty(t, isolated.auth().Password)
+	// The original is not modified.
+	require.Nil(t, proxy.auth())
+}
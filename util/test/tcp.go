@@ -130,6 +130,11 @@ func (s *TCPServer) Dialer() proxy.Dialer {
 	}}
 }
 
+// Addr returns the address the started server listens on, in host:port format.
+func (s *TCPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
 // Close stops listening. Callers are responsible for closing any idle connections
 // passed on to accept function in StartTLS.
 func (s *TCPServer) Close() {